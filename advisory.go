@@ -0,0 +1,63 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"net/http"
+	"path"
+
+	wp "github.com/google/go-webdav/path"
+)
+
+// LockEnforcementHeader is set on OPTIONS responses to "enforced" or
+// "advisory", telling clients whether writes to the resource are refused
+// without the tokens of the locks on it.
+const LockEnforcementHeader = "X-Lock-Enforcement"
+
+// WithAdvisoryLocks makes locks advisory within the given collections, or
+// everywhere if none are given. LOCK is granted and refused as usual, and
+// locks are still reported by lockdiscovery, but writes within those
+// collections no longer need the tokens of the locks on them. This suits
+// deployments where locks left behind by clients, such as office suites,
+// do more harm than the lost updates they prevent.
+func WithAdvisoryLocks(prefixes ...string) Option {
+	return func(s *WebDAV) {
+		if len(prefixes) == 0 {
+			prefixes = []string{"/"}
+		}
+		for _, p := range prefixes {
+			s.advisory = append(s.advisory, path.Clean("/"+p))
+		}
+	}
+}
+
+// advisoryLocks determines if the locks on a path are advisory.
+func (s *WebDAV) advisoryLocks(p string) bool {
+	for _, a := range s.advisory {
+		if wp.InTree(p, a) {
+			return true
+		}
+	}
+	return false
+}
+
+// lockEnforcementHeader reports whether the locks on a path are enforced.
+func (s *WebDAV) lockEnforcementHeader(w http.ResponseWriter, p string) {
+	mode := "enforced"
+	if s.advisoryLocks(p) {
+		mode = "advisory"
+	}
+	w.Header().Set(LockEnforcementHeader, mode)
+}
@@ -0,0 +1,55 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+func TestAdvisoryLocks(t *testing.T) {
+	s := webdav.NewWebDAV(memfs.NewMemFS(), webdav.WithAdvisoryLocks("/shared"))
+	lockinfo := `<lockinfo xmlns="DAV:"><lockscope><exclusive/></lockscope><locktype><write/></locktype></lockinfo>`
+	for _, p := range []string{"/shared", "/private"} {
+		serve(s, "MKCOL", p, "")
+		serve(s, "PUT", p+"/a", "a")
+		if w := serve(s, "LOCK", p+"/a", lockinfo, "Depth", "0"); w.Code != http.StatusOK {
+			t.Fatalf("LOCK %s/a got %d", p, w.Code)
+		}
+	}
+
+	if w := serve(s, "PUT", "/shared/a", "b"); w.Code != http.StatusNoContent {
+		t.Errorf("PUT without the token of an advisory lock got %d", w.Code)
+	}
+	if w := serve(s, "PUT", "/private/a", "b"); w.Code != webdav.StatusLocked {
+		t.Errorf("PUT without the token of an enforced lock got %d", w.Code)
+	}
+	if w := serve(s, "DELETE", "/shared", ""); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE of a collection with advisory locks got %d", w.Code)
+	}
+	if w := serve(s, "LOCK", "/private/a", lockinfo, "Depth", "0"); w.Code != webdav.StatusLocked {
+		t.Errorf("conflicting LOCK got %d", w.Code)
+	}
+
+	for p, want := range map[string]string{"/shared": "advisory", "/private/a": "enforced"} {
+		w := serve(s, "OPTIONS", p, "")
+		if got := w.Header().Get(webdav.LockEnforcementHeader); got != want {
+			t.Errorf("OPTIONS %s got %s %q, want %q", p, webdav.LockEnforcementHeader, got, want)
+		}
+	}
+}
@@ -0,0 +1,411 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package archivefs implements a read-only webdav.FileSystem over a zip or tar
+archive, so that bundles of static content can be served without unpacking
+them.
+
+The archive is indexed when opened, and content is read from it on demand.
+Directories which are not recorded in the archive, but contain members of
+it, are served too. All methods modifying the FileSystem fail with
+webdav.ErrorForbidden, handlers serving it should use webdav.WithReadOnly.
+*/
+package archivefs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	w "github.com/google/go-webdav"
+)
+
+// FS is a read-only webdav.FileSystem serving an archive.
+type FS struct {
+	entries map[string]*entry
+	closer  io.Closer
+}
+
+var _ w.FileSystem = &FS{}
+
+// entry is a file or directory of the archive.
+type entry struct {
+	p        string
+	dir      bool
+	size     int64
+	modified time.Time
+	// open gets the content of a file.
+	open func() (io.ReadCloser, error)
+	// members are the names of the entries of a directory.
+	members []string
+}
+
+func newFS() *FS {
+	return &FS{entries: map[string]*entry{"/": {p: "/", dir: true}}}
+}
+
+// add adds an entry, and the directories containing it which are not yet
+// known. Entries which would be extracted outside of the archive's
+// directory, named with "..", are ignored.
+func (fs *FS) add(name string, e *entry) {
+	for _, seg := range strings.Split(name, "/") {
+		if seg == ".." {
+			return
+		}
+	}
+	e.p = path.Clean("/" + name)
+	if e.p == "/" {
+		return
+	}
+	if old, ok := fs.entries[e.p]; ok {
+		if old.dir && e.dir {
+			old.modified = e.modified
+			return
+		}
+		// Later entries replace earlier ones, as when extracting.
+		e.members = old.members
+		fs.entries[e.p] = e
+		return
+	}
+	fs.entries[e.p] = e
+	parent := path.Dir(e.p)
+	if _, ok := fs.entries[parent]; !ok {
+		fs.add(parent, &entry{dir: true, modified: e.modified})
+	}
+	pe := fs.entries[parent]
+	pe.members = append(pe.members, path.Base(e.p))
+}
+
+// NewZip creates a FileSystem serving a zip archive of the given size.
+func NewZip(r io.ReaderAt, size int64) (*FS, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	fs := newFS()
+	for _, f := range zr.File {
+		fs.add(f.Name, &entry{
+			dir:      f.FileInfo().IsDir(),
+			size:     int64(f.UncompressedSize64),
+			modified: f.Modified,
+			open:     f.Open,
+		})
+	}
+	fs.sort()
+	return fs, nil
+}
+
+// NewTar creates a FileSystem serving a tar archive of the given size,
+// which must not be compressed. Entries other than regular files and
+// directories, such as links, are not served.
+func NewTar(r io.ReaderAt, size int64) (*FS, error) {
+	cr := &countingReader{r: io.NewSectionReader(r, 0, size)}
+	tr := tar.NewReader(cr)
+	fs := newFS()
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch h.Typeflag {
+		case tar.TypeDir:
+			fs.add(h.Name, &entry{dir: true, modified: h.ModTime})
+		case tar.TypeReg:
+			// The content follows the header, which has been read.
+			off, n := cr.n, h.Size
+			fs.add(h.Name, &entry{
+				size:     n,
+				modified: h.ModTime,
+				open: func() (io.ReadCloser, error) {
+					return section{io.NewSectionReader(r, off, n)}, nil
+				},
+			})
+		}
+	}
+	fs.sort()
+	return fs, nil
+}
+
+// Open opens an archive file, a zip archive if its name ends in .zip and a
+// tar archive otherwise.
+func Open(name string) (*FS, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	var fs *FS
+	if strings.EqualFold(path.Ext(name), ".zip") {
+		fs, err = NewZip(f, fi.Size())
+	} else {
+		fs, err = NewTar(f, fi.Size())
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	fs.closer = f
+	return fs, nil
+}
+
+// Close closes the archive file of a FileSystem created by Open.
+func (fs *FS) Close() error {
+	if fs.closer == nil {
+		return nil
+	}
+	return fs.closer.Close()
+}
+
+// sort orders the members of directories by name.
+func (fs *FS) sort() {
+	for _, e := range fs.entries {
+		sort.Strings(e.members)
+	}
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// ForPath implements webdav.FileSystem.
+func (fs *FS) ForPath(p string) (w.Path, error) {
+	return &apath{fs: fs, p: path.Clean("/" + p)}, nil
+}
+
+// Dump implements webdav.FileSystem.
+func (fs *FS) Dump(out io.Writer, format w.DumpFormat) error {
+	var entries []w.DumpEntry
+	for _, e := range fs.entries {
+		entries = append(entries, w.DumpEntry{
+			Path:     e.p,
+			Dir:      e.dir,
+			Size:     e.size,
+			Modified: e.modified,
+		})
+	}
+	return w.WriteDump(out, format, entries)
+}
+
+type apath struct {
+	fs *FS
+	p  string
+}
+
+func (p *apath) String() string {
+	return p.p
+}
+
+func (p *apath) Parent() w.Path {
+	return &apath{fs: p.fs, p: path.Dir(p.p)}
+}
+
+func (p *apath) Lookup() (w.File, error) {
+	e, ok := p.fs.entries[p.p]
+	if !ok {
+		return nil, w.ErrorNotFound
+	}
+	return &afile{e}, nil
+}
+
+func (p *apath) LookupSubtree(depth int) ([]w.File, error) {
+	e, ok := p.fs.entries[p.p]
+	if !ok {
+		return nil, w.ErrorNotFound
+	}
+	return p.fs.subtree(e, depth), nil
+}
+
+func (fs *FS) subtree(e *entry, depth int) []w.File {
+	files := []w.File{&afile{e}}
+	if depth == 0 {
+		return files
+	}
+	for _, m := range e.members {
+		files = append(files, fs.subtree(fs.entries[path.Join(e.p, m)], depth-1)...)
+	}
+	return files
+}
+
+func (p *apath) Mkdir() (w.File, error) {
+	return nil, w.ErrorForbidden
+}
+
+func (p *apath) Create() (w.File, w.FileHandle, error) {
+	return nil, nil, w.ErrorForbidden
+}
+
+func (p *apath) CopyTo(dst w.Path, opt w.CopyOptions) (bool, error) {
+	return false, w.ErrorForbidden
+}
+
+func (p *apath) Remove() error {
+	return w.ErrorForbidden
+}
+
+func (p *apath) RecursiveRemove() map[string]error {
+	return map[string]error{p.p: w.ErrorForbidden}
+}
+
+type afile struct {
+	e *entry
+}
+
+func (f *afile) GetPath() string {
+	return f.e.p
+}
+
+func (f *afile) IsDirectory() bool {
+	return f.e.dir
+}
+
+// Stat implements webdav.File. Archives do not record creation times, so
+// the modification time is reported instead.
+func (f *afile) Stat() (w.FileInfo, error) {
+	return w.FileInfo{
+		Size:         f.e.size,
+		Created:      f.e.modified,
+		LastModified: f.e.modified,
+	}, nil
+}
+
+func (f *afile) Open() (w.FileHandle, error) {
+	if f.e.dir {
+		return &handle{}, nil
+	}
+	h := &handle{e: f.e}
+	if err := h.reopen(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (f *afile) Truncate() (w.FileHandle, error) {
+	return nil, w.ErrorForbidden
+}
+
+func (f *afile) PatchProp(set, remove map[string]string) error {
+	return w.ErrorForbidden
+}
+
+func (f *afile) GetProp(k string) (string, bool) {
+	return "", false
+}
+
+var errReadOnly = errors.New("archivefs: archives are read-only")
+
+// handle reads the content of an entry. As compressed content can only be
+// read in order, seeking backwards reopens it, and seeking forwards skips
+// over it.
+type handle struct {
+	e   *entry
+	rc  io.ReadCloser
+	pos int64
+}
+
+func (h *handle) reopen() error {
+	if h.rc != nil {
+		h.rc.Close()
+	}
+	rc, err := h.e.open()
+	if err != nil {
+		return err
+	}
+	h.rc, h.pos = rc, 0
+	return nil
+}
+
+func (h *handle) Read(b []byte) (int, error) {
+	if h.rc == nil {
+		return 0, io.EOF
+	}
+	n, err := h.rc.Read(b)
+	h.pos += int64(n)
+	return n, err
+}
+
+func (h *handle) Seek(offset int64, whence int) (int64, error) {
+	if h.rc == nil {
+		return 0, nil
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += h.pos
+	case io.SeekEnd:
+		offset += h.e.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	if rs, ok := h.rc.(io.Seeker); ok {
+		pos, err := rs.Seek(offset, io.SeekStart)
+		h.pos = pos
+		return pos, err
+	}
+	if offset < h.pos {
+		if err := h.reopen(); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := io.CopyN(io.Discard, h, offset-h.pos); err != nil && err != io.EOF {
+		return h.pos, err
+	}
+	return offset, nil
+}
+
+func (h *handle) Write([]byte) (int, error) {
+	return 0, errReadOnly
+}
+
+func (h *handle) Close() error {
+	if h.rc == nil {
+		return nil
+	}
+	return h.rc.Close()
+}
+
+var _ w.FileHandle = &handle{}
+
+// section is content stored in the archive as is, which can be seeked.
+type section struct {
+	*io.SectionReader
+}
+
+func (section) Close() error {
+	return nil
+}
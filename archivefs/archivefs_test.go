@@ -0,0 +1,148 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archivefs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	w "github.com/google/go-webdav"
+)
+
+var files = map[string]string{
+	"index.html":     "<h1>hello</h1>",
+	"css/site.css":   "body { margin: 0 }",
+	"img/a/logo.svg": strings.Repeat("<svg/>", 1000),
+	"../escape":      "outside",
+}
+
+func newZip(t *testing.T) *FS {
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for name, content := range files {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := NewZip(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func newTar(t *testing.T) *FS {
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	tw.WriteHeader(&tar.Header{Name: "css/", Typeflag: tar.TypeDir, Mode: 0o755})
+	for name, content := range files {
+		h := &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(content))}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(content))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := NewTar(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func TestArchives(t *testing.T) {
+	for _, a := range []struct {
+		name  string
+		newFS func(t *testing.T) *FS
+	}{
+		{"zip", newZip},
+		{"tar", newTar},
+	} {
+		t.Run(a.name, func(t *testing.T) {
+			h := w.NewWebDAV(a.newFS(t), w.WithReadOnly())
+			do := func(method, p, body string, header ...string) *httptest.ResponseRecorder {
+				r := httptest.NewRequest(method, p, strings.NewReader(body))
+				for i := 0; i+1 < len(header); i += 2 {
+					r.Header.Set(header[i], header[i+1])
+				}
+				rw := httptest.NewRecorder()
+				h.ServeHTTP(rw, r)
+				return rw
+			}
+
+			for name, content := range files {
+				if strings.HasPrefix(name, "..") {
+					continue
+				}
+				if rw := do("GET", "/"+name, ""); rw.Body.String() != content {
+					t.Errorf("GET /%s got %q", name, rw.Body.String())
+				}
+			}
+			if rw := do("GET", "/img/a/logo.svg", "", "Range", "bytes=5994-"); rw.Body.String() != "<svg/>" {
+				t.Errorf("GET of a range got %q, want \"<svg/>\"", rw.Body.String())
+			}
+			if rw := do("GET", "/escape", ""); rw.Code != http.StatusNotFound {
+				t.Errorf("GET of an entry outside of the archive got %d", rw.Code)
+			}
+
+			rw := do("PROPFIND", "/", `<propfind xmlns="DAV:"><allprop/></propfind>`, "Depth", "1")
+			if rw.Code != w.StatusMulti {
+				t.Fatalf("PROPFIND got %d", rw.Code)
+			}
+			for _, want := range []string{"<href>/css</href>", "<href>/img</href>", "<href>/index.html</href>"} {
+				if !strings.Contains(rw.Body.String(), want) {
+					t.Errorf("PROPFIND did not list %s", want)
+				}
+			}
+			if strings.Contains(rw.Body.String(), "logo.svg") {
+				t.Error("PROPFIND with Depth: 1 listed /img/a/logo.svg")
+			}
+
+			if rw := do("PUT", "/new", "x"); rw.Code != http.StatusForbidden && rw.Code != http.StatusMethodNotAllowed {
+				t.Errorf("PUT got %d", rw.Code)
+			}
+		})
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	fs := newZip(t)
+	p, _ := fs.ForPath("/index.html")
+	if _, _, err := p.Create(); err != w.ErrorForbidden {
+		t.Errorf("Create got %v, want ErrorForbidden", err)
+	}
+	f, err := p.Lookup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.PatchProp(map[string]string{"urn:x:k": "v"}, nil); err != w.ErrorForbidden {
+		t.Errorf("PatchProp got %v, want ErrorForbidden", err)
+	}
+	if _, err := f.Truncate(); err != w.ErrorForbidden {
+		t.Errorf("Truncate got %v, want ErrorForbidden", err)
+	}
+}
@@ -0,0 +1,262 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	wp "github.com/google/go-webdav/path"
+)
+
+// Scope restricts what an authenticated principal may do, the zero value
+// is unrestricted.
+type Scope struct {
+	ReadOnly bool `json:"readOnly,omitempty"`
+	// UploadOnly permits only the creation of files and collections.
+	// Whether an upload overwrites an existing file is only known to the
+	// handler, so uploads are made conditional with "If-None-Match: *",
+	// see Restrict.
+	UploadOnly bool   `json:"uploadOnly,omitempty"`
+	Root       string `json:"root,omitempty"`
+}
+
+var safeMethods = map[string]bool{
+	"GET":      true,
+	"HEAD":     true,
+	"OPTIONS":  true,
+	"PROPFIND": true,
+	"REPORT":   true,
+	"SEARCH":   true,
+	"POLL":     true,
+}
+
+var uploadMethods = map[string]bool{
+	"OPTIONS": true,
+	"PUT":     true,
+	"MKCOL":   true,
+}
+
+// Permits determines whether the scope allows the given request.
+func (s Scope) Permits(r *http.Request) bool {
+	if s.ReadOnly && !safeMethods[r.Method] {
+		return false
+	}
+	if s.UploadOnly && !uploadMethods[r.Method] {
+		return false
+	}
+	if s.Root == "" {
+		return true
+	}
+	if !wp.InTree(path.Clean(r.URL.Path), s.Root) {
+		return false
+	}
+	if d := r.Header.Get("Destination"); d != "" {
+		u, err := url.Parse(d)
+		if err != nil || !wp.InTree(path.Clean(u.Path), s.Root) {
+			return false
+		}
+	}
+	return true
+}
+
+// Restrict adapts a permitted request to the scope, making the uploads of
+// an UploadOnly scope fail rather than overwrite an existing file.
+func (s Scope) Restrict(r *http.Request) *http.Request {
+	if !s.UploadOnly || r.Method != "PUT" {
+		return r
+	}
+	r = r.Clone(r.Context())
+	r.Header.Del("If-Match")
+	r.Header.Set("If-None-Match", "*")
+	return r
+}
+
+// AppPassword describes a password issued for a single device.
+type AppPassword struct {
+	ID       string    `json:"id"`
+	User     string    `json:"user"`
+	Device   string    `json:"device"`
+	Scope    Scope     `json:"scope"`
+	Created  time.Time `json:"created"`
+	LastUsed time.Time `json:"lastUsed,omitempty"`
+
+	hash [sha256.Size]byte
+}
+
+// AppPasswords is an Authenticator accepting generated per-device
+// passwords, so users need not give their primary password to every
+// client. Only hashes of the passwords are kept.
+type AppPasswords struct {
+	m      sync.Mutex
+	tokens map[string]*AppPassword
+}
+
+// NewAppPasswords creates an empty set of app passwords.
+func NewAppPasswords() *AppPasswords {
+	return &AppPasswords{tokens: make(map[string]*AppPassword)}
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)), nil
+}
+
+// Create issues a new password for the user's device, returning its
+// description and the password itself, which cannot be retrieved again.
+func (a *AppPasswords) Create(user, device string, scope Scope) (AppPassword, string, error) {
+	secret, err := randomString(20)
+	if err != nil {
+		return AppPassword{}, "", err
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return AppPassword{}, "", err
+	}
+	if scope.Root != "" {
+		scope.Root = path.Clean("/" + scope.Root)
+	}
+	ap := &AppPassword{
+		ID:      hex.EncodeToString(id),
+		User:    user,
+		Device:  device,
+		Scope:   scope,
+		Created: time.Now(),
+		hash:    sha256.Sum256([]byte(secret)),
+	}
+	a.m.Lock()
+	defer a.m.Unlock()
+	a.tokens[ap.ID] = ap
+	return *ap, secret, nil
+}
+
+// Revoke removes the user's password with the given ID, reporting whether
+// it existed.
+func (a *AppPasswords) Revoke(user, id string) bool {
+	a.m.Lock()
+	defer a.m.Unlock()
+	ap, ok := a.tokens[id]
+	if !ok || ap.User != user {
+		return false
+	}
+	delete(a.tokens, id)
+	return true
+}
+
+// List gets the descriptions of all of the user's passwords.
+func (a *AppPasswords) List(user string) []AppPassword {
+	a.m.Lock()
+	defer a.m.Unlock()
+	res := []AppPassword{}
+	for _, ap := range a.tokens {
+		if ap.User == user {
+			res = append(res, *ap)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Created.Before(res[j].Created) })
+	return res
+}
+
+// Authenticate implements Authenticator, the resulting principal carries
+// the scope of the matched password.
+func (a *AppPasswords) Authenticate(user, password string) (*Principal, error) {
+	h := sha256.Sum256([]byte(password))
+	a.m.Lock()
+	defer a.m.Unlock()
+	for _, ap := range a.tokens {
+		if ap.User != user {
+			continue
+		}
+		if subtle.ConstantTimeCompare(ap.hash[:], h[:]) == 1 {
+			ap.LastUsed = time.Now()
+			return &Principal{Name: user, Scope: ap.Scope}, nil
+		}
+	}
+	return nil, ErrBadCredentials
+}
+
+// ServeHTTP provides an API for authenticated users to manage their own
+// app passwords. It must be served behind authentication with the users'
+// primary credentials. GET lists passwords, POST with form values
+// "device", "readonly" and "root" creates one, and DELETE with an "id"
+// query parameter revokes one.
+func (a *AppPasswords) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p, ok := FromContext(r.Context())
+	if !ok || p.Scope != (Scope{}) {
+		// Scoped credentials must not be able to mint new ones.
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	var res interface{}
+	switch r.Method {
+	case "GET":
+		res = a.List(p.Name)
+	case "POST":
+		scope := Scope{
+			ReadOnly: r.FormValue("readonly") == "true",
+			Root:     r.FormValue("root"),
+		}
+		ap, secret, err := a.Create(p.Name, r.FormValue("device"), scope)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		res = struct {
+			AppPassword
+			Password string `json:"password"`
+		}{ap, secret}
+	case "DELETE":
+		if !a.Revoke(p.Name, r.URL.Query().Get("id")) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// Chain is an Authenticator trying each of its members in turn, for
+// example accepting either a primary password or an app password.
+type Chain []Authenticator
+
+// Authenticate implements Authenticator.
+func (c Chain) Authenticate(user, password string) (*Principal, error) {
+	for _, a := range c {
+		if p, err := a.Authenticate(user, password); err == nil {
+			return p, nil
+		}
+	}
+	return nil, ErrBadCredentials
+}
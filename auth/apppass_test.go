@@ -0,0 +1,76 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAppPasswords(t *testing.T) {
+	a := NewAppPasswords()
+	ap, secret, err := a.Create("bob", "phone", Scope{ReadOnly: true, Root: "photos"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.Authenticate("alice", secret); err == nil {
+		t.Error("expected another user not to authenticate with bob's password")
+	}
+	p, err := a.Authenticate("bob", secret)
+	if err != nil {
+		t.Fatalf("expected bob to authenticate, got %v", err)
+	}
+	if p.Scope.Root != "/photos" || !p.Scope.ReadOnly {
+		t.Errorf("expected scope to be carried, got %+v", p.Scope)
+	}
+
+	if a.Revoke("alice", ap.ID) {
+		t.Error("expected alice not to revoke bob's password")
+	}
+	if !a.Revoke("bob", ap.ID) {
+		t.Error("expected bob to revoke his password")
+	}
+	if _, err := a.Authenticate("bob", secret); err == nil {
+		t.Error("expected revoked password to fail")
+	}
+}
+
+func TestScopePermits(t *testing.T) {
+	s := Scope{ReadOnly: true, Root: "/photos"}
+	examples := []struct {
+		method, path, dest string
+		ok                 bool
+	}{
+		{"GET", "/photos/a.jpg", "", true},
+		{"PROPFIND", "/photos", "", true},
+		{"PUT", "/photos/a.jpg", "", false},
+		{"GET", "/photosx/a.jpg", "", false},
+		{"GET", "/photos/../secret", "", false},
+	}
+	for _, e := range examples {
+		r := httptest.NewRequest(e.method, e.path, nil)
+		if got := s.Permits(r); got != e.ok {
+			t.Errorf("%s %s: expected %v, got %v", e.method, e.path, e.ok, got)
+		}
+	}
+
+	s = Scope{Root: "/photos"}
+	r := httptest.NewRequest("MOVE", "/photos/a.jpg", nil)
+	r.Header.Set("Destination", "http://example.com/other/a.jpg")
+	if s.Permits(r) {
+		t.Error("expected MOVE out of the scope root to be denied")
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package auth provides HTTP authentication middleware to place in front of
+the WebDAV handler, along with credential backends. Authenticated principals
+are attached to the request context, see FromContext.
+*/
+package auth
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrBadCredentials is returned by an Authenticator when the presented
+// credentials are not valid.
+var ErrBadCredentials = errors.New("auth: bad credentials")
+
+// Principal identifies an authenticated user.
+type Principal struct {
+	Name   string
+	Groups []string
+	// Scope restricts the requests the principal may make, such as when
+	// authenticated by a limited app password.
+	Scope Scope
+}
+
+// InGroup determines whether the principal is a member of the given group.
+func (p *Principal) InGroup(g string) bool {
+	for _, pg := range p.Groups {
+		if pg == g {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator verifies a user name and password.
+type Authenticator interface {
+	Authenticate(user, password string) (*Principal, error)
+}
+
+type principalKey struct{}
+
+// NewContext returns a copy of ctx carrying the given principal.
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext gets the principal authenticated for a request, if any.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// BasicHandler is middleware requiring every request to carry HTTP Basic
+// credentials accepted by its Authenticator.
+type BasicHandler struct {
+	Handler       http.Handler
+	Authenticator Authenticator
+	Realm         string
+	// Throttle, if set, bans clients repeatedly failing to authenticate.
+	Throttle *Throttle
+	// Shares, if set, permits anonymous requests presenting a valid share
+	// token, limited to the share's scope.
+	Shares *Shares
+	// Rules, if set, authorizes the requests of authenticated principals,
+	// those of shares being limited by their scope alone.
+	Rules *Rules
+}
+
+// Basic wraps h, requiring every request to carry HTTP Basic credentials
+// accepted by the given Authenticator.
+func Basic(h http.Handler, a Authenticator, realm string) *BasicHandler {
+	return &BasicHandler{Handler: h, Authenticator: a, Realm: realm}
+}
+
+func (b *BasicHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if b.Throttle != nil {
+		if d := b.Throttle.Banned(r.RemoteAddr); d > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(d/time.Second)+1))
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	if b.Shares != nil {
+		p, ok, err := b.Shares.fromRequest(r)
+		if ok {
+			if err != nil || !p.Scope.Permits(r) {
+				log.Printf("auth: audit: share from %s not permitted %s %s: %v", r.RemoteAddr, r.Method, r.URL.Path, err)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			b.Handler.ServeHTTP(w, p.Scope.Restrict(r.WithContext(NewContext(r.Context(), p))))
+			return
+		}
+	}
+
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		b.challenge(w)
+		return
+	}
+	p, err := b.Authenticator.Authenticate(user, pass)
+	if err != nil {
+		log.Printf("auth: audit: rejected %q from %s: %s", user, r.RemoteAddr, err)
+		if b.Throttle != nil {
+			b.Throttle.Failed(r.RemoteAddr, user)
+		}
+		b.challenge(w)
+		return
+	}
+	if b.Throttle != nil {
+		b.Throttle.Succeeded(r.RemoteAddr, user)
+	}
+	if !p.Scope.Permits(r) || (b.Rules != nil && !b.Rules.Permits(p, r)) {
+		log.Printf("auth: audit: %q from %s not permitted %s %s", user, r.RemoteAddr, r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	b.Handler.ServeHTTP(w, p.Scope.Restrict(r.WithContext(NewContext(r.Context(), p))))
+}
+
+func (b *BasicHandler) challenge(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", "Basic realm="+strconv.Quote(b.Realm))
+	w.WriteHeader(http.StatusUnauthorized)
+}
@@ -0,0 +1,238 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BcryptCompare is used to check bcrypt ("$2y$") htpasswd entries. It is
+// nil by default, leaving bcrypt entries unusable, and is intended to be
+// set to bcrypt.CompareHashAndPassword from golang.org/x/crypto/bcrypt.
+var BcryptCompare func(hash, password []byte) error
+
+// File is an Authenticator backed by an Apache htpasswd or htdigest file.
+// Digest credentials are only used to verify Basic authentication, the
+// Digest challenge scheme itself is not supported.
+type File struct {
+	file   reloadingFile
+	realm  string
+	digest bool
+
+	m       sync.Mutex
+	entries map[string]string
+}
+
+// NewHtpasswd loads an htpasswd file supporting apr1, SHA1 and (given
+// BcryptCompare) bcrypt entries. If reload is non-zero, the file is checked
+// for modification at most that often and reloaded if it has changed.
+func NewHtpasswd(path string, reload time.Duration) (*File, error) {
+	f := &File{file: reloadingFile{path: path, reload: reload}}
+	f.file.parse = f.parse
+	return f, f.Reload()
+}
+
+// NewHtdigest loads the entries for the given realm from an htdigest file,
+// with reloading as per NewHtpasswd.
+func NewHtdigest(path, realm string, reload time.Duration) (*File, error) {
+	f := &File{file: reloadingFile{path: path, reload: reload}, realm: realm, digest: true}
+	f.file.parse = f.parse
+	return f, f.Reload()
+}
+
+// Reload unconditionally rereads the file.
+func (f *File) Reload() error {
+	return f.file.load()
+}
+
+// parse reads the entries of the file.
+func (f *File) parse(r io.Reader) error {
+	entries := make(map[string]string)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		l := strings.TrimSpace(sc.Text())
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		if f.digest {
+			// user:realm:HA1
+			parts := strings.SplitN(l, ":", 3)
+			if len(parts) != 3 {
+				return fmt.Errorf("auth: malformed htdigest line %q", l)
+			}
+			if parts[1] == f.realm {
+				entries[parts[0]] = parts[2]
+			}
+			continue
+		}
+		parts := strings.SplitN(l, ":", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("auth: malformed htpasswd line %q", l)
+		}
+		entries[parts[0]] = parts[1]
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.entries = entries
+	return nil
+}
+
+// Authenticate implements Authenticator.
+func (f *File) Authenticate(user, password string) (*Principal, error) {
+	f.file.maybeReload()
+	f.m.Lock()
+	hash, ok := f.entries[user]
+	f.m.Unlock()
+	if !ok {
+		return nil, ErrBadCredentials
+	}
+
+	var err error
+	if f.digest {
+		err = checkDigest(hash, user, f.realm, password)
+	} else {
+		err = checkHtpasswd(hash, password)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Principal{Name: user}, nil
+}
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+func checkDigest(ha1, user, realm, password string) error {
+	sum := md5.Sum([]byte(user + ":" + realm + ":" + password))
+	if !equal(hex.EncodeToString(sum[:]), strings.ToLower(ha1)) {
+		return ErrBadCredentials
+	}
+	return nil
+}
+
+func checkHtpasswd(hash, password string) error {
+	switch {
+	case strings.HasPrefix(hash, "$apr1$"):
+		parts := strings.SplitN(hash[len("$apr1$"):], "$", 2)
+		if len(parts) != 2 {
+			return errors.New("auth: malformed apr1 hash")
+		}
+		if !equal(apr1(password, parts[0]), hash) {
+			return ErrBadCredentials
+		}
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		if !equal(base64.StdEncoding.EncodeToString(sum[:]), hash[len("{SHA}"):]) {
+			return ErrBadCredentials
+		}
+	case strings.HasPrefix(hash, "$2"):
+		if BcryptCompare == nil {
+			return errors.New("auth: bcrypt entries require BcryptCompare")
+		}
+		if BcryptCompare([]byte(hash), []byte(password)) != nil {
+			return ErrBadCredentials
+		}
+	default:
+		return errors.New("auth: unsupported htpasswd hash")
+	}
+	return nil
+}
+
+const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// apr1 computes Apache's variant of the MD5-based crypt(3) scheme.
+func apr1(password, salt string) string {
+	const magic = "$apr1$"
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	pw := []byte(password)
+
+	alt := md5.New()
+	alt.Write(pw)
+	alt.Write([]byte(salt))
+	alt.Write(pw)
+	mixin := alt.Sum(nil)
+
+	d := md5.New()
+	d.Write(pw)
+	d.Write([]byte(magic))
+	d.Write([]byte(salt))
+	for i := len(pw); i > 0; i -= 16 {
+		n := i
+		if n > 16 {
+			n = 16
+		}
+		d.Write(mixin[:n])
+	}
+	for i := len(pw); i != 0; i >>= 1 {
+		if i&1 != 0 {
+			d.Write([]byte{0})
+		} else {
+			d.Write(pw[:1])
+		}
+	}
+	final := d.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		d := md5.New()
+		if i&1 != 0 {
+			d.Write(pw)
+		} else {
+			d.Write(final)
+		}
+		if i%3 != 0 {
+			d.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			d.Write(pw)
+		}
+		if i&1 != 0 {
+			d.Write(final)
+		} else {
+			d.Write(pw)
+		}
+		final = d.Sum(nil)
+	}
+
+	out := []byte(magic + salt + "$")
+	to64 := func(v uint32, n int) {
+		for ; n > 0; n-- {
+			out = append(out, itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+	for _, g := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		to64(uint32(final[g[0]])<<16|uint32(final[g[1]])<<8|uint32(final[g[2]]), 4)
+	}
+	to64(uint32(final[11]), 2)
+	return string(out)
+}
@@ -0,0 +1,50 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"testing"
+)
+
+func TestCheckHtpasswd(t *testing.T) {
+	examples := []struct {
+		hash, password string
+		ok             bool
+	}{
+		{"$apr1$abcdefgh$FBwExRW4dCc8aL.OvjpIE1", "password", true},
+		{"$apr1$abcdefgh$FBwExRW4dCc8aL.OvjpIE1", "Password", false},
+		{"{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=", "password", true},
+		{"{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=", "", false},
+		{"$2y$05$unusable", "password", false},
+		{"plaintext", "plaintext", false},
+	}
+
+	for _, e := range examples {
+		err := checkHtpasswd(e.hash, e.password)
+		if ok := err == nil; ok != e.ok {
+			t.Errorf("%q with %q: expected %v, got %v", e.hash, e.password, e.ok, err)
+		}
+	}
+}
+
+func TestCheckDigest(t *testing.T) {
+	const ha1 = "33f69ffc50d41fc145405bf3fa08a818"
+	if err := checkDigest(ha1, "bob", "dav", "secret"); err != nil {
+		t.Errorf("expected valid digest credentials, got %v", err)
+	}
+	if err := checkDigest(ha1, "bob", "other", "secret"); err == nil {
+		t.Error("expected digest credentials for another realm to fail")
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// LDAPEntry is a single entry returned by an LDAP search.
+type LDAPEntry struct {
+	DN    string
+	Attrs map[string][]string
+}
+
+// LDAPConn is the subset of an LDAP client connection used by LDAP. It is
+// intended to be a thin adapter over a client library such as
+// github.com/go-ldap/ldap, performing subtree searches.
+type LDAPConn interface {
+	Bind(dn, password string) error
+	Search(baseDN, filter string, attrs []string) ([]LDAPEntry, error)
+	Close() error
+}
+
+// LDAP is an Authenticator verifying credentials against an LDAP directory
+// such as Active Directory. If UserDN is set users bind directly with their
+// own DN, otherwise a service account locates the user with UserFilter
+// before binding as them.
+type LDAP struct {
+	// Dial opens a new connection to the directory.
+	Dial func() (LDAPConn, error)
+
+	// UserDN is a format string producing a user's DN from their name,
+	// e.g. "uid=%s,ou=people,dc=example,dc=com".
+	UserDN string
+
+	// BindDN and BindPassword are the service account credentials used
+	// to search for users.
+	BindDN, BindPassword string
+	// BaseDN is the subtree searched for users.
+	BaseDN string
+	// UserFilter is a format string producing the search filter for a
+	// user's name, e.g. "(sAMAccountName=%s)".
+	UserFilter string
+
+	// GroupAttr names the attribute of the user entry listing the groups
+	// they are a member of, e.g. "memberOf". Groups named by DN are
+	// reported by the value of their first RDN.
+	GroupAttr string
+}
+
+// Authenticate implements Authenticator.
+func (l *LDAP) Authenticate(user, password string) (*Principal, error) {
+	// An empty password would be an unauthenticated bind, which most
+	// directories accept without checking anything.
+	if user == "" || password == "" {
+		return nil, ErrBadCredentials
+	}
+
+	conn, err := l.Dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var dn string
+	if l.UserDN != "" {
+		dn = fmt.Sprintf(l.UserDN, escapeDN(user))
+	} else {
+		if err := conn.Bind(l.BindDN, l.BindPassword); err != nil {
+			return nil, fmt.Errorf("auth: service bind failed: %s", err)
+		}
+		filter := fmt.Sprintf(l.UserFilter, escapeFilter(user))
+		entries, err := conn.Search(l.BaseDN, filter, []string{"dn"})
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) != 1 {
+			return nil, ErrBadCredentials
+		}
+		dn = entries[0].DN
+	}
+
+	if err := conn.Bind(dn, password); err != nil {
+		return nil, ErrBadCredentials
+	}
+
+	p := &Principal{Name: user}
+	if l.GroupAttr == "" {
+		return p, nil
+	}
+	entries, err := conn.Search(dn, "(objectClass=*)", []string{l.GroupAttr})
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !strings.EqualFold(e.DN, dn) {
+			continue
+		}
+		for _, g := range e.Attrs[l.GroupAttr] {
+			p.Groups = append(p.Groups, groupName(g))
+		}
+	}
+	return p, nil
+}
+
+// groupName gets the value of the first RDN of a group DN, or the value
+// unchanged if it is not a DN.
+func groupName(dn string) string {
+	rdn := dn
+	for i := 0; i < len(dn); i++ {
+		if dn[i] == '\\' {
+			i++
+			continue
+		}
+		if dn[i] == ',' {
+			rdn = dn[:i]
+			break
+		}
+	}
+	idx := strings.Index(rdn, "=")
+	if idx < 0 {
+		return dn
+	}
+	return strings.Replace(rdn[idx+1:], "\\", "", -1)
+}
+
+// escapeFilter escapes a value for inclusion in a search filter, as
+// described in RFC 4515.
+func escapeFilter(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', '*', '(', ')', 0:
+			fmt.Fprintf(&b, "\\%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// escapeDN escapes a value for use in a DN, as described in RFC 4514.
+func escapeDN(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case strings.IndexByte(",+\"\\<>;=", c) >= 0:
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == 0:
+			b.WriteString("\\00")
+		case (c == ' ' || c == '#') && i == 0, c == ' ' && i == len(s)-1:
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// Check verifies that the LDAP authenticator is usefully configured.
+func (l *LDAP) Check() error {
+	if l.Dial == nil {
+		return errors.New("auth: LDAP has no Dial function")
+	}
+	if l.UserDN == "" && (l.UserFilter == "" || l.BaseDN == "") {
+		return errors.New("auth: LDAP needs either UserDN or BaseDN and UserFilter")
+	}
+	return nil
+}
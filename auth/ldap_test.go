@@ -0,0 +1,100 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"errors"
+	"testing"
+)
+
+// fakeDirectory is a single-user directory.
+type fakeDirectory struct {
+	filters []string
+}
+
+const aliceDN = "CN=Alice,OU=People,DC=example,DC=com"
+
+func (d *fakeDirectory) Bind(dn, password string) error {
+	if (dn == aliceDN && password == "secret") || (dn == "svc" && password == "svcpw") {
+		return nil
+	}
+	return errors.New("invalid credentials")
+}
+
+func (d *fakeDirectory) Search(base, filter string, attrs []string) ([]LDAPEntry, error) {
+	d.filters = append(d.filters, filter)
+	if filter == "(sAMAccountName=alice)" || base == aliceDN {
+		return []LDAPEntry{{
+			DN: aliceDN,
+			Attrs: map[string][]string{
+				"memberOf": {"CN=Staff\\, London,OU=Groups,DC=example,DC=com", "CN=Admins,OU=Groups,DC=example,DC=com"},
+			},
+		}}, nil
+	}
+	return nil, nil
+}
+
+func (d *fakeDirectory) Close() error {
+	return nil
+}
+
+func TestLDAPSearchBind(t *testing.T) {
+	d := &fakeDirectory{}
+	l := &LDAP{
+		Dial:         func() (LDAPConn, error) { return d, nil },
+		BindDN:       "svc",
+		BindPassword: "svcpw",
+		BaseDN:       "DC=example,DC=com",
+		UserFilter:   "(sAMAccountName=%s)",
+		GroupAttr:    "memberOf",
+	}
+
+	p, err := l.Authenticate("alice", "secret")
+	if err != nil {
+		t.Fatalf("expected alice to authenticate, got %v", err)
+	}
+	if !p.InGroup("Admins") || !p.InGroup("Staff, London") {
+		t.Errorf("expected alice's groups, got %v", p.Groups)
+	}
+
+	if _, err := l.Authenticate("alice", "wrong"); err == nil {
+		t.Error("expected bad password to fail")
+	}
+	if _, err := l.Authenticate("alice", ""); err == nil {
+		t.Error("expected empty password to fail")
+	}
+	if _, err := l.Authenticate("*)(uid=*", "secret"); err == nil {
+		t.Error("expected filter injection to fail")
+	}
+	if last := d.filters[len(d.filters)-1]; last != "(sAMAccountName=\\2a\\29\\28uid=\\2a)" {
+		t.Errorf("expected escaped filter, got %q", last)
+	}
+}
+
+func TestEscapeDN(t *testing.T) {
+	examples := map[string]string{
+		"alice":     "alice",
+		"a,b":       "a\\,b",
+		" lead":     "\\ lead",
+		"trail ":    "trail\\ ",
+		"#hash":     "\\#hash",
+		"x=y+z<\">": "x\\=y\\+z\\<\\\"\\>",
+	}
+	for in, exp := range examples {
+		if got := escapeDN(in); got != exp {
+			t.Errorf("escapeDN(%q): expected %q, got %q", in, exp, got)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// reloadingFile rereads a configuration file when it changes, checking for
+// modification at most every reload, or never if reload is zero.
+type reloadingFile struct {
+	path   string
+	reload time.Duration
+	// parse reads the content of the file, installing it only if it is
+	// valid, so that the previous content is kept otherwise.
+	parse func(io.Reader) error
+
+	m       sync.Mutex
+	modTime time.Time
+	checked time.Time
+}
+
+// load unconditionally rereads the file.
+func (rf *reloadingFile) load() error {
+	fd, err := os.Open(rf.path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	fi, err := fd.Stat()
+	if err != nil {
+		return err
+	}
+	if err := rf.parse(fd); err != nil {
+		return err
+	}
+
+	rf.m.Lock()
+	defer rf.m.Unlock()
+	rf.modTime = fi.ModTime()
+	rf.checked = time.Now()
+	return nil
+}
+
+// maybeReload reloads the file if the reload interval has passed and the
+// file has been modified since it was last read.
+func (rf *reloadingFile) maybeReload() {
+	rf.m.Lock()
+	due := rf.reload > 0 && time.Since(rf.checked) > rf.reload
+	if due {
+		rf.checked = time.Now()
+	}
+	modTime := rf.modTime
+	rf.m.Unlock()
+	if !due {
+		return
+	}
+
+	fi, err := os.Stat(rf.path)
+	if err != nil || fi.ModTime().Equal(modTime) {
+		return
+	}
+	if err := rf.load(); err != nil {
+		// Keep serving the previous content.
+		log.Printf("auth: could not reload %s: %s", rf.path, err)
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	wp "github.com/google/go-webdav/path"
+)
+
+// Rule allows or denies principals some methods below a path.
+type Rule struct {
+	Allow bool
+	// Who is a user name, a group name prefixed with "@", or "*" for
+	// every principal.
+	Who string
+	// Methods are method names, or the classes "read", for methods which
+	// do not modify resources, and "write", for all others. Empty matches
+	// every method.
+	Methods []string
+	// Prefix is the path the rule applies below.
+	Prefix string
+}
+
+func (r Rule) matches(p *Principal, method, rp string) bool {
+	switch {
+	case r.Who == "*":
+	case strings.HasPrefix(r.Who, "@"):
+		if !p.InGroup(r.Who[1:]) {
+			return false
+		}
+	case r.Who != p.Name:
+		return false
+	}
+	if !wp.InTree(rp, r.Prefix) {
+		return false
+	}
+	if len(r.Methods) == 0 {
+		return true
+	}
+	for _, m := range r.Methods {
+		switch m {
+		case "read":
+			if safeMethods[method] {
+				return true
+			}
+		case "write":
+			if !safeMethods[method] {
+				return true
+			}
+		default:
+			if m == method {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseRules reads rules, one per line of the form
+//
+//	allow|deny who methods prefix
+//
+// where methods are separated by commas, or "*" for all of them. Blank
+// lines and those starting with "#" are ignored.
+func parseRules(r io.Reader) ([]Rule, error) {
+	var rules []Rule
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		l := strings.TrimSpace(sc.Text())
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		f := strings.Fields(l)
+		if len(f) != 4 || (f[0] != "allow" && f[0] != "deny") || !strings.HasPrefix(f[3], "/") {
+			return nil, fmt.Errorf("auth: malformed rule %q", l)
+		}
+		rule := Rule{Allow: f[0] == "allow", Who: f[1], Prefix: path.Clean(f[3])}
+		if f[2] != "*" {
+			for _, m := range strings.Split(f[2], ",") {
+				if m != "read" && m != "write" {
+					m = strings.ToUpper(m)
+				}
+				rule.Methods = append(rule.Methods, m)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, sc.Err()
+}
+
+// Rules is a table of rules authorizing the requests of principals, such
+// as "admins write, staff read", loaded from a file:
+//
+//	# Admins may do anything, staff may only read.
+//	allow @admins * /
+//	allow @staff read /
+//	allow alice write /staff/alice
+//
+// The first rule matching a request decides it, and requests matching no
+// rule are denied. COPY and MOVE requests must also be allowed for their
+// destination.
+type Rules struct {
+	file reloadingFile
+
+	m     sync.Mutex
+	rules []Rule
+}
+
+// NewRules loads rules from a file. If reload is non-zero, the file is
+// checked for modification at most that often and reloaded if it has
+// changed.
+func NewRules(path string, reload time.Duration) (*Rules, error) {
+	rs := &Rules{file: reloadingFile{path: path, reload: reload}}
+	rs.file.parse = rs.parse
+	return rs, rs.Reload()
+}
+
+// Reload unconditionally rereads the file, keeping the previous rules if
+// it cannot be parsed.
+func (rs *Rules) Reload() error {
+	return rs.file.load()
+}
+
+// parse reads the rules of the file.
+func (rs *Rules) parse(r io.Reader) error {
+	rules, err := parseRules(r)
+	if err != nil {
+		return err
+	}
+	rs.m.Lock()
+	defer rs.m.Unlock()
+	rs.rules = rules
+	return nil
+}
+
+// Permits determines whether the rules allow the principal's request.
+func (rs *Rules) Permits(p *Principal, r *http.Request) bool {
+	rs.file.maybeReload()
+	if !rs.allows(p, r.Method, path.Clean("/"+r.URL.Path)) {
+		return false
+	}
+	if d := r.Header.Get("Destination"); d != "" {
+		u, err := url.Parse(d)
+		if err != nil || !rs.allows(p, r.Method, path.Clean("/"+u.Path)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (rs *Rules) allows(p *Principal, method, rp string) bool {
+	rs.m.Lock()
+	defer rs.m.Unlock()
+	for _, rule := range rs.rules {
+		if rule.matches(p, method, rp) {
+			return rule.Allow
+		}
+	}
+	return false
+}
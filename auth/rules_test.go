@@ -0,0 +1,90 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRules(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "rules")
+	const table = `
+# Admins may do anything, staff may only read.
+deny @staff * /private
+allow @admins * /
+allow @staff read /
+allow bob write,lock /bob
+`
+	if err := os.WriteFile(name, []byte(table), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rs, err := NewRules(name, time.Nanosecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	admin := &Principal{Name: "alice", Groups: []string{"admins"}}
+	staff := &Principal{Name: "bob", Groups: []string{"staff"}}
+	other := &Principal{Name: "carol"}
+	examples := []struct {
+		p            *Principal
+		method, path string
+		dest         string
+		want         bool
+	}{
+		{admin, "PUT", "/a", "", true},
+		{staff, "GET", "/a", "", true},
+		{staff, "PROPFIND", "/a", "", true},
+		{staff, "PUT", "/a", "", false},
+		{staff, "GET", "/private/a", "", false},
+		{staff, "PUT", "/bob/a", "", true},
+		{staff, "LOCK", "/bob/a", "", true},
+		{staff, "MOVE", "/bob/a", "http://h/bob/b", true},
+		{staff, "MOVE", "/bob/a", "http://h/a", false},
+		{other, "GET", "/a", "", false},
+	}
+	for _, e := range examples {
+		r := httptest.NewRequest(e.method, e.path, nil)
+		if e.dest != "" {
+			r.Header.Set("Destination", e.dest)
+		}
+		if got := rs.Permits(e.p, r); got != e.want {
+			t.Errorf("%s %s %s got %v, want %v", e.p.Name, e.method, e.path, got, e.want)
+		}
+	}
+
+	// Changes are picked up, malformed tables are not.
+	if err := os.WriteFile(name, []byte("allow * read /\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(name, time.Time{}, time.Now().Add(time.Hour))
+	time.Sleep(time.Millisecond)
+	if !rs.Permits(other, httptest.NewRequest("GET", "/a", nil)) {
+		t.Error("reloaded rules do not permit reading")
+	}
+	if err := os.WriteFile(name, []byte("allow everyone\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := rs.Reload(); err == nil {
+		t.Error("Reload accepted a malformed rule")
+	}
+	if !rs.Permits(other, httptest.NewRequest("GET", "/a", nil)) {
+		t.Error("rules were lost by a failed reload")
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrBadShare is returned when a share token is malformed, forged or
+// expired.
+var ErrBadShare = errors.New("auth: invalid share token")
+
+var errSharePermission = errors.New("auth: unknown share permission")
+
+// SharePermission is what a share link permits within its subtree.
+type SharePermission int
+
+// Permissions a share link may grant.
+const (
+	// ShareRead permits reading and listing.
+	ShareRead SharePermission = iota
+	// ShareUpload permits only adding files, see Scope.UploadOnly.
+	ShareUpload
+)
+
+// valid determines whether the permission is one of those defined, so
+// that an unknown one never grants unrestricted access.
+func (p SharePermission) valid() bool {
+	return p == ShareRead || p == ShareUpload
+}
+
+// Share describes anonymous access to a subtree.
+type Share struct {
+	Root       string          `json:"r"`
+	Expires    time.Time       `json:"e"`
+	Permission SharePermission `json:"p"`
+}
+
+// Shares issues and verifies share links, tokens signed with a secret key
+// which grant anonymous access to a subtree until they expire. Tokens are
+// presented in the "share" query parameter or the Share-Token header.
+type Shares struct {
+	Key []byte
+}
+
+func (s *Shares) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.Key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Token creates a signed token for the given share.
+func (s *Shares) Token(sh Share) (string, error) {
+	if !sh.Permission.valid() {
+		return "", errSharePermission
+	}
+	sh.Root = path.Clean("/" + sh.Root)
+	b, err := json.Marshal(sh)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	return payload + "." + s.sign(payload), nil
+}
+
+// Verify checks a token's signature and expiry, returning its share.
+func (s *Shares) Verify(tok string) (Share, error) {
+	var sh Share
+	idx := strings.LastIndex(tok, ".")
+	if idx < 0 || len(s.Key) == 0 {
+		return sh, ErrBadShare
+	}
+	payload, sig := tok[:idx], tok[idx+1:]
+	if !hmac.Equal([]byte(sig), []byte(s.sign(payload))) {
+		return sh, ErrBadShare
+	}
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return sh, ErrBadShare
+	}
+	if err := json.Unmarshal(b, &sh); err != nil {
+		return sh, ErrBadShare
+	}
+	if time.Now().After(sh.Expires) || !sh.Permission.valid() {
+		return sh, ErrBadShare
+	}
+	return sh, nil
+}
+
+// fromRequest gets the share presented with a request, if any.
+func (s *Shares) fromRequest(r *http.Request) (*Principal, bool, error) {
+	tok := r.Header.Get("Share-Token")
+	if tok == "" {
+		tok = r.URL.Query().Get("share")
+	}
+	if tok == "" {
+		return nil, false, nil
+	}
+	sh, err := s.Verify(tok)
+	if err != nil {
+		return nil, true, err
+	}
+	return &Principal{
+		Name: "share",
+		Scope: Scope{
+			Root:       sh.Root,
+			ReadOnly:   sh.Permission == ShareRead,
+			UploadOnly: sh.Permission == ShareUpload,
+		},
+	}, true, nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestShares(t *testing.T) {
+	s := &Shares{Key: []byte("secret")}
+	tok, err := s.Token(Share{Root: "/docs", Expires: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sh, err := s.Verify(tok); err != nil || sh.Root != "/docs" {
+		t.Errorf("expected valid share for /docs, got %+v: %v", sh, err)
+	}
+
+	other := &Shares{Key: []byte("other")}
+	if _, err := other.Verify(tok); err == nil {
+		t.Error("expected token signed with another key to fail")
+	}
+
+	expired, _ := s.Token(Share{Root: "/docs", Expires: time.Now().Add(-time.Second)})
+	if _, err := s.Verify(expired); err == nil {
+		t.Error("expected expired token to fail")
+	}
+
+	h := Basic(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), Chain{}, "dav")
+	h.Shares = s
+	examples := []struct {
+		method, url string
+		code        int
+	}{
+		{"GET", "/docs/a.txt?share=" + tok, http.StatusOK},
+		{"PUT", "/docs/a.txt?share=" + tok, http.StatusForbidden},
+		{"GET", "/private?share=" + tok, http.StatusForbidden},
+		{"GET", "/docs/a.txt?share=" + expired, http.StatusForbidden},
+		{"GET", "/docs/a.txt", http.StatusUnauthorized},
+	}
+	for _, e := range examples {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(e.method, e.url, nil))
+		if w.Code != e.code {
+			t.Errorf("%s %s: expected %d, got %d", e.method, e.url, e.code, w.Code)
+		}
+	}
+}
+
+func TestSharePermissions(t *testing.T) {
+	s := &Shares{Key: []byte("secret")}
+	if _, err := s.Token(Share{Root: "/in", Expires: time.Now().Add(time.Hour), Permission: 7}); err == nil {
+		t.Error("expected a token with an unknown permission to be refused")
+	}
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"r":"/in","e":"2999-01-01T00:00:00Z","p":7}`))
+	if _, err := s.Verify(payload + "." + s.sign(payload)); err != ErrBadShare {
+		t.Errorf("expected a signed share with an unknown permission to fail, got %v", err)
+	}
+
+	var inm []string
+	h := Basic(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inm = append(inm, r.Header.Get("If-None-Match"))
+	}), Chain{}, "dav")
+	h.Shares = s
+	tok, _ := s.Token(Share{Root: "/in", Expires: time.Now().Add(time.Hour), Permission: ShareUpload})
+	for _, m := range []string{"PUT", "MKCOL"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(m, "/in/a?share="+tok, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("%s with an upload share: expected 200, got %d", m, w.Code)
+		}
+	}
+	if len(inm) != 2 || inm[0] != "*" || inm[1] != "" {
+		t.Errorf("expected only uploads made conditional on creating, got If-None-Match %q", inm)
+	}
+}
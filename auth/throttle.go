@@ -0,0 +1,167 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	w "github.com/google/go-webdav"
+)
+
+// Default Throttle settings, used when the corresponding field is zero.
+const (
+	DefaultThreshold = 5
+	DefaultBaseBan   = time.Second
+	DefaultMaxBan    = 15 * time.Minute
+	DefaultForget    = time.Hour
+)
+
+type failures struct {
+	count  int
+	users  map[string]int
+	last   time.Time
+	banned time.Time
+}
+
+// Throttle tracks failed authentications per client address, temporarily
+// banning addresses with exponentially increasing durations once they
+// exceed a threshold. It needs no client session state, so it protects
+// Basic authentication from password guessing. A success only forgives the
+// failures of the user who succeeded, so logging in to one account does not
+// permit guessing the passwords of others.
+type Throttle struct {
+	// Threshold is the number of consecutive failures permitted before
+	// an address is banned.
+	Threshold int
+	// BaseBan is the duration of the first ban, which doubles for every
+	// further failure up to MaxBan.
+	BaseBan, MaxBan time.Duration
+	// Forget is how long an address must be idle before its failures
+	// are forgotten.
+	Forget time.Duration
+	// Clock supplies the time of failures and bans, nil meaning
+	// webdav.SystemClock.
+	Clock w.Clock
+
+	m       sync.Mutex
+	clients map[string]*failures
+}
+
+func orDuration(d, def time.Duration) time.Duration {
+	if d == 0 {
+		return def
+	}
+	return d
+}
+
+func (t *Throttle) now() time.Time {
+	if t.Clock == nil {
+		return w.SystemClock.Now()
+	}
+	return t.Clock.Now()
+}
+
+// clientAddr gets the address of the client, without the port.
+func clientAddr(remote string) string {
+	host, _, err := net.SplitHostPort(remote)
+	if err != nil {
+		return remote
+	}
+	return host
+}
+
+// Banned reports the remaining ban duration for the given client address,
+// zero if it is not banned.
+func (t *Throttle) Banned(remote string) time.Duration {
+	t.m.Lock()
+	defer t.m.Unlock()
+	f := t.clients[clientAddr(remote)]
+	if f == nil {
+		return 0
+	}
+	if d := f.banned.Sub(t.now()); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// Failed records a failed authentication by the given user.
+func (t *Throttle) Failed(remote, user string) {
+	addr := clientAddr(remote)
+	t.m.Lock()
+	defer t.m.Unlock()
+	if t.clients == nil {
+		t.clients = make(map[string]*failures)
+	}
+	t.expire()
+
+	f := t.clients[addr]
+	if f == nil {
+		f = &failures{users: make(map[string]int)}
+		t.clients[addr] = f
+	}
+	f.count++
+	f.users[user]++
+	f.last = t.now()
+
+	threshold := t.Threshold
+	if threshold == 0 {
+		threshold = DefaultThreshold
+	}
+	if f.count < threshold {
+		return
+	}
+	ban := orDuration(t.BaseBan, DefaultBaseBan)
+	max := orDuration(t.MaxBan, DefaultMaxBan)
+	for i := threshold; i < f.count && ban < max; i++ {
+		ban *= 2
+	}
+	if ban > max {
+		ban = max
+	}
+	f.banned = f.last.Add(ban)
+	log.Printf("auth: audit: banning %s for %s after %d failures, last as %q", addr, ban, f.count, user)
+}
+
+// Succeeded clears the failures of the given client address made as the
+// given user.
+func (t *Throttle) Succeeded(remote, user string) {
+	addr := clientAddr(remote)
+	t.m.Lock()
+	defer t.m.Unlock()
+	f := t.clients[addr]
+	if f == nil {
+		return
+	}
+	f.count -= f.users[user]
+	delete(f.users, user)
+	if f.count == 0 {
+		delete(t.clients, addr)
+	}
+}
+
+// expire forgets idle addresses, so that the table cannot grow unbounded.
+func (t *Throttle) expire() {
+	forget := orDuration(t.Forget, DefaultForget)
+	now := t.now()
+	for addr, f := range t.clients {
+		if now.Sub(f.last) > forget && now.After(f.banned) {
+			delete(t.clients, addr)
+		}
+	}
+}
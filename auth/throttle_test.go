@@ -0,0 +1,99 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThrottle(t *testing.T) {
+	th := &Throttle{Threshold: 3, BaseBan: time.Minute, MaxBan: 4 * time.Minute}
+	const addr = "192.0.2.1:1234"
+
+	th.Failed(addr, "bob")
+	th.Failed(addr, "bob")
+	if d := th.Banned(addr); d != 0 {
+		t.Errorf("expected no ban below threshold, got %s", d)
+	}
+	th.Failed(addr, "bob")
+	if d := th.Banned("192.0.2.1:5678"); d <= 0 || d > time.Minute {
+		t.Errorf("expected a one minute ban regardless of port, got %s", d)
+	}
+	for i := 0; i < 5; i++ {
+		th.Failed(addr, "bob")
+	}
+	if d := th.Banned(addr); d <= 2*time.Minute || d > 4*time.Minute {
+		t.Errorf("expected ban capped at four minutes, got %s", d)
+	}
+	if d := th.Banned("192.0.2.2:1234"); d != 0 {
+		t.Errorf("expected other addresses not to be banned, got %s", d)
+	}
+
+	th.Succeeded(addr, "bob")
+	if d := th.Banned(addr); d != 0 {
+		t.Errorf("expected ban cleared on success, got %s", d)
+	}
+}
+
+func TestThrottleOtherUserSucceeded(t *testing.T) {
+	th := &Throttle{Threshold: 3, BaseBan: time.Minute}
+	const addr = "192.0.2.1:1234"
+
+	// Logging in to one account between guesses at others does not
+	// reset the count.
+	for _, user := range []string{"bob", "carol"} {
+		th.Failed(addr, user)
+		th.Succeeded(addr, "alice")
+	}
+	th.Failed(addr, "dave")
+	if d := th.Banned(addr); d <= 0 {
+		t.Error("expected a ban despite interleaved successes as another user")
+	}
+}
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.t }
+
+func TestThrottleClock(t *testing.T) {
+	c := &fakeClock{time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	th := &Throttle{Threshold: 1, BaseBan: time.Minute, Forget: time.Hour, Clock: c}
+	const addr = "192.0.2.1:1234"
+
+	th.Failed(addr, "bob")
+	if d := th.Banned(addr); d != time.Minute {
+		t.Errorf("expected a one minute ban, got %s", d)
+	}
+	c.t = c.t.Add(40 * time.Second)
+	if d := th.Banned(addr); d != 20*time.Second {
+		t.Errorf("expected 20s of the ban left, got %s", d)
+	}
+	c.t = c.t.Add(20 * time.Second)
+	if d := th.Banned(addr); d != 0 {
+		t.Errorf("expected the ban to end, got %s", d)
+	}
+
+	// The failures are remembered until the address is idle for Forget.
+	th.Failed(addr, "bob")
+	if d := th.Banned(addr); d != 2*time.Minute {
+		t.Errorf("expected the second ban to double, got %s", d)
+	}
+	c.t = c.t.Add(2 * time.Hour)
+	th.Failed(addr, "bob")
+	if d := th.Banned(addr); d != time.Minute {
+		t.Errorf("expected failures to be forgotten after Forget, got %s", d)
+	}
+}
@@ -0,0 +1,498 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package breakerfs guards a wrapped webdav.FileSystem with a circuit breaker,
+so that requests fail fast while its backend, such as an NFS mount or an
+object store, is down rather than piling up behind it.
+
+After a number of consecutive backend failures the breaker opens, and for a
+cooldown period every operation fails with webdav.ErrorUnavailable, answered
+with 503 and a Retry-After header. Once the cooldown has passed the breaker
+is half-open: a single operation is let through as a probe, closing the
+breaker if it succeeds and opening it again if it fails.
+
+Failures are the errors which the handler answers with 500, 503 or 504, that
+is those which webdav.FromOSError does not recognize and Errors with those
+statuses; errors such as webdav.ErrorNotFound are the backend answering, and
+count as successes. Reads and writes of files already open are never
+refused, but their failures are counted.
+*/
+package breakerfs
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	w "github.com/google/go-webdav"
+)
+
+// Defaults for the Options.
+const (
+	DefaultFailures = 5
+	DefaultCooldown = 30 * time.Second
+)
+
+// Options configure the breaker.
+type Options struct {
+	// Failures is the number of consecutive failures opening the breaker,
+	// DefaultFailures if zero.
+	Failures int
+	// Cooldown is how long the breaker stays open before probing the
+	// backend, DefaultCooldown if zero.
+	Cooldown time.Duration
+	// Clock is the source of time, webdav.SystemClock if nil.
+	Clock w.Clock
+}
+
+// State is the state of the breaker.
+type State int
+
+// States of the breaker.
+const (
+	// Closed lets every operation through.
+	Closed State = iota
+	// Open refuses every operation until the cooldown has passed.
+	Open
+	// HalfOpen lets a single probe through.
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// Stats report the state and history of the breaker.
+type Stats struct {
+	State State
+	// Failures counts the consecutive failures of the backend.
+	Failures int
+	// Trips counts the times the breaker opened, Rejected the operations
+	// refused while it was open, and Probes the operations let through
+	// while it was half-open.
+	Trips, Rejected, Probes uint64
+	// Opened is when the breaker last opened.
+	Opened time.Time
+}
+
+// FS is a webdav.FileSystem failing fast while its backend is failing.
+type FS struct {
+	inner    w.FileSystem
+	failures int
+	cooldown time.Duration
+	clock    w.Clock
+
+	m     sync.Mutex
+	stats Stats
+	// probing is set while the probe of a half-open breaker runs.
+	probing bool
+}
+
+// New wraps a FileSystem with a circuit breaker.
+func New(inner w.FileSystem, opts Options) *FS {
+	fs := &FS{
+		inner:    inner,
+		failures: opts.Failures,
+		cooldown: opts.Cooldown,
+		clock:    opts.Clock,
+	}
+	if fs.failures <= 0 {
+		fs.failures = DefaultFailures
+	}
+	if fs.cooldown <= 0 {
+		fs.cooldown = DefaultCooldown
+	}
+	if fs.clock == nil {
+		fs.clock = w.SystemClock
+	}
+	return fs
+}
+
+// ForPath implements webdav.FileSystem.
+func (fs *FS) ForPath(p string) (w.Path, error) {
+	ip, err := fs.inner.ForPath(p)
+	if err != nil {
+		return nil, err
+	}
+	return &bpath{fs: fs, inner: ip}, nil
+}
+
+// Dump implements webdav.FileSystem, dumping the inner FileSystem.
+func (fs *FS) Dump(out io.Writer, format w.DumpFormat) error {
+	return fs.inner.Dump(out, format)
+}
+
+// Stats gets the state and history of the breaker.
+func (fs *FS) Stats() Stats {
+	fs.m.Lock()
+	defer fs.m.Unlock()
+	fs.halfOpen()
+	return fs.stats
+}
+
+// halfOpen moves an open breaker whose cooldown has passed to half-open.
+// fs.m must be held.
+func (fs *FS) halfOpen() {
+	if fs.stats.State == Open && !fs.clock.Now().Before(fs.stats.Opened.Add(fs.cooldown)) {
+		fs.stats.State = HalfOpen
+	}
+}
+
+// allow admits an operation, failing with webdav.ErrorUnavailable if the
+// breaker refuses it. The operation is a probe if the breaker is half-open.
+func (fs *FS) allow() (probe bool, err error) {
+	fs.m.Lock()
+	defer fs.m.Unlock()
+	fs.halfOpen()
+	switch {
+	case fs.stats.State == Closed:
+		return false, nil
+	case fs.stats.State == HalfOpen && !fs.probing:
+		fs.probing = true
+		fs.stats.Probes++
+		return true, nil
+	}
+	fs.stats.Rejected++
+	wait := fs.stats.Opened.Add(fs.cooldown).Sub(fs.clock.Now())
+	if wait <= 0 {
+		// Another probe is running, and will decide shortly.
+		wait = time.Second
+	}
+	return false, w.ErrorUnavailable.WithRetryAfter(wait)
+}
+
+// done records the outcome of an operation.
+func (fs *FS) done(probe bool, err error) {
+	fs.m.Lock()
+	defer fs.m.Unlock()
+	if probe {
+		fs.probing = false
+	}
+	if !failed(err) {
+		if probe || fs.stats.State == Closed {
+			fs.stats.State, fs.stats.Failures = Closed, 0
+		}
+		return
+	}
+	fs.stats.Failures++
+	if probe || (fs.stats.State == Closed && fs.stats.Failures >= fs.failures) {
+		fs.stats.State = Open
+		fs.stats.Opened = fs.clock.Now()
+		fs.stats.Trips++
+	}
+}
+
+// failed determines if an error is a failure of the backend.
+func failed(err error) bool {
+	if err == nil || err == io.EOF {
+		return false
+	}
+	var we w.Error
+	if !errors.As(w.FromOSError(err), &we) {
+		return true
+	}
+	switch we.HTTPCode() {
+	case http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// call runs an operation if the breaker allows it.
+func (fs *FS) call(op func() error) error {
+	probe, err := fs.allow()
+	if err != nil {
+		return err
+	}
+	err = op()
+	fs.done(probe, err)
+	return err
+}
+
+type bpath struct {
+	fs    *FS
+	inner w.Path
+}
+
+func (p *bpath) String() string {
+	return p.inner.String()
+}
+
+func (p *bpath) Parent() w.Path {
+	return &bpath{fs: p.fs, inner: p.inner.Parent()}
+}
+
+func (p *bpath) Lookup() (w.File, error) {
+	var f w.File
+	err := p.fs.call(func() (err error) {
+		f, err = p.inner.Lookup()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &bfile{File: f, fs: p.fs}, nil
+}
+
+// Exists implements webdav.Exister if the inner Path does.
+func (p *bpath) Exists() (bool, error) {
+	var ok bool
+	err := p.fs.call(func() (err error) {
+		if e, isExister := p.inner.(w.Exister); isExister {
+			ok, err = e.Exists()
+			return err
+		}
+		_, lerr := p.inner.Lookup()
+		ok = lerr == nil
+		if failed(lerr) {
+			return lerr
+		}
+		return nil
+	})
+	return ok, err
+}
+
+// CheckSpace implements webdav.SpaceChecker if the inner Path does.
+func (p *bpath) CheckSpace(size int64) error {
+	sc, ok := p.inner.(w.SpaceChecker)
+	if !ok {
+		return nil
+	}
+	return p.fs.call(func() error {
+		return sc.CheckSpace(size)
+	})
+}
+
+func (p *bpath) LookupSubtree(depth int) ([]w.File, error) {
+	var files []w.File
+	err := p.fs.call(func() (err error) {
+		files, err = p.inner.LookupSubtree(depth)
+		return err
+	})
+	for i, f := range files {
+		files[i] = &bfile{File: f, fs: p.fs}
+	}
+	return files, err
+}
+
+func (p *bpath) Mkdir() (w.File, error) {
+	var f w.File
+	err := p.fs.call(func() (err error) {
+		f, err = p.inner.Mkdir()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &bfile{File: f, fs: p.fs}, nil
+}
+
+func (p *bpath) Create() (w.File, w.FileHandle, error) {
+	var f w.File
+	var fh w.FileHandle
+	err := p.fs.call(func() (err error) {
+		f, fh, err = p.inner.Create()
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &bfile{File: f, fs: p.fs}, p.fs.handle(fh), nil
+}
+
+func (p *bpath) CopyTo(dst w.Path, opt w.CopyOptions) (bool, error) {
+	dp, ok := dst.(*bpath)
+	if !ok {
+		return false, w.ErrorBadHost
+	}
+	var created bool
+	err := p.fs.call(func() (err error) {
+		created, err = p.inner.CopyTo(dp.inner, opt)
+		return err
+	})
+	return created, err
+}
+
+func (p *bpath) Remove() error {
+	return p.fs.call(p.inner.Remove)
+}
+
+// RecursiveRemove counts as a failure if removing any resource failed.
+func (p *bpath) RecursiveRemove() map[string]error {
+	var errs map[string]error
+	err := p.fs.call(func() error {
+		errs = p.inner.RecursiveRemove()
+		for _, err := range errs {
+			if failed(err) {
+				return err
+			}
+		}
+		return nil
+	})
+	if errs == nil && err != nil {
+		errs = map[string]error{p.String(): err}
+	}
+	return errs
+}
+
+type bfile struct {
+	w.File
+	fs *FS
+}
+
+func (f *bfile) Stat() (w.FileInfo, error) {
+	var fi w.FileInfo
+	err := f.fs.call(func() (err error) {
+		fi, err = f.File.Stat()
+		return err
+	})
+	return fi, err
+}
+
+func (f *bfile) Open() (w.FileHandle, error) {
+	var fh w.FileHandle
+	err := f.fs.call(func() (err error) {
+		fh, err = f.File.Open()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return f.fs.handle(fh), nil
+}
+
+func (f *bfile) Truncate() (w.FileHandle, error) {
+	var fh w.FileHandle
+	err := f.fs.call(func() (err error) {
+		fh, err = f.File.Truncate()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return f.fs.handle(fh), nil
+}
+
+// Update implements webdav.Updater if the inner File does.
+func (f *bfile) Update() (w.FileHandle, error) {
+	u, ok := f.File.(w.Updater)
+	if !ok {
+		return nil, w.ErrorNotImplemented
+	}
+	var fh w.FileHandle
+	err := f.fs.call(func() (err error) {
+		fh, err = u.Update()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return f.fs.handle(fh), nil
+}
+
+func (f *bfile) PatchProp(set, remove map[string]string) error {
+	return f.fs.call(func() error {
+		return f.File.PatchProp(set, remove)
+	})
+}
+
+// PropNames implements webdav.PropLister if the inner File does.
+func (f *bfile) PropNames() []string {
+	if pl, ok := f.File.(w.PropLister); ok {
+		return pl.PropNames()
+	}
+	return nil
+}
+
+// ETag implements webdav.ETagger if the inner File does.
+func (f *bfile) ETag() (string, error) {
+	et, ok := f.File.(w.ETagger)
+	if !ok {
+		return "", w.ErrorNotFound
+	}
+	var tag string
+	err := f.fs.call(func() (err error) {
+		tag, err = et.ETag()
+		return err
+	})
+	return tag, err
+}
+
+// Representation implements webdav.Representer if the inner File does.
+func (f *bfile) Representation() (w.File, error) {
+	if r, ok := f.File.(w.Representer); ok {
+		return r.Representation()
+	}
+	return nil, w.ErrorNotFound
+}
+
+// handle counts the failures of reads and writes, without refusing them.
+type handle struct {
+	w.FileHandle
+	fs *FS
+}
+
+func (h *handle) Read(b []byte) (int, error) {
+	n, err := h.FileHandle.Read(b)
+	if err != nil {
+		h.fs.done(false, err)
+	}
+	return n, err
+}
+
+func (h *handle) Write(b []byte) (int, error) {
+	n, err := h.FileHandle.Write(b)
+	if err != nil {
+		h.fs.done(false, err)
+	}
+	return n, err
+}
+
+func (h *handle) Close() error {
+	err := h.FileHandle.Close()
+	h.fs.done(false, err)
+	return err
+}
+
+// handle wraps a FileHandle of the wrapped FileSystem, keeping the
+// webdav.Committer it may implement.
+func (fs *FS) handle(fh w.FileHandle) w.FileHandle {
+	h := &handle{FileHandle: fh, fs: fs}
+	if _, ok := fh.(w.Committer); ok {
+		return committer{h}
+	}
+	return h
+}
+
+type committer struct {
+	*handle
+}
+
+func (c committer) Commit() (w.FileInfo, error) {
+	var fi w.FileInfo
+	err := c.fs.call(func() (err error) {
+		fi, err = c.FileHandle.(w.Committer).Commit()
+		return err
+	})
+	return fi, err
+}
@@ -0,0 +1,133 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package breakerfs
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	w "github.com/google/go-webdav"
+	"github.com/google/go-webdav/fstest"
+	"github.com/google/go-webdav/memfs"
+)
+
+func TestConformance(t *testing.T) {
+	fstest.TestFileSystem(t, func(t *testing.T) w.FileSystem {
+		return New(memfs.NewMemFS(), Options{})
+	})
+}
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+// downFS wraps a FileSystem whose lookups fail while it is down, counting
+// them.
+type downFS struct {
+	w.FileSystem
+	down    bool
+	lookups int
+}
+
+type downPath struct {
+	w.Path
+	fs *downFS
+}
+
+func (fs *downFS) ForPath(p string) (w.Path, error) {
+	ip, err := fs.FileSystem.ForPath(p)
+	if err != nil {
+		return nil, err
+	}
+	return downPath{ip, fs}, nil
+}
+
+func (p downPath) Lookup() (w.File, error) {
+	p.fs.lookups++
+	if p.fs.down {
+		return nil, errors.New("connection refused")
+	}
+	return p.Path.Lookup()
+}
+
+func TestBreaker(t *testing.T) {
+	inner := &downFS{FileSystem: memfs.NewMemFS()}
+	clock := &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	fs := New(inner, Options{Failures: 3, Cooldown: time.Minute, Clock: clock})
+	h := w.NewWebDAV(fs)
+	do := func(method, p, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, p, strings.NewReader(body)))
+		return rec
+	}
+
+	do("PUT", "/a", "hello")
+	for i := 0; i < 3; i++ {
+		if rec := do("GET", "/missing", ""); rec.Code != http.StatusNotFound {
+			t.Fatalf("GET of a missing file got %d, want 404", rec.Code)
+		}
+	}
+	if st := fs.Stats(); st.State != Closed || st.Failures != 0 {
+		t.Errorf("Stats after files not found = %+v, want closed", st)
+	}
+
+	inner.down = true
+	for i := 0; i < 3; i++ {
+		if rec := do("GET", "/a", ""); rec.Code == http.StatusOK {
+			t.Error("GET while down succeeded")
+		}
+	}
+	if st := fs.Stats(); st.State != Open || st.Trips != 1 {
+		t.Errorf("Stats after failures = %+v, want open once", st)
+	}
+	lookups := inner.lookups
+	rec := do("GET", "/a", "")
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "60" {
+		t.Errorf("GET while open got %d, Retry-After %q, want 503 after 60", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if inner.lookups != lookups {
+		t.Error("GET while open reached the backend")
+	}
+
+	// A failed probe opens the breaker again.
+	clock.now = clock.now.Add(time.Minute)
+	if st := fs.Stats(); st.State != HalfOpen {
+		t.Errorf("State after the cooldown = %s, want half-open", st.State)
+	}
+	if rec := do("GET", "/a", ""); rec.Code == http.StatusOK || rec.Code == http.StatusServiceUnavailable {
+		t.Errorf("GET probing while down got %d", rec.Code)
+	}
+	if rec := do("GET", "/a", ""); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("GET after a failed probe got %d, want 503", rec.Code)
+	}
+
+	inner.down = false
+	clock.now = clock.now.Add(time.Minute)
+	if rec := do("GET", "/a", ""); rec.Code != http.StatusOK || rec.Body.String() != "hello" {
+		t.Errorf("GET probing once up got %d %q", rec.Code, rec.Body)
+	}
+	st := fs.Stats()
+	if st.State != Closed || st.Trips != 2 || st.Probes != 2 || st.Rejected != 2 {
+		t.Errorf("Stats once up = %+v, want closed after 2 trips, 2 probes, 2 rejections", st)
+	}
+}
@@ -0,0 +1,585 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package cachefs is a read-through cache wrapping a slow webdav.FileSystem,
+such as a remote one. It caches lookups, listings, FileInfo and properties,
+and optionally the content of small files and which paths do not exist, for
+a limited time. Mutations made through the cache invalidate the affected
+entries, and changes made through other handlers sharing the backend can be
+applied with Watch.
+*/
+package cachefs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	w "github.com/google/go-webdav"
+	wp "github.com/google/go-webdav/path"
+)
+
+// DefaultTTL is used when Options.TTL is zero.
+const DefaultTTL = 10 * time.Second
+
+// Options configure a cache.
+type Options struct {
+	// TTL bounds how long cached results are used.
+	TTL time.Duration
+	// MaxContentSize enables caching the content of files up to the given
+	// size in bytes, zero disables content caching.
+	MaxContentSize int64
+	// NegativeTTL enables caching that paths were not found, as sync
+	// clients probe many nonexistent paths, zero disables it.
+	NegativeTTL time.Duration
+	// MaxEntries bounds the number of files cached, zero means
+	// DefaultMaxEntries. The files cached longest are evicted first.
+	MaxEntries int
+}
+
+// DefaultMaxEntries is used when Options.MaxEntries is zero.
+const DefaultMaxEntries = 10000
+
+// negativeCacheSize bounds the number of paths remembered as not found.
+const negativeCacheSize = 4096
+
+// FS is a caching webdav.FileSystem.
+type FS struct {
+	inner      w.FileSystem
+	ttl        time.Duration
+	max        int64
+	negTTL     time.Duration
+	maxEntries int
+
+	m        sync.Mutex
+	entries  map[string]*entry
+	listings map[listingKey]*listing
+	missing  map[string]time.Time
+}
+
+type entry struct {
+	f       w.File
+	expires time.Time
+
+	m       sync.Mutex
+	stat    *w.FileInfo
+	tag     *string
+	props   map[string]propValue
+	content []byte
+}
+
+type propValue struct {
+	v  string
+	ok bool
+}
+
+type listingKey struct {
+	path  string
+	depth int
+}
+
+type listing struct {
+	paths   []string
+	expires time.Time
+}
+
+// New wraps a FileSystem with a cache.
+func New(inner w.FileSystem, opts Options) *FS {
+	ttl := opts.TTL
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+	maxEntries := opts.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = DefaultMaxEntries
+	}
+	return &FS{
+		inner:      inner,
+		ttl:        ttl,
+		max:        opts.MaxContentSize,
+		negTTL:     opts.NegativeTTL,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*entry),
+		listings:   make(map[listingKey]*listing),
+		missing:    make(map[string]time.Time),
+	}
+}
+
+// ForPath implements webdav.FileSystem.
+func (fs *FS) ForPath(p string) (w.Path, error) {
+	ip, err := fs.inner.ForPath(p)
+	if err != nil {
+		return nil, err
+	}
+	return &cpath{fs: fs, inner: ip}, nil
+}
+
+// Dump implements webdav.FileSystem, dumping the inner FileSystem.
+func (fs *FS) Dump(out io.Writer, format w.DumpFormat) error {
+	return fs.inner.Dump(out, format)
+}
+
+// Invalidate drops cached results for the given path, everything below
+// it, its parent, and the listings containing it.
+func (fs *FS) Invalidate(p string) {
+	fs.m.Lock()
+	defer fs.m.Unlock()
+	delete(fs.entries, path.Dir(p))
+	for ep := range fs.entries {
+		if wp.InTree(ep, p) {
+			delete(fs.entries, ep)
+		}
+	}
+	for k := range fs.listings {
+		if wp.InTree(k.path, p) || wp.InTree(p, k.path) {
+			delete(fs.listings, k)
+		}
+	}
+	for mp := range fs.missing {
+		if wp.InTree(mp, p) {
+			delete(fs.missing, mp)
+		}
+	}
+}
+
+// Watch invalidates cached results as changes are received, such as from
+// webdav.WebDAV.Subscribe on another handler sharing the inner FileSystem,
+// until the channel is closed.
+func (fs *FS) Watch(changes <-chan w.Change) {
+	for c := range changes {
+		fs.Invalidate(c.Path)
+		if c.Destination != "" {
+			fs.Invalidate(c.Destination)
+		}
+	}
+}
+
+// lookup gets the cached entry for a path, if it has not expired.
+func (fs *FS) lookup(p string) (*entry, bool) {
+	fs.m.Lock()
+	defer fs.m.Unlock()
+	e, ok := fs.entries[p]
+	if !ok || time.Now().After(e.expires) {
+		return nil, false
+	}
+	return e, true
+}
+
+// isMissing determines if a path was recently not found.
+func (fs *FS) isMissing(p string) bool {
+	if fs.negTTL <= 0 {
+		return false
+	}
+	fs.m.Lock()
+	defer fs.m.Unlock()
+	exp, ok := fs.missing[p]
+	return ok && time.Now().Before(exp)
+}
+
+// notFound records the result of a failed lookup, if it was not found.
+func (fs *FS) notFound(p string, err error) {
+	if fs.negTTL <= 0 || !errors.Is(w.FromOSError(err), w.ErrorNotFound) {
+		return
+	}
+	now := time.Now()
+	fs.m.Lock()
+	defer fs.m.Unlock()
+	if len(fs.missing) >= negativeCacheSize {
+		for mp, exp := range fs.missing {
+			if now.After(exp) {
+				delete(fs.missing, mp)
+			}
+		}
+		if len(fs.missing) >= negativeCacheSize {
+			fs.missing = make(map[string]time.Time)
+		}
+	}
+	fs.missing[p] = now.Add(fs.negTTL)
+}
+
+// add caches a file found in the inner FileSystem.
+func (fs *FS) add(f w.File) *entry {
+	now := time.Now()
+	e := &entry{f: f, expires: now.Add(fs.ttl)}
+	fs.m.Lock()
+	defer fs.m.Unlock()
+	if len(fs.entries) >= fs.maxEntries {
+		fs.evict(now)
+	}
+	fs.entries[f.GetPath()] = e
+	return e
+}
+
+// evict makes room in a full cache, dropping expired results and then the
+// oldest quarter of the entries, so that the cost is amortized over the
+// following additions. It must be called with the mutex held.
+func (fs *FS) evict(now time.Time) {
+	for ep, e := range fs.entries {
+		if now.After(e.expires) {
+			delete(fs.entries, ep)
+		}
+	}
+	for k, l := range fs.listings {
+		if now.After(l.expires) {
+			delete(fs.listings, k)
+		}
+	}
+	if len(fs.entries) < fs.maxEntries {
+		return
+	}
+	byAge := make([]string, 0, len(fs.entries))
+	for ep := range fs.entries {
+		byAge = append(byAge, ep)
+	}
+	sort.Slice(byAge, func(i, j int) bool {
+		return fs.entries[byAge[i]].expires.Before(fs.entries[byAge[j]].expires)
+	})
+	for _, ep := range byAge[:len(byAge)-fs.maxEntries*3/4] {
+		delete(fs.entries, ep)
+	}
+}
+
+type cpath struct {
+	fs    *FS
+	inner w.Path
+}
+
+func (p *cpath) String() string {
+	return p.inner.String()
+}
+
+func (p *cpath) Parent() w.Path {
+	return &cpath{fs: p.fs, inner: p.inner.Parent()}
+}
+
+func (p *cpath) Lookup() (w.File, error) {
+	if e, ok := p.fs.lookup(p.String()); ok {
+		return &cfile{fs: p.fs, e: e}, nil
+	}
+	if p.fs.isMissing(p.String()) {
+		return nil, w.ErrorNotFound
+	}
+	f, err := p.inner.Lookup()
+	if err != nil {
+		p.fs.notFound(p.String(), err)
+		return nil, err
+	}
+	return &cfile{fs: p.fs, e: p.fs.add(f)}, nil
+}
+
+// CheckSpace implements webdav.SpaceChecker if the inner Path does.
+func (p *cpath) CheckSpace(size int64) error {
+	if sc, ok := p.inner.(w.SpaceChecker); ok {
+		return sc.CheckSpace(size)
+	}
+	return nil
+}
+
+// Exists implements webdav.Exister, answering from the cache where
+// possible, and otherwise from the inner Path if it implements it.
+func (p *cpath) Exists() (bool, error) {
+	if _, ok := p.fs.lookup(p.String()); ok {
+		return true, nil
+	}
+	if p.fs.isMissing(p.String()) {
+		return false, nil
+	}
+	ex, ok := p.inner.(w.Exister)
+	if !ok {
+		_, err := p.Lookup()
+		if errors.Is(w.FromOSError(err), w.ErrorNotFound) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	exists, err := ex.Exists()
+	if err == nil && !exists {
+		p.fs.notFound(p.String(), w.ErrorNotFound)
+	}
+	return exists, err
+}
+
+func (p *cpath) LookupSubtree(depth int) ([]w.File, error) {
+	if files, ok := p.cachedSubtree(depth); ok {
+		return files, nil
+	}
+
+	if p.fs.isMissing(p.String()) {
+		return nil, w.ErrorNotFound
+	}
+	inner, err := p.inner.LookupSubtree(depth)
+	if err != nil {
+		p.fs.notFound(p.String(), err)
+		return nil, err
+	}
+	files := make([]w.File, len(inner))
+	l := &listing{expires: time.Now().Add(p.fs.ttl)}
+	for i, f := range inner {
+		files[i] = &cfile{fs: p.fs, e: p.fs.add(f)}
+		l.paths = append(l.paths, f.GetPath())
+	}
+	p.fs.m.Lock()
+	p.fs.listings[listingKey{p.String(), depth}] = l
+	p.fs.m.Unlock()
+	return files, nil
+}
+
+// cachedSubtree gets a listing from the cache, if it and all of the files
+// in it are cached.
+func (p *cpath) cachedSubtree(depth int) ([]w.File, bool) {
+	p.fs.m.Lock()
+	l, ok := p.fs.listings[listingKey{p.String(), depth}]
+	p.fs.m.Unlock()
+	if !ok || time.Now().After(l.expires) {
+		return nil, false
+	}
+	files := make([]w.File, len(l.paths))
+	for i, fp := range l.paths {
+		e, ok := p.fs.lookup(fp)
+		if !ok {
+			return nil, false
+		}
+		files[i] = &cfile{fs: p.fs, e: e}
+	}
+	return files, true
+}
+
+func (p *cpath) Mkdir() (w.File, error) {
+	defer p.fs.Invalidate(p.String())
+	f, err := p.inner.Mkdir()
+	if err != nil {
+		return nil, err
+	}
+	return &cfile{fs: p.fs, e: &entry{f: f}}, nil
+}
+
+func (p *cpath) Create() (w.File, w.FileHandle, error) {
+	defer p.fs.Invalidate(p.String())
+	f, fh, err := p.inner.Create()
+	if err != nil {
+		return nil, nil, err
+	}
+	return &cfile{fs: p.fs, e: &entry{f: f}}, p.fs.handle(fh, p.String()), nil
+}
+
+func (p *cpath) CopyTo(dst w.Path, opt w.CopyOptions) (bool, error) {
+	dp, ok := dst.(*cpath)
+	if !ok {
+		return false, w.ErrorBadHost
+	}
+	defer p.fs.Invalidate(dp.String())
+	if opt.Move {
+		defer p.fs.Invalidate(p.String())
+	}
+	return p.inner.CopyTo(dp.inner, opt)
+}
+
+func (p *cpath) Remove() error {
+	defer p.fs.Invalidate(p.String())
+	return p.inner.Remove()
+}
+
+func (p *cpath) RecursiveRemove() map[string]error {
+	defer p.fs.Invalidate(p.String())
+	return p.inner.RecursiveRemove()
+}
+
+// cfile is a File whose metadata is cached.
+type cfile struct {
+	fs *FS
+	e  *entry
+}
+
+func (f *cfile) GetPath() string {
+	return f.e.f.GetPath()
+}
+
+func (f *cfile) IsDirectory() bool {
+	return f.e.f.IsDirectory()
+}
+
+func (f *cfile) Stat() (w.FileInfo, error) {
+	f.e.m.Lock()
+	defer f.e.m.Unlock()
+	if f.e.stat != nil {
+		return *f.e.stat, nil
+	}
+	fi, err := f.e.f.Stat()
+	if err != nil {
+		return fi, err
+	}
+	f.e.stat = &fi
+	return fi, nil
+}
+
+func (f *cfile) Open() (w.FileHandle, error) {
+	f.e.m.Lock()
+	content := f.e.content
+	f.e.m.Unlock()
+	if content != nil {
+		return &bytesHandle{bytes.NewReader(content)}, nil
+	}
+
+	fh, err := f.e.f.Open()
+	if err != nil || f.fs.max <= 0 {
+		return fh, err
+	}
+	fi, err := f.Stat()
+	if err != nil || fi.Size > f.fs.max {
+		return fh, nil
+	}
+	defer fh.Close()
+	content, err = io.ReadAll(io.LimitReader(fh, f.fs.max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) <= f.fs.max {
+		f.e.m.Lock()
+		f.e.content = content
+		f.e.m.Unlock()
+	}
+	return &bytesHandle{bytes.NewReader(content)}, nil
+}
+
+func (f *cfile) Truncate() (w.FileHandle, error) {
+	p := f.GetPath()
+	defer f.fs.Invalidate(p)
+	fh, err := f.e.f.Truncate()
+	if err != nil {
+		return nil, err
+	}
+	return f.fs.handle(fh, p), nil
+}
+
+// Update implements webdav.Updater if the inner File does.
+func (f *cfile) Update() (w.FileHandle, error) {
+	u, ok := f.e.f.(w.Updater)
+	if !ok {
+		return nil, w.ErrorNotImplemented
+	}
+	p := f.GetPath()
+	defer f.fs.Invalidate(p)
+	fh, err := u.Update()
+	if err != nil {
+		return nil, err
+	}
+	return f.fs.handle(fh, p), nil
+}
+
+func (f *cfile) PatchProp(set, remove map[string]string) error {
+	defer f.fs.Invalidate(f.GetPath())
+	return f.e.f.PatchProp(set, remove)
+}
+
+func (f *cfile) GetProp(k string) (string, bool) {
+	f.e.m.Lock()
+	defer f.e.m.Unlock()
+	if pv, ok := f.e.props[k]; ok {
+		return pv.v, pv.ok
+	}
+	v, ok := f.e.f.GetProp(k)
+	if f.e.props == nil {
+		f.e.props = make(map[string]propValue)
+	}
+	f.e.props[k] = propValue{v, ok}
+	return v, ok
+}
+
+// PropNames implements webdav.PropLister if the inner File does.
+func (f *cfile) PropNames() []string {
+	if pl, ok := f.e.f.(w.PropLister); ok {
+		return pl.PropNames()
+	}
+	return nil
+}
+
+// ETag implements webdav.ETagger if the inner File does.
+func (f *cfile) ETag() (string, error) {
+	et, ok := f.e.f.(w.ETagger)
+	if !ok {
+		return "", w.ErrorNotFound
+	}
+	f.e.m.Lock()
+	defer f.e.m.Unlock()
+	if f.e.tag != nil {
+		return *f.e.tag, nil
+	}
+	tag, err := et.ETag()
+	if err != nil {
+		return "", err
+	}
+	f.e.tag = &tag
+	return tag, nil
+}
+
+// Representation implements webdav.Representer if the inner File does,
+// the representation being served uncached.
+func (f *cfile) Representation() (w.File, error) {
+	if r, ok := f.e.f.(w.Representer); ok {
+		return r.Representation()
+	}
+	return nil, w.ErrorNotFound
+}
+
+// handle invalidates the file it writes when closed, as writes may have
+// happened after it was invalidated on opening.
+type handle struct {
+	w.FileHandle
+	fs   *FS
+	path string
+}
+
+func (h *handle) Close() error {
+	defer h.fs.Invalidate(h.path)
+	return h.FileHandle.Close()
+}
+
+// handle wraps a FileHandle of the wrapped FileSystem, keeping the
+// webdav.Committer it may implement.
+func (fs *FS) handle(fh w.FileHandle, p string) w.FileHandle {
+	h := &handle{FileHandle: fh, fs: fs, path: p}
+	if _, ok := fh.(w.Committer); ok {
+		return committer{h}
+	}
+	return h
+}
+
+type committer struct {
+	*handle
+}
+
+func (c committer) Commit() (w.FileInfo, error) {
+	defer c.fs.Invalidate(c.path)
+	return c.FileHandle.(w.Committer).Commit()
+}
+
+var errReadOnly = errors.New("cachefs: cached content is read-only")
+
+// bytesHandle is a read-only FileHandle over cached content.
+type bytesHandle struct {
+	*bytes.Reader
+}
+
+func (h *bytesHandle) Write([]byte) (int, error) {
+	return 0, errReadOnly
+}
+
+func (h *bytesHandle) Close() error {
+	return nil
+}
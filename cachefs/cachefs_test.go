@@ -0,0 +1,194 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cachefs
+
+import (
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	w "github.com/google/go-webdav"
+	"github.com/google/go-webdav/fstest"
+	"github.com/google/go-webdav/memfs"
+)
+
+// countingFS counts the lookups reaching the inner FileSystem.
+type countingFS struct {
+	w.FileSystem
+	lookups int
+}
+
+func (fs *countingFS) ForPath(p string) (w.Path, error) {
+	ip, err := fs.FileSystem.ForPath(p)
+	if err != nil {
+		return nil, err
+	}
+	return countingPath{ip, fs}, nil
+}
+
+type countingPath struct {
+	w.Path
+	fs *countingFS
+}
+
+func (p countingPath) Lookup() (w.File, error) {
+	p.fs.lookups++
+	return p.Path.Lookup()
+}
+
+func (p countingPath) LookupSubtree(depth int) ([]w.File, error) {
+	p.fs.lookups++
+	return p.Path.LookupSubtree(depth)
+}
+
+func put(t *testing.T, fs w.FileSystem, p, content string) {
+	wp, err := fs.ForPath(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fh w.FileHandle
+	if f, err := wp.Lookup(); err == nil {
+		fh, err = f.Truncate()
+		if err != nil {
+			t.Fatal(err)
+		}
+	} else if _, fh, err = wp.Create(); err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(fh, content)
+	fh.Close()
+}
+
+func read(t *testing.T, fs w.FileSystem, p string) string {
+	wp, _ := fs.ForPath(p)
+	f, err := wp.Lookup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fh, err := f.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	b, _ := io.ReadAll(fh)
+	return string(b)
+}
+
+func TestCache(t *testing.T) {
+	inner := &countingFS{FileSystem: memfs.NewMemFS()}
+	fs := New(inner, Options{TTL: time.Hour, MaxContentSize: 1024})
+	put(t, fs, "/a", "one")
+
+	inner.lookups = 0
+	for i := 0; i < 3; i++ {
+		if got := read(t, fs, "/a"); got != "one" {
+			t.Fatalf("expected one, got %q", got)
+		}
+		root, _ := fs.ForPath("/")
+		if files, err := root.LookupSubtree(1); err != nil || len(files) != 2 {
+			t.Fatalf("expected 2 files, got %d: %v", len(files), err)
+		}
+	}
+	if inner.lookups != 2 {
+		t.Errorf("expected 2 inner lookups, got %d", inner.lookups)
+	}
+
+	put(t, fs, "/a", "two")
+	if got := read(t, fs, "/a"); got != "two" {
+		t.Errorf("expected write through the cache to invalidate it, got %q", got)
+	}
+
+	put(t, inner, "/a", "three")
+	if got := read(t, fs, "/a"); got != "two" {
+		t.Errorf("expected stale content before invalidation, got %q", got)
+	}
+	changes := make(chan w.Change, 1)
+	changes <- w.Change{Kind: w.ChangeModified, Path: "/a"}
+	close(changes)
+	fs.Watch(changes)
+	if got := read(t, fs, "/a"); got != "three" {
+		t.Errorf("expected change to invalidate the cache, got %q", got)
+	}
+}
+
+func TestMaxEntries(t *testing.T) {
+	inner := &countingFS{FileSystem: memfs.NewMemFS()}
+	fs := New(inner, Options{TTL: time.Hour, MaxEntries: 4})
+	for i := 0; i < 8; i++ {
+		p := fmt.Sprintf("/f%d", i)
+		put(t, inner, p, "x")
+		read(t, fs, p)
+	}
+	if n := len(fs.entries); n > 4 {
+		t.Errorf("%d entries cached, want at most 4", n)
+	}
+
+	inner.lookups = 0
+	read(t, fs, "/f7")
+	if inner.lookups != 0 {
+		t.Error("expected the latest entry to remain cached")
+	}
+	read(t, fs, "/f0")
+	if inner.lookups != 1 {
+		t.Error("expected the oldest entry to be evicted")
+	}
+}
+
+func TestNegativeCache(t *testing.T) {
+	inner := &countingFS{FileSystem: memfs.NewMemFS()}
+	fs := New(inner, Options{TTL: time.Hour, NegativeTTL: time.Hour})
+
+	p, _ := fs.ForPath("/missing")
+	for i := 0; i < 3; i++ {
+		if _, err := p.Lookup(); err == nil {
+			t.Fatal("expected /missing not to be found")
+		}
+	}
+	if inner.lookups != 1 {
+		t.Errorf("expected 1 inner lookup, got %d", inner.lookups)
+	}
+
+	put(t, fs, "/missing", "found")
+	if got := read(t, fs, "/missing"); got != "found" {
+		t.Errorf("expected creation to invalidate the negative entry, got %q", got)
+	}
+}
+
+func TestExists(t *testing.T) {
+	inner := &countingFS{FileSystem: memfs.NewMemFS()}
+	fs := New(inner, Options{TTL: time.Hour, NegativeTTL: time.Hour})
+	put(t, fs, "/a", "a")
+	inner.lookups = 0
+
+	for _, tt := range []struct {
+		p    string
+		want bool
+	}{{"/a", true}, {"/missing", false}, {"/a", true}, {"/missing", false}} {
+		p, _ := fs.ForPath(tt.p)
+		if got, err := p.(w.Exister).Exists(); err != nil || got != tt.want {
+			t.Errorf("Exists(%s) = %v, %v, want %v", tt.p, got, err, tt.want)
+		}
+	}
+	if inner.lookups != 2 {
+		t.Errorf("expected 2 inner lookups, got %d", inner.lookups)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	fstest.TestFileSystem(t, func(t *testing.T) w.FileSystem {
+		return New(memfs.NewMemFS(), Options{})
+	})
+}
@@ -0,0 +1,197 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+)
+
+// PropChecker may optionally be implemented by a FileSystem keeping dead
+// properties apart from the resources they describe, as osfs does in
+// sidecar files, which are left behind by resources removed other than
+// through the FileSystem.
+type PropChecker interface {
+	// OrphanedProps gets the paths which do not exist but still have
+	// properties kept, ordered by path.
+	OrphanedProps() ([]string, error)
+	// RemoveOrphanedProps removes the properties kept for a path which
+	// does not exist.
+	RemoveOrphanedProps(p string) error
+}
+
+// CheckOptions selects the repairs made by Check, which only reports the
+// inconsistencies found by default.
+type CheckOptions struct {
+	// RemoveStaleLocks unlocks the locks of resources which do not exist.
+	RemoveStaleLocks bool
+	// RemoveOrphanedProps removes the properties kept for resources which
+	// do not exist, if the FileSystem implements PropChecker.
+	RemoveOrphanedProps bool
+}
+
+// JournalGap is a range of sequence numbers missing from the journal, the
+// changes of which failed to be appended. Clients syncing across a gap miss
+// those changes, so sync tokens from before it should be discarded.
+type JournalGap struct {
+	From uint64 `json:"from"`
+	To   uint64 `json:"to"`
+}
+
+// CheckReport lists the inconsistencies found by Check.
+type CheckReport struct {
+	// StaleLocks are the locks of resources which do not exist.
+	StaleLocks []LockState `json:"stale_locks,omitempty"`
+	// OrphanedProps are the paths which do not exist but have properties.
+	OrphanedProps []string `json:"orphaned_props,omitempty"`
+	// JournalGaps are the ranges of changes missing from the journal,
+	// which cannot be repaired.
+	JournalGaps []JournalGap `json:"journal_gaps,omitempty"`
+	// Repaired counts the stale locks and orphaned properties removed.
+	Repaired int `json:"repaired"`
+}
+
+// Check verifies that the locks, dead properties and journal of the handler
+// agree with the FileSystem, which they may not when they are kept in
+// separate stores, such as a LockStore, or when the FileSystem is changed
+// other than through the handler. It repairs what opts selects, reporting
+// everything found, including what was repaired.
+func (s *WebDAV) Check(opts CheckOptions) (CheckReport, error) {
+	var rep CheckReport
+	for _, l := range s.Snapshot().Locks {
+		ok, err := s.exists(l.Path)
+		if err != nil {
+			return rep, err
+		}
+		if ok {
+			continue
+		}
+		rep.StaleLocks = append(rep.StaleLocks, l)
+		if opts.RemoveStaleLocks {
+			if err := s.lm.unlock(l.Token); err != nil {
+				return rep, err
+			}
+			rep.Repaired++
+		}
+	}
+
+	if pc, ok := s.fs.(PropChecker); ok {
+		orphans, err := pc.OrphanedProps()
+		if err != nil {
+			return rep, err
+		}
+		rep.OrphanedProps = orphans
+		if opts.RemoveOrphanedProps {
+			for _, p := range orphans {
+				if err := pc.RemoveOrphanedProps(p); err != nil {
+					return rep, err
+				}
+				rep.Repaired++
+			}
+		}
+	}
+
+	gaps, err := s.journalGaps()
+	rep.JournalGaps = gaps
+	return rep, err
+}
+
+// exists determines if a resource exists, forks stored as properties
+// existing along with the files they belong to.
+func (s *WebDAV) exists(p string) (bool, error) {
+	if owner, _, ok := forkOf(p); ok && s.forks == ForksAsProps {
+		p = owner
+	}
+	fp, err := s.fs.ForPath(p)
+	if err != nil {
+		return false, nil
+	}
+	if _, err := fp.Lookup(); err != nil {
+		if errors.Is(FromOSError(err), ErrorNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// journalGaps finds the changes missing from the journal, both between
+// those it holds and after the latest of them. The oldest changes dropped
+// by a bounded journal are not gaps.
+func (s *WebDAV) journalGaps() ([]JournalGap, error) {
+	last := s.journalSeq()
+	store := s.journal.store
+	changes, err := store.Since(0)
+	if errors.Is(err, ErrJournalTruncated) {
+		// Find the oldest change still held.
+		lo, hi := uint64(0), last
+		for lo < hi {
+			mid := lo + (hi-lo)/2
+			if _, err := store.Since(mid); errors.Is(err, ErrJournalTruncated) {
+				lo = mid + 1
+			} else if err != nil {
+				return nil, err
+			} else {
+				hi = mid
+			}
+		}
+		changes, err = store.Since(lo)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Seq < changes[j].Seq })
+
+	var gaps []JournalGap
+	var prev uint64
+	for i, c := range changes {
+		if i > 0 && c.Seq > prev+1 {
+			gaps = append(gaps, JournalGap{From: prev + 1, To: c.Seq - 1})
+		}
+		prev = c.Seq
+	}
+	if last > prev {
+		gaps = append(gaps, JournalGap{From: prev + 1, To: last})
+	}
+	return gaps, nil
+}
+
+// serveCheck serves the /checkz debug endpoint, reporting the result of
+// Check as JSON. POST requests make all the repairs, unless the handler is
+// read-only.
+func (s *WebDAV) serveCheck(w http.ResponseWriter, r *http.Request) {
+	var opts CheckOptions
+	switch {
+	case r.Method == "POST" && s.ReadOnly:
+		w.WriteHeader(http.StatusForbidden)
+		return
+	case r.Method == "POST":
+		opts = CheckOptions{RemoveStaleLocks: true, RemoveOrphanedProps: true}
+	case r.Method != "GET":
+		w.Header().Set("Allow", "GET, POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	rep, err := s.Check(opts)
+	if err != nil {
+		s.logger.Printf("check failed: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rep)
+}
@@ -0,0 +1,80 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+// flakyJournal fails to append the changes with the given sequence numbers.
+type flakyJournal struct {
+	*webdav.MemoryJournal
+	fail map[uint64]bool
+}
+
+func (j flakyJournal) Append(c webdav.Change) error {
+	if j.fail[c.Seq] {
+		return errors.New("disk full")
+	}
+	return j.MemoryJournal.Append(c)
+}
+
+func TestCheck(t *testing.T) {
+	fs := memfs.NewMemFS()
+	journal := flakyJournal{webdav.NewMemoryJournal(100), map[uint64]bool{2: true, 3: true, 5: true}}
+	h := webdav.NewWebDAV(fs, webdav.WithJournal(journal), webdav.WithDebug())
+	for _, p := range []string{"/a", "/b", "/c", "/d", "/e"} {
+		serve(h, "PUT", p, "x")
+	}
+	const lockBody = `<lockinfo xmlns="DAV:"><lockscope><exclusive/></lockscope><locktype><write/></locktype></lockinfo>`
+	for _, p := range []string{"/a", "/b"} {
+		if w := serve(h, "LOCK", p, lockBody); w.Code != http.StatusOK {
+			t.Fatalf("LOCK %s got %d", p, w.Code)
+		}
+	}
+	// Removed behind the handler's back.
+	fp, _ := fs.ForPath("/a")
+	if err := fp.Remove(); err != nil {
+		t.Fatal(err)
+	}
+
+	rep, err := h.Check(webdav.CheckOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.StaleLocks) != 1 || rep.StaleLocks[0].Path != "/a" || rep.Repaired != 0 {
+		t.Errorf("stale locks got %+v", rep)
+	}
+	want := []webdav.JournalGap{{From: 2, To: 3}, {From: 5, To: 5}}
+	if len(rep.JournalGaps) != 2 || rep.JournalGaps[0] != want[0] || rep.JournalGaps[1] != want[1] {
+		t.Errorf("journal gaps got %+v, want %+v", rep.JournalGaps, want)
+	}
+
+	if w := serve(h, "POST", "/checkz", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"repaired":1`) {
+		t.Errorf("POST /checkz got %d %s", w.Code, w.Body)
+	}
+	if locks := h.Snapshot().Locks; len(locks) != 1 || locks[0].Path != "/b" {
+		t.Errorf("locks after repair got %+v, want only that of /b", locks)
+	}
+	if rep, err := h.Check(webdav.CheckOptions{}); err != nil || len(rep.StaleLocks) != 0 {
+		t.Errorf("Check after repair got %+v, %v", rep, err)
+	}
+}
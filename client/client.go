@@ -0,0 +1,194 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package client is a WebDAV client. Requests are made for paths below the
+base URL of a Client, and fail with a *StatusError for error responses:
+
+	c, err := client.New("https://example.com/dav/", nil)
+	...
+	lm := client.NewLockManager(c, time.Minute)
+	err = lm.WithLock(ctx, "/doc.txt", func(ctx context.Context) error {
+		resp, err := c.Do(ctx, "PUT", "/doc.txt", body, nil)
+		...
+	})
+
+Requests made while locks are held through a LockManager carry an If
+header submitting the tokens of the locks covering the requested path.
+A TransferManager gets and puts many files in parallel, and downloads
+large files in segments.
+*/
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/go-webdav/davhttp"
+)
+
+// Client makes WebDAV requests to a server.
+type Client struct {
+	hc    *http.Client
+	base  *url.URL
+	locks *LockManager
+	retry RetryPolicy
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// Option configures a Client, see New.
+type Option func(*Client)
+
+// New creates a Client for the resources below the given base URL, using
+// hc or http.DefaultClient if it is nil.
+func New(base string, hc *http.Client, opts ...Option) (*Client, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	if !u.IsAbs() {
+		return nil, fmt.Errorf("client: base URL %q is not absolute", base)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawPath = ""
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	c := &Client{hc: hc, base: u, sleep: sleep}
+	for _, o := range opts {
+		o(c)
+	}
+	return c, nil
+}
+
+// URL gets the URL of a path.
+func (c *Client) URL(p string) string {
+	u := *c.base
+	u.Path += path.Clean("/" + p)
+	return u.String()
+}
+
+// path maps a URL below the base URL to a path, returning the empty string
+// for others.
+func (c *Client) path(s string) string {
+	u, err := davhttp.ParseDestination(s)
+	if s == "" || err != nil || (u.Host != "" && u.Host != c.base.Host) {
+		return ""
+	}
+	if u.Path == c.base.Path {
+		return "/"
+	}
+	if !strings.HasPrefix(u.Path, c.base.Path+"/") {
+		return ""
+	}
+	return strings.TrimPrefix(u.Path, c.base.Path)
+}
+
+// StatusError is the error of a request which the server answered with
+// an error status.
+type StatusError struct {
+	Method, Path string
+	Code         int
+	Status       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("client: %s %s: %s", e.Method, e.Path, e.Status)
+}
+
+// Do makes a request for a path, with the given body and headers, which
+// may be nil. Responses with an error status are closed and returned as a
+// *StatusError, others must be closed by the caller. Failed requests are
+// retried as the Client's RetryPolicy allows, if their body can be sent
+// again, which it can for bodies of the types http.NewRequest knows.
+func (c *Client) Do(ctx context.Context, method, p string, body io.Reader, header http.Header) (*http.Response, error) {
+	r, err := http.NewRequestWithContext(ctx, method, c.URL(p), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	// The tokens of held locks are submitted, unless the caller submits
+	// its own. LOCK and UNLOCK name the locks they are for.
+	paths := []string{p}
+	if d := c.path(r.Header.Get(davhttp.Destination)); d != "" {
+		paths = append(paths, d)
+	}
+	submit := c.locks != nil && r.Header.Get(davhttp.If) == "" && method != "LOCK" && method != "UNLOCK"
+	if submit {
+		c.submit(r, paths)
+	}
+
+	var retries int
+	var recovered bool
+	for {
+		resp, err := c.hc.Do(r)
+		if err == nil && resp.StatusCode < 400 {
+			return resp, nil
+		}
+		var code int
+		if err == nil {
+			code = resp.StatusCode
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+			resp.Body.Close()
+		}
+
+		retry, wait := false, time.Duration(0)
+		switch {
+		case ctx.Err() != nil || (r.Body != nil && r.GetBody == nil):
+		case (code == http.StatusLocked || code == http.StatusPreconditionFailed) && submit && c.retry.RefreshLocks && !recovered:
+			recovered = true
+			if retry = c.locks.recover(ctx, paths...); retry {
+				c.submit(r, paths)
+			}
+		case code == http.StatusConflict && c.retry.CreateParents && !recovered && (method == "PUT" || method == "MKCOL"):
+			recovered = true
+			retry = c.mkParents(ctx, p) == nil
+		case retries < c.retry.MaxRetries && idempotent[method] && (retryableStatus[code] || timeout(err)):
+			wait, retry = c.retry.backoff(retries, resp)
+			retries++
+		}
+		if !retry {
+			if err != nil {
+				return nil, err
+			}
+			return nil, &StatusError{Method: method, Path: p, Code: code, Status: resp.Status}
+		}
+		if err := c.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+		if r.GetBody != nil {
+			if r.Body, err = r.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// submit sets the If header of a request to submit the tokens of the held
+// locks covering the given paths.
+func (c *Client) submit(r *http.Request, paths []string) {
+	if h := c.locks.If(paths...); h != "" {
+		r.Header.Set(davhttp.If, h)
+	} else {
+		r.Header.Del(davhttp.If)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+func newClient(t *testing.T) (*Client, string) {
+	srv := httptest.NewServer(webdav.NewWebDAV(memfs.NewMemFS(), webdav.WithPrefix("/dav")))
+	t.Cleanup(srv.Close)
+	c, err := New(srv.URL+"/dav/", srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, srv.URL
+}
+
+func put(ctx context.Context, c *Client, p, content string) error {
+	resp, err := c.Do(ctx, "PUT", p, strings.NewReader(content), nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func status(err error) int {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Code
+	}
+	return 0
+}
+
+func TestDo(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newClient(t)
+	if err := put(ctx, c, "/a b", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Do(ctx, "GET", "/missing", nil, nil); status(err) != http.StatusNotFound {
+		t.Errorf("GET of a missing file got %v, want a 404 StatusError", err)
+	}
+	if got, want := c.URL("/a b"), "/dav/a%20b"; !strings.HasSuffix(got, want) {
+		t.Errorf("URL got %q, want a suffix of %q", got, want)
+	}
+}
+
+func TestWithLock(t *testing.T) {
+	ctx := context.Background()
+	c, url := newClient(t)
+	other, _ := New(url+"/dav", nil)
+	lm := NewLockManager(c, time.Minute)
+	if err := put(ctx, c, "/a", "x"); err != nil {
+		t.Fatal(err)
+	}
+
+	err := lm.WithLock(ctx, "/", func(ctx context.Context) error {
+		if h := lm.If("/a"); h == "" {
+			t.Error("If got no tokens for a locked path")
+		}
+		if err := put(ctx, other, "/a", "other"); status(err) != webdav.StatusLocked {
+			t.Errorf("PUT without the lock got %v, want a 423 StatusError", err)
+		}
+		return put(ctx, c, "/a", "mine")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := lm.If("/a"); h != "" {
+		t.Errorf("If got %q after the lock was released", h)
+	}
+	if err := put(ctx, other, "/a", "other"); err != nil {
+		t.Errorf("PUT after the lock was released: %v", err)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newClient(t)
+	l, err := c.Lock(ctx, "/a", 0, time.Minute, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The server reports the time remaining, in whole seconds.
+	if l.Timeout < time.Minute-time.Second || l.Timeout > time.Minute {
+		t.Errorf("Lock got a timeout of %v, want a minute", l.Timeout)
+	}
+	if err := c.Refresh(ctx, l, 2*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if l.Timeout < 2*time.Minute-time.Second || l.Timeout > 2*time.Minute {
+		t.Errorf("Refresh got a timeout of %v, want two minutes", l.Timeout)
+	}
+	if err := c.Unlock(ctx, l); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Refresh(ctx, l, 0); err == nil {
+		t.Error("Refresh of a released lock succeeded")
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+
+	"github.com/google/go-webdav"
+	wp "github.com/google/go-webdav/path"
+)
+
+// Gateway is a webdav.RemoteCopier making WebDAV requests, so that a
+// handler serves COPY and MOVE requests to other servers, for migrating
+// between them:
+//
+//	h := webdav.NewWebDAV(fs, webdav.WithGateway(&client.Gateway{}, "old.example.com"))
+//
+// Files are put with their dead properties, collections made with MKCOL.
+type Gateway struct {
+	// HTTPClient makes the requests, http.DefaultClient if nil.
+	HTTPClient *http.Client
+	// Options configure the Client made for each copy.
+	Options []Option
+}
+
+// CopyRemote implements webdav.RemoteCopier.
+func (g *Gateway) CopyRemote(ctx context.Context, src webdav.Path, dst *url.URL, opt webdav.CopyOptions) (bool, error) {
+	c, err := New(dst.Scheme+"://"+dst.Host, g.HTTPClient, g.Options...)
+	if err != nil {
+		return false, webdav.ErrorBadDest.WithCause(err)
+	}
+	files, err := src.LookupSubtree(opt.Depth)
+	if err != nil {
+		return false, err
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].GetPath() < files[j].GetPath()
+	})
+
+	exists := true
+	resp, err := c.Do(ctx, "HEAD", dst.Path, nil, nil)
+	var se *StatusError
+	switch {
+	case errors.As(err, &se) && se.Code == http.StatusNotFound:
+		exists = false
+	case err != nil:
+		return false, remoteError(err)
+	default:
+		resp.Body.Close()
+	}
+	if exists {
+		if !opt.Overwrite {
+			return false, webdav.ErrorDestExists
+		}
+		resp, err := c.Do(ctx, "DELETE", dst.Path, nil, nil)
+		if err != nil {
+			return false, remoteError(err)
+		}
+		resp.Body.Close()
+	}
+
+	root := src.String()
+	for _, f := range files {
+		rel, ok := wp.Included(f.GetPath(), root, opt.Depth)
+		if !ok {
+			continue
+		}
+		if err := copyFile(ctx, c, f, path.Join(dst.Path, rel)); err != nil {
+			return false, remoteError(err)
+		}
+	}
+	return !exists, nil
+}
+
+// copyFile copies a file or collection, without its members, to a path.
+func copyFile(ctx context.Context, c *Client, f webdav.File, p string) error {
+	var resp *http.Response
+	if f.IsDirectory() {
+		var err error
+		if resp, err = c.Do(ctx, "MKCOL", p, nil, nil); err != nil {
+			return err
+		}
+	} else {
+		fh, err := f.Open()
+		if err != nil {
+			return err
+		}
+		resp, err = c.Do(ctx, "PUT", p, fh, nil)
+		fh.Close()
+		if err != nil {
+			return err
+		}
+	}
+	resp.Body.Close()
+
+	pl, ok := f.(webdav.PropLister)
+	if !ok {
+		return nil
+	}
+	set := make(map[string]string)
+	for _, n := range pl.PropNames() {
+		if v, ok := f.GetProp(n); ok {
+			set[n] = v
+		}
+	}
+	if len(set) == 0 {
+		return nil
+	}
+	return c.PropPatch(ctx, p, set, nil)
+}
+
+// remoteError maps the error of a request to the destination server to
+// that of the COPY or MOVE, which fails with 502 Bad Gateway unless the
+// destination was locked or missing its parent.
+func remoteError(err error) error {
+	var se *StatusError
+	if !errors.As(err, &se) {
+		return webdav.ErrorBadHost.WithCause(err)
+	}
+	switch se.Code {
+	case http.StatusConflict:
+		return webdav.ErrorMissingParent.WithCause(err)
+	case webdav.StatusLocked:
+		return webdav.ErrorLocked.WithCause(err)
+	case http.StatusInsufficientStorage:
+		return webdav.ErrorInsufficientStorage.WithCause(err)
+	}
+	return webdav.ErrorBadHost.WithCause(err)
+}
@@ -0,0 +1,98 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+func TestGateway(t *testing.T) {
+	ctx := context.Background()
+	remote, rurl := newClient(t)
+	u, _ := url.Parse(rurl)
+
+	gw := httptest.NewServer(webdav.NewWebDAV(memfs.NewMemFS(), webdav.WithGateway(&Gateway{}, u.Host)))
+	defer gw.Close()
+	local, err := New(gw.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := local.Do(ctx, "MKCOL", "/d", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if err := put(ctx, local, "/d/a", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	patch := `<propertyupdate xmlns="DAV:"><set><prop><color xmlns="urn:x">red</color></prop></set></propertyupdate>`
+	resp, err = local.Do(ctx, "PROPPATCH", "/d/a", strings.NewReader(patch), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	move := func(dst string, h ...string) (*http.Response, error) {
+		hdr := http.Header{"Destination": {dst}}
+		for i := 0; i < len(h); i += 2 {
+			hdr.Set(h[i], h[i+1])
+		}
+		return local.Do(ctx, "MOVE", "/d", nil, hdr)
+	}
+	resp, err = move(remote.URL("/e"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("MOVE to another server got %s, want 201", resp.Status)
+	}
+
+	resp, err = remote.Do(ctx, "GET", "/e/a", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(b) != "hello" {
+		t.Errorf("GET of the moved file got %q", b)
+	}
+	var e entry
+	if err := remote.PropFindInto(ctx, "/e/a", 0, &e); err != nil || e.Color != "red" {
+		t.Errorf("PropFindInto of the moved file got %+v, %v", e, err)
+	}
+	if _, err := local.Do(ctx, "GET", "/d/a", nil, nil); status(err) != http.StatusNotFound {
+		t.Errorf("GET of the moved source got %v, want a 404 StatusError", err)
+	}
+
+	if err := put(ctx, local, "/d", "again"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := move(remote.URL("/e"), "Overwrite", "F"); status(err) != http.StatusPreconditionFailed {
+		t.Errorf("MOVE onto an existing destination got %v, want a 412 StatusError", err)
+	}
+	if _, err := move("http://elsewhere.example.com/e"); status(err) != http.StatusBadGateway {
+		t.Errorf("MOVE to a host not allowed got %v, want a 502 StatusError", err)
+	}
+}
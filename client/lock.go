@@ -0,0 +1,301 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-webdav/davhttp"
+	wp "github.com/google/go-webdav/path"
+)
+
+// Lock is an exclusive write lock held on a resource.
+type Lock struct {
+	// Path is the root of the lock.
+	Path  string
+	Token string
+	Depth int
+	// Timeout is that granted by the server when the lock was taken, or
+	// last refreshed through Refresh, or davhttp.TimeoutInfinite.
+	Timeout time.Duration
+}
+
+// ifHeader gets an If header submitting the token of a lock rooted at p.
+func ifHeader(c *Client, p, token string) string {
+	return "<" + c.URL(p) + "> (<" + token + ">)"
+}
+
+var errNoToken = errors.New("client: LOCK response has no Lock-Token")
+
+// Lock locks a path, with the given depth, either 0 or
+// davhttp.DepthInfinity, requesting the given timeout, zero to leave it to
+// the server. Owner is XML identifying the owner of the lock, or empty.
+func (c *Client) Lock(ctx context.Context, p string, depth int, timeout time.Duration, owner string) (*Lock, error) {
+	h := http.Header{}
+	h.Set(davhttp.Depth, davhttp.FormatDepth(depth))
+	if timeout != 0 {
+		h.Set(davhttp.Timeout, davhttp.FormatTimeout(timeout))
+	}
+	h.Set("Content-Type", `application/xml; charset="utf-8"`)
+	body := `<?xml version="1.0" encoding="utf-8"?>
+<D:lockinfo xmlns:D="DAV:">
+  <D:lockscope><D:exclusive/></D:lockscope>
+  <D:locktype><D:write/></D:locktype>
+  <D:owner>` + owner + `</D:owner>
+</D:lockinfo>`
+	resp, err := c.Do(ctx, "LOCK", p, strings.NewReader(body), h)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	tok, err := davhttp.ParseLockToken(resp.Header.Get(davhttp.LockToken))
+	if err != nil {
+		return nil, errNoToken
+	}
+	l := &Lock{Path: path.Clean("/" + p), Token: tok, Depth: depth}
+	l.Timeout = grantedTimeout(resp, timeout)
+	return l, nil
+}
+
+// Refresh refreshes a lock, requesting the given timeout, zero to leave it
+// to the server.
+func (c *Client) Refresh(ctx context.Context, l *Lock, timeout time.Duration) error {
+	h := http.Header{}
+	h.Set(davhttp.If, ifHeader(c, l.Path, l.Token))
+	if timeout != 0 {
+		h.Set(davhttp.Timeout, davhttp.FormatTimeout(timeout))
+	}
+	resp, err := c.Do(ctx, "LOCK", l.Path, nil, h)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	l.Timeout = grantedTimeout(resp, timeout)
+	return nil
+}
+
+// Unlock releases a lock.
+func (c *Client) Unlock(ctx context.Context, l *Lock) error {
+	h := http.Header{}
+	h.Set(davhttp.LockToken, davhttp.FormatLockToken(l.Token))
+	resp, err := c.Do(ctx, "UNLOCK", l.Path, nil, h)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// lockDiscovery is the body of a LOCK response.
+type lockDiscovery struct {
+	Timeouts []string `xml:"lockdiscovery>activelock>timeout"`
+}
+
+// grantedTimeout gets the timeout of the lock of a LOCK response, which is
+// that requested if the response does not tell.
+func grantedTimeout(resp *http.Response, requested time.Duration) time.Duration {
+	var ld lockDiscovery
+	if err := xml.NewDecoder(resp.Body).Decode(&ld); err != nil || len(ld.Timeouts) == 0 {
+		return requested
+	}
+	ts, err := davhttp.ParseTimeout(strings.TrimSpace(ld.Timeouts[0]))
+	if err != nil || len(ts) == 0 {
+		return requested
+	}
+	return ts[0]
+}
+
+// DefaultRefreshTimeout is the timeout assumed for locks for which the
+// server reports none, to schedule their refreshes.
+const DefaultRefreshTimeout = time.Minute
+
+// LockManager holds locks for a Client, refreshing them in the background
+// until they are released. Requests the Client makes carry the tokens of
+// the locks covering the requested path.
+type LockManager struct {
+	c       *Client
+	timeout time.Duration
+
+	m    sync.Mutex
+	held map[*Lock]*heldLock
+}
+
+// heldLock is the state of a held Lock, whose token changes if it is taken
+// again, see recover.
+type heldLock struct {
+	token  string
+	cancel context.CancelFunc
+}
+
+// NewLockManager creates the LockManager of a Client, which requests locks
+// with the given timeout, zero to leave it to the server.
+func NewLockManager(c *Client, timeout time.Duration) *LockManager {
+	lm := &LockManager{
+		c:       c,
+		timeout: timeout,
+		held:    make(map[*Lock]*heldLock),
+	}
+	c.locks = lm
+	return lm
+}
+
+// Acquire locks a path and its members, refreshing the lock when half of
+// its timeout has passed until it is released.
+func (lm *LockManager) Acquire(ctx context.Context, p string) (*Lock, error) {
+	l, err := lm.c.Lock(ctx, p, davhttp.DepthInfinity, lm.timeout, "")
+	if err != nil {
+		return nil, err
+	}
+	rctx, cancel := context.WithCancel(context.Background())
+	lm.m.Lock()
+	lm.held[l] = &heldLock{token: l.Token, cancel: cancel}
+	lm.m.Unlock()
+	go lm.refresh(rctx, l)
+	return l, nil
+}
+
+// refresh refreshes a lock until ctx is done, which it is once the lock is
+// released, or it could not be refreshed. A copy of the lock is refreshed,
+// leaving that of Acquire's caller unchanged.
+func (lm *LockManager) refresh(ctx context.Context, l *Lock) {
+	rl := *l
+	for rl.Timeout != davhttp.TimeoutInfinite {
+		rl.Token = lm.token(l)
+		d := rl.Timeout
+		if d <= 0 {
+			d = DefaultRefreshTimeout
+		}
+		t := time.NewTimer(d / 2)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		if err := lm.c.Refresh(ctx, &rl, lm.timeout); err != nil {
+			lm.forget(l)
+			return
+		}
+	}
+}
+
+// token gets the current token of a held lock.
+func (lm *LockManager) token(l *Lock) string {
+	lm.m.Lock()
+	defer lm.m.Unlock()
+	if h, ok := lm.held[l]; ok {
+		return h.token
+	}
+	return l.Token
+}
+
+// forget stops refreshing a lock and submitting its token, returning its
+// current token.
+func (lm *LockManager) forget(l *Lock) string {
+	lm.m.Lock()
+	defer lm.m.Unlock()
+	h, ok := lm.held[l]
+	if !ok {
+		return l.Token
+	}
+	h.cancel()
+	delete(lm.held, l)
+	return h.token
+}
+
+// Release stops refreshing a lock and unlocks it.
+func (lm *LockManager) Release(ctx context.Context, l *Lock) error {
+	ul := *l
+	ul.Token = lm.forget(l)
+	return lm.c.Unlock(ctx, &ul)
+}
+
+// recover refreshes the held locks covering any of the given paths, taking
+// those which were lost again, reporting whether all of them are held.
+func (lm *LockManager) recover(ctx context.Context, paths ...string) bool {
+	lm.m.Lock()
+	var covering []Lock
+	for l, h := range lm.held {
+		for _, p := range paths {
+			if _, ok := wp.Included(path.Clean("/"+p), l.Path, l.Depth); ok {
+				rl := *l
+				rl.Token = h.token
+				covering = append(covering, rl)
+				break
+			}
+		}
+	}
+	lm.m.Unlock()
+	if len(covering) == 0 {
+		return false
+	}
+
+	for _, rl := range covering {
+		if err := lm.c.Refresh(ctx, &rl, lm.timeout); err == nil {
+			continue
+		}
+		nl, err := lm.c.Lock(ctx, rl.Path, rl.Depth, lm.timeout, "")
+		if err != nil {
+			return false
+		}
+		lm.m.Lock()
+		for _, h := range lm.held {
+			if h.token == rl.Token {
+				h.token = nl.Token
+			}
+		}
+		lm.m.Unlock()
+	}
+	return true
+}
+
+// WithLock calls fn with a lock held on a path and its members, releasing
+// it once fn returns.
+func (lm *LockManager) WithLock(ctx context.Context, p string, fn func(ctx context.Context) error) error {
+	l, err := lm.Acquire(ctx, p)
+	if err != nil {
+		return err
+	}
+	err = fn(ctx)
+	if uerr := lm.Release(ctx, l); err == nil {
+		err = uerr
+	}
+	return err
+}
+
+// If gets an If header submitting the tokens of the held locks covering
+// any of the given paths, or the empty string if there are none. Requests
+// moving or copying into locked destinations need their tokens too, so
+// they are made with the If header for both paths.
+func (lm *LockManager) If(paths ...string) string {
+	lm.m.Lock()
+	defer lm.m.Unlock()
+	var lists []string
+	for l, h := range lm.held {
+		for _, p := range paths {
+			if _, ok := wp.Included(path.Clean("/"+p), l.Path, l.Depth); ok {
+				lists = append(lists, ifHeader(lm.c, l.Path, h.token))
+				break
+			}
+		}
+	}
+	return strings.Join(lists, " ")
+}
@@ -0,0 +1,416 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-webdav/davhttp"
+)
+
+// Prop is a property of a resource, as reported in a multistatus.
+type Prop struct {
+	// Status is the status reported for the property, such as 200 if it
+	// was found or 404 if it was not.
+	Status int
+	// Value is the text of the property, and Inner its XML content.
+	Value, Inner string
+}
+
+// Response is the response for a resource of a multistatus.
+type Response struct {
+	// Path is the path of the resource, or its href if it is not below the
+	// base URL of the Client.
+	Path string
+	// Status is the status reported for the resource as a whole, zero if
+	// its properties are reported instead.
+	Status int
+	// Props are the properties reported, by name, such as
+	// "DAV::getetag".
+	Props map[string]Prop
+}
+
+// multistatus is the body of a multistatus response.
+type multistatus struct {
+	Responses []struct {
+		Href      string `xml:"DAV: href"`
+		Status    string `xml:"DAV: status"`
+		PropStats []struct {
+			Prop struct {
+				Any []anyProp `xml:",any"`
+			} `xml:"DAV: prop"`
+			Status string `xml:"DAV: status"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+type anyProp struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+	Inner   string `xml:",innerxml"`
+}
+
+// parseStatus gets the code of a status line, such as "HTTP/1.1 200 OK".
+func parseStatus(s string) int {
+	f := strings.Fields(s)
+	if len(f) < 2 {
+		return 0
+	}
+	code, _ := strconv.Atoi(f[1])
+	return code
+}
+
+// PropFind gets the properties of a path, and of its members to the given
+// depth, either 0, 1 or davhttp.DepthInfinity. Names are those of the
+// properties, such as "DAV::getetag", with none requesting all of them.
+func (c *Client) PropFind(ctx context.Context, p string, depth int, names ...string) ([]Response, error) {
+	if len(names) == 0 {
+		return c.PropFindAll(ctx, p, depth)
+	}
+	return c.propFind(ctx, p, depth, "prop", names)
+}
+
+// PropFindAll gets all the properties of a path and its members, as
+// PropFind does without names, along with the named properties servers
+// leave out of allprop requests unless included, such as the quota
+// properties of RFC 4331.
+func (c *Client) PropFindAll(ctx context.Context, p string, depth int, include ...string) ([]Response, error) {
+	return c.propFind(ctx, p, depth, "include", include)
+}
+
+// propFind makes a PROPFIND request, for the names given in the element
+// elem, which is either "prop" or the "include" of an allprop request.
+func (c *Client) propFind(ctx context.Context, p string, depth int, elem string, names []string) ([]Response, error) {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n" + `<D:propfind xmlns:D="DAV:">`)
+	if elem == "include" {
+		b.WriteString(`<D:allprop/>`)
+	}
+	if len(names) > 0 {
+		b.WriteString(`<D:` + elem + `>`)
+		for _, n := range names {
+			i := strings.LastIndex(n, ":")
+			if i < 0 {
+				return nil, fmt.Errorf("client: property name %q has no namespace", n)
+			}
+			b.WriteString(`<p:` + n[i+1:] + ` xmlns:p="`)
+			xml.EscapeText(&b, []byte(n[:i]))
+			b.WriteString(`"/>`)
+		}
+		b.WriteString(`</D:` + elem + `>`)
+	}
+	b.WriteString(`</D:propfind>`)
+
+	h := http.Header{}
+	h.Set(davhttp.Depth, davhttp.FormatDepth(depth))
+	h.Set("Content-Type", `application/xml; charset="utf-8"`)
+	resp, err := c.Do(ctx, "PROPFIND", p, strings.NewReader(b.String()), h)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, err
+	}
+
+	var res []Response
+	for _, mr := range ms.Responses {
+		r := Response{
+			Path:   c.path(mr.Href),
+			Status: parseStatus(mr.Status),
+			Props:  make(map[string]Prop),
+		}
+		if r.Path == "" {
+			r.Path = mr.Href
+		}
+		for _, ps := range mr.PropStats {
+			status := parseStatus(ps.Status)
+			for _, ap := range ps.Prop.Any {
+				r.Props[ap.XMLName.Space+":"+ap.XMLName.Local] = Prop{
+					Status: status,
+					Value:  ap.Value,
+					Inner:  ap.Inner,
+				}
+			}
+		}
+		res = append(res, r)
+	}
+	return res, nil
+}
+
+// PropFindInto gets the properties of a path, and of its members to the
+// given depth, decoding them as Unmarshal does. Only the properties named
+// by the fields of v are requested.
+func (c *Client) PropFindInto(ctx context.Context, p string, depth int, v any) error {
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Pointer {
+		return errUnmarshal
+	}
+	t = t.Elem()
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return errUnmarshal
+	}
+	var names []string
+	for _, f := range reflect.VisibleFields(t) {
+		switch name := f.Tag.Get("dav"); name {
+		case "", ",href", ",status":
+		case ",collection":
+			names = append(names, "DAV::resourcetype")
+		default:
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return errUnmarshal
+	}
+	res, err := c.PropFind(ctx, p, depth, names...)
+	if err != nil {
+		return err
+	}
+	return Unmarshal(res, v)
+}
+
+var errUnmarshal = errors.New("client: Unmarshal needs a pointer to a struct or a slice of structs")
+
+// Unmarshal decodes responses into v, which points to a struct, to decode
+// the first response, or to a slice of structs or pointers to structs, to
+// decode all of them. Fields are decoded from the properties named by
+// their dav tags:
+//
+//	type entry struct {
+//		Path     string    `dav:",href"`
+//		Status   int       `dav:",status"`
+//		Dir      bool      `dav:",collection"`
+//		Size     int64     `dav:"DAV::getcontentlength"`
+//		Modified time.Time `dav:"DAV::getlastmodified"`
+//		Color    string    `dav:"urn:x:color"`
+//		Owner    Prop      `dav:"urn:x:owner"`
+//	}
+//
+// The ",href" field holds the path of the resource, ",status" the status
+// reported for it as a whole and ",collection" whether it is a collection.
+// Fields of type Prop hold the property whatever its status, others are
+// only set for properties reported with status 200, and keep their zero
+// values otherwise. Properties are decoded into strings, integers, bools
+// and times, which are parsed as HTTP dates or as formatted by time.Time's
+// String method.
+func Unmarshal(res []Response, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errUnmarshal
+	}
+	rv = rv.Elem()
+	switch {
+	case rv.Kind() == reflect.Struct:
+		if len(res) == 0 {
+			return errors.New("client: no responses to unmarshal")
+		}
+		return unmarshal(res[0], rv)
+	case rv.Kind() != reflect.Slice:
+		return errUnmarshal
+	}
+	et := rv.Type().Elem()
+	ptr := et.Kind() == reflect.Pointer
+	if ptr {
+		et = et.Elem()
+	}
+	if et.Kind() != reflect.Struct {
+		return errUnmarshal
+	}
+	s := reflect.MakeSlice(rv.Type(), 0, len(res))
+	for _, r := range res {
+		e := reflect.New(et)
+		if err := unmarshal(r, e.Elem()); err != nil {
+			return err
+		}
+		if !ptr {
+			e = e.Elem()
+		}
+		s = reflect.Append(s, e)
+	}
+	rv.Set(s)
+	return nil
+}
+
+var propType = reflect.TypeOf(Prop{})
+
+func unmarshal(r Response, sv reflect.Value) error {
+	for _, f := range reflect.VisibleFields(sv.Type()) {
+		name := f.Tag.Get("dav")
+		if name == "" || !f.IsExported() {
+			continue
+		}
+		fv := sv.FieldByIndex(f.Index)
+		switch name {
+		case ",href":
+			fv.SetString(r.Path)
+			continue
+		case ",status":
+			fv.SetInt(int64(r.Status))
+			continue
+		case ",collection":
+			rt := r.Props["DAV::resourcetype"]
+			fv.SetBool(rt.Status == http.StatusOK && strings.Contains(rt.Inner, "collection"))
+			continue
+		}
+		p, ok := r.Props[name]
+		if f.Type == propType {
+			if ok {
+				fv.Set(reflect.ValueOf(p))
+			}
+			continue
+		}
+		if !ok || p.Status != http.StatusOK {
+			continue
+		}
+		if err := setValue(fv, strings.TrimSpace(p.Value)); err != nil {
+			return fmt.Errorf("client: property %s of %s: %w", name, r.Path, err)
+		}
+	}
+	return nil
+}
+
+// setValue sets a field from the text of a property.
+func setValue(fv reflect.Value, s string) error {
+	if fv.Type() == reflect.TypeOf(time.Time{}) {
+		t, err := parseTime(s)
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(t))
+		return nil
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	default:
+		return fmt.Errorf("cannot decode into %s", fv.Type())
+	}
+	return nil
+}
+
+// goTimeLayout is that of time.Time's String method.
+const goTimeLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+func parseTime(s string) (time.Time, error) {
+	if t, err := http.ParseTime(s); err == nil {
+		return t, nil
+	}
+	if i := strings.Index(s, " m="); i >= 0 {
+		// The monotonic clock reading of time.Time's String.
+		s = s[:i]
+	}
+	return time.Parse(goTimeLayout, s)
+}
+
+// PropPatch sets and removes dead properties of a path, named as for
+// PropFind. Set values are text, which is escaped.
+func (c *Client) PropPatch(ctx context.Context, p string, set map[string]string, remove []string) error {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n" + `<D:propertyupdate xmlns:D="DAV:">`)
+	elem := func(n, v string, empty bool) error {
+		i := strings.LastIndex(n, ":")
+		if i < 0 {
+			return fmt.Errorf("client: property name %q has no namespace", n)
+		}
+		b.WriteString(`<p:` + n[i+1:] + ` xmlns:p="`)
+		xml.EscapeText(&b, []byte(n[:i]))
+		if empty {
+			b.WriteString(`"/>`)
+			return nil
+		}
+		b.WriteString(`">`)
+		xml.EscapeText(&b, []byte(v))
+		b.WriteString(`</p:` + n[i+1:] + `>`)
+		return nil
+	}
+	if len(set) > 0 {
+		b.WriteString(`<D:set><D:prop>`)
+		for n, v := range set {
+			if err := elem(n, v, false); err != nil {
+				return err
+			}
+		}
+		b.WriteString(`</D:prop></D:set>`)
+	}
+	if len(remove) > 0 {
+		b.WriteString(`<D:remove><D:prop>`)
+		for _, n := range remove {
+			if err := elem(n, "", true); err != nil {
+				return err
+			}
+		}
+		b.WriteString(`</D:prop></D:remove>`)
+	}
+	b.WriteString(`</D:propertyupdate>`)
+
+	h := http.Header{}
+	h.Set("Content-Type", `application/xml; charset="utf-8"`)
+	resp, err := c.Do(ctx, "PROPPATCH", p, strings.NewReader(b.String()), h)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil
+	}
+	// The properties which could not be changed are reported in a
+	// multistatus.
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return err
+	}
+	for _, mr := range ms.Responses {
+		for _, ps := range mr.PropStats {
+			if code := parseStatus(ps.Status); code >= 300 {
+				return &StatusError{Method: "PROPPATCH", Path: p, Code: code, Status: strings.TrimSpace(strings.TrimPrefix(ps.Status, "HTTP/1.1"))}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-webdav/davhttp"
+)
+
+type entry struct {
+	Path     string    `dav:",href"`
+	Dir      bool      `dav:",collection"`
+	Size     int64     `dav:"DAV::getcontentlength"`
+	Modified time.Time `dav:"DAV::getlastmodified"`
+	Color    string    `dav:"urn:x:color"`
+	Shape    Prop      `dav:"urn:x:shape"`
+}
+
+func TestPropFindInto(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newClient(t)
+	resp, err := c.Do(ctx, "MKCOL", "/d", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if err := put(ctx, c, "/d/a", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	patch := `<propertyupdate xmlns="DAV:"><set><prop><color xmlns="urn:x">red</color></prop></set></propertyupdate>`
+	resp, err = c.Do(ctx, "PROPPATCH", "/d/a", strings.NewReader(patch), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	var entries []entry
+	if err := c.PropFindInto(ctx, "/d", 1, &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("PropFindInto got %d entries, want 2", len(entries))
+	}
+	d, a := entries[0], entries[1]
+	if d.Path != "/d" {
+		d, a = a, d
+	}
+	if d.Path != "/d" || !d.Dir || d.Color != "" {
+		t.Errorf("PropFindInto got %+v for the collection", d)
+	}
+	if a.Path != "/d/a" || a.Dir || a.Size != 5 || a.Color != "red" || a.Modified.IsZero() {
+		t.Errorf("PropFindInto got %+v for the file", a)
+	}
+	if a.Shape.Status != http.StatusNotFound {
+		t.Errorf("PropFindInto got status %d for a missing property, want 404", a.Shape.Status)
+	}
+
+	var one entry
+	if err := c.PropFindInto(ctx, "/d/a", 0, &one); err != nil {
+		t.Fatal(err)
+	}
+	if one.Color != "red" {
+		t.Errorf("PropFindInto into a struct got %+v", one)
+	}
+}
+
+func TestPropFindAll(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newClient(t)
+	if err := put(ctx, c, "/a", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.PropPatch(ctx, "/a", map[string]string{"urn:x:color": "red"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	res, err := c.PropFindAll(ctx, "/a", 0, "urn:x:shape")
+	if err != nil || len(res) != 1 {
+		t.Fatalf("PropFindAll got %v, %v", res, err)
+	}
+	props := res[0].Props
+	if props["urn:x:color"].Value != "red" || props["DAV::getetag"].Status != http.StatusOK {
+		t.Errorf("PropFindAll got %+v, want all properties", props)
+	}
+	if props["urn:x:shape"].Status != http.StatusNotFound {
+		t.Errorf("PropFindAll got %+v for an included missing property, want 404", props["urn:x:shape"])
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	res := []Response{{Path: "/a", Props: map[string]Prop{
+		"DAV::getcontentlength": {Status: http.StatusOK, Value: "many"},
+	}}}
+	var e entry
+	if err := Unmarshal(res, &e); err == nil {
+		t.Error("Unmarshal of a malformed length succeeded")
+	}
+	if err := Unmarshal(res, e); err == nil {
+		t.Error("Unmarshal into a struct, rather than a pointer, succeeded")
+	}
+	res[0].Props["DAV::getcontentlength"] = Prop{Status: http.StatusForbidden, Value: "many"}
+	if err := Unmarshal(res, &e); err != nil || e.Size != 0 {
+		t.Errorf("Unmarshal of a forbidden property got %+v, %v", e, err)
+	}
+	c, _ := New("http://0.0.0.0:0/", nil)
+	if _, err := c.PropFind(context.Background(), "/", davhttp.DepthInfinity, "nonamespace"); err == nil {
+		t.Error("PropFind of a name without a namespace succeeded")
+	}
+}
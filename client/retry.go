@@ -0,0 +1,164 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy controls how a Client recovers from failed requests. The
+// zero value makes no retries.
+type RetryPolicy struct {
+	// MaxRetries is the number of times idempotent requests are retried
+	// after timing out, or failing with a server error or 429 Too Many
+	// Requests.
+	MaxRetries int
+	// MinBackoff is the wait before the first retry, which doubles for
+	// each retry after it, up to MaxBackoff. A Retry-After header is
+	// honored instead, unless it asks for a wait longer than MaxBackoff,
+	// when the request is not retried.
+	MinBackoff, MaxBackoff time.Duration
+	// RefreshLocks retries requests failing with 423 Locked once, after
+	// refreshing the locks covering them held by the Client's LockManager.
+	// Locks which were lost, for example as the server restarted, are
+	// taken again. As servers answer 412 Precondition Failed to requests
+	// submitting the tokens of lost locks, these are retried too.
+	RefreshLocks bool
+	// CreateParents retries PUT and MKCOL requests failing with 409
+	// Conflict once, after creating their missing parent collections.
+	CreateParents bool
+}
+
+// DefaultRetryPolicy is a RetryPolicy suitable for most servers.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries:   3,
+	MinBackoff:   100 * time.Millisecond,
+	MaxBackoff:   10 * time.Second,
+	RefreshLocks: true,
+}
+
+// WithRetryPolicy sets how the Client recovers from failed requests, by
+// default it does not.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = p
+	}
+}
+
+// idempotent are the methods which are retried, see
+// http://www.webdav.org/specs/rfc4918.html#rfc.section.9.
+var idempotent = map[string]bool{
+	"GET":       true,
+	"HEAD":      true,
+	"OPTIONS":   true,
+	"PUT":       true,
+	"DELETE":    true,
+	"PROPFIND":  true,
+	"PROPPATCH": true,
+	"REPORT":    true,
+}
+
+// retryableStatus are the statuses of transient failures.
+var retryableStatus = map[int]bool{
+	http.StatusRequestTimeout:      true,
+	http.StatusTooManyRequests:     true,
+	http.StatusInternalServerError: true,
+	http.StatusBadGateway:          true,
+	http.StatusServiceUnavailable:  true,
+	http.StatusGatewayTimeout:      true,
+}
+
+// timeout reports whether a request failed by timing out.
+func timeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// backoff gets the wait before retrying a request for the n-th time,
+// starting at 0, reporting whether it may be retried.
+func (p RetryPolicy) backoff(n int, resp *http.Response) (time.Duration, bool) {
+	if resp != nil {
+		if d, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+			return d, p.MaxBackoff <= 0 || d <= p.MaxBackoff
+		}
+	}
+	d := p.MinBackoff
+	for i := 0; i < n && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d, true
+}
+
+// retryAfter parses a Retry-After header, which is a number of seconds or
+// an HTTP date.
+func retryAfter(s string) (time.Duration, bool) {
+	if s == "" {
+		return 0, false
+	}
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 {
+		return time.Duration(n) * time.Second, true
+	}
+	t, err := http.ParseTime(s)
+	if err != nil {
+		return 0, false
+	}
+	if d := time.Until(t); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
+
+// sleep waits for d, or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// mkParents creates the collections containing a path, those which exist
+// already failing with 405 Method Not Allowed.
+func (c *Client) mkParents(ctx context.Context, p string) error {
+	segs := strings.Split(strings.Trim(path.Clean("/"+p), "/"), "/")
+	for i := 1; i < len(segs); i++ {
+		resp, err := c.Do(ctx, "MKCOL", "/"+path.Join(segs[:i]...), nil, nil)
+		var se *StatusError
+		switch {
+		case errors.As(err, &se) && se.Code == http.StatusMethodNotAllowed:
+		case err != nil:
+			return err
+		default:
+			resp.Body.Close()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+// flaky fails the first requests with 503 Service Unavailable.
+type flaky struct {
+	h          http.Handler
+	failures   int
+	retryAfter string
+	requests   int
+}
+
+func (f *flaky) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.requests++
+	if f.requests <= f.failures {
+		if f.retryAfter != "" {
+			w.Header().Set("Retry-After", f.retryAfter)
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	f.h.ServeHTTP(w, r)
+}
+
+func newFlaky(t *testing.T, failures int, p RetryPolicy) (*Client, *flaky, *[]time.Duration) {
+	f := &flaky{h: webdav.NewWebDAV(memfs.NewMemFS()), failures: failures}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	c, err := New(srv.URL, nil, WithRetryPolicy(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var waits []time.Duration
+	c.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	return c, f, &waits
+}
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+	p := RetryPolicy{MaxRetries: 3, MinBackoff: time.Second, MaxBackoff: 3 * time.Second}
+	c, f, waits := newFlaky(t, 3, p)
+	if err := put(ctx, c, "/a", "x"); err != nil {
+		t.Fatalf("PUT failed after retries: %v", err)
+	}
+	if f.requests != 4 {
+		t.Errorf("PUT made %d requests, want 4", f.requests)
+	}
+	if want := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}; len(*waits) != 3 || (*waits)[0] != want[0] || (*waits)[1] != want[1] || (*waits)[2] != want[2] {
+		t.Errorf("PUT waited %v, want %v", *waits, want)
+	}
+
+	c, f, _ = newFlaky(t, 4, p)
+	if err := put(ctx, c, "/a", "x"); status(err) != http.StatusServiceUnavailable {
+		t.Errorf("PUT failing more often than retried got %v, want a 503 StatusError", err)
+	}
+
+	c, f, _ = newFlaky(t, 1, p)
+	if _, err := c.Do(ctx, "MKCOL", "/d", nil, nil); status(err) != http.StatusServiceUnavailable || f.requests != 1 {
+		t.Errorf("MKCOL got %v after %d requests, want no retries", err, f.requests)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	ctx := context.Background()
+	p := RetryPolicy{MaxRetries: 1, MinBackoff: time.Second, MaxBackoff: 10 * time.Second}
+	c, f, waits := newFlaky(t, 1, p)
+	f.retryAfter = "7"
+	if err := put(ctx, c, "/a", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if len(*waits) != 1 || (*waits)[0] != 7*time.Second {
+		t.Errorf("PUT waited %v, want 7s", *waits)
+	}
+
+	c, f, _ = newFlaky(t, 1, p)
+	f.retryAfter = "60"
+	if err := put(ctx, c, "/a", "x"); status(err) != http.StatusServiceUnavailable {
+		t.Errorf("PUT asked to wait longer than MaxBackoff got %v, want a 503 StatusError", err)
+	}
+}
+
+func TestCreateParents(t *testing.T) {
+	ctx := context.Background()
+	c, _, _ := newFlaky(t, 0, RetryPolicy{CreateParents: true})
+	if err := put(ctx, c, "/a/b/c", "x"); err != nil {
+		t.Fatal(err)
+	}
+	res, err := c.PropFind(ctx, "/a/b/c", 0)
+	if err != nil || len(res) != 1 {
+		t.Errorf("PropFind of the file got %v, %v", res, err)
+	}
+}
+
+func TestRecoverLocks(t *testing.T) {
+	ctx := context.Background()
+	c, url := newClient(t)
+	c.retry = RetryPolicy{RefreshLocks: true}
+	other, _ := New(url+"/dav", nil)
+	lm := NewLockManager(c, time.Minute)
+
+	l, err := lm.Acquire(ctx, "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The lock is lost, as if the server had restarted.
+	if err := other.Unlock(ctx, l); err != nil {
+		t.Fatal(err)
+	}
+	if err := put(ctx, c, "/a", "x"); err != nil {
+		t.Fatalf("PUT after the lock was lost: %v", err)
+	}
+	if h := lm.If("/a"); h == "" || strings.Contains(h, l.Token) {
+		t.Errorf("If got %q, want the token of the lock taken again", h)
+	}
+	if err := put(ctx, other, "/a", "x"); status(err) != webdav.StatusLocked {
+		t.Errorf("PUT without the lock got %v, want a 423 StatusError", err)
+	}
+	if err := lm.Release(ctx, l); err != nil {
+		t.Errorf("Release of the lock taken again: %v", err)
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// NewTransport creates a transport keeping up to n idle connections open
+// to each host, and opening no more than n, for Clients making up to n
+// concurrent requests, such as those of a TransferManager:
+//
+//	c, err := client.New(base, &http.Client{Transport: client.NewTransport(8)})
+//
+// http.DefaultTransport keeps only two idle connections to each host, so
+// most connections of more concurrent requests are not reused.
+func NewTransport(n int) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConnsPerHost = n
+	t.MaxConnsPerHost = n
+	return t
+}
+
+// DefaultSegmentSize is the size of the segments files are downloaded in by
+// TransferManagers which were not given one.
+const DefaultSegmentSize = 8 << 20
+
+// TransferManager makes many GET and PUT requests of a Client in parallel,
+// with bounded concurrency, and downloads large files in segments.
+type TransferManager struct {
+	c *Client
+	n int
+	// SegmentSize is the size of the segments of Download, which does not
+	// split files of up to this size.
+	SegmentSize int64
+}
+
+// NewTransferManager creates a TransferManager making up to n concurrent
+// requests of a Client, which should keep as many connections open to its
+// server, see NewTransport.
+func NewTransferManager(c *Client, n int) *TransferManager {
+	if n < 1 {
+		n = 1
+	}
+	return &TransferManager{c: c, n: n, SegmentSize: DefaultSegmentSize}
+}
+
+// parallel calls fn for each of 0 to n-1, with up to tm.n calls running
+// at once, returning the first error. Calls not started before the first
+// error are not made, and ctx is canceled for those running.
+func (tm *TransferManager) parallel(ctx context.Context, n int, fn func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg    sync.WaitGroup
+		once  sync.Once
+		first error
+	)
+	sem := make(chan struct{}, tm.n)
+	for i := 0; i < n; i++ {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := fn(ctx, i); err != nil {
+				once.Do(func() {
+					first = err
+					cancel()
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+	if first == nil {
+		first = ctx.Err()
+	}
+	return first
+}
+
+// discard reads the rest of a response body and closes it, so that its
+// connection is reused.
+func discard(resp *http.Response) error {
+	io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// GetAll gets paths in parallel, calling fn with the body of each, which
+// may be called concurrently.
+func (tm *TransferManager) GetAll(ctx context.Context, paths []string, fn func(p string, r io.Reader) error) error {
+	return tm.parallel(ctx, len(paths), func(ctx context.Context, i int) error {
+		resp, err := tm.c.Do(ctx, "GET", paths[i], nil, nil)
+		if err != nil {
+			return err
+		}
+		defer discard(resp)
+		return fn(paths[i], resp.Body)
+	})
+}
+
+// Upload is a file to put.
+type Upload struct {
+	Path string
+	// Open opens the content of the file, which is closed once put.
+	Open func() (io.ReadCloser, error)
+}
+
+// PutAll puts files in parallel.
+func (tm *TransferManager) PutAll(ctx context.Context, uploads []Upload) error {
+	return tm.parallel(ctx, len(uploads), func(ctx context.Context, i int) error {
+		rc, err := uploads[i].Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		resp, err := tm.c.Do(ctx, "PUT", uploads[i].Path, rc, nil)
+		if err != nil {
+			return err
+		}
+		return discard(resp)
+	})
+}
+
+// Download gets a file into w, returning its size. Files larger than the
+// SegmentSize are got in segments, with parallel Range requests, if the
+// server supports them. The first segment is requested alone, which tells
+// the size of the file, and those after it with an If-Match header for its
+// ETag, or an If-Unmodified-Since header for servers whose ETags are not
+// quoted, so that a file modified during the download fails with a 412
+// StatusError rather than being got mixed up.
+func (tm *TransferManager) Download(ctx context.Context, p string, w io.WriterAt) (int64, error) {
+	seg := tm.SegmentSize
+	if seg <= 0 {
+		seg = DefaultSegmentSize
+	}
+	resp, err := tm.c.Do(ctx, "GET", p, nil, http.Header{"Range": {rangeHeader(0, seg)}})
+	if err != nil {
+		return 0, err
+	}
+	defer discard(resp)
+	if resp.StatusCode != http.StatusPartialContent {
+		// The server ignored the range, and sent all of the file.
+		return io.Copy(io.NewOffsetWriter(w, 0), resp.Body)
+	}
+	size, err := rangeSize(resp.Header.Get("Content-Range"), 0)
+	if err != nil {
+		return 0, fmt.Errorf("client: GET %s: %w", p, err)
+	}
+	if err := copySegment(w, resp, 0, min(seg, size)); err != nil {
+		return 0, err
+	}
+
+	h := http.Header{}
+	if etag := resp.Header.Get("ETag"); strings.HasPrefix(strings.TrimPrefix(etag, "W/"), `"`) {
+		h.Set("If-Match", etag)
+	} else if lm := resp.Header.Get("Last-Modified"); lm != "" {
+		h.Set("If-Unmodified-Since", lm)
+	}
+	segs := int((size + seg - 1) / seg)
+	err = tm.parallel(ctx, segs-1, func(ctx context.Context, i int) error {
+		start := int64(i+1) * seg
+		end := min(start+seg, size)
+		sh := h.Clone()
+		sh.Set("Range", rangeHeader(start, end-start))
+		resp, err := tm.c.Do(ctx, "GET", p, nil, sh)
+		if err != nil {
+			return err
+		}
+		defer discard(resp)
+		if resp.StatusCode != http.StatusPartialContent {
+			return fmt.Errorf("client: GET %s: got %s for a range", p, resp.Status)
+		}
+		if _, err := rangeSize(resp.Header.Get("Content-Range"), start); err != nil {
+			return fmt.Errorf("client: GET %s: %w", p, err)
+		}
+		return copySegment(w, resp, start, end-start)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// rangeHeader gets a Range header for n bytes from an offset.
+func rangeHeader(off, n int64) string {
+	return fmt.Sprintf("bytes=%d-%d", off, off+n-1)
+}
+
+// rangeSize checks that a Content-Range header is for a range starting at
+// an offset, and gets the size of the file it reports.
+func rangeSize(cr string, off int64) (int64, error) {
+	var start, end, size int64
+	if _, err := fmt.Sscanf(cr, "bytes %d-%d/%d", &start, &end, &size); err != nil || start != off || end < start || size <= end {
+		return 0, fmt.Errorf("unexpected Content-Range %q for a range from %d", cr, off)
+	}
+	return size, nil
+}
+
+// copySegment writes n bytes of a response body to w at an offset.
+func copySegment(w io.WriterAt, resp *http.Response, off, n int64) error {
+	got, err := io.Copy(io.NewOffsetWriter(w, off), io.LimitReader(resp.Body, n))
+	if err == nil && got != n {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
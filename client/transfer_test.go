@@ -0,0 +1,133 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+func TestPutAllGetAll(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newClient(t)
+	tm := NewTransferManager(c, 4)
+
+	var uploads []Upload
+	for i := 0; i < 20; i++ {
+		content := fmt.Sprintf("file %d", i)
+		uploads = append(uploads, Upload{
+			Path: fmt.Sprintf("/f%d", i),
+			Open: func() (io.ReadCloser, error) {
+				return io.NopCloser(strings.NewReader(content)), nil
+			},
+		})
+	}
+	if err := tm.PutAll(ctx, uploads); err != nil {
+		t.Fatal(err)
+	}
+
+	var m sync.Mutex
+	got := make(map[string]string)
+	var paths []string
+	for _, u := range uploads {
+		paths = append(paths, u.Path)
+	}
+	err := tm.GetAll(ctx, paths, func(p string, r io.Reader) error {
+		b, err := io.ReadAll(r)
+		m.Lock()
+		got[p] = string(b)
+		m.Unlock()
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range paths {
+		if want := fmt.Sprintf("file %d", i); got[p] != want {
+			t.Errorf("GetAll got %q for %s, want %q", got[p], p, want)
+		}
+	}
+
+	if err := tm.GetAll(ctx, []string{"/f0", "/missing"}, func(string, io.Reader) error { return nil }); status(err) != http.StatusNotFound {
+		t.Errorf("GetAll of a missing file got %v, want a 404 StatusError", err)
+	}
+}
+
+func TestDownload(t *testing.T) {
+	ctx := context.Background()
+	var ranges int32
+	h := webdav.NewWebDAV(memfs.NewMemFS())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			atomic.AddInt32(&ranges, 1)
+		}
+		h.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	c, err := New(srv.URL, &http.Client{Transport: NewTransport(4)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	resp, err := c.Do(ctx, "PUT", "/big", bytes.NewReader(content), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	tm := NewTransferManager(c, 4)
+	tm.SegmentSize = 3000
+	f, err := os.CreateTemp(t.TempDir(), "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	n, err := tm.Download(ctx, "/big", f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(f.Name()); n != int64(len(content)) || !bytes.Equal(got, content) {
+		t.Errorf("Download got %d bytes, want %d", n, len(content))
+	}
+	if got := atomic.LoadInt32(&ranges); got != 4 {
+		t.Errorf("Download made %d Range requests, want 4", got)
+	}
+
+	atomic.StoreInt32(&ranges, 0)
+	tm.SegmentSize = int64(len(content))
+	f2, err := os.CreateTemp(t.TempDir(), "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f2.Close()
+	if _, err := tm.Download(ctx, "/big", f2); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&ranges); got != 1 {
+		t.Errorf("Download of a single segment made %d Range requests, want 1", got)
+	}
+}
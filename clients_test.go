@@ -0,0 +1,134 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+// step is a request of a client fixture, with the status it must get.
+type step struct {
+	line         int
+	method, path string
+	status       int
+	header       http.Header
+	body         string
+}
+
+// parseFixture parses the requests of a client, each starting with a line
+//
+//	> METHOD PATH STATUS
+//
+// followed by its headers, a blank line and its body, which runs up to the
+// next request. Lines starting with "#" before the first request are
+// comments.
+func parseFixture(b []byte) ([]step, error) {
+	var steps []step
+	var body []string
+	inBody := false
+	flush := func() {
+		if len(steps) > 0 {
+			steps[len(steps)-1].body = strings.TrimRight(strings.Join(body, "\n"), "\n")
+		}
+		body, inBody = nil, false
+	}
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; sc.Scan(); n++ {
+		l := sc.Text()
+		switch {
+		case strings.HasPrefix(l, "> "):
+			flush()
+			f := strings.Fields(l[2:])
+			if len(f) != 3 {
+				return nil, fmt.Errorf("line %d: malformed request %q", n, l)
+			}
+			status, err := strconv.Atoi(f[2])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: malformed status %q", n, f[2])
+			}
+			steps = append(steps, step{line: n, method: f[0], path: f[1], status: status, header: make(http.Header)})
+		case len(steps) == 0:
+			if l != "" && !strings.HasPrefix(l, "#") {
+				return nil, fmt.Errorf("line %d: expected a request", n)
+			}
+		case inBody:
+			body = append(body, l)
+		case l == "":
+			inBody = true
+		default:
+			k, v, ok := strings.Cut(l, ":")
+			if !ok {
+				return nil, fmt.Errorf("line %d: malformed header %q", n, l)
+			}
+			steps[len(steps)-1].header.Add(k, strings.TrimSpace(v))
+		}
+	}
+	flush()
+	return steps, sc.Err()
+}
+
+// TestClients replays the request sequences of popular clients, found in
+// testdata/clients, each against a new handler. Fixtures refer to the lock
+// token of the latest LOCK as {{lock}}.
+func TestClients(t *testing.T) {
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "clients", "*.txt"))
+	if err != nil || len(fixtures) == 0 {
+		t.Fatalf("no fixtures found: %v", err)
+	}
+	for _, fn := range fixtures {
+		t.Run(strings.TrimSuffix(filepath.Base(fn), ".txt"), func(t *testing.T) {
+			b, err := os.ReadFile(fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			steps, err := parseFixture(b)
+			if err != nil {
+				t.Fatalf("%s: %v", fn, err)
+			}
+
+			h := webdav.NewWebDAV(memfs.NewMemFS())
+			var lock string
+			for _, st := range steps {
+				expand := strings.NewReplacer("{{lock}}", lock).Replace
+				r := httptest.NewRequest(st.method, st.path, strings.NewReader(expand(st.body)))
+				for k, vs := range st.header {
+					for _, v := range vs {
+						r.Header.Add(k, expand(v))
+					}
+				}
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, r)
+				if w.Code != st.status {
+					t.Fatalf("%s:%d: %s %s got %d, want %d\n%s", fn, st.line, st.method, st.path, w.Code, st.status, w.Body)
+				}
+				if tok := w.Header().Get("Lock-Token"); tok != "" {
+					lock = strings.Trim(tok, "<>")
+				}
+			}
+		})
+	}
+}
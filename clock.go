@@ -0,0 +1,42 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import "time"
+
+// Clock is a source of the current time, which tests may replace in order
+// to control the passing of time, such as for lock expiry.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock is the Clock reading the system time, used by default.
+var SystemClock Clock = systemClock{}
+
+// WithClock sets the source of time used for locks, retention periods and
+// change timestamps.
+func WithClock(c Clock) Option {
+	return func(s *WebDAV) {
+		s.clock = c
+		s.lm.clock = c
+		s.sm.clock = c
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Command davmigrate migrates a whole tree between two storage backends, each
+either a local directory, served as by osfs, or a WebDAV server:
+
+	davmigrate [flags] source destination
+
+	davmigrate -state migrate.json https://old.example.com/dav/ /srv/dav
+
+Dead properties are migrated with their resources, those of WebDAV servers
+being the ones they report for allprop PROPFIND requests. The times of
+files and collections are preserved in local directories. Files are read back
+from the destination once written, failing the migration unless their
+SHA-256 checksums match those of the source.
+
+Progress is saved to the -state file after each resource, so that running
+the command again resumes an interrupted migration. Resources changed in
+the meantime are only migrated again if the -journal flag names the
+FileJournal of the handler serving the source, see webdav.WithJournal.
+*/
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/client"
+	"github.com/google/go-webdav/osfs"
+)
+
+var (
+	stateFile   = flag.String("state", "", "file to save progress in, resuming from it")
+	journalFile = flag.String("journal", "", "FileJournal of the handler serving the source")
+	verify      = flag.Bool("verify", true, "check the checksums of files written")
+)
+
+// open opens a tree, which is a WebDAV server if named by an http or https
+// URL, a local directory otherwise.
+func open(name string) (tree, error) {
+	if strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://") {
+		c, err := client.New(name, nil, client.WithRetryPolicy(client.DefaultRetryPolicy))
+		if err != nil {
+			return nil, err
+		}
+		return &davTree{c: c}, nil
+	}
+	fs, err := osfs.New(name)
+	if err != nil {
+		return nil, err
+	}
+	return &fsTree{fs: fs, dir: name}, nil
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] source destination\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	m := &migration{state: *stateFile, verify: *verify, logf: log.Printf}
+	var err error
+	if m.src, err = open(flag.Arg(0)); err != nil {
+		log.Fatal(err)
+	}
+	if m.dst, err = open(flag.Arg(1)); err != nil {
+		log.Fatal(err)
+	}
+	if *journalFile != "" {
+		j, err := webdav.OpenFileJournal(*journalFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer j.Close()
+		m.journal = j
+	}
+
+	st, err := m.run(context.Background())
+	log.Printf("migrated %d collections and %d files (%d bytes), skipped %d already migrated",
+		st.Dirs, st.Files, st.Bytes, st.Skipped)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/google/go-webdav"
+	wp "github.com/google/go-webdav/path"
+)
+
+// progress is the state of a migration, saved after each entry so that an
+// interrupted migration resumes where it stopped.
+type progress struct {
+	// Seq is the sequence number of the latest change in the journal of
+	// the source when the entries in Done were listed.
+	Seq uint64 `json:"seq"`
+	// Done maps the paths migrated to the SHA-256 of their content, which
+	// is empty for collections.
+	Done map[string]string `json:"done"`
+}
+
+// migration copies a tree to another.
+type migration struct {
+	src, dst tree
+	// journal is that of the handler serving the source, if any. Entries
+	// changed since they were migrated are migrated again on resumption.
+	journal webdav.JournalStore
+	// state is the file progress is saved in, if any.
+	state string
+	// verify reads files back from the destination, checking that their
+	// checksums match those of the source.
+	verify bool
+	logf   func(format string, args ...any)
+}
+
+// stats counts what a migration did.
+type stats struct {
+	Dirs, Files, Skipped int
+	Bytes                int64
+}
+
+func (m *migration) load() (*progress, error) {
+	pr := &progress{Done: make(map[string]string)}
+	if m.state != "" {
+		b, err := os.ReadFile(m.state)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+		case err != nil:
+			return nil, err
+		default:
+			if err := json.Unmarshal(b, pr); err != nil {
+				return nil, fmt.Errorf("%s: %w", m.state, err)
+			}
+			if pr.Done == nil {
+				pr.Done = make(map[string]string)
+			}
+		}
+	}
+	if m.journal == nil {
+		return pr, nil
+	}
+
+	last, err := m.journal.Last()
+	if err != nil {
+		return nil, err
+	}
+	if len(pr.Done) > 0 {
+		changes, err := m.journal.Since(pr.Seq)
+		if errors.Is(err, webdav.ErrJournalTruncated) {
+			m.logf("journal truncated since change %d, migrating everything again", pr.Seq)
+			pr.Done = make(map[string]string)
+		} else if err != nil {
+			return nil, err
+		}
+		for _, c := range changes {
+			for _, p := range []string{c.Path, c.Destination} {
+				for d := range pr.Done {
+					if p != "" && wp.InTree(d, p) {
+						delete(pr.Done, d)
+					}
+				}
+			}
+		}
+	}
+	pr.Seq = last
+	return pr, nil
+}
+
+func (m *migration) save(pr *progress) error {
+	if m.state == "" {
+		return nil
+	}
+	b, err := json.Marshal(pr)
+	if err != nil {
+		return err
+	}
+	tmp := m.state + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.state)
+}
+
+// run migrates the entries of the source not migrated already.
+func (m *migration) run(ctx context.Context) (stats, error) {
+	var st stats
+	pr, err := m.load()
+	if err != nil {
+		return st, err
+	}
+	entries, err := m.src.List(ctx)
+	if err != nil {
+		return st, err
+	}
+
+	for _, e := range entries {
+		if _, ok := pr.Done[e.Path]; ok {
+			st.Skipped++
+			continue
+		}
+		sum := ""
+		if e.Dir {
+			err = m.dst.Mkdir(ctx, e)
+			st.Dirs++
+		} else {
+			var n int64
+			n, sum, err = m.copy(ctx, e)
+			st.Files++
+			st.Bytes += n
+		}
+		if err != nil {
+			return st, fmt.Errorf("%s: %w", e.Path, err)
+		}
+		pr.Done[e.Path] = sum
+		if err := m.save(pr); err != nil {
+			return st, err
+		}
+	}
+
+	// Adding members changes the times of collections, so they are set
+	// again once their members are migrated.
+	for i := len(entries) - 1; i >= 0; i-- {
+		if e := entries[i]; e.Dir {
+			if err := m.dst.Mkdir(ctx, e); err != nil {
+				return st, fmt.Errorf("%s: %w", e.Path, err)
+			}
+		}
+	}
+	return st, nil
+}
+
+// copy copies a file, returning its size and checksum.
+func (m *migration) copy(ctx context.Context, e entry) (int64, string, error) {
+	rc, err := m.src.Open(ctx, e.Path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer rc.Close()
+	h := sha256.New()
+	cr := &countingReader{r: io.TeeReader(rc, h)}
+	if err := m.dst.Put(ctx, e, cr); err != nil {
+		return 0, "", err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	if !m.verify {
+		return cr.n, sum, nil
+	}
+
+	rc, err = m.dst.Open(ctx, e.Path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer rc.Close()
+	h.Reset()
+	if _, err := io.Copy(h, rc); err != nil {
+		return 0, "", err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != sum {
+		return 0, "", fmt.Errorf("checksum %s of the destination, want %s", got, sum)
+	}
+	return cr.n, sum, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,123 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/client"
+	"github.com/google/go-webdav/memfs"
+)
+
+func do(t *testing.T, h http.Handler, method, p, body string) {
+	t.Helper()
+	r := httptest.NewRequest(method, p, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code >= 300 {
+		t.Fatalf("%s %s got %d", method, p, w.Code)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	srcfs := memfs.NewMemFS()
+	journal := webdav.NewMemoryJournal(100)
+	src := webdav.NewWebDAV(srcfs, webdav.WithJournal(journal))
+	do(t, src, "MKCOL", "/d", "")
+	do(t, src, "PUT", "/d/a", "hello")
+	do(t, src, "PUT", "/b", "world")
+	do(t, src, "PROPPATCH", "/d/a", `<propertyupdate xmlns="DAV:"><set><prop><color xmlns="urn:x">red</color></prop></set></propertyupdate>`)
+
+	remote := httptest.NewServer(webdav.NewWebDAV(memfs.NewMemFS()))
+	defer remote.Close()
+	c, err := client.New(remote.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := filepath.Join(t.TempDir(), "state.json")
+	m := &migration{
+		src:     &fsTree{fs: srcfs},
+		dst:     &davTree{c: c},
+		journal: journal,
+		state:   state,
+		verify:  true,
+		logf:    t.Logf,
+	}
+	st, err := m.run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Dirs != 2 || st.Files != 2 || st.Bytes != 10 {
+		t.Errorf("first run got %+v, want 2 collections and 2 files of 10 bytes", st)
+	}
+	res, err := c.PropFind(ctx, "/d/a", 0, "urn:x:color")
+	if err != nil || len(res) != 1 || res[0].Props["urn:x:color"].Value != "red" {
+		t.Errorf("migrated file got properties %+v, %v, want its color", res, err)
+	}
+
+	if st, err = m.run(ctx); err != nil || st.Files != 0 || st.Skipped != 4 {
+		t.Errorf("resumed run got %+v, %v, want everything skipped", st, err)
+	}
+	do(t, src, "PUT", "/d/a", "hello again")
+	if st, err = m.run(ctx); err != nil || st.Files != 1 || st.Skipped != 3 {
+		t.Errorf("run after a change got %+v, %v, want the changed file migrated", st, err)
+	}
+
+	// From the server to a local directory, whose times are preserved.
+	dir := t.TempDir()
+	m = &migration{src: &davTree{c: c}, verify: true, logf: t.Logf}
+	if m.dst, err = open(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "d", "a"))
+	if err != nil || string(b) != "hello again" {
+		t.Errorf("migrated file got %q, %v", b, err)
+	}
+	srcEntries, err := m.src.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checked := 0
+	for _, e := range srcEntries {
+		// Times are only reported for files.
+		if e.Dir {
+			continue
+		}
+		checked++
+		fi, err := os.Stat(filepath.Join(dir, filepath.FromSlash(e.Path)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !fi.ModTime().Equal(e.Modified) {
+			t.Errorf("%s got time %s, want %s", e.Path, fi.ModTime().UTC(), e.Modified.Format(time.RFC3339))
+		}
+	}
+	if checked != 2 {
+		t.Errorf("checked the times of %d files, want 2", checked)
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/client"
+)
+
+// entry is a file or collection of a tree.
+type entry struct {
+	Path     string
+	Dir      bool
+	Modified time.Time
+	// Props are the dead properties, by name such as "urn:x:color".
+	Props map[string]string
+}
+
+// tree is the source or destination of a migration.
+type tree interface {
+	// List gets the entries of the tree, parents before their members.
+	List(ctx context.Context) ([]entry, error)
+	// Open opens the content of a file.
+	Open(ctx context.Context, p string) (io.ReadCloser, error)
+	// Mkdir creates a collection, which may exist already.
+	Mkdir(ctx context.Context, e entry) error
+	// Put writes a file.
+	Put(ctx context.Context, e entry, r io.Reader) error
+}
+
+// fsTree is a tree of a FileSystem. Times are only preserved for those of
+// local directories, which are set directly.
+type fsTree struct {
+	fs  webdav.FileSystem
+	dir string // The local directory of fs, if any.
+}
+
+func (t *fsTree) List(ctx context.Context) ([]entry, error) {
+	root, err := t.fs.ForPath("/")
+	if err != nil {
+		return nil, err
+	}
+	files, err := root.LookupSubtree(-1)
+	if err != nil {
+		return nil, err
+	}
+	var res []entry
+	for _, f := range files {
+		fi, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		e := entry{
+			Path:     f.GetPath(),
+			Dir:      f.IsDirectory(),
+			Modified: fi.LastModified,
+			Props:    make(map[string]string),
+		}
+		if pl, ok := f.(webdav.PropLister); ok {
+			for _, n := range pl.PropNames() {
+				if v, ok := f.GetProp(n); ok {
+					e.Props[n] = v
+				}
+			}
+		}
+		res = append(res, e)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Path < res[j].Path })
+	return res, nil
+}
+
+func (t *fsTree) Open(ctx context.Context, p string) (io.ReadCloser, error) {
+	fp, err := t.fs.ForPath(p)
+	if err != nil {
+		return nil, err
+	}
+	f, err := fp.Lookup()
+	if err != nil {
+		return nil, err
+	}
+	return f.Open()
+}
+
+func (t *fsTree) Mkdir(ctx context.Context, e entry) error {
+	fp, err := t.fs.ForPath(e.Path)
+	if err != nil {
+		return err
+	}
+	f, err := fp.Lookup()
+	if err != nil {
+		if f, err = fp.Mkdir(); err != nil {
+			return err
+		}
+	} else if !f.IsDirectory() {
+		return webdav.ErrorIsNotDir
+	}
+	return t.finish(f, e)
+}
+
+func (t *fsTree) Put(ctx context.Context, e entry, r io.Reader) error {
+	fp, err := t.fs.ForPath(e.Path)
+	if err != nil {
+		return err
+	}
+	var fh webdav.FileHandle
+	f, err := fp.Lookup()
+	if err == nil {
+		fh, err = f.Truncate()
+	} else {
+		f, fh, err = fp.Create()
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(fh, r); err != nil {
+		fh.Close()
+		return err
+	}
+	if err := fh.Close(); err != nil {
+		return err
+	}
+	return t.finish(f, e)
+}
+
+// finish sets the dead properties and time of a file.
+func (t *fsTree) finish(f webdav.File, e entry) error {
+	if len(e.Props) > 0 {
+		if err := f.PatchProp(e.Props, nil); err != nil {
+			return err
+		}
+	}
+	if t.dir == "" || e.Modified.IsZero() || e.Path == "/" {
+		return nil
+	}
+	return os.Chtimes(filepath.Join(t.dir, filepath.FromSlash(e.Path)), time.Time{}, e.Modified)
+}
+
+// davTree is a tree of a WebDAV server. Its times are left to the server.
+type davTree struct {
+	c *client.Client
+}
+
+// davEntry is a resource as reported by PROPFIND.
+type davEntry struct {
+	Path     string    `dav:",href"`
+	Dir      bool      `dav:",collection"`
+	Modified time.Time `dav:"DAV::getlastmodified"`
+}
+
+// liveProp determines if a property is maintained by the server, rather
+// than dead and to be migrated.
+func liveProp(n string) bool {
+	return strings.HasPrefix(n, "DAV::") || n == webdav.CTagProp
+}
+
+// List walks the tree with PROPFIND requests of depth 1, as servers may
+// refuse those of infinite depth. Dead properties are those reported for
+// allprop requests, which some servers leave out.
+func (t *davTree) List(ctx context.Context) ([]entry, error) {
+	var res []entry
+	todo := []string{"/"}
+	for len(todo) > 0 {
+		p := todo[0]
+		todo = todo[1:]
+		rs, err := t.c.PropFind(ctx, p, 1, "DAV::resourcetype", "DAV::getlastmodified")
+		if err != nil {
+			return nil, err
+		}
+		all, err := t.c.PropFind(ctx, p, 1)
+		if err != nil {
+			return nil, err
+		}
+		dead := make(map[string]map[string]string)
+		for _, r := range all {
+			for n, v := range r.Props {
+				if v.Status == http.StatusOK && !liveProp(n) {
+					if dead[r.Path] == nil {
+						dead[r.Path] = make(map[string]string)
+					}
+					dead[r.Path][n] = v.Value
+				}
+			}
+		}
+		for _, r := range rs {
+			if r.Path == p && p != "/" {
+				continue // Listed by its parent.
+			}
+			if r.Path != p && path.Dir(r.Path) != p {
+				continue // Not below the base URL.
+			}
+			var de davEntry
+			if err := client.Unmarshal([]client.Response{r}, &de); err != nil {
+				return nil, err
+			}
+			e := entry{Path: de.Path, Dir: de.Dir, Modified: de.Modified, Props: dead[r.Path]}
+			res = append(res, e)
+			if e.Dir && e.Path != p {
+				todo = append(todo, e.Path)
+			}
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Path < res[j].Path })
+	return res, nil
+}
+
+func (t *davTree) Open(ctx context.Context, p string) (io.ReadCloser, error) {
+	resp, err := t.c.Do(ctx, "GET", p, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (t *davTree) Mkdir(ctx context.Context, e entry) error {
+	if e.Path != "/" {
+		resp, err := t.c.Do(ctx, "MKCOL", e.Path, nil, nil)
+		var se *client.StatusError
+		switch {
+		case errors.As(err, &se) && se.Code == http.StatusMethodNotAllowed:
+			// It exists already.
+		case err != nil:
+			return err
+		default:
+			resp.Body.Close()
+		}
+	}
+	return t.patch(ctx, e)
+}
+
+func (t *davTree) Put(ctx context.Context, e entry, r io.Reader) error {
+	resp, err := t.c.Do(ctx, "PUT", e.Path, r, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return t.patch(ctx, e)
+}
+
+// patch sets the dead properties of a resource.
+func (t *davTree) patch(ctx context.Context, e entry) error {
+	if len(e.Props) == 0 {
+		return nil
+	}
+	return t.c.PropPatch(ctx, e.Path, e.Props, nil)
+}
@@ -0,0 +1,82 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/google/go-webdav/davhttp"
+)
+
+// Compliance classes which may be announced with WithCompliance.
+const (
+	ComplianceExtendedMkcol = "extended-mkcol"  // RFC 5689
+	ComplianceAccessControl = "access-control"  // RFC 3744
+	ComplianceCalendar      = "calendar-access" // RFC 4791
+	ComplianceAddressBook   = "addressbook"     // RFC 6352
+)
+
+// baseMethods lists the methods implemented for every FileSystem.
+var baseMethods = []string{
+	"OPTIONS", "GET", "HEAD", "POST", "PUT", "DELETE", "TRACE", "PROPFIND",
+	"PROPPATCH", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK", "REPORT", "SEARCH",
+}
+
+// WithCompliance announces extensions, such as ComplianceCalendar, in the
+// DAV header of OPTIONS responses, after the classes "1, 2, 3" implemented by
+// the handler itself. It should be given for the extensions served by the
+// FileSystem or by handlers in front of this one, as clients use the header
+// to decide which features to try.
+func WithCompliance(classes ...string) Option {
+	return func(s *WebDAV) {
+		for _, c := range classes {
+			if c = strings.TrimSpace(c); c != "" && !s.announces(c) {
+				s.compliance = append(s.compliance, c)
+			}
+		}
+	}
+}
+
+func (s *WebDAV) announces(class string) bool {
+	for _, c := range s.compliance {
+		if strings.EqualFold(c, class) {
+			return true
+		}
+	}
+	return false
+}
+
+// davHeader sets the headers advertising the capabilities of the handler on
+// an OPTIONS response for the path p. The Public header, from RFC 2068,
+// lists the methods of the server as a whole and is still inspected by
+// older clients.
+func (s *WebDAV) davHeader(w http.ResponseWriter, p string) {
+	// http://www.webdav.org/specs/rfc4918.html#dav.compliance.classes
+	w.Header().Set(davhttp.DAV, strings.Join(append([]string{"1", "2", "3"}, s.compliance...), ", "))
+
+	methods := baseMethods
+	if s.LegacyNotifications {
+		methods = append(methods[:len(methods):len(methods)], "SUBSCRIBE", "POLL", "UNSUBSCRIBE")
+	}
+	var public []string
+	for _, m := range methods {
+		if s.ReadOnly && !readOnlyMethods[m] {
+			continue
+		}
+		public = append(public, m)
+	}
+	w.Header().Set("Public", s.filterAllowed(p, strings.Join(public, ", ")))
+}
@@ -0,0 +1,97 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+func TestCompliance(t *testing.T) {
+	options := func(h *webdav.WebDAV) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("OPTIONS", "/", nil))
+		return w
+	}
+
+	w := options(webdav.NewWebDAV(memfs.NewMemFS()))
+	if got := w.Header().Get("DAV"); got != "1, 2, 3" {
+		t.Errorf("DAV = %q, want \"1, 2, 3\"", got)
+	}
+	if got := w.Header().Get("Public"); !strings.Contains(got, "PROPFIND") || strings.Contains(got, "SUBSCRIBE") {
+		t.Errorf("Public = %q", got)
+	}
+
+	h := webdav.NewWebDAV(memfs.NewMemFS(), webdav.WithReadOnly(),
+		webdav.WithCompliance(webdav.ComplianceCalendar, webdav.ComplianceExtendedMkcol, webdav.ComplianceCalendar))
+	w = options(h)
+	if got, want := w.Header().Get("DAV"), "1, 2, 3, calendar-access, extended-mkcol"; got != want {
+		t.Errorf("DAV = %q, want %q", got, want)
+	}
+	if got := w.Header().Get("Public"); strings.Contains(got, "PUT") || !strings.Contains(got, "GET") {
+		t.Errorf("read-only Public = %q", got)
+	}
+}
+
+func TestClass3Locks(t *testing.T) {
+	h := webdav.NewWebDAV(memfs.NewMemFS())
+	serve(h, "MKCOL", "/d", "")
+	serve(h, "PUT", "/d/a", "x")
+	const lockBody = `<lockinfo xmlns="DAV:"><lockscope><exclusive/></lockscope><locktype><write/></locktype></lockinfo>`
+	w := serve(h, "LOCK", "/d/a", lockBody, "Depth", "0")
+	if w.Code != http.StatusOK {
+		t.Fatalf("LOCK got %d", w.Code)
+	}
+	tok := w.Header().Get("Lock-Token")
+
+	w = serve(h, "PUT", "/d/a", "y")
+	if w.Code != webdav.StatusLocked || !strings.Contains(w.Body.String(), "<lock-token-submitted") ||
+		!strings.Contains(w.Body.String(), "<href>/d/a</href>") {
+		t.Errorf("PUT without the token got %d %s", w.Code, w.Body)
+	}
+	w = serve(h, "DELETE", "/d", "")
+	if w.Code != webdav.StatusLocked || !strings.Contains(w.Body.String(), "<href>/d/a</href>") {
+		t.Errorf("DELETE of the parent without the token got %d %s", w.Code, w.Body)
+	}
+	w = serve(h, "LOCK", "/d", lockBody)
+	if w.Code != webdav.StatusLocked || !strings.Contains(w.Body.String(), "<no-conflicting-lock") {
+		t.Errorf("conflicting LOCK got %d %s", w.Code, w.Body)
+	}
+	w = serve(h, "UNLOCK", "/d", "", "Lock-Token", tok)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "<lock-token-matches-request-uri") {
+		t.Errorf("UNLOCK of another resource got %d %s", w.Code, w.Body)
+	}
+
+	// A tagged list for the locked member submits its token, and its
+	// ETag as quoted in the header matches.
+	w = serve(h, "PROPFIND", "/d/a", propfindETag, "Depth", "0")
+	etag := regexp.MustCompile(`<getetag[^>]*>([^<]*)<`).FindStringSubmatch(w.Body.String())
+	if etag == nil {
+		t.Fatalf("no ETag in %s", w.Body)
+	}
+	w = serve(h, "PUT", "/d/a", "y", "If", `</d/a> (`+tok+` ["`+etag[1]+`"])`)
+	if w.Code != http.StatusNoContent && w.Code != http.StatusCreated && w.Code != http.StatusOK {
+		t.Errorf("PUT with a tagged list got %d %s", w.Code, w.Body)
+	}
+	if w := serve(h, "DELETE", "/d", "", "If", `</d/a> (`+tok+`)`); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE with the token got %d %s", w.Code, w.Body)
+	}
+}
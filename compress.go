@@ -0,0 +1,135 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// defaultCompressible are the media types compressed if WithCompression is
+// given none.
+var defaultCompressible = []string{
+	"text/*",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"image/svg+xml",
+}
+
+// WithCompression makes GET compress the content of files of the given
+// media types, such as "text/html" or "text/*", with gzip for clients
+// accepting it, or that of files of common textual types if none are
+// given. The media type of a file is that of its extension. Requests for
+// ranges are served uncompressed, so that the ranges are those of the
+// file, and compressed responses have an ETag of their own.
+func WithCompression(types ...string) Option {
+	return func(s *WebDAV) {
+		if len(types) == 0 {
+			types = defaultCompressible
+		}
+		s.compressible = types
+	}
+}
+
+// compresses determines if the content of a file is compressed for clients
+// accepting it.
+func (s *WebDAV) compresses(p string) bool {
+	if len(s.compressible) == 0 {
+		return false
+	}
+	mt, _, err := mime.ParseMediaType(mime.TypeByExtension(path.Ext(p)))
+	if err != nil {
+		return false
+	}
+	for _, t := range s.compressible {
+		if t == mt || (strings.HasSuffix(t, "/*") && strings.HasPrefix(mt, t[:len(t)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsGzip determines if the Accept-Encoding header of a request lists
+// gzip, or any encoding, without refusing it with q=0.
+func acceptsGzip(r *http.Request) bool {
+	for _, e := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(e, ";")
+		coding = strings.TrimSpace(coding)
+		if !strings.EqualFold(coding, "gzip") && coding != "*" {
+			continue
+		}
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if q, err := strconv.ParseFloat(v, 64); err != nil || q == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipWriter compresses the body of a successful response, which is
+// written without Content-Length and cannot be served by ranges.
+type gzipWriter struct {
+	http.ResponseWriter
+	// body is unset for HEAD, which only gets the headers.
+	body  bool
+	gz    *gzip.Writer
+	wrote bool
+}
+
+func (w *gzipWriter) WriteHeader(status int) {
+	if w.wrote {
+		return
+	}
+	w.wrote = true
+	if status == http.StatusOK {
+		h := w.Header()
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+		h.Set("Content-Encoding", "gzip")
+		if w.body {
+			w.gz = gzip.NewWriter(w.ResponseWriter)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *gzipWriter) Write(b []byte) (int, error) {
+	if !w.wrote {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.gz.Write(b)
+}
+
+// close ends the compressed body, if any.
+func (w *gzipWriter) close() error {
+	if w.gz == nil {
+		return nil
+	}
+	return w.gz.Close()
+}
+
+func (w *gzipWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
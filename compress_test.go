@@ -0,0 +1,75 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+func TestCompression(t *testing.T) {
+	text := strings.Repeat("hello world\n", 100)
+	s := webdav.NewWebDAV(memfs.NewMemFS(), webdav.WithCompression())
+	serve(s, "PUT", "/a.txt", text)
+	serve(s, "PUT", "/a.bin", text)
+	identity := serve(s, "GET", "/a.txt", "")
+
+	w := serve(s, "GET", "/a.txt", "", "Accept-Encoding", "br, gzip")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("Content-Length") != "" {
+		t.Fatalf("GET accepting gzip got %d with headers %v", w.Code, w.Header())
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := io.ReadAll(zr); err != nil || string(b) != text {
+		t.Errorf("GET accepting gzip got %d bytes, %v, want the file", len(b), err)
+	}
+	if tag := w.Header().Get("ETag"); tag == "" || tag == identity.Header().Get("ETag") {
+		t.Errorf("compressed GET has ETag %q, the same as the uncompressed one", tag)
+	}
+	for _, w := range []*http.Response{w.Result(), identity.Result()} {
+		if w.Header.Get("Vary") != "Accept-Encoding" {
+			t.Errorf("GET got Vary %q, want Accept-Encoding", w.Header.Get("Vary"))
+		}
+	}
+	if w := serve(s, "HEAD", "/a.txt", "", "Accept-Encoding", "gzip"); w.Header().Get("Content-Encoding") != "gzip" || w.Body.Len() != 0 {
+		t.Errorf("HEAD accepting gzip got headers %v and %d bytes", w.Header(), w.Body.Len())
+	}
+
+	// Ranges are of the uncompressed file.
+	w = serve(s, "GET", "/a.txt", "", "Accept-Encoding", "gzip", "Range", "bytes=0-4")
+	if w.Code != http.StatusPartialContent || w.Header().Get("Content-Encoding") != "" || w.Body.String() != "hello" {
+		t.Errorf("GET of a range got %d %q, encoded %q", w.Code, w.Body, w.Header().Get("Content-Encoding"))
+	}
+
+	for _, tc := range []struct {
+		p, accept string
+	}{
+		{"/a.bin", "gzip"},
+		{"/a.txt", "gzip;q=0, identity"},
+		{"/a.txt", ""},
+	} {
+		if w := serve(s, "GET", tc.p, "", "Accept-Encoding", tc.accept); w.Header().Get("Content-Encoding") != "" || w.Body.String() != text {
+			t.Errorf("GET of %s accepting %q was compressed", tc.p, tc.accept)
+		}
+	}
+}
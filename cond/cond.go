@@ -76,7 +76,7 @@ func (c *Condition) Eval(e Env, r string) bool {
 	if c.State != "" {
 		res = e.Locked(r, c.State)
 	} else {
-		res = e.ETag(r) == c.ETag
+		res = sameETag(e.ETag(r), c.ETag)
 	}
 	if c.Not {
 		res = !res
@@ -84,6 +84,20 @@ func (c *Condition) Eval(e Env, r string) bool {
 	return res
 }
 
+// sameETag compares entity tags, which may or may not be quoted and weak,
+// as the If header quotes them while Env need not.
+func sameETag(a, b string) bool {
+	return a != "" && unquoteETag(a) == unquoteETag(b)
+}
+
+func unquoteETag(t string) string {
+	t = strings.TrimPrefix(t, "W/")
+	if len(t) >= 2 && t[0] == '"' && t[len(t)-1] == '"' {
+		t = t[1 : len(t)-1]
+	}
+	return t
+}
+
 func (c *Condition) String() string {
 	prefix := ""
 	if c.Not {
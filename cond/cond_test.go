@@ -44,3 +44,30 @@ func TestParse(t *testing.T) {
 		}
 	}
 }
+
+type etagEnv string
+
+func (e etagEnv) ETag(r string) string    { return string(e) }
+func (e etagEnv) Locked(r, l string) bool { return false }
+
+func TestEvalETag(t *testing.T) {
+	for _, tc := range []struct {
+		etag, header string
+		want         bool
+	}{
+		{`12-34`, `(["12-34"])`, true},
+		{`"12-34"`, `(["12-34"])`, true},
+		{`"12-34"`, `([W/"12-34"])`, true},
+		{`12-34`, `(["12-35"])`, false},
+		{``, `([""])`, false},
+		{`12-34`, `(Not ["12-34"])`, false},
+	} {
+		it, err := ParseIfTag(tc.header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := it.Eval(etagEnv(tc.etag), "/a"); got != tc.want {
+			t.Errorf("%s with ETag %s got %v, want %v", tc.header, tc.etag, got, tc.want)
+		}
+	}
+}
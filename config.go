@@ -0,0 +1,175 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Config describes the effective configuration of a handler, as reported
+// by the /configz debug endpoint.
+type Config struct {
+	FileSystem  string `json:"filesystem"`
+	Prefix      string `json:"prefix,omitempty"`
+	TokenSource string `json:"token_source"`
+	SyncTokens  string `json:"sync_tokens"`
+	Journal     string `json:"journal"`
+	LockStore   string `json:"lock_store,omitempty"`
+
+	Debug               bool `json:"debug"`
+	Hardened            bool `json:"hardened"`
+	Authenticated       bool `json:"authenticated"`
+	ReadOnly            bool `json:"read_only"`
+	Strict              bool `json:"strict"`
+	EventStream         bool `json:"event_stream"`
+	LegacyNotifications bool `json:"legacy_notifications"`
+	DeferredDeletion    bool `json:"deferred_deletion"`
+
+	Limits     Limits     `json:"limits"`
+	LockPolicy LockPolicy `json:"lock_policy"`
+	Forks      string     `json:"forks"`
+
+	DropBoxes       []string            `json:"drop_boxes,omitempty"`
+	Retention       []RetentionPolicy   `json:"retention,omitempty"`
+	Versions        VersionRetention    `json:"version_retention"`
+	Hidden          []string            `json:"hidden,omitempty"`
+	DisabledMethods map[string][]string `json:"disabled_methods,omitempty"`
+	Virtual         []string            `json:"virtual,omitempty"`
+	Transformers    []string            `json:"transformers,omitempty"`
+	Validators      []string            `json:"validators,omitempty"`
+	Disposition     string              `json:"disposition,omitempty"`
+	HeaderHooks     int                 `json:"header_hooks,omitempty"`
+	LenientClients  []string            `json:"lenient_clients,omitempty"`
+	Compliance      []string            `json:"compliance,omitempty"`
+	Compression     []string            `json:"compression,omitempty"`
+	ComputedProps   []string            `json:"computed_props,omitempty"`
+	Aliases         map[string]string   `json:"namespace_aliases,omitempty"`
+	GatewayHosts    []string            `json:"gateway_hosts,omitempty"`
+	Fallback        string              `json:"fallback,omitempty"`
+	SyncWindow      time.Duration       `json:"sync_window"`
+	WriteOverlay    time.Duration       `json:"write_overlay,omitempty"`
+	AdvisoryLocks   []string            `json:"advisory_locks,omitempty"`
+	StaleLockIdle   time.Duration       `json:"stale_lock_idle,omitempty"`
+	TransferPolicy  TransferPolicy      `json:"transfer_policy"`
+	NamePolicy      NamePolicy          `json:"name_policy"`
+}
+
+// serveConfig serves the /configz debug endpoint, reporting the effective
+// configuration.
+func (s *WebDAV) serveConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := s.writeConfig(w); err != nil {
+		s.logger.Printf("config report failed: %s", err)
+	}
+}
+
+// Config gets the effective configuration of the handler.
+func (s *WebDAV) Config() Config {
+	c := Config{
+		FileSystem:          fmt.Sprintf("%T", s.fs),
+		Prefix:              s.prefix,
+		TokenSource:         fmt.Sprintf("%T", s.lm.tokens),
+		SyncTokens:          fmt.Sprintf("%T", s.syncTokens),
+		Debug:               s.Debug,
+		Hardened:            s.Hardened,
+		Authenticated:       s.Authenticated,
+		ReadOnly:            s.ReadOnly,
+		Strict:              s.strict,
+		EventStream:         s.EventStream,
+		LegacyNotifications: s.LegacyNotifications,
+		DeferredDeletion:    s.deferDelete,
+		Limits: Limits{
+			MaxDeadProps:     s.MaxDeadProps,
+			MaxPropValueSize: s.MaxPropValueSize,
+			MaxPropfindDepth: s.MaxPropfindDepth,
+			MaxRanges:        s.maxRanges,
+			MaxValidatedSize: s.MaxValidatedSize,
+		},
+		LockPolicy:     s.lockPolicy,
+		Forks:          "visible",
+		DropBoxes:      s.DropBoxes,
+		Retention:      s.Retention,
+		Versions:       s.versions,
+		Virtual:        s.virtualIn("/", -1),
+		Disposition:    s.disposition,
+		HeaderHooks:    len(s.headerHooks),
+		LenientClients: s.lenientUAs,
+		Compliance:     s.compliance,
+		Compression:    s.compressible,
+		GatewayHosts:   s.gatewayHosts,
+		SyncWindow:     s.syncValidity(),
+		WriteOverlay:   s.overlay.ttl,
+		Aliases:        s.aliases,
+		AdvisoryLocks:  s.advisory,
+		StaleLockIdle:  s.staleLocks.MaxIdle,
+		TransferPolicy: s.transferPolicy,
+		NamePolicy:     s.namePolicy,
+	}
+	s.journal.m.Lock()
+	s.journal.load(s)
+	c.Journal = fmt.Sprintf("%T", s.journal.store)
+	s.journal.m.Unlock()
+	if s.lm.store != nil {
+		c.LockStore = fmt.Sprintf("%T", s.lm.store)
+	}
+	if s.forks == ForksAsProps {
+		c.Forks = "props"
+	}
+	if s.fallback != nil {
+		c.Fallback = fmt.Sprintf("%T", s.fallback)
+	}
+	for _, r := range s.hidden {
+		c.Hidden = append(c.Hidden, r.String())
+	}
+	for _, t := range s.transformers {
+		c.Transformers = append(c.Transformers, t.Name)
+	}
+	for mt := range s.Validators {
+		c.Validators = append(c.Validators, mt)
+	}
+	sort.Strings(c.Validators)
+	for pn := range s.computed {
+		c.ComputedProps = append(c.ComputedProps, pn)
+	}
+	sort.Strings(c.ComputedProps)
+
+	s.methods.m.RLock()
+	for prefix, ms := range s.methods.disabled {
+		if c.DisabledMethods == nil {
+			c.DisabledMethods = make(map[string][]string)
+		}
+		for m := range ms {
+			c.DisabledMethods[prefix] = append(c.DisabledMethods[prefix], m)
+		}
+		sort.Strings(c.DisabledMethods[prefix])
+	}
+	s.methods.m.RUnlock()
+	return c
+}
+
+// writeConfig serializes the effective configuration as indented JSON.
+func (s *WebDAV) writeConfig(w io.Writer) error {
+	b, err := json.MarshalIndent(s.Config(), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
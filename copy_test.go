@@ -0,0 +1,61 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+// TestCopyMoveStatus checks the status of COPY and MOVE is chosen by the
+// handler, whatever the FileSystem would report.
+func TestCopyMoveStatus(t *testing.T) {
+	for _, method := range []string{"COPY", "MOVE"} {
+		for _, tc := range []struct {
+			name, src, dst, overwrite string
+			want                      int
+		}{
+			{"new", "/a", "/new", "", http.StatusCreated},
+			{"overwritten", "/a", "/b", "", http.StatusNoContent},
+			{"overwritten explicitly", "/a", "/b", "T", http.StatusNoContent},
+			{"existing without overwrite", "/a", "/b", "F", http.StatusPreconditionFailed},
+			{"missing parent", "/a", "/missing/a", "", http.StatusConflict},
+			{"missing source", "/missing", "/new", "", http.StatusNotFound},
+			{"same file", "/a", "/a", "", http.StatusForbidden},
+			{"other host", "/a", "http://elsewhere/new", "", http.StatusBadGateway},
+		} {
+			t.Run(method+" "+tc.name, func(t *testing.T) {
+				h := webdav.NewWebDAV(memfs.NewMemFS())
+				serve(h, "PUT", "/a", "a")
+				serve(h, "PUT", "/b", "b")
+				hdr := []string{"Destination", tc.dst}
+				if tc.overwrite != "" {
+					hdr = append(hdr, "Overwrite", tc.overwrite)
+				}
+				if w := serve(h, method, tc.src, "", hdr...); w.Code != tc.want {
+					t.Errorf("%s %s to %s got %d, want %d", method, tc.src, tc.dst, w.Code, tc.want)
+				}
+				if tc.want >= 300 {
+					if w := serve(h, "GET", "/b", ""); w.Body.String() != "b" {
+						t.Errorf("failed %s changed the destination to %q", method, w.Body)
+					}
+				}
+			})
+		}
+	}
+}
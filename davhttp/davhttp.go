@@ -0,0 +1,200 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package davhttp parses and formats the HTTP headers defined by WebDAV, see
+http://www.webdav.org/specs/rfc4918.html#http.headers.for.distributed.authoring.
+It is shared by servers and clients. The If header, which needs a parser
+of its own, is handled by package cond.
+*/
+package davhttp
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Header names.
+const (
+	DAV         = "DAV"
+	Depth       = "Depth"
+	Destination = "Destination"
+	If          = "If"
+	LockToken   = "Lock-Token"
+	Overwrite   = "Overwrite"
+	Timeout     = "Timeout"
+)
+
+// DepthInfinity is the depth "infinity".
+const DepthInfinity = -1
+
+// TimeoutInfinite is the timeout "Infinite".
+const TimeoutInfinite time.Duration = -1
+
+// maxTimeoutSeconds is the greatest timeout value allowed by RFC 4918.
+const maxTimeoutSeconds = 1<<32 - 1
+
+// Errors returned for malformed headers.
+var (
+	ErrDepth       = errors.New("davhttp: bad Depth header")
+	ErrDestination = errors.New("davhttp: bad Destination header")
+	ErrLockToken   = errors.New("davhttp: bad Lock-Token header")
+	ErrOverwrite   = errors.New("davhttp: bad Overwrite header")
+	ErrTimeout     = errors.New("davhttp: bad Timeout header")
+)
+
+// ParseDepth parses a Depth header, which is "0", "1" or "infinity".
+// Other non-negative numbers are accepted, for the benefit of extensions,
+// and an absent header means DepthInfinity.
+func ParseDepth(s string) (int, error) {
+	if s == "infinity" || s == "" {
+		return DepthInfinity, nil
+	}
+	if !digits(s) {
+		return 0, ErrDepth
+	}
+	d, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, ErrDepth
+	}
+	return d, nil
+}
+
+// digits determines if s is a non-empty string of decimal digits.
+func digits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// FormatDepth formats a Depth header.
+func FormatDepth(d int) string {
+	if d < 0 {
+		return "infinity"
+	}
+	return strconv.Itoa(d)
+}
+
+// ParseOverwrite parses an Overwrite header, which is "T" or "F". An absent
+// header means true.
+func ParseOverwrite(s string) (bool, error) {
+	switch s {
+	case "", "T":
+		return true, nil
+	case "F":
+		return false, nil
+	}
+	return false, ErrOverwrite
+}
+
+// FormatOverwrite formats an Overwrite header.
+func FormatOverwrite(b bool) string {
+	if b {
+		return "T"
+	}
+	return "F"
+}
+
+// ParseTimeout parses a Timeout header, a list of the timeouts a client
+// would like in order of preference. Each is either TimeoutInfinite or a
+// whole number of seconds. An absent header is an empty list.
+func ParseTimeout(s string) ([]time.Duration, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var res []time.Duration
+	for _, o := range strings.Split(s, ",") {
+		o = strings.TrimSpace(o)
+		if o == "Infinite" {
+			res = append(res, TimeoutInfinite)
+			continue
+		}
+		v, ok := strings.CutPrefix(o, "Second-")
+		if !ok || !digits(v) {
+			return nil, ErrTimeout
+		}
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil || n > maxTimeoutSeconds {
+			return nil, ErrTimeout
+		}
+		res = append(res, time.Duration(n)*time.Second)
+	}
+	return res, nil
+}
+
+// FormatTimeout formats a Timeout header, or a timeout element of a lock,
+// rounding down to whole seconds.
+func FormatTimeout(ds ...time.Duration) string {
+	opts := make([]string, len(ds))
+	for i, d := range ds {
+		if d < 0 {
+			opts[i] = "Infinite"
+		} else {
+			opts[i] = "Second-" + strconv.FormatInt(int64(d/time.Second), 10)
+		}
+	}
+	return strings.Join(opts, ", ")
+}
+
+// ParseLockToken parses a Lock-Token header, a lock token URI enclosed in
+// angle brackets.
+func ParseLockToken(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 3 || s[0] != '<' || s[len(s)-1] != '>' {
+		return "", ErrLockToken
+	}
+	t := s[1 : len(s)-1]
+	if strings.ContainsAny(t, "<> \t") || !strings.Contains(t, ":") {
+		return "", ErrLockToken
+	}
+	return t, nil
+}
+
+// FormatLockToken formats a Lock-Token header.
+func FormatLockToken(token string) string {
+	return "<" + token + ">"
+}
+
+// ParseDestination parses a Destination header, which is an absolute URI
+// or an absolute path. For the latter the URL has no scheme or host.
+func ParseDestination(s string) (*url.URL, error) {
+	if s == "" {
+		return nil, ErrDestination
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, ErrDestination
+	}
+	switch {
+	case u.Scheme == "" && u.Host == "":
+		if !strings.HasPrefix(u.Path, "/") {
+			return nil, ErrDestination
+		}
+	case u.Scheme != "http" && u.Scheme != "https", u.Host == "":
+		return nil, ErrDestination
+	}
+	if u.Fragment != "" || u.User != nil {
+		return nil, ErrDestination
+	}
+	return u, nil
+}
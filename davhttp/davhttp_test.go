@@ -0,0 +1,183 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package davhttp
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseDepth(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want int
+		ok   bool
+	}{
+		{"", DepthInfinity, true},
+		{"infinity", DepthInfinity, true},
+		{"0", 0, true},
+		{"1", 1, true},
+		{"Infinity", 0, false},
+		{"-1", 0, false},
+		{"+1", 0, false},
+		{" 1", 0, false},
+		{"99999999999999999999", 0, false},
+	} {
+		got, err := ParseDepth(c.in)
+		if (err == nil) != c.ok || (c.ok && got != c.want) {
+			t.Errorf("ParseDepth(%q) = %d, %v", c.in, got, err)
+		}
+	}
+}
+
+func TestParseTimeout(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want []time.Duration
+		ok   bool
+	}{
+		{"", nil, true},
+		{"Second-60", []time.Duration{time.Minute}, true},
+		{"Infinite, Second-4100000000", []time.Duration{TimeoutInfinite, 4100000000 * time.Second}, true},
+		{"Second-4294967296", nil, false},
+		{"Second-", nil, false},
+		{"Second--1", nil, false},
+		{"Seconds-60", nil, false},
+		{"60", nil, false},
+	} {
+		got, err := ParseTimeout(c.in)
+		if (err == nil) != c.ok || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ParseTimeout(%q) = %v, %v", c.in, got, err)
+		}
+	}
+	if got := FormatTimeout(TimeoutInfinite, 90*time.Second); got != "Infinite, Second-90" {
+		t.Errorf("FormatTimeout() = %q", got)
+	}
+}
+
+func TestParseLockToken(t *testing.T) {
+	for _, c := range []struct {
+		in, want string
+		ok       bool
+	}{
+		{"<opaquelocktoken:a-b>", "opaquelocktoken:a-b", true},
+		{" <urn:uuid:a> ", "urn:uuid:a", true},
+		{"opaquelocktoken:a", "", false},
+		{"<>", "", false},
+		{"<a>", "", false},
+		{"<<urn:x>>", "", false},
+	} {
+		got, err := ParseLockToken(c.in)
+		if (err == nil) != c.ok || got != c.want {
+			t.Errorf("ParseLockToken(%q) = %q, %v", c.in, got, err)
+		}
+	}
+}
+
+func TestParseDestination(t *testing.T) {
+	for _, c := range []struct {
+		in, path string
+		ok       bool
+	}{
+		{"http://example.com/a%20b", "/a b", true},
+		{"/a/b", "/a/b", true},
+		{"", "", false},
+		{"a/b", "", false},
+		{"ftp://example.com/a", "", false},
+		{"http:///a", "", false},
+		{"http://example.com/a#f", "", false},
+	} {
+		u, err := ParseDestination(c.in)
+		if (err == nil) != c.ok || (c.ok && u.Path != c.path) {
+			t.Errorf("ParseDestination(%q) = %v, %v", c.in, u, err)
+		}
+	}
+}
+
+func FuzzDepth(f *testing.F) {
+	for _, s := range []string{"", "0", "1", "infinity", "-1", "007"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		d, err := ParseDepth(s)
+		if err != nil {
+			return
+		}
+		if d2, err := ParseDepth(FormatDepth(d)); err != nil || d2 != d {
+			t.Errorf("ParseDepth(FormatDepth(%d)) = %d, %v", d, d2, err)
+		}
+	})
+}
+
+func FuzzOverwrite(f *testing.F) {
+	for _, s := range []string{"", "T", "F", "t"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		o, err := ParseOverwrite(s)
+		if err != nil {
+			return
+		}
+		if o2, err := ParseOverwrite(FormatOverwrite(o)); err != nil || o2 != o {
+			t.Errorf("ParseOverwrite(FormatOverwrite(%v)) = %v, %v", o, o2, err)
+		}
+	})
+}
+
+func FuzzTimeout(f *testing.F) {
+	for _, s := range []string{"", "Infinite", "Second-1, Infinite", "Second-4294967295"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		ds, err := ParseTimeout(s)
+		if err != nil || len(ds) == 0 {
+			return
+		}
+		if ds2, err := ParseTimeout(FormatTimeout(ds...)); err != nil || !reflect.DeepEqual(ds2, ds) {
+			t.Errorf("ParseTimeout(FormatTimeout(%v)) = %v, %v", ds, ds2, err)
+		}
+	})
+}
+
+func FuzzLockToken(f *testing.F) {
+	for _, s := range []string{"<opaquelocktoken:a>", "<urn:uuid:b>", "x"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		tok, err := ParseLockToken(s)
+		if err != nil {
+			return
+		}
+		if tok2, err := ParseLockToken(FormatLockToken(tok)); err != nil || tok2 != tok {
+			t.Errorf("ParseLockToken(FormatLockToken(%q)) = %q, %v", tok, tok2, err)
+		}
+	})
+}
+
+func FuzzDestination(f *testing.F) {
+	for _, s := range []string{"/a", "http://example.com/a%2Fb?q", "https://h:1/"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		u, err := ParseDestination(s)
+		if err != nil {
+			return
+		}
+		if u2, err := ParseDestination(u.String()); err != nil || u2.String() != u.String() {
+			t.Errorf("ParseDestination(%q) = %v, %v", u, u2, err)
+		}
+	})
+}
@@ -0,0 +1,216 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	wp "github.com/google/go-webdav/path"
+)
+
+// maxDeletionErrors bounds the errors kept for each deletion, and
+// maxFinishedDeletions the finished deletions kept for reporting.
+const (
+	maxDeletionErrors    = 100
+	maxFinishedDeletions = 100
+)
+
+var errDeletionPending = errors.New("deletion in progress")
+
+// WithDeferredDeletion makes DELETE of collections answer as soon as the
+// collection is marked deleted, removing its members in the background.
+// Until they are removed, the collection and its members are hidden from
+// clients and cannot be created again. The progress of deletions is
+// reported by Deletions and the /jobz debug endpoint.
+func WithDeferredDeletion() Option {
+	return func(s *WebDAV) {
+		s.deferDelete = true
+	}
+}
+
+// Deletion reports the progress of the deferred deletion of a collection.
+type Deletion struct {
+	ID       uint64    `json:"id"`
+	Path     string    `json:"path"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	// Total counts the resources to remove, once they have been listed.
+	Total   int `json:"total"`
+	Removed int `json:"removed"`
+	// Errors maps the resources which could not be removed to the reason.
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// Done determines if the deletion has finished, successfully or not.
+func (d Deletion) Done() bool {
+	return !d.Finished.IsZero()
+}
+
+// deletions tracks the deferred deletions, running and recently finished.
+type deletions struct {
+	m    sync.Mutex
+	wg   sync.WaitGroup
+	next uint64
+	jobs []*Deletion
+}
+
+// Deletions gets the deferred deletions which are running or have
+// recently finished, ordered by when they started.
+func (s *WebDAV) Deletions() []Deletion {
+	s.deletions.m.Lock()
+	defer s.deletions.m.Unlock()
+	res := make([]Deletion, 0, len(s.deletions.jobs))
+	for _, j := range s.deletions.jobs {
+		d := *j
+		if j.Errors != nil {
+			d.Errors = make(map[string]string, len(j.Errors))
+			for p, e := range j.Errors {
+				d.Errors[p] = e
+			}
+		}
+		res = append(res, d)
+	}
+	return res
+}
+
+// WaitDeletions waits for the running deferred deletions to finish, such as
+// before shutting down.
+func (s *WebDAV) WaitDeletions() {
+	s.deletions.wg.Wait()
+}
+
+// pendingDeletion determines if a path is within a collection being
+// deleted.
+func (s *WebDAV) pendingDeletion(p string) bool {
+	if !s.deferDelete {
+		return false
+	}
+	s.deletions.m.Lock()
+	defer s.deletions.m.Unlock()
+	for _, j := range s.deletions.jobs {
+		if !j.Done() && wp.InTree(p, j.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteLater marks the collection at p deleted and starts removing it.
+func (s *WebDAV) deleteLater(p Path) {
+	ds := &s.deletions
+	ds.m.Lock()
+	ds.next++
+	j := &Deletion{ID: ds.next, Path: p.String(), Started: s.clock.Now()}
+	ds.jobs = append(ds.jobs, j)
+	finished := 0
+	for i := len(ds.jobs) - 1; i >= 0; i-- {
+		if ds.jobs[i].Done() {
+			if finished++; finished > maxFinishedDeletions {
+				ds.jobs = append(ds.jobs[:i], ds.jobs[i+1:]...)
+			}
+		}
+	}
+	ds.m.Unlock()
+
+	ds.wg.Add(1)
+	go func() {
+		defer ds.wg.Done()
+		s.runDeletion(j, p)
+	}()
+}
+
+// runDeletion removes the members of a collection one at a time, deepest
+// first, and then the collection itself.
+func (s *WebDAV) runDeletion(j *Deletion, p Path) {
+	ds := &s.deletions
+	fail := func(p string, err error) {
+		s.logger.Printf("deferred deletion of %s: %s: %s", j.Path, p, err)
+		ds.m.Lock()
+		defer ds.m.Unlock()
+		if j.Errors == nil {
+			j.Errors = make(map[string]string)
+		}
+		if len(j.Errors) < maxDeletionErrors {
+			j.Errors[p] = err.Error()
+		}
+	}
+	defer func() {
+		ds.m.Lock()
+		j.Finished = s.clock.Now()
+		ds.m.Unlock()
+	}()
+
+	files, err := p.LookupSubtree(-1)
+	if err != nil {
+		fail(j.Path, err)
+		return
+	}
+	// Members sort after the collections containing them.
+	paths := make([]string, len(files))
+	dirs := make(map[string]bool)
+	for i, f := range files {
+		paths[i] = f.GetPath()
+		dirs[paths[i]] = f.IsDirectory()
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+	ds.m.Lock()
+	j.Total = len(paths)
+	ds.m.Unlock()
+
+	for _, fp := range paths {
+		rp, err := s.fs.ForPath(fp)
+		switch {
+		case err != nil:
+		case dirs[fp]:
+			// Collections are empty by now, but may only be removed
+			// recursively.
+			errs := rp.RecursiveRemove()
+			for ep, e := range errs {
+				fail(ep, e)
+			}
+			if len(errs) > 0 {
+				continue
+			}
+		default:
+			err = rp.Remove()
+		}
+		if err != nil {
+			fail(fp, err)
+			continue
+		}
+		ds.m.Lock()
+		j.Removed++
+		ds.m.Unlock()
+	}
+}
+
+// serveJobs serves the /jobz debug endpoint, reporting the deferred
+// deletions as JSON.
+func (s *WebDAV) serveJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Deletions []Deletion `json:"deletions"`
+	}{s.Deletions()})
+}
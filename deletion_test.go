@@ -0,0 +1,97 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+// gatedFS holds removals until the gate is closed.
+type gatedFS struct {
+	webdav.FileSystem
+	gate chan struct{}
+}
+
+func (fs gatedFS) ForPath(p string) (webdav.Path, error) {
+	fp, err := fs.FileSystem.ForPath(p)
+	if err != nil {
+		return nil, err
+	}
+	return gatedPath{fp, fs.gate}, nil
+}
+
+type gatedPath struct {
+	webdav.Path
+	gate chan struct{}
+}
+
+func (p gatedPath) Remove() error {
+	<-p.gate
+	return p.Path.Remove()
+}
+
+func TestDeferredDeletion(t *testing.T) {
+	fs := gatedFS{memfs.NewMemFS(), make(chan struct{})}
+	s := webdav.NewWebDAV(fs, webdav.WithDeferredDeletion(), webdav.WithDebug())
+	serve(s, "MKCOL", "/d", "")
+	serve(s, "MKCOL", "/d/e", "")
+	serve(s, "PUT", "/d/e/a", "a")
+	serve(s, "PUT", "/d/b", "b")
+	serve(s, "PUT", "/c", "c")
+
+	if w := serve(s, "DELETE", "/d", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE got %d, want 204", w.Code)
+	}
+	for _, p := range []string{"/d", "/d/b", "/d/e/a"} {
+		if w := serve(s, "GET", p, ""); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s while deleting got %d, want 404", p, w.Code)
+		}
+	}
+	if w := serve(s, "PROPFIND", "/", "", "Depth", "infinity"); strings.Contains(w.Body.String(), "<href>/d") {
+		t.Errorf("PROPFIND while deleting listed the collection: %s", w.Body)
+	}
+	if w := serve(s, "MKCOL", "/d", ""); w.Code != http.StatusConflict {
+		t.Errorf("MKCOL while deleting got %d, want 409", w.Code)
+	}
+	if d := s.Deletions(); len(d) != 1 || d[0].Path != "/d" || d[0].Done() {
+		t.Errorf("Deletions() = %+v, want /d running", d)
+	}
+	if w := serve(s, "GET", "/jobz", ""); !strings.Contains(w.Body.String(), `"path":"/d"`) {
+		t.Errorf("/jobz got %s", w.Body)
+	}
+
+	close(fs.gate)
+	s.WaitDeletions()
+	d := s.Deletions()
+	if len(d) != 1 || !d[0].Done() || d[0].Total != 4 || d[0].Removed != 4 || len(d[0].Errors) != 0 {
+		t.Errorf("Deletions() = %+v, want /d done removing 4 resources", d)
+	}
+	if fp, _ := fs.ForPath("/d"); fp != nil {
+		if _, err := fp.Lookup(); err == nil {
+			t.Error("collection exists after its deletion finished")
+		}
+	}
+	if w := serve(s, "MKCOL", "/d", ""); w.Code != http.StatusCreated {
+		t.Errorf("MKCOL after deleting got %d, want 201", w.Code)
+	}
+	if w := serve(s, "GET", "/c", ""); w.Body.String() != "c" {
+		t.Errorf("GET of a file outside the deletion got %q", w.Body)
+	}
+}
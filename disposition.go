@@ -0,0 +1,93 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// DispositionProp is the dead property overriding the Content-Disposition
+// type of a single resource, with the value "attachment" or "inline".
+const DispositionProp = extNS + ":content-disposition"
+
+// WithContentDisposition sends a Content-Disposition header of the given
+// type, "attachment" or "inline", with the name of the file when serving
+// GET. Resources may override the type with DispositionProp.
+func WithContentDisposition(disposition string) Option {
+	return func(s *WebDAV) {
+		s.disposition = disposition
+	}
+}
+
+// setDisposition sets the Content-Disposition header for a file.
+func (s *WebDAV) setDisposition(w http.ResponseWriter, f File) {
+	d := s.disposition
+	if v, ok := f.GetProp(DispositionProp); ok {
+		switch v = strings.ToLower(strings.TrimSpace(v)); v {
+		case "attachment", "inline":
+			d = v
+		}
+	}
+	if d == "" {
+		return
+	}
+	w.Header().Set("Content-Disposition", contentDisposition(d, path.Base(f.GetPath())))
+}
+
+// contentDisposition formats a Content-Disposition header as described by
+// RFC 6266, with an ASCII fallback for clients which do not understand the
+// UTF-8 encoded filename* parameter.
+func contentDisposition(d, name string) string {
+	var ascii strings.Builder
+	isASCII := true
+	for _, r := range name {
+		switch {
+		case r >= 0x80:
+			isASCII = false
+			ascii.WriteByte('_')
+		case r < 0x20 || r == 0x7f || r == '"' || r == '\\' || r == '%':
+			ascii.WriteByte('_')
+		default:
+			ascii.WriteRune(r)
+		}
+	}
+	h := fmt.Sprintf(`%s; filename="%s"`, d, ascii.String())
+	if isASCII && ascii.String() == name {
+		return h
+	}
+
+	var enc strings.Builder
+	for _, b := range []byte(name) {
+		if isAttrChar(b) {
+			enc.WriteByte(b)
+		} else {
+			fmt.Fprintf(&enc, "%%%02X", b)
+		}
+	}
+	return h + "; filename*=UTF-8''" + enc.String()
+}
+
+// isAttrChar reports whether a byte may appear unencoded in an extended
+// parameter value, see RFC 8187 section 3.2.1.
+func isAttrChar(b byte) bool {
+	switch {
+	case 'a' <= b && b <= 'z', 'A' <= b && b <= 'Z', '0' <= b && b <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", b) >= 0
+}
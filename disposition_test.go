@@ -0,0 +1,33 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import "testing"
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		d, name, want string
+	}{
+		{"attachment", "report.pdf", `attachment; filename="report.pdf"`},
+		{"inline", `a "b".txt`, `inline; filename="a _b_.txt"; filename*=UTF-8''a%20%22b%22.txt`},
+		{"attachment", "naïve résumé.txt", `attachment; filename="na_ve r_sum_.txt"; filename*=UTF-8''na%C3%AFve%20r%C3%A9sum%C3%A9.txt`},
+		{"attachment", "100%.txt", `attachment; filename="100_.txt"; filename*=UTF-8''100%25.txt`},
+	}
+	for _, tt := range tests {
+		if got := contentDisposition(tt.d, tt.name); got != tt.want {
+			t.Errorf("contentDisposition(%q, %q) = %s, want %s", tt.d, tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"net/http"
+
+	wp "github.com/google/go-webdav/path"
+)
+
+// dropBoxFor gets the drop-box collection containing the given path.
+func (s *WebDAV) dropBoxFor(p string) (string, bool) {
+	for _, box := range s.DropBoxes {
+		if wp.InTree(p, box) {
+			return box, true
+		}
+	}
+	return "", false
+}
+
+// checkDropBox applies drop-box semantics to a request within the given
+// drop-box: new files and collections may be added, but nothing may be
+// read, listed (beyond the drop-box itself), overwritten or removed. A
+// lock-null resource may be written by the holder of its lock, as clients
+// lock a new name before uploading to it.
+func (s *WebDAV) checkDropBox(ctx *context, r *http.Request, box string) error {
+	exists := false
+	if _, err := ctx.p.Lookup(); err == nil {
+		exists = true
+	}
+	if exists && r.Method == "PUT" && ctx.cond != nil && s.lm.heldLockNull(ctx.p.String(), ctx.cond.GetAllTokens()) {
+		exists = false
+	}
+
+	switch r.Method {
+	case "OPTIONS", "UNLOCK":
+		return nil
+	case "PUT", "MKCOL", "LOCK":
+		if exists {
+			return ErrorDropBox
+		}
+		return nil
+	case "PROPFIND":
+		if ctx.p.String() != box {
+			return ErrorDropBox
+		}
+		ctx.depth = 0
+		return nil
+	}
+	return ErrorDropBox
+}
@@ -0,0 +1,74 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+func TestDropBox(t *testing.T) {
+	h := webdav.NewWebDAV(memfs.NewMemFS(), webdav.WithDropBoxes("/box"))
+	serve(h, "MKCOL", "/box", "")
+	if w := serve(h, "PUT", "/box/secret.txt", "s"); w.Code != http.StatusCreated {
+		t.Fatalf("PUT into a drop box got %d", w.Code)
+	}
+	for _, m := range []string{"GET", "PUT", "DELETE"} {
+		if w := serve(h, m, "/box/secret.txt", "t"); w.Code != http.StatusForbidden {
+			t.Errorf("%s of a file in a drop box got %d, want 403", m, w.Code)
+		}
+	}
+
+	// Listings name the drop box but none of its members.
+	for _, p := range []string{"/", "/box"} {
+		w := serve(h, "PROPFIND", p, propfindETag, "Depth", "infinity")
+		if w.Code != http.StatusMultiStatus || strings.Contains(w.Body.String(), "secret") {
+			t.Errorf("PROPFIND of %s got %d:\n%s", p, w.Code, w.Body)
+		}
+		if !strings.Contains(w.Body.String(), "<href>/box</href>") {
+			t.Errorf("PROPFIND of %s did not list the drop box:\n%s", p, w.Body)
+		}
+	}
+}
+
+// TestDropBoxLockNull checks the sequence of Finder and Explorer, which lock
+// a new name before uploading to it.
+func TestDropBoxLockNull(t *testing.T) {
+	h := webdav.NewWebDAV(memfs.NewMemFS(), webdav.WithDropBoxes("/box"))
+	serve(h, "MKCOL", "/box", "")
+	const lockBody = `<lockinfo xmlns="DAV:"><lockscope><exclusive/></lockscope><locktype><write/></locktype></lockinfo>`
+	w := serve(h, "LOCK", "/box/new.txt", lockBody, "Depth", "0")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("LOCK of a new name got %d", w.Code)
+	}
+	tok := w.Header().Get("Lock-Token")
+
+	if w := serve(h, "PUT", "/box/new.txt", "x"); w.Code != http.StatusForbidden && w.Code != webdav.StatusLocked {
+		t.Errorf("PUT without the token got %d", w.Code)
+	}
+	if w := serve(h, "PUT", "/box/new.txt", "x", "If", "("+tok+")"); w.Code/100 != 2 {
+		t.Errorf("PUT with the token got %d:\n%s", w.Code, w.Body)
+	}
+	if w := serve(h, "PUT", "/box/new.txt", "y", "If", "("+tok+")"); w.Code != http.StatusForbidden {
+		t.Errorf("second PUT with the token got %d, want 403", w.Code)
+	}
+	if w := serve(h, "UNLOCK", "/box/new.txt", "", "Lock-Token", tok); w.Code != http.StatusNoContent {
+		t.Errorf("UNLOCK got %d", w.Code)
+	}
+}
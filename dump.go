@@ -0,0 +1,193 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	wp "github.com/google/go-webdav/path"
+)
+
+// DumpFormat selects how state is serialized by Dump.
+type DumpFormat int
+
+const (
+	// DumpText produces a human readable, indented tree.
+	DumpText DumpFormat = iota
+	// DumpJSON produces a machine readable JSON document.
+	DumpJSON
+)
+
+// ParseDumpFormat gets the DumpFormat with the given name, defaulting to
+// DumpText for unknown names.
+func ParseDumpFormat(name string) DumpFormat {
+	if name == "json" {
+		return DumpJSON
+	}
+	return DumpText
+}
+
+// DumpEntry describes a single resource in a state dump.
+type DumpEntry struct {
+	Path     string            `json:"path"`
+	Dir      bool              `json:"dir"`
+	Size     int64             `json:"size"`
+	Modified time.Time         `json:"modified"`
+	Props    map[string]string `json:"props,omitempty"`
+}
+
+// WriteDump serializes the given entries in the requested format, it is
+// provided so that FileSystem implementations need only collect entries.
+func WriteDump(w io.Writer, format DumpFormat, entries []DumpEntry) error {
+	sort.Sort(byPath(entries))
+	if format == DumpJSON {
+		if entries == nil {
+			entries = []DumpEntry{}
+		}
+		return json.NewEncoder(w).Encode(entries)
+	}
+
+	for _, e := range entries {
+		indent := strings.Repeat("  ", depthOf(e.Path))
+		name := path.Base(e.Path)
+		if e.Dir {
+			if name != "/" {
+				name += "/"
+			}
+			_, err := fmt.Fprintf(w, "%s%s\n", indent, name)
+			if err != nil {
+				return err
+			}
+		} else {
+			_, err := fmt.Fprintf(w, "%s%s (%d bytes, %s)\n", indent, name, e.Size,
+				e.Modified.Format(time.RFC3339))
+			if err != nil {
+				return err
+			}
+		}
+
+		keys := make([]string, 0, len(e.Props))
+		for k := range e.Props {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			_, err := fmt.Fprintf(w, "%s  @%s = %q\n", indent, k, e.Props[k])
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type byPath []DumpEntry
+
+func (b byPath) Len() int           { return len(b) }
+func (b byPath) Less(i, j int) bool { return b[i].Path < b[j].Path }
+func (b byPath) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+
+func depthOf(p string) int {
+	if p == "/" {
+		return 0
+	}
+	return strings.Count(p, "/")
+}
+
+// Dump writes a snapshot of the served FileSystem, including properties,
+// along with the current lock state.
+func (s *WebDAV) Dump(w io.Writer, format DumpFormat) error {
+	locks := s.Snapshot().Locks
+
+	if format == DumpJSON {
+		var fs bytes.Buffer
+		if err := s.fs.Dump(&fs, format); err != nil {
+			return err
+		}
+		if locks == nil {
+			locks = []LockState{}
+		}
+		return json.NewEncoder(w).Encode(struct {
+			Files json.RawMessage `json:"files"`
+			Locks []LockState     `json:"locks"`
+		}{json.RawMessage(bytes.TrimSpace(fs.Bytes())), locks})
+	}
+
+	if _, err := fmt.Fprintln(w, "files:"); err != nil {
+		return err
+	}
+	if err := s.fs.Dump(w, format); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(w, "locks:"); err != nil {
+		return err
+	}
+	for _, l := range locks {
+		_, err := fmt.Fprintf(w, "%s depth=%d token=%s expires=%s remaining=%s\n",
+			wp.URLEncode(l.Path), l.Depth, l.Token, l.Expires.Format(time.RFC3339), l.Remaining)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// debugEndpoint gets the handler of the debug endpoint at a path, if any.
+func (s *WebDAV) debugEndpoint(p string) http.HandlerFunc {
+	switch p {
+	case "/dumpz":
+		return s.serveDump
+	case "/configz":
+		return s.serveConfig
+	case "/checkz":
+		return s.serveCheck
+	case "/jobz":
+		return s.serveJobs
+	}
+	return nil
+}
+
+// DebugHandler gets a handler serving only the debug endpoints: /dumpz,
+// /configz, /checkz and /jobz. It serves them whether or not Debug is set,
+// so is meant for a listener of its own, reachable only by administrators,
+// without shadowing files of the same names.
+func (s *WebDAV) DebugHandler() http.Handler {
+	mux := http.NewServeMux()
+	for _, p := range []string{"/dumpz", "/configz", "/checkz", "/jobz"} {
+		mux.Handle(p, s.debugEndpoint(p))
+	}
+	return mux
+}
+
+// serveDump serves the /dumpz debug endpoint, a dump of all files.
+func (s *WebDAV) serveDump(w http.ResponseWriter, r *http.Request) {
+	format := ParseDumpFormat(r.URL.Query().Get("format"))
+	if format == DumpJSON {
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	if err := s.Dump(w, format); err != nil {
+		s.logger.Printf("dump failed: %s", err)
+	}
+}
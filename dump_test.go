@@ -0,0 +1,90 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+func TestDump(t *testing.T) {
+	h := webdav.NewWebDAV(memfs.NewMemFS(), webdav.WithDebug())
+	serve(h, "MKCOL", "/d", "")
+	serve(h, "PUT", "/d/a", "hello")
+	serve(h, "PROPPATCH", "/d/a", `<propertyupdate xmlns="DAV:"><set><prop><color xmlns="urn:x:">red</color></prop></set></propertyupdate>`)
+
+	w := serve(h, "GET", "/dumpz", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "  a (5 bytes, ") || !strings.Contains(w.Body.String(), `@urn:x::color = "red"`) {
+		t.Errorf("GET /dumpz got %d:\n%s", w.Code, w.Body)
+	}
+
+	w = serve(h, "GET", "/dumpz?format=json", "")
+	var dump struct {
+		Files []webdav.DumpEntry `json:"files"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &dump); err != nil {
+		t.Fatalf("GET /dumpz?format=json got %s: %v", w.Body, err)
+	}
+	if len(dump.Files) != 3 || dump.Files[2].Path != "/d/a" || dump.Files[2].Size != 5 {
+		t.Errorf("JSON dump got %+v", dump.Files)
+	}
+}
+
+// TestDumpDisabled checks the dump, which reveals lock tokens, is only
+// served when debugging, and otherwise does not hide a file of that name.
+func TestDumpDisabled(t *testing.T) {
+	h := webdav.NewWebDAV(memfs.NewMemFS())
+	serve(h, "PUT", "/a", "a")
+	if w := serve(h, "GET", "/dumpz", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET /dumpz without debugging got %d, want 404:\n%s", w.Code, w.Body)
+	}
+	serve(h, "PUT", "/dumpz", "mine")
+	if w := serve(h, "GET", "/dumpz", ""); w.Body.String() != "mine" {
+		t.Errorf("GET of a file named /dumpz got %q", w.Body)
+	}
+}
+
+func TestConfigz(t *testing.T) {
+	h := webdav.NewWebDAV(memfs.NewMemFS(), webdav.WithDebug(), webdav.WithReadOnly())
+	w := serve(h, "GET", "/configz", "")
+	var c webdav.Config
+	if err := json.Unmarshal(w.Body.Bytes(), &c); err != nil || !c.Debug || !c.ReadOnly {
+		t.Errorf("GET /configz got %+v: %v", c, err)
+	}
+
+	// Without debugging, a file of that name is served instead, and the
+	// endpoints are only served by DebugHandler.
+	h = webdav.NewWebDAV(memfs.NewMemFS())
+	if w := serve(h, "GET", "/configz", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET /configz without debugging got %d, want 404", w.Code)
+	}
+	serve(h, "PUT", "/configz", "mine")
+	if w := serve(h, "GET", "/configz", ""); w.Body.String() != "mine" {
+		t.Errorf("GET of a file named /configz got %q", w.Body)
+	}
+	for _, p := range []string{"/configz", "/dumpz", "/checkz", "/jobz"} {
+		if w := serve(h.DebugHandler(), "GET", p, ""); w.Code != http.StatusOK || w.Body.String() == "mine" {
+			t.Errorf("GET %s of DebugHandler got %d %q", p, w.Code, w.Body)
+		}
+	}
+	if w := serve(h.DebugHandler(), "GET", "/a", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET of a file from DebugHandler got %d, want 404", w.Code)
+	}
+}
@@ -15,8 +15,12 @@
 package webdav
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"net/http"
+	"syscall"
+	"time"
 )
 
 // http://www.webdav.org/specs/rfc4918.html#status.code.extensions.to.http11
@@ -36,40 +40,216 @@ var extStatusText = map[int]string{
 	StatusInsufficientStorage: "Insufficient Storage",
 }
 
-// Error is the common error type used for webdav methods.
+// ErrorCode is a stable, machine-readable name for an Error, reported by
+// Error.Code. The set of codes only grows: existing codes are never renamed
+// or given a different meaning.
+type ErrorCode string
+
+// Codes of the errors reportable from the API.
+const (
+	CodeNotYetImplemented   ErrorCode = "TODO"
+	CodeBadPath             ErrorCode = "BadPath"
+	CodeBadRequest          ErrorCode = "BadRequest"
+	CodeNotFound            ErrorCode = "NotFound"
+	CodeForbidden           ErrorCode = "Forbidden"
+	CodeInsufficientStorage ErrorCode = "InsufficientStorage"
+	CodeNotAcceptable       ErrorCode = "NotAcceptable"
+	CodeConflict            ErrorCode = "Conflict"
+	CodeNotAllowed          ErrorCode = "NotAllowed"
+	CodeUnsupportedType     ErrorCode = "UnsupportedType"
+	CodeIsDir               ErrorCode = "IsDir"
+	CodeIsNotDir            ErrorCode = "IsNotDir"
+	CodeMissingParent       ErrorCode = "MissingParent"
+	CodeUnderrun            ErrorCode = "Underrun"
+	CodeBadHost             ErrorCode = "BadHost"
+	CodeBadDepth            ErrorCode = "BadDepth"
+	CodeBadDest             ErrorCode = "BadDest"
+	CodeBadPropfind         ErrorCode = "BadPropfind"
+	CodeBadReport           ErrorCode = "BadReport"
+	CodeDestExists          ErrorCode = "DestExists"
+	CodePreconditionFailed  ErrorCode = "PreconditionFailed"
+	CodeSameFile            ErrorCode = "SameFile"
+	CodeBadProppatch        ErrorCode = "BadProppatch"
+	CodeLocked              ErrorCode = "Locked"
+	CodeBadLock             ErrorCode = "BadLock"
+	CodeBadSubscription     ErrorCode = "BadSubscription"
+	CodeDropBox             ErrorCode = "DropBox"
+	CodeRetained            ErrorCode = "Retained"
+	CodeFiniteDepth         ErrorCode = "FiniteDepth"
+	CodePropQuota           ErrorCode = "PropQuota"
+	CodePropTooLarge        ErrorCode = "PropTooLarge"
+	CodeInvalidCalendarData ErrorCode = "InvalidCalendarData"
+	CodeInvalidAddressData  ErrorCode = "InvalidAddressData"
+	CodeInvalidSyncToken    ErrorCode = "InvalidSyncToken"
+	CodeLockTokenMismatch   ErrorCode = "LockTokenMismatch"
+	CodeNotImplemented      ErrorCode = "NotImplemented"
+	CodeBadRange            ErrorCode = "BadRange"
+	CodeSlowClient          ErrorCode = "SlowClient"
+	CodeBadName             ErrorCode = "BadName"
+	CodeBadSearch           ErrorCode = "BadSearch"
+	CodeUnavailable         ErrorCode = "Unavailable"
+	CodeTooLarge            ErrorCode = "TooLarge"
+)
+
+// Error is the common error type used for webdav methods. Backends should
+// return one of the Error values below, optionally using WithCause to
+// attach the underlying error; errors.Is matches errors with causes against
+// the plain values.
 type Error struct {
-	code  int
-	text  string
-	cause error
+	code      int
+	text      ErrorCode
+	condition string
+	cause     error
+	// resources are the paths the condition is about, a pointer keeping
+	// Errors comparable.
+	resources *[]string
+	// retryAfter is when the client may retry, reported with the
+	// Retry-After header.
+	retryAfter time.Duration
 }
 
+// extNS is the XML namespace used for conditions and properties that are
+// specific to this implementation.
+const extNS = "http://github.com/google/go-webdav/"
+
 // Error codes that are reportable from the API.
 var (
 	// ErrorNotYetImplemented is intended for use for code in progress.
-	ErrorNotYetImplemented = Error{code: http.StatusTeapot, text: "TODO"}
-	ErrorBadPath           = Error{code: http.StatusBadRequest, text: "BadPath"}
-	ErrorNotFound          = Error{code: http.StatusNotFound, text: "NotFound"}
-	ErrorConflict          = Error{code: http.StatusConflict, text: "Conflict"}
-	ErrorNotAllowed        = Error{code: http.StatusMethodNotAllowed, text: "NotAllowed"}
-	ErrorUnsupportedType   = Error{code: http.StatusUnsupportedMediaType, text: "UnsupportedType"}
-	ErrorIsDir             = Error{code: http.StatusMethodNotAllowed, text: "IsDir"}
-	ErrorIsNotDir          = Error{code: http.StatusMethodNotAllowed, text: "IsNotDir"}
-	ErrorMissingParent     = Error{code: http.StatusConflict, text: "MissingParent"}
-	ErrorUnderrun          = Error{code: http.StatusBadRequest, text: "Underrun"}
-	ErrorBadHost           = Error{code: http.StatusBadGateway, text: "BadHost"}
-	ErrorBadDepth          = Error{code: http.StatusBadRequest, text: "BadDepth"}
-	ErrorBadDest           = Error{code: http.StatusBadRequest, text: "BadDest"}
-	ErrorBadPropfind       = Error{code: http.StatusBadRequest, text: "BadPropfind"}
-	ErrorDestExists        = Error{code: http.StatusPreconditionFailed, text: "DestExists"}
-	ErrorSameFile          = Error{code: http.StatusForbidden, text: "SameFile"}
-	ErrorBadProppatch      = Error{code: http.StatusBadRequest, text: "BadProppatch"}
-	ErrorLocked            = Error{code: StatusLocked, text: "Locked"}
-	ErrorBadLock           = Error{code: http.StatusBadRequest, text: "BadLock"}
+	ErrorNotYetImplemented = Error{code: http.StatusTeapot, text: CodeNotYetImplemented}
+	ErrorBadPath           = Error{code: http.StatusBadRequest, text: CodeBadPath}
+	ErrorBadRequest        = Error{code: http.StatusBadRequest, text: CodeBadRequest}
+	ErrorNotFound          = Error{code: http.StatusNotFound, text: CodeNotFound}
+	ErrorForbidden         = Error{code: http.StatusForbidden, text: CodeForbidden}
+	ErrorConflict          = Error{code: http.StatusConflict, text: CodeConflict}
+	ErrorNotAllowed        = Error{code: http.StatusMethodNotAllowed, text: CodeNotAllowed}
+	ErrorNotAcceptable     = Error{code: http.StatusNotAcceptable, text: CodeNotAcceptable}
+	ErrorUnsupportedType   = Error{code: http.StatusUnsupportedMediaType, text: CodeUnsupportedType}
+	ErrorIsDir             = Error{code: http.StatusMethodNotAllowed, text: CodeIsDir}
+	ErrorIsNotDir          = Error{code: http.StatusMethodNotAllowed, text: CodeIsNotDir}
+	ErrorMissingParent     = Error{code: http.StatusConflict, text: CodeMissingParent}
+	ErrorUnderrun          = Error{code: http.StatusBadRequest, text: CodeUnderrun}
+	ErrorBadHost           = Error{code: http.StatusBadGateway, text: CodeBadHost}
+	ErrorBadDepth          = Error{code: http.StatusBadRequest, text: CodeBadDepth}
+	ErrorBadDest           = Error{code: http.StatusBadRequest, text: CodeBadDest}
+	ErrorBadPropfind       = Error{code: http.StatusBadRequest, text: CodeBadPropfind}
+	ErrorBadReport         = Error{code: http.StatusBadRequest, text: CodeBadReport}
+	ErrorDestExists        = Error{code: http.StatusPreconditionFailed, text: CodeDestExists}
+	ErrorPrecondition      = Error{code: http.StatusPreconditionFailed, text: CodePreconditionFailed}
+	ErrorSameFile          = Error{code: http.StatusForbidden, text: CodeSameFile}
+	ErrorBadProppatch      = Error{code: http.StatusBadRequest, text: CodeBadProppatch}
+	ErrorLocked            = Error{code: StatusLocked, text: CodeLocked}
+	ErrorBadLock           = Error{code: http.StatusBadRequest, text: CodeBadLock}
+	ErrorBadSubscription   = Error{code: http.StatusPreconditionFailed, text: CodeBadSubscription}
+	ErrorDropBox           = Error{code: http.StatusForbidden, text: CodeDropBox}
+	ErrorRetained          = Error{code: http.StatusForbidden, text: CodeRetained, condition: extNS + ":retention-period-expired"}
+	ErrorFiniteDepth       = Error{code: http.StatusForbidden, text: CodeFiniteDepth, condition: "DAV::propfind-finite-depth"}
+	ErrorPropQuota         = Error{code: StatusInsufficientStorage, text: CodePropQuota, condition: "DAV::quota-not-exceeded"}
+	ErrorPropTooLarge      = Error{code: http.StatusForbidden, text: CodePropTooLarge, condition: extNS + ":max-property-size"}
+	ErrorProtectedProp     = Error{code: http.StatusForbidden, text: CodeForbidden, condition: "DAV::cannot-modify-protected-property"}
+	ErrorNotImplemented    = Error{code: http.StatusNotImplemented, text: CodeNotImplemented}
+	ErrorBadRange          = Error{code: http.StatusRequestedRangeNotSatisfiable, text: CodeBadRange}
+	ErrorSlowClient        = Error{code: http.StatusRequestTimeout, text: CodeSlowClient}
+	ErrorBadName           = Error{code: http.StatusForbidden, text: CodeBadName, condition: extNS + ":name-allowed"}
+	ErrorBadSearch         = Error{code: http.StatusBadRequest, text: CodeBadSearch, condition: "DAV::search-grammar-supported"}
+	ErrorBadSearchScope    = Error{code: http.StatusBadRequest, text: CodeBadSearch, condition: "DAV::search-scope-valid"}
+	ErrorUnavailable       = Error{code: http.StatusServiceUnavailable, text: CodeUnavailable}
+	ErrorTooLarge          = Error{code: http.StatusRequestEntityTooLarge, text: CodeTooLarge}
+
+	// ErrorLockTokenSubmitted and ErrorNoConflictingLock are ErrorLocked
+	// with the conditions of RFC 4918 section 16, which name the roots of
+	// the locks concerned, see WithResources.
+	ErrorLockTokenSubmitted = Error{code: StatusLocked, text: CodeLocked, condition: "DAV::lock-token-submitted"}
+	ErrorNoConflictingLock  = Error{code: StatusLocked, text: CodeLocked, condition: "DAV::no-conflicting-lock"}
+	ErrorLockTokenMismatch  = Error{code: http.StatusConflict, text: CodeLockTokenMismatch, condition: "DAV::lock-token-matches-request-uri"}
+
+	// ErrorInvalidSyncToken rejects a sync-collection REPORT with a sync
+	// token which is unknown or no longer valid, as required by RFC 6578.
+	ErrorInvalidSyncToken = Error{code: http.StatusForbidden, text: CodeInvalidSyncToken, condition: "DAV::valid-sync-token"}
+
+	// ErrorInsufficientStorage is typically produced by FromOSError for
+	// backends which ran out of space or quota.
+	ErrorInsufficientStorage = Error{code: StatusInsufficientStorage, text: CodeInsufficientStorage}
+
+	// ErrorInvalidCalendarData and ErrorInvalidAddressData are intended
+	// for use by a ContentValidator rejecting malformed uploads.
+	ErrorInvalidCalendarData = Error{code: http.StatusForbidden, text: CodeInvalidCalendarData, condition: "urn:ietf:params:xml:ns:caldav:valid-calendar-data"}
+	ErrorInvalidAddressData  = Error{code: http.StatusForbidden, text: CodeInvalidAddressData, condition: "urn:ietf:params:xml:ns:carddav:valid-address-data"}
 )
 
+// FromOSError translates errors commonly returned by backends, such as
+// those from the os package, io/fs sentinels and syscall errnos, into the
+// corresponding Error, so backends returning plain errors still report the
+// right status to clients. Errors which are already an Error, and those not
+// recognized, are returned unchanged.
+func FromOSError(err error) error {
+	var we Error
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &we):
+		return err
+	case errors.Is(err, syscall.ENOSPC), errors.Is(err, syscall.EDQUOT):
+		return ErrorInsufficientStorage.WithCause(err)
+	case errors.Is(err, syscall.ENOTEMPTY), errors.Is(err, syscall.ENOTDIR):
+		return ErrorConflict.WithCause(err)
+	case errors.Is(err, syscall.EISDIR):
+		return ErrorIsDir.WithCause(err)
+	case errors.Is(err, syscall.ENAMETOOLONG):
+		return ErrorBadPath.WithCause(err)
+	case errors.Is(err, syscall.EROFS):
+		return ErrorForbidden.WithCause(err)
+	case errors.Is(err, fs.ErrNotExist):
+		return ErrorNotFound.WithCause(err)
+	case errors.Is(err, fs.ErrPermission):
+		return ErrorForbidden.WithCause(err)
+	}
+	return err
+}
+
 // WithCause is used to chain a cause onto a reported HTTP error code.
 func (e Error) WithCause(cause error) Error {
-	return Error{code: e.code, text: e.text, cause: cause}
+	e.cause = cause
+	return e
+}
+
+// WithResources attaches the paths of the resources the condition of the
+// error is about, such as the roots of the locks which conflict, which are
+// reported as hrefs in the response body.
+func (e Error) WithResources(paths ...string) Error {
+	e.resources = &paths
+	return e
+}
+
+// Resources gets the paths attached with WithResources.
+func (e Error) Resources() []string {
+	if e.resources == nil {
+		return nil
+	}
+	return *e.resources
+}
+
+// WithRetryAfter sets how long the client should wait before retrying, such
+// as for ErrorUnavailable, reported with the Retry-After header.
+func (e Error) WithRetryAfter(d time.Duration) Error {
+	e.retryAfter = d
+	return e
+}
+
+// RetryAfter gets the wait set with WithRetryAfter, zero if none was.
+func (e Error) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+// Code gets the machine-readable name of the error.
+func (e Error) Code() ErrorCode {
+	return e.text
+}
+
+// Condition gets the name of the precondition or postcondition that the
+// error violates, to be reported in the response body. It is empty if the
+// error carries no condition.
+func (e Error) Condition() string {
+	return e.condition
 }
 
 // HTTPCode gets the HTTP error code appropriate for the error.
@@ -91,6 +271,19 @@ func (e Error) InternalCause() error {
 	return e.cause
 }
 
+// Unwrap gets the underlying cause of the error, so that errors.Is and
+// errors.As may inspect it.
+func (e Error) Unwrap() error {
+	return e.cause
+}
+
+// Is reports whether the target is an Error with the same status and code,
+// ignoring causes.
+func (e Error) Is(target error) bool {
+	t, ok := target.(Error)
+	return ok && t.code == e.code && t.text == e.text
+}
+
 func (e Error) Error() string {
 	if e.cause != nil {
 		return fmt.Sprintf("%d %s : %s (%s)", e.code, e.HTTPStatus(), e.text, e.cause)
@@ -0,0 +1,281 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	wp "github.com/google/go-webdav/path"
+)
+
+// ChangeKind identifies the type of mutation a Change describes.
+type ChangeKind int
+
+// Kinds of changes reported to subscribers.
+const (
+	ChangeCreated ChangeKind = iota
+	ChangeModified
+	ChangeRemoved
+	ChangeMoved
+	ChangeCopied
+	ChangeProps
+	// ChangeUnlocked reports a lock broken, see StaleLockPolicy.
+	ChangeUnlocked
+)
+
+var changeKindNames = map[ChangeKind]string{
+	ChangeCreated:  "created",
+	ChangeModified: "modified",
+	ChangeRemoved:  "removed",
+	ChangeMoved:    "moved",
+	ChangeCopied:   "copied",
+	ChangeProps:    "props",
+	ChangeUnlocked: "unlocked",
+}
+
+func (k ChangeKind) String() string {
+	return changeKindNames[k]
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (k ChangeKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (k *ChangeKind) UnmarshalText(b []byte) error {
+	for kind, name := range changeKindNames {
+		if name == string(b) {
+			*k = kind
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown change kind %q", b)
+}
+
+// Change describes a single successful mutation made through the handler.
+type Change struct {
+	// Seq numbers the change in the journal, see ChangesSince.
+	Seq  uint64     `json:"seq"`
+	Kind ChangeKind `json:"kind"`
+	Path string     `json:"path"`
+	// Destination is the target path for ChangeMoved and ChangeCopied.
+	Destination string    `json:"destination,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+// affects reports whether the change touches the given subtree.
+func (c Change) affects(subtree string) bool {
+	if wp.InTree(c.Path, subtree) {
+		return true
+	}
+	return c.Destination != "" && wp.InTree(c.Destination, subtree)
+}
+
+// subscriberBuffer is the number of changes buffered for each subscriber,
+// changes are dropped for subscribers which fall further behind.
+const subscriberBuffer = 64
+
+type subscriber struct {
+	subtree string
+	c       chan Change
+}
+
+type changeFeed struct {
+	m    sync.Mutex
+	subs map[*subscriber]bool
+}
+
+// publish delivers a change to subscribers, returning the number of
+// subscribers it was dropped for.
+func (f *changeFeed) publish(c Change) (dropped int) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	for s := range f.subs {
+		if !c.affects(s.subtree) {
+			continue
+		}
+		select {
+		case s.c <- c:
+		default:
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// Subscribe registers for changes affecting the given subtree. Changes are
+// delivered on the returned channel until the returned cancel function is
+// called, after which the channel is closed.
+func (s *WebDAV) Subscribe(subtree string) (<-chan Change, func()) {
+	sub := &subscriber{subtree: subtree, c: make(chan Change, subscriberBuffer)}
+	s.feed.m.Lock()
+	if s.feed.subs == nil {
+		s.feed.subs = make(map[*subscriber]bool)
+	}
+	s.feed.subs[sub] = true
+	s.feed.m.Unlock()
+
+	var once sync.Once
+	return sub.c, func() {
+		once.Do(func() {
+			s.feed.m.Lock()
+			delete(s.feed.subs, sub)
+			s.feed.m.Unlock()
+			close(sub.c)
+		})
+	}
+}
+
+// notify records a change in the journal and reports it to all interested
+// subscribers.
+func (s *WebDAV) notify(kind ChangeKind, p, dst string) {
+	c := Change{Kind: kind, Path: p, Destination: dst, Time: s.clock.Now()}
+	s.overlayChange(c)
+	s.record(c, func(c Change) {
+		if n := s.feed.publish(c); n > 0 {
+			s.logger.Printf("dropping change %s %s for %d slow subscribers", c.Kind, c.Path, n)
+		}
+		s.sm.changed(c)
+		s.lm.changed(c)
+	})
+}
+
+// wantsEventStream determines if the request is a subscription to changes
+// as Server-Sent Events.
+func wantsEventStream(r *http.Request) bool {
+	return r.Method == "GET" && strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// serveEventStream streams changes to the requested subtree as Server-Sent
+// Events until the client goes away. Events carry the sequence number of
+// the change as their ID, so a client reconnecting with Last-Event-ID is
+// first sent the changes it missed, or a "truncated" event if the journal
+// no longer holds them.
+func (s *WebDAV) serveEventStream(w http.ResponseWriter, r *http.Request) {
+	ctx, err := s.extractContext(r)
+	if err != nil {
+		s.errorHeader(ctx, w, err)
+		return
+	}
+	if err := s.checkEventStream(&ctx, r); err != nil {
+		s.errorHeader(ctx, w, err)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+
+	subtree := ctx.p.String()
+	changes, cancel := s.Subscribe(subtree)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	var last uint64
+	send := func(c Change) error {
+		last = c.Seq
+		if !s.changeVisible(c) {
+			return nil
+		}
+		b, err := json.Marshal(c)
+		if err != nil {
+			s.logger.Printf("could not encode change: %s", err)
+			return nil
+		}
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", c.Seq, c.Kind, b)
+		return err
+	}
+
+	if id, err := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64); err == nil {
+		missed, err := s.ChangesSince(id)
+		if err != nil {
+			s.logger.Printf("replaying changes since %d: %s", id, err)
+			fmt.Fprint(w, "event: truncated\ndata:\n\n")
+		}
+		for _, c := range missed {
+			if !c.affects(subtree) {
+				continue
+			}
+			if send(c) != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case c := <-changes:
+			if c.Seq <= last {
+				// Already sent while replaying.
+				continue
+			}
+			if send(c) != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// checkEventStream refuses to stream the changes to a subtree which could
+// not be read by GET: hidden ones, drop boxes and their contents, and those
+// where GET is disabled.
+func (s *WebDAV) checkEventStream(ctx *context, r *http.Request) error {
+	if s.isHiddenPath(ctx.p) {
+		return ErrorNotFound
+	}
+	if box, ok := s.dropBoxFor(ctx.p.String()); ok {
+		if err := s.checkDropBox(ctx, r, box); err != nil {
+			return err
+		}
+	}
+	if s.methodDisabled(ctx.p.String(), r.Method) {
+		return ErrorNotAllowed
+	}
+	return nil
+}
+
+// changeVisible determines if a change may be streamed to clients, which
+// it may not if either of its paths is hidden or within a drop box.
+func (s *WebDAV) changeVisible(c Change) bool {
+	for _, p := range []string{c.Path, c.Destination} {
+		if p == "" {
+			continue
+		}
+		if _, ok := s.dropBoxFor(p); ok {
+			return false
+		}
+		// Whether the resource was a collection is not known.
+		if s.hiddenByRules(p, false) || s.hiddenByRules(p, true) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,117 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+// openStream requests the event stream of a path, failing the test rather
+// than blocking if the handler does not answer.
+func openStream(t *testing.T, srv *httptest.Server, p, lastID string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest("GET", srv.URL+p, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	c := &http.Client{Timeout: 5 * time.Second}
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s: %v", p, err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+	return res
+}
+
+// readEvents reads the data of events from a stream until one mentions
+// until.
+func readEvents(t *testing.T, res *http.Response, until string) []string {
+	t.Helper()
+	var events []string
+	sc := bufio.NewScanner(res.Body)
+	for sc.Scan() {
+		if d, ok := strings.CutPrefix(sc.Text(), "data: "); ok {
+			events = append(events, d)
+			if strings.Contains(d, until) {
+				return events
+			}
+		}
+	}
+	t.Fatalf("stream ended before %s: %v, read %v", until, sc.Err(), events)
+	return nil
+}
+
+func TestEventStream(t *testing.T) {
+	h := webdav.NewWebDAV(memfs.NewMemFS(), webdav.WithEventStream(),
+		webdav.WithHidden(".secret"), webdav.WithDropBoxes("/box"))
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	serve(h, "MKCOL", "/box", "")
+	serve(h, "PUT", "/a", "a")
+
+	res := openStream(t, srv, "/", "")
+	if ct := res.Header.Get("Content-Type"); res.StatusCode != http.StatusOK || ct != "text/event-stream" {
+		t.Fatalf("event stream got %d %q", res.StatusCode, ct)
+	}
+	serve(h, "PUT", "/.secret", "s")
+	serve(h, "PUT", "/box/b", "b")
+	serve(h, "MOVE", "/a", "", "Destination", "/box/a")
+	serve(h, "PUT", "/c", "c")
+	events := readEvents(t, res, `"/c"`)
+	if len(events) != 1 {
+		t.Errorf("stream sent changes to hidden resources or drop boxes: %v", events)
+	}
+
+	// Changes replayed after reconnecting are filtered too.
+	events = readEvents(t, openStream(t, srv, "/", "1"), `"/c"`)
+	for _, e := range events {
+		if strings.Contains(e, ".secret") || strings.Contains(e, "/box") {
+			t.Errorf("replay sent %s", e)
+		}
+	}
+}
+
+func TestEventStreamRefused(t *testing.T) {
+	h := webdav.NewWebDAV(memfs.NewMemFS(), webdav.WithEventStream(),
+		webdav.WithHidden(".secret"), webdav.WithDropBoxes("/box"))
+	h.DisableMethods("/frozen", "GET")
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	for _, p := range []string{"/box", "/.secret", "/frozen"} {
+		serve(h, "MKCOL", p, "")
+	}
+
+	for p, want := range map[string]int{
+		"/.secret": http.StatusNotFound,
+		"/box":     http.StatusForbidden,
+		"/frozen":  http.StatusMethodNotAllowed,
+	} {
+		if res := openStream(t, srv, p, ""); res.StatusCode != want {
+			t.Errorf("event stream of %s got %d, want %d", p, res.StatusCode, want)
+		}
+	}
+}
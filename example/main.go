@@ -23,8 +23,7 @@ import (
 )
 
 func main() {
-	srv := webdav.NewWebDAV(memfs.NewMemFS())
-	srv.Debug = true
+	srv := webdav.NewWebDAV(memfs.NewMemFS(), webdav.WithDebug())
 	log.Printf("Listening on http://localhost:8080/...")
 	err := http.ListenAndServe(":8080", srv)
 	if err != nil {
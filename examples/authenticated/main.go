@@ -0,0 +1,69 @@
+//go:build example
+
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command authenticated serves a local directory over WebDAV to the users of
+// an htpasswd file, who may also issue per-device app passwords at
+// /app-passwords.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/auth"
+	"github.com/google/go-webdav/osfs"
+)
+
+var (
+	addr     = flag.String("addr", "localhost:8080", "address to listen on")
+	htpasswd = flag.String("htpasswd", "", "htpasswd file of users")
+	root     = flag.String("root", ".", "directory to serve")
+)
+
+func newHandler(fs webdav.FileSystem, users auth.Authenticator, apps *auth.AppPasswords) http.Handler {
+	dav := webdav.NewWebDAV(fs,
+		webdav.WithAuthenticated(),
+		webdav.WithHardened(),
+		webdav.WithLimits(webdav.Limits{MaxPropfindDepth: 1}))
+
+	mux := http.NewServeMux()
+	mux.Handle("/app-passwords", auth.Basic(apps, users, "WebDAV"))
+	mux.Handle("/", &auth.BasicHandler{
+		Handler:       dav,
+		Authenticator: auth.Chain{users, apps},
+		Realm:         "WebDAV",
+		Throttle:      &auth.Throttle{},
+	})
+	return mux
+}
+
+func main() {
+	flag.Parse()
+	users, err := auth.NewHtpasswd(*htpasswd, time.Minute)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fs, err := osfs.New(*root)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fs.Close()
+	log.Printf("Serving %s on http://%s/...", *root, *addr)
+	log.Fatal(http.ListenAndServe(*addr, newHandler(fs, users, auth.NewAppPasswords())))
+}
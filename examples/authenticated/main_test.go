@@ -0,0 +1,65 @@
+//go:build example
+
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-webdav/auth"
+	"github.com/google/go-webdav/osfs"
+)
+
+func TestAuthenticated(t *testing.T) {
+	apps := auth.NewAppPasswords()
+	_, secret, err := apps.Create("alice", "laptop", auth.Scope{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	fs, err := osfs.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+	srv := httptest.NewServer(newHandler(fs, auth.Chain{}, apps))
+	defer srv.Close()
+
+	put := func(user, pass string) int {
+		req, _ := http.NewRequest("PUT", srv.URL+"/a.txt", strings.NewReader("a"))
+		req.SetBasicAuth(user, pass)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	if code := put("alice", "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("PUT with a bad password got %d, want 401", code)
+	}
+	if code := put("alice", secret); code != http.StatusCreated {
+		t.Errorf("PUT with an app password got %d, want 201", code)
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "a.txt")); err != nil || string(b) != "a" {
+		t.Errorf("served directory holds %q: %v", b, err)
+	}
+}
@@ -0,0 +1,61 @@
+//go:build example
+
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command caldav serves in-memory calendars and address books, checking
+// that uploaded iCalendar and vCard data is well-formed.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+	"github.com/google/go-webdav/vobject"
+)
+
+var addr = flag.String("addr", "localhost:8080", "address to listen on")
+
+func newHandler() http.Handler {
+	fs := memfs.NewMemFS()
+	dav := webdav.NewWebDAV(fs,
+		webdav.WithValidator("text/calendar", vobject.ValidateCalendar),
+		webdav.WithValidator("text/vcard", vobject.ValidateVCard))
+	for _, p := range []string{"/calendars", "/contacts"} {
+		fp, err := fs.ForPath(p)
+		if err == nil {
+			_, err = fp.Mkdir()
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Clients discover the collections through the well-known URIs of
+	// RFC 6764.
+	mux := http.NewServeMux()
+	mux.Handle("/.well-known/caldav", http.RedirectHandler("/calendars/", http.StatusMovedPermanently))
+	mux.Handle("/.well-known/carddav", http.RedirectHandler("/contacts/", http.StatusMovedPermanently))
+	mux.Handle("/", dav)
+	return mux
+}
+
+func main() {
+	flag.Parse()
+	log.Printf("Listening on http://%s/...", *addr)
+	log.Fatal(http.ListenAndServe(*addr, newHandler()))
+}
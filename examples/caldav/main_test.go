@@ -0,0 +1,59 @@
+//go:build example
+
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const event = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//example//EN\r\n" +
+	"BEGIN:VEVENT\r\nUID:1@example.com\r\nDTSTAMP:20240101T000000Z\r\n" +
+	"DTSTART:20240101T100000Z\r\nSUMMARY:Meeting\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+
+func TestCalDAV(t *testing.T) {
+	srv := httptest.NewServer(newHandler())
+	defer srv.Close()
+
+	put := func(body string) int {
+		req, _ := http.NewRequest("PUT", srv.URL+"/calendars/meeting.ics", strings.NewReader(body))
+		req.Header.Set("Content-Type", "text/calendar")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	if code := put("not a calendar"); code != http.StatusForbidden {
+		t.Errorf("PUT of invalid data got %d, want 403", code)
+	}
+	if code := put(event); code != http.StatusCreated {
+		t.Errorf("PUT of an event got %d, want 201", code)
+	}
+
+	res, err := http.Get(srv.URL + "/.well-known/caldav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.Request.URL.Path != "/calendars/" {
+		t.Errorf("well-known URI led to %s, want /calendars/", res.Request.URL.Path)
+	}
+}
@@ -0,0 +1,129 @@
+//go:build example
+
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command clientsync mirrors the files of a WebDAV server into a local
+// directory, downloading only those whose size or modification time
+// differ from the local copy.
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/go-webdav/client"
+)
+
+var (
+	base     = flag.String("url", "http://localhost:8080/", "URL of the collection to mirror")
+	dir      = flag.String("dir", ".", "directory to mirror into")
+	parallel = flag.Int("parallel", 4, "number of files to download at once")
+)
+
+type entry struct {
+	Path     string    `dav:",href"`
+	Dir      bool      `dav:",collection"`
+	Size     int64     `dav:"DAV::getcontentlength"`
+	Modified time.Time `dav:"DAV::getlastmodified"`
+}
+
+// list lists the files below a collection, a level at a time, as servers
+// may refuse PROPFIND of infinite depth.
+func list(ctx context.Context, c *client.Client, p string) ([]entry, error) {
+	var res []entry
+	if err := c.PropFindInto(ctx, p, 1, &res); err != nil {
+		return nil, err
+	}
+	var files []entry
+	for _, e := range res {
+		e.Path = path.Clean(e.Path)
+		switch {
+		case e.Path == path.Clean(p):
+		case e.Dir:
+			sub, err := list(ctx, c, e.Path)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, sub...)
+		default:
+			files = append(files, e)
+		}
+	}
+	return files, nil
+}
+
+// mirror downloads the changed files below the root into dir, which
+// confines them however the server names them, returning how many it
+// downloaded.
+func mirror(ctx context.Context, c *client.Client, dir *os.Root, n int) (int, error) {
+	files, err := list(ctx, c, "/")
+	if err != nil {
+		return 0, err
+	}
+	changed := map[string]entry{}
+	var paths []string
+	for _, e := range files {
+		local := strings.TrimPrefix(e.Path, "/")
+		if fi, err := dir.Stat(local); err == nil && fi.Size() == e.Size && fi.ModTime().Equal(e.Modified) {
+			continue
+		}
+		changed[e.Path] = e
+		paths = append(paths, e.Path)
+	}
+	tm := client.NewTransferManager(c, n)
+	err = tm.GetAll(ctx, paths, func(p string, r io.Reader) error {
+		local := strings.TrimPrefix(p, "/")
+		if err := dir.MkdirAll(path.Dir(local), 0o755); err != nil {
+			return err
+		}
+		f, err := dir.Create(local)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, r); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		return dir.Chtimes(local, time.Now(), changed[p].Modified)
+	})
+	return len(paths), err
+}
+
+func main() {
+	flag.Parse()
+	c, err := client.New(*base, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	root, err := os.OpenRoot(*dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer root.Close()
+	n, err := mirror(context.Background(), c, root, *parallel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Downloaded %d files into %s", n, *dir)
+}
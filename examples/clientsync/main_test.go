@@ -0,0 +1,79 @@
+//go:build example
+
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/client"
+	"github.com/google/go-webdav/memfs"
+)
+
+func TestClientSync(t *testing.T) {
+	srv := httptest.NewServer(webdav.NewWebDAV(memfs.NewMemFS()))
+	defer srv.Close()
+	c, err := client.New(srv.URL+"/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	put := func(p, body string) {
+		t.Helper()
+		res, err := c.Do(ctx, "PUT", p, strings.NewReader(body), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+	if res, err := c.Do(ctx, "MKCOL", "/d", nil, nil); err != nil {
+		t.Fatal(err)
+	} else {
+		res.Body.Close()
+	}
+	put("/a.txt", "a")
+	put("/d/b.txt", "b")
+
+	dir := t.TempDir()
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+	if n, err := mirror(ctx, c, root, 2); err != nil || n != 2 {
+		t.Fatalf("first mirror downloaded %d files: %v", n, err)
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "d", "b.txt")); err != nil || string(b) != "b" {
+		t.Errorf("mirrored d/b.txt holds %q: %v", b, err)
+	}
+	if n, err := mirror(ctx, c, root, 2); err != nil || n != 0 {
+		t.Errorf("mirror without changes downloaded %d files: %v", n, err)
+	}
+
+	put("/a.txt", "changed")
+	if n, err := mirror(ctx, c, root, 2); err != nil || n != 1 {
+		t.Errorf("mirror after a change downloaded %d files: %v", n, err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "a.txt")); string(b) != "changed" {
+		t.Errorf("mirrored a.txt holds %q", b)
+	}
+}
@@ -0,0 +1,39 @@
+//go:build example
+
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command minimal serves an in-memory WebDAV share.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+var addr = flag.String("addr", "localhost:8080", "address to listen on")
+
+func newHandler() http.Handler {
+	return webdav.NewWebDAV(memfs.NewMemFS())
+}
+
+func main() {
+	flag.Parse()
+	log.Printf("Listening on http://%s/...", *addr)
+	log.Fatal(http.ListenAndServe(*addr, newHandler()))
+}
@@ -0,0 +1,40 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import "net/http"
+
+// WithFallback sets a handler serving GET and HEAD requests for paths which
+// do not exist, or are hidden, instead of the handler answering 404, for
+// example with the index.html of a single page application or a page with
+// upload instructions. Other methods are unaffected, so that clients still
+// see the resource missing, and the fallback should set its own status
+// where the resource is meant to be reported missing.
+func WithFallback(h http.Handler) Option {
+	return func(s *WebDAV) {
+		s.fallback = h
+	}
+}
+
+// notFound answers a request for a path which does not exist, with the
+// fallback handler for GET and HEAD requests if there is one.
+func (s *WebDAV) notFound(ctx context, w http.ResponseWriter, r *http.Request, err error) {
+	if s.fallback != nil && (r.Method == "GET" || r.Method == "HEAD") {
+		s.logger.Printf("E[%s]: %s, falling back", ctx.p, err)
+		s.fallback.ServeHTTP(w, r)
+		return
+	}
+	s.errorHeader(ctx, w, err)
+}
@@ -0,0 +1,51 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+func TestFallback(t *testing.T) {
+	fallback := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, "upload with PUT")
+	})
+	s := webdav.NewWebDAV(memfs.NewMemFS(), webdav.WithFallback(fallback), webdav.WithHidden(".*"))
+	serve(s, "PUT", "/a", "hello")
+	serve(s, "PUT", "/.secret", "hidden")
+
+	if w := serve(s, "GET", "/a", ""); w.Body.String() != "hello" {
+		t.Errorf("GET of an existing file got %q", w.Body)
+	}
+	for _, p := range []string{"/missing", "/.secret"} {
+		if w := serve(s, "GET", p, ""); w.Code != http.StatusNotFound || w.Body.String() != "upload with PUT" {
+			t.Errorf("GET %s got %d %q, want the fallback", p, w.Code, w.Body)
+		}
+	}
+	if w := serve(s, "HEAD", "/missing", ""); w.Body.String() != "upload with PUT" {
+		t.Errorf("HEAD got %q, want the fallback", w.Body)
+	}
+	for _, m := range []string{"DELETE", "PROPFIND", "POST"} {
+		if w := serve(s, m, "/missing", ""); w.Body.String() == "upload with PUT" {
+			t.Errorf("%s got the fallback", m)
+		}
+	}
+}
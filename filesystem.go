@@ -23,13 +23,47 @@ import (
 // operations on paths.
 type FileSystem interface {
 	ForPath(p string) (Path, error)
-	Dumpz()
+	// Dump writes a snapshot of all files and their properties in the
+	// given format, see WriteDump.
+	Dump(w io.Writer, format DumpFormat) error
 }
 
 // CopyOptions indicate options applicable to a copy operation.
 type CopyOptions struct {
 	Overwrite, Move bool
 	Depth           int
+	// Preconditions are those of the request, for the source.
+	Preconditions Preconditions
+}
+
+// Preconditions are the expectations a client stated about the resource a
+// request modifies. The handler has evaluated them already, but backends
+// which can modify storage conditionally, such as object stores with
+// conditional writes or databases with compare-and-set, may enforce them
+// again atomically, failing with ErrorPrecondition if the resource changed
+// in the meantime.
+type Preconditions struct {
+	// IfMatch and IfNoneMatch hold the entity tags of the If-Match and
+	// If-None-Match headers, without quotes or weakness, or "*".
+	IfMatch, IfNoneMatch []string
+	// ETag is the entity tag of the resource when the handler evaluated
+	// the preconditions, empty if it did not exist.
+	ETag string
+	// Tokens are the state tokens, such as lock tokens, of the If header.
+	Tokens []string
+}
+
+// ConditionalCreator may optionally be implemented by a Path to receive
+// the preconditions of a request creating a file, in place of Create.
+type ConditionalCreator interface {
+	CreateIf(pre Preconditions) (File, FileHandle, error)
+}
+
+// ConditionalTruncater may optionally be implemented by a File to receive
+// the preconditions of a request replacing its content, in place of
+// Truncate.
+type ConditionalTruncater interface {
+	TruncateIf(pre Preconditions) (FileHandle, error)
 }
 
 // Path is a unique path in the filesystem.
@@ -62,13 +96,120 @@ type File interface {
 	GetProp(k string) (string, bool)
 }
 
-// FileHandle is an open reference to a file for writing or reading.
+// PropLister may optionally be implemented by a File to enumerate the names
+// of all dead properties set on it.
+type PropLister interface {
+	PropNames() []string
+}
+
+// ETagger may optionally be implemented by a File to supply its entity tag,
+// such as a hash of its content or the version ID given by an object store,
+// rather than the handler deriving one from its size and modification
+// time, which may collide. A FileHandle implementing Committer may also
+// implement it, to supply the tag of the content it wrote once committed.
+// If ETag fails, the derived tag is used.
+type ETagger interface {
+	ETag() (string, error)
+}
+
+// Representer may optionally be implemented by a File which is a collection
+// to serve a representation of its own for GET and HEAD, such as an index
+// generated by the backend, rather than the handler treating it as any
+// other collection. The ETag reported for the collection, and compared by
+// conditional requests, is then that of its representation.
+type Representer interface {
+	// Representation gets the File served for the collection, which is
+	// not a directory, failing with ErrorNotFound if there is none.
+	Representation() (File, error)
+}
+
+// Exister may optionally be implemented by a Path to cheaply determine if
+// a resource exists, without the full lookup needed to serve it. HEAD
+// requests for missing resources, which some clients send before every
+// PUT, are then answered without a Lookup.
+type Exister interface {
+	Exists() (bool, error)
+}
+
+// SpaceChecker may optionally be implemented by a Path to refuse a file of
+// the given size before it is written, such as one exceeding a quota.
+// CheckSpace is called for PUT requests of known length before their body
+// is read, so that clients sending "Expect: 100-continue" are refused
+// before uploading.
+type SpaceChecker interface {
+	CheckSpace(size int64) error
+}
+
+// Walker may optionally be implemented by a Path to visit the files of its
+// subtree one at a time, as LookupSubtree would list them, rather than all
+// at once. PROPFIND then lists the tree as it is walked, so that large
+// listings are neither held in memory nor generated faster than the client
+// reads them. Walk stops with the error returned by fn.
+type Walker interface {
+	Walk(depth int, fn func(File) error) error
+}
+
+// FileHandle is an open reference to a file for writing or reading. A
+// FileHandle opened for reading may also implement io.ReaderAt, letting
+// GET read the ranges requested where they are rather than seeking, which
+// suits remote backends serving ranges by request.
 type FileHandle interface {
 	io.ReadSeeker
 	io.Closer
 	io.Writer
 }
 
+// Versioning may optionally be implemented by a File keeping the past
+// versions of its content, for the basic versioning of RFC 3253. Once the
+// file is put under version control by VERSION-CONTROL, each write of it
+// committed through a Committer records a new version, as with the
+// auto-versioning of DAV:checkout-checkin.
+type Versioning interface {
+	// VersionControl puts the file under version control, recording its
+	// content as the first version. Files under version control already
+	// are left unchanged.
+	VersionControl() error
+	// Versions lists the versions of the file, oldest first, none if it is
+	// not under version control.
+	Versions() ([]Version, error)
+	// OpenVersion opens the content of a version for reading.
+	OpenVersion(name string) (FileHandle, error)
+}
+
+// VersionPruner may optionally be implemented by a Versioning file able to
+// discard past versions, as required by WithVersionRetention.
+type VersionPruner interface {
+	// RemoveVersion discards a version other than the latest.
+	RemoveVersion(name string) error
+}
+
+// Version describes a version of a file under version control.
+type Version struct {
+	// Name identifies the version among those of its file, such as "3".
+	Name    string
+	Created time.Time
+	Size    int64
+}
+
+// Committer may optionally be implemented by a FileHandle opened for
+// writing. Commit closes the handle, as Close does, and gets the FileInfo
+// of the content as written, so that the ETag reported for a PUT is that
+// of its own content rather than of a concurrent write.
+type Committer interface {
+	Commit() (FileInfo, error)
+}
+
+// Updater may optionally be implemented by a File to allow updating part
+// of its content, for PUT with Content-Range and the partial PATCH of
+// SabreDAV, with which clients resume interrupted uploads. Update opens the
+// file for writing without truncating it; writes are made at the offset
+// last given to Seek, extending the file if they go beyond its end. The
+// handle may implement Committer as for Truncate. Wrappers of a File which
+// lacks Updater return ErrorNotImplemented.
+type Updater interface {
+	Update() (FileHandle, error)
+}
+
 // emptyFile represents an empty file, it also implements FileHandle
 type emptyFile struct{}
 
@@ -0,0 +1,234 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	x "github.com/google/go-webdav/xml"
+)
+
+// ForkPolicy determines how resource forks are stored. These are side
+// files which desktop clients write to hold metadata for another resource,
+// such as the "._name" AppleDouble files written by the macOS Finder and
+// "name:stream" alternate data streams written by Windows.
+type ForkPolicy int
+
+const (
+	// ForksVisible stores forks as ordinary files.
+	ForksVisible ForkPolicy = iota
+	// ForksAsProps stores forks as dead properties of the resource they
+	// describe, in the ForkNS namespace, so they do not appear in
+	// listings. The fork is still readable and writable by its own name.
+	ForksAsProps
+)
+
+// ForkNS is the namespace of the dead properties holding resource forks,
+// whose values are base64 encoded.
+const ForkNS = extNS + "forks/"
+
+// appleDoubleStream is the stream name used for AppleDouble files.
+const appleDoubleStream = "AppleDouble"
+
+// WithForkPolicy sets how resource forks are stored.
+func WithForkPolicy(p ForkPolicy) Option {
+	return func(s *WebDAV) {
+		s.forks = p
+	}
+}
+
+// validStream determines whether a stream name may be used as the local
+// name of a property.
+func validStream(n string) bool {
+	if n == "" {
+		return false
+	}
+	for i, c := range n {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+		case i > 0 && (c >= '0' && c <= '9' || c == '.' || c == '-'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// forkOf determines if a path names a fork of another resource, returning
+// the path of that resource and the property holding the fork.
+func forkOf(p string) (owner, prop string, ok bool) {
+	dir, base := path.Split(p)
+	if strings.HasPrefix(base, "._") && len(base) > 2 {
+		return dir + base[2:], ForkNS + ":" + appleDoubleStream, true
+	}
+	i := strings.Index(base, ":")
+	if i <= 0 {
+		return "", "", false
+	}
+	stream := strings.TrimSuffix(base[i+1:], ":$DATA")
+	if !validStream(stream) {
+		return "", "", false
+	}
+	return dir + base[:i], ForkNS + ":" + stream, true
+}
+
+// serveFork handles requests for the resource forks of ctx.p, reporting
+// whether the request was handled. Locking is left to the usual methods,
+// which do not create lock-null resources for forks. A fork is part of the
+// resource it describes, so the locks, retention, hiding, drop boxes and
+// disabled methods of that resource apply to it.
+func (s *WebDAV) serveFork(ctx context, w http.ResponseWriter, r *http.Request) bool {
+	if s.forks != ForksAsProps {
+		return false
+	}
+	op, prop, ok := forkOf(ctx.p.String())
+	if !ok {
+		return false
+	}
+	switch r.Method {
+	case "GET", "HEAD", "PUT", "DELETE", "PROPFIND":
+	case "OPTIONS", "LOCK", "UNLOCK":
+		return false
+	default:
+		s.errorHeader(ctx, w, ErrorNotAllowed)
+		return true
+	}
+
+	owner, err := s.fs.ForPath(op)
+	if err != nil {
+		s.errorHeader(ctx, w, err)
+		return true
+	}
+	f, err := owner.Lookup()
+	if err == nil && s.isHidden(op, f.IsDirectory()) {
+		err = ErrorNotFound
+	}
+	if err != nil {
+		if r.Method == "PUT" {
+			err = ErrorMissingParent.WithCause(err)
+		}
+		s.errorHeader(ctx, w, err)
+		return true
+	}
+	if err := s.checkForkOwner(ctx, r, owner); err != nil {
+		s.errorHeader(ctx, w, err)
+		return true
+	}
+
+	if r.Method == "PUT" {
+		s.putFork(ctx, w, r, f, prop)
+		return true
+	}
+
+	v, ok := f.GetProp(prop)
+	if !ok {
+		s.errorHeader(ctx, w, ErrorNotFound)
+		return true
+	}
+	data, err := base64.StdEncoding.DecodeString(v)
+	if err != nil {
+		s.errorHeader(ctx, w, err)
+		return true
+	}
+
+	switch r.Method {
+	case "GET", "HEAD":
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == "GET" {
+			w.Write(data)
+		}
+	case "DELETE":
+		if err := f.PatchProp(nil, map[string]string{prop: ""}); err != nil {
+			s.errorHeader(ctx, w, err)
+			return true
+		}
+		s.notify(ChangeProps, f.GetPath(), "")
+		w.WriteHeader(http.StatusNoContent)
+	case "PROPFIND":
+		ms := x.NewMultiStatus()
+		length := x.NewAny("DAV::getcontentlength")
+		length.Value = strconv.Itoa(len(data))
+		ms.AddPropStatus(s.href(ctx.p.String()),
+			[]x.Any{x.NewAny("DAV::resourcetype"), length}, nil)
+		ms.Send(w)
+	}
+	return true
+}
+
+// checkForkOwner applies the restrictions of the resource at owner to a
+// request for one of its forks.
+func (s *WebDAV) checkForkOwner(ctx context, r *http.Request, owner Path) error {
+	op := owner.String()
+	if s.methodDisabled(op, r.Method) {
+		return ErrorNotAllowed
+	}
+	if box, ok := s.dropBoxFor(op); ok {
+		octx := ctx
+		octx.p = owner
+		if err := s.checkDropBox(&octx, r, box); err != nil {
+			return err
+		}
+	}
+	if r.Method != "PUT" && r.Method != "DELETE" {
+		return nil
+	}
+	if err := s.checkLocks(ctx, owner, false); err != nil {
+		return err
+	}
+	return s.checkRetained(owner, false)
+}
+
+// putFork stores the request body as the fork prop of the file.
+func (s *WebDAV) putFork(ctx context, w http.ResponseWriter, r *http.Request, f File, prop string) {
+	// Forks are stored base64 encoded, so the body may be no larger than
+	// the value it encodes to.
+	var body io.Reader = r.Body
+	if s.MaxPropValueSize > 0 {
+		max := int64(s.MaxPropValueSize / 4 * 3)
+		if r.ContentLength > max {
+			s.errorHeader(ctx, w, ErrorPropTooLarge)
+			return
+		}
+		body = io.LimitReader(r.Body, max+1)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		s.errorHeader(ctx, w, ErrorConflict.WithCause(err))
+		return
+	}
+	_, exists := f.GetProp(prop)
+	set := map[string]string{prop: base64.StdEncoding.EncodeToString(data)}
+	if err := s.checkPropLimits(f, x.PropPatchRequest{Set: set}); err != nil {
+		s.errorHeader(ctx, w, err)
+		return
+	}
+	if err := f.PatchProp(set, nil); err != nil {
+		s.errorHeader(ctx, w, err)
+		return
+	}
+	s.notify(ChangeProps, f.GetPath(), "")
+	if exists {
+		w.WriteHeader(http.StatusNoContent)
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+}
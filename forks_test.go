@@ -0,0 +1,104 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+func TestForksAsProps(t *testing.T) {
+	h := webdav.NewWebDAV(memfs.NewMemFS(), webdav.WithForkPolicy(webdav.ForksAsProps),
+		webdav.WithLimits(webdav.Limits{MaxPropValueSize: 8}))
+	serve(h, "PUT", "/a", "a")
+
+	if w := serve(h, "PUT", "/._a", "finder"); w.Code != http.StatusCreated {
+		t.Fatalf("PUT of a fork got %d", w.Code)
+	}
+	if w := serve(h, "GET", "/._a", ""); w.Code != http.StatusOK || w.Body.String() != "finder" {
+		t.Errorf("GET of a fork got %d %q", w.Code, w.Body)
+	}
+	if w := serve(h, "GET", "/a:color", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET of a missing stream got %d, want 404", w.Code)
+	}
+	if w := serve(h, "PROPFIND", "/", propfindETag, "Depth", "1"); strings.Contains(w.Body.String(), "._a") {
+		t.Errorf("PROPFIND listed a fork:\n%s", w.Body)
+	}
+	if w := serve(h, "PUT", "/._b", "x"); w.Code != http.StatusConflict {
+		t.Errorf("PUT of a fork of a missing file got %d, want 409", w.Code)
+	}
+	if w := serve(h, "PUT", "/._a", "toolarge"); w.Code != http.StatusForbidden {
+		t.Errorf("PUT of a fork over MaxPropValueSize got %d, want 403", w.Code)
+	}
+	if w := serve(h, "DELETE", "/._a", ""); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE of a fork got %d", w.Code)
+	}
+	if w := serve(h, "GET", "/._a", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET of a deleted fork got %d, want 404", w.Code)
+	}
+}
+
+// TestForkOwnerPolicy checks forks are subject to the restrictions of the
+// resource they belong to.
+func TestForkOwnerPolicy(t *testing.T) {
+	fs := memfs.NewMemFS()
+	if p, err := fs.ForPath("/.secret"); err == nil {
+		p.Create()
+	}
+	h := webdav.NewWebDAV(fs, webdav.WithForkPolicy(webdav.ForksAsProps),
+		webdav.WithHidden(".secret"), webdav.WithDropBoxes("/box"),
+		webdav.WithRetention(webdav.RetentionPolicy{Prefix: "/worm", Period: time.Hour}))
+	h.DisableMethods("/frozen", "PUT")
+	for _, p := range []string{"/box", "/worm", "/frozen"} {
+		serve(h, "MKCOL", p, "")
+	}
+	for _, p := range []string{"/a", "/box/a", "/worm/a"} {
+		serve(h, "PUT", p, "a")
+	}
+	serve(h, "PUT", "/frozen/a", "a")
+
+	const lockBody = `<lockinfo xmlns="DAV:"><lockscope><exclusive/></lockscope><locktype><write/></locktype></lockinfo>`
+	tok := serve(h, "LOCK", "/a", lockBody).Header().Get("Lock-Token")
+	if w := serve(h, "PUT", "/._a", "x"); w.Code != webdav.StatusLocked {
+		t.Errorf("PUT of a fork of a locked file got %d, want 423", w.Code)
+	}
+	if w := serve(h, "PUT", "/._a", "x", "If", "</a> ("+tok+")"); w.Code != http.StatusCreated {
+		t.Errorf("PUT of a fork with the lock token got %d", w.Code)
+	}
+	if w := serve(h, "DELETE", "/._a", ""); w.Code != webdav.StatusLocked {
+		t.Errorf("DELETE of a fork of a locked file got %d, want 423", w.Code)
+	}
+
+	for _, tc := range []struct {
+		method, path string
+		want         int
+	}{
+		{"PUT", "/worm/._a", http.StatusForbidden},
+		{"PUT", "/box/._a", http.StatusForbidden},
+		{"GET", "/box/._a", http.StatusForbidden},
+		{"GET", "/._.secret", http.StatusNotFound},
+		{"PUT", "/._.secret", http.StatusConflict},
+		{"PUT", "/frozen/._a", http.StatusMethodNotAllowed},
+	} {
+		if w := serve(h, tc.method, tc.path, "x"); w.Code != tc.want {
+			t.Errorf("%s %s got %d, want %d", tc.method, tc.path, w.Code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package fstest checks that a webdav.FileSystem behaves as the handler
+expects. Backends run the checks from their own tests:
+
+	func TestConformance(t *testing.T) {
+		fstest.TestFileSystem(t, func(t *testing.T) webdav.FileSystem {
+			return memfs.NewMemFS()
+		})
+	}
+*/
+package fstest
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	w "github.com/google/go-webdav"
+)
+
+// TestFileSystem runs the conformance checks as subtests, each against a
+// new, empty FileSystem returned by newFS.
+func TestFileSystem(t *testing.T, newFS func(t *testing.T) w.FileSystem) {
+	for _, c := range []struct {
+		name string
+		test func(t *testing.T, fs w.FileSystem)
+	}{
+		{"Create", testCreate},
+		{"MoveProps", testMoveProps},
+		{"CopyProps", testCopyProps},
+		{"MoveLocks", testMoveLocks},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			c.test(t, newFS(t))
+		})
+	}
+}
+
+func forPath(t *testing.T, fs w.FileSystem, p string) w.Path {
+	t.Helper()
+	wp, err := fs.ForPath(p)
+	if err != nil {
+		t.Fatalf("ForPath(%q): %v", p, err)
+	}
+	return wp
+}
+
+func lookup(t *testing.T, fs w.FileSystem, p string) w.File {
+	t.Helper()
+	f, err := forPath(t, fs, p).Lookup()
+	if err != nil {
+		t.Fatalf("Lookup(%q): %v", p, err)
+	}
+	return f
+}
+
+func put(t *testing.T, fs w.FileSystem, p, content string) {
+	t.Helper()
+	_, fh, err := forPath(t, fs, p).Create()
+	if err != nil {
+		t.Fatalf("Create(%q): %v", p, err)
+	}
+	if _, err := io.WriteString(fh, content); err != nil {
+		t.Fatalf("writing %q: %v", p, err)
+	}
+	if err := fh.Close(); err != nil {
+		t.Fatalf("closing %q: %v", p, err)
+	}
+}
+
+func mkdir(t *testing.T, fs w.FileSystem, p string) {
+	t.Helper()
+	if _, err := forPath(t, fs, p).Mkdir(); err != nil {
+		t.Fatalf("Mkdir(%q): %v", p, err)
+	}
+}
+
+func patch(t *testing.T, fs w.FileSystem, p, k, v string) {
+	t.Helper()
+	if err := lookup(t, fs, p).PatchProp(map[string]string{k: v}, nil); err != nil {
+		t.Fatalf("PatchProp(%q): %v", p, err)
+	}
+}
+
+func wantProp(t *testing.T, fs w.FileSystem, p, k, want string) {
+	t.Helper()
+	if v, ok := lookup(t, fs, p).GetProp(k); !ok || v != want {
+		t.Errorf("GetProp(%q) of %s = %q, %v, want %q", k, p, v, ok, want)
+	}
+}
+
+func testCreate(t *testing.T, fs w.FileSystem) {
+	mkdir(t, fs, "/d")
+	put(t, fs, "/d/a", "hello")
+
+	fh, err := lookup(t, fs, "/d/a").Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(fh)
+	fh.Close()
+	if err != nil || string(b) != "hello" {
+		t.Errorf("read %q, %v, want \"hello\"", b, err)
+	}
+	if _, _, err := forPath(t, fs, "/d/a").Create(); !errors.Is(err, w.ErrorConflict) {
+		t.Errorf("Create of an existing file got %v, want ErrorConflict", err)
+	}
+	if _, _, err := forPath(t, fs, "/missing/a").Create(); !errors.Is(err, w.ErrorMissingParent) {
+		t.Errorf("Create without a parent got %v, want ErrorMissingParent", err)
+	}
+}
+
+// testMoveProps checks that dead properties move with a subtree, see
+// http://www.webdav.org/specs/rfc4918.html#move.for.properties.
+func testMoveProps(t *testing.T, fs w.FileSystem) {
+	mkdir(t, fs, "/d")
+	put(t, fs, "/d/a", "a")
+	patch(t, fs, "/d", "urn:x:color", "red")
+	patch(t, fs, "/d/a", "urn:x:color", "blue")
+
+	_, err := forPath(t, fs, "/d").CopyTo(forPath(t, fs, "/e"), w.CopyOptions{Move: true, Depth: -1})
+	if err != nil {
+		t.Fatalf("MOVE: %v", err)
+	}
+	if _, err := forPath(t, fs, "/d").Lookup(); err == nil {
+		t.Error("source exists after MOVE")
+	}
+	wantProp(t, fs, "/e", "urn:x:color", "red")
+	wantProp(t, fs, "/e/a", "urn:x:color", "blue")
+
+	// A MOVE replacing a file brings the properties of the source only.
+	put(t, fs, "/b", "b")
+	patch(t, fs, "/b", "urn:x:shape", "round")
+	_, err = forPath(t, fs, "/e/a").CopyTo(forPath(t, fs, "/b"), w.CopyOptions{Move: true, Overwrite: true, Depth: -1})
+	if err != nil {
+		t.Fatalf("MOVE with overwrite: %v", err)
+	}
+	wantProp(t, fs, "/b", "urn:x:color", "blue")
+	if _, ok := lookup(t, fs, "/b").GetProp("urn:x:shape"); ok {
+		t.Error("MOVE kept a property of the replaced file")
+	}
+}
+
+// testCopyProps checks that dead properties are copied, see
+// http://www.webdav.org/specs/rfc4918.html#copy.for.properties.
+func testCopyProps(t *testing.T, fs w.FileSystem) {
+	mkdir(t, fs, "/d")
+	put(t, fs, "/d/a", "a")
+	patch(t, fs, "/d/a", "urn:x:color", "red")
+
+	_, err := forPath(t, fs, "/d").CopyTo(forPath(t, fs, "/e"), w.CopyOptions{Depth: -1})
+	if err != nil {
+		t.Fatalf("COPY: %v", err)
+	}
+	wantProp(t, fs, "/d/a", "urn:x:color", "red")
+	wantProp(t, fs, "/e/a", "urn:x:color", "red")
+
+	// The copy is independent of its source.
+	patch(t, fs, "/e/a", "urn:x:color", "green")
+	wantProp(t, fs, "/d/a", "urn:x:color", "red")
+}
+
+// testMoveLocks checks through the handler that locks are neither moved
+// with a locked resource nor left behind, see
+// http://www.webdav.org/specs/rfc4918.html#rfc.section.7.5.
+func testMoveLocks(t *testing.T, fs w.FileSystem) {
+	h := w.NewWebDAV(fs)
+	do := func(method, p, body string, hdr ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, p, strings.NewReader(body))
+		for i := 0; i+1 < len(hdr); i += 2 {
+			r.Header.Set(hdr[i], hdr[i+1])
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+
+	do("PUT", "/a", "a")
+	lock := do("LOCK", "/a", `<lockinfo xmlns="DAV:"><lockscope><exclusive/></lockscope><locktype><write/></locktype></lockinfo>`, "Depth", "0")
+	token := lock.Header().Get("Lock-Token")
+	if lock.Code != http.StatusOK || token == "" {
+		t.Fatalf("LOCK got %d, token %q", lock.Code, token)
+	}
+
+	if rec := do("MOVE", "/a", "", "Destination", "http://example.com/b", "If", "("+token+")"); rec.Code != http.StatusCreated {
+		t.Fatalf("MOVE of a locked file got %d, want 201", rec.Code)
+	}
+	if rec := do("PUT", "/b", "b"); rec.Code != http.StatusNoContent {
+		t.Errorf("PUT to the destination of a locked file got %d, want 204", rec.Code)
+	}
+	// The lock is gone with the resource, rather than blocking a new one
+	// at the source until it expires.
+	if rec := do("PUT", "/a", "a"); rec.Code != http.StatusCreated {
+		t.Errorf("PUT to the source of a moved locked file got %d, want 201", rec.Code)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	gocontext "context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RemoteCopier copies resources to other servers, for COPY and MOVE
+// requests whose Destination is on another host. The client package has an
+// implementation making WebDAV requests.
+type RemoteCopier interface {
+	// CopyRemote copies the resource at src, and its members to the depth
+	// of the options, to a URL on another server, reporting whether the
+	// destination was created. Moves are copies, the source being removed
+	// by the handler once they succeed.
+	CopyRemote(ctx gocontext.Context, src Path, dst *url.URL, opt CopyOptions) (bool, error)
+}
+
+// WithGateway lets COPY and MOVE requests have a Destination on one of the
+// given hosts, such as "dav.example.com:8080", which the handler then
+// transfers resources to itself with rc. This is meant for migrating
+// between servers, as the handler makes requests on behalf of its clients
+// to the hosts, which must be trusted. Others are refused with 502 Bad
+// Gateway, as when there is no gateway.
+func WithGateway(rc RemoteCopier, hosts ...string) Option {
+	return func(s *WebDAV) {
+		s.gateway = rc
+		s.gatewayHosts = append(s.gatewayHosts, hosts...)
+	}
+}
+
+// gatewayAllows determines if the gateway may copy to a host.
+func (s *WebDAV) gatewayAllows(host string) bool {
+	if s.gateway == nil {
+		return false
+	}
+	for _, h := range s.gatewayHosts {
+		if strings.EqualFold(h, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// copyRemote serves a COPY or MOVE to another server through the gateway.
+func (s *WebDAV) copyRemote(ctx context, w http.ResponseWriter, r *http.Request, dst *url.URL, move bool) {
+	src := ctx.p
+	srcf, err := src.Lookup()
+	if err != nil {
+		s.errorHeader(ctx, w, ErrorNotFound.WithCause(err))
+		return
+	}
+
+	s.logger.Println("TO ", dst)
+	created, err := s.gateway.CopyRemote(r.Context(), src, dst, CopyOptions{
+		Overwrite: ctx.overwrite,
+		Depth:     ctx.depth,
+	})
+	if err != nil {
+		s.errorHeader(ctx, w, err)
+		return
+	}
+	if move {
+		if srcf.IsDirectory() {
+			if errs := src.RecursiveRemove(); len(errs) != 0 {
+				s.notify(ChangeRemoved, src.String(), "")
+				s.errorHeader(ctx, w, ErrorConflict)
+				return
+			}
+		} else if err := src.Remove(); err != nil {
+			s.errorHeader(ctx, w, err)
+			return
+		}
+		s.notify(ChangeRemoved, src.String(), "")
+	}
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
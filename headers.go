@@ -0,0 +1,67 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import "net/http"
+
+// HeaderHook customizes the headers of a response, such as adding
+// X-Robots-Tag or security headers. It is called once the status of the
+// response is decided, just before the headers are sent, with the path
+// of the request relative to the FileSystem.
+type HeaderHook func(r *http.Request, p string, status int, h http.Header)
+
+// WithHeaderHook adds a hook called for every response.
+func WithHeaderHook(h HeaderHook) Option {
+	return func(s *WebDAV) {
+		s.headerHooks = append(s.headerHooks, h)
+	}
+}
+
+// hookWriter runs the header hooks before the response status is sent.
+type hookWriter struct {
+	http.ResponseWriter
+	r     *http.Request
+	p     string
+	hooks []HeaderHook
+	wrote bool
+}
+
+func (w *hookWriter) WriteHeader(status int) {
+	if !w.wrote {
+		w.wrote = true
+		for _, h := range w.hooks {
+			h(w.r, w.p, status, w.Header())
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *hookWriter) Write(b []byte) (int, error) {
+	if !w.wrote {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// finish runs the hooks for a response on which nothing was written.
+func (w *hookWriter) finish() {
+	if !w.wrote {
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (w *hookWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
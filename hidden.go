@@ -0,0 +1,165 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"path"
+	"strings"
+)
+
+// WithHidden hides resources matching the given gitignore-style patterns
+// from clients, as though they did not exist, without changing the
+// FileSystem. Patterns without a slash match names at any depth, others
+// match paths from the root, where "**" matches any number of directories.
+// A trailing slash matches only collections, and a leading "!" makes
+// matching resources visible again. Later patterns override earlier ones
+// and the contents of hidden collections are hidden too, for example:
+//
+//	WithHidden(".*", "!.well-known/", "/versions/", "**/tmp/*.props")
+func WithHidden(patterns ...string) Option {
+	return func(s *WebDAV) {
+		for _, p := range patterns {
+			if r, ok := parseHideRule(p); ok {
+				s.hidden = append(s.hidden, r)
+			}
+		}
+	}
+}
+
+type hideRule struct {
+	segments []string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+func parseHideRule(p string) (hideRule, bool) {
+	var r hideRule
+	if strings.HasPrefix(p, "!") {
+		r.negate = true
+		p = p[1:]
+	}
+	if strings.HasSuffix(p, "/") {
+		r.dirOnly = true
+		p = strings.TrimRight(p, "/")
+	}
+	if strings.Contains(p, "/") {
+		r.anchored = true
+		p = strings.TrimPrefix(p, "/")
+	}
+	if p == "" {
+		return r, false
+	}
+	r.segments = strings.Split(p, "/")
+	return r, true
+}
+
+// String formats the rule as the pattern it was parsed from.
+func (r hideRule) String() string {
+	var b strings.Builder
+	if r.negate {
+		b.WriteString("!")
+	}
+	if r.anchored {
+		b.WriteString("/")
+	}
+	b.WriteString(strings.Join(r.segments, "/"))
+	if r.dirOnly {
+		b.WriteString("/")
+	}
+	return b.String()
+}
+
+// matches determines if the rule applies to the resource with the given
+// path segments.
+func (r hideRule) matches(segs []string, dir bool) bool {
+	if r.dirOnly && !dir {
+		return false
+	}
+	if !r.anchored {
+		ok, _ := path.Match(r.segments[0], segs[len(segs)-1])
+		return ok
+	}
+	return matchSegments(r.segments, segs)
+}
+
+// matchSegments matches path segments against pattern segments, where a
+// "**" pattern segment matches any number of path segments.
+func matchSegments(pat, segs []string) bool {
+	if len(pat) == 0 {
+		return len(segs) == 0
+	}
+	if pat[0] == "**" {
+		for i := 0; i <= len(segs); i++ {
+			if matchSegments(pat[1:], segs[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segs) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pat[0], segs[0]); !ok {
+		return false
+	}
+	return matchSegments(pat[1:], segs[1:])
+}
+
+// isHidden determines if the resource at the given path is hidden from
+// clients, either itself or by being within a hidden collection or one
+// being deleted.
+func (s *WebDAV) isHidden(p string, dir bool) bool {
+	return s.pendingDeletion(p) || s.hiddenByRules(p, dir)
+}
+
+// hiddenByRules determines if the resource at the given path is hidden by
+// the patterns of WithHidden, either itself or by being within a hidden
+// collection.
+func (s *WebDAV) hiddenByRules(p string, dir bool) bool {
+	if len(s.hidden) == 0 {
+		return false
+	}
+	segs := strings.Split(strings.Trim(p, "/"), "/")
+	if segs[0] == "" {
+		return false
+	}
+	for i := 1; i <= len(segs); i++ {
+		isDir := dir || i < len(segs)
+		hidden := false
+		for _, r := range s.hidden {
+			if r.matches(segs[:i], isDir) {
+				hidden = !r.negate
+			}
+		}
+		if hidden {
+			return true
+		}
+	}
+	return false
+}
+
+// isHiddenPath determines if the resource at the given path is hidden,
+// looking it up to know whether it is a collection.
+func (s *WebDAV) isHiddenPath(p Path) bool {
+	if len(s.hidden) == 0 {
+		return s.pendingDeletion(p.String())
+	}
+	dir := false
+	if f, err := p.Lookup(); err == nil {
+		dir = f.IsDirectory()
+	}
+	return s.isHidden(p.String(), dir)
+}
@@ -0,0 +1,49 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import "testing"
+
+func TestIsHidden(t *testing.T) {
+	s := &WebDAV{}
+	WithHidden(".*", "!.well-known/", "/versions/", "**/tmp/*.props", "*.bak")(s)
+
+	tests := []struct {
+		p      string
+		dir    bool
+		hidden bool
+	}{
+		{"/", true, false},
+		{"/a.txt", false, false},
+		{"/.Trash", true, true},
+		{"/.Trash/a.txt", false, true},
+		{"/docs/.DS_Store", false, true},
+		{"/.well-known", true, false},
+		{"/.well-known/caldav", false, false},
+		{"/.well-known", false, true},
+		{"/versions", true, true},
+		{"/versions/1/a", false, true},
+		{"/docs/versions", true, false},
+		{"/tmp/x.props", false, true},
+		{"/a/b/tmp/x.props", false, true},
+		{"/a/tmp/x.txt", false, false},
+		{"/a/old.bak", false, true},
+	}
+	for _, tt := range tests {
+		if got := s.isHidden(tt.p, tt.dir); got != tt.hidden {
+			t.Errorf("isHidden(%q, %v) = %v, want %v", tt.p, tt.dir, got, tt.hidden)
+		}
+	}
+}
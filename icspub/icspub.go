@@ -0,0 +1,330 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package icspub is a read-only webdav.FileSystem publishing calendar
+collections whose .ics resources are produced by generator functions, for
+deployments that only need to expose calendars (such as free/busy data)
+rather than accept writes.
+
+Each collection reports a CalendarServer getctag and a DAV sync-token which
+change whenever the generated content does, so clients only refetch
+resources after an actual change.
+*/
+package icspub
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	w "github.com/google/go-webdav"
+)
+
+// Property names reported on published collections.
+const (
+	PropCTag      = "http://calendarserver.org/ns/:getctag"
+	PropSyncToken = "DAV::sync-token"
+)
+
+// Generator produces the current resources of a collection, keyed by name
+// (for example "busy.ics").
+type Generator func() (map[string][]byte, error)
+
+type pubfs struct {
+	m     sync.Mutex
+	cols  map[string]*collection
+	clock w.Clock
+}
+
+type collection struct {
+	gen      Generator
+	files    map[string][]byte
+	ctag     string
+	modified time.Time
+}
+
+// New creates a read-only webdav.FileSystem publishing the given
+// collections, keyed by collection name.
+func New(collections map[string]Generator) w.FileSystem {
+	return NewWithClock(collections, w.SystemClock)
+}
+
+// NewWithClock creates a FileSystem as New, whose collections are modified
+// at the time of the given clock when their content changes.
+func NewWithClock(collections map[string]Generator, c w.Clock) w.FileSystem {
+	fs := &pubfs{cols: make(map[string]*collection), clock: c}
+	for n, g := range collections {
+		fs.cols[n] = &collection{gen: g}
+	}
+	return fs
+}
+
+// refresh regenerates a collection, updating its tag and modification
+// time only if the content changed.
+func (c *collection) refresh(now time.Time) error {
+	files, err := c.gen()
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(files))
+	for n := range files {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	h := sha1.New()
+	for _, n := range names {
+		fmt.Fprintf(h, "%s\x00%d\x00", n, len(files[n]))
+		h.Write(files[n])
+	}
+	ctag := fmt.Sprintf("%x", h.Sum(nil))
+	if ctag != c.ctag {
+		c.ctag = ctag
+		c.modified = now
+	}
+	c.files = files
+	return nil
+}
+
+func (fs *pubfs) Dump(out io.Writer, format w.DumpFormat) error {
+	fs.m.Lock()
+	defer fs.m.Unlock()
+	entries := []w.DumpEntry{{Path: "/", Dir: true}}
+	for cn, c := range fs.cols {
+		if err := c.refresh(fs.clock.Now()); err != nil {
+			return err
+		}
+		entries = append(entries, w.DumpEntry{
+			Path:     "/" + cn,
+			Dir:      true,
+			Modified: c.modified,
+			Props:    map[string]string{PropCTag: c.ctag},
+		})
+		for fn, d := range c.files {
+			entries = append(entries, w.DumpEntry{
+				Path:     "/" + cn + "/" + fn,
+				Size:     int64(len(d)),
+				Modified: c.modified,
+			})
+		}
+	}
+	return w.WriteDump(out, format, entries)
+}
+
+func (fs *pubfs) ForPath(p string) (w.Path, error) {
+	p = path.Clean(p)
+	if !path.IsAbs(p) {
+		return nil, w.ErrorBadPath
+	}
+	return &pubp{fs: fs, path: p}, nil
+}
+
+type pubp struct {
+	fs   *pubfs
+	path string
+}
+
+func (p *pubp) String() string {
+	return p.path
+}
+
+func (p *pubp) Parent() w.Path {
+	return &pubp{fs: p.fs, path: path.Dir(p.path)}
+}
+
+// split gets the collection and resource names of the path.
+func (p *pubp) split() (string, string) {
+	parts := strings.SplitN(strings.TrimPrefix(p.path, "/"), "/", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+func (p *pubp) Lookup() (w.File, error) {
+	p.fs.m.Lock()
+	defer p.fs.m.Unlock()
+	f, _, err := p.lookup()
+	return f, err
+}
+
+// lookup looks up the resource, regenerating the collection it is within,
+// which is nil for the root. fs.m must be held.
+func (p *pubp) lookup() (w.File, *collection, error) {
+	if p.path == "/" {
+		return &pubfile{path: "/", dir: true}, nil, nil
+	}
+
+	cn, fn := p.split()
+	c, ok := p.fs.cols[cn]
+	if !ok {
+		return nil, nil, w.ErrorNotFound
+	}
+	if err := c.refresh(p.fs.clock.Now()); err != nil {
+		return nil, nil, err
+	}
+	if fn == "" {
+		return &pubfile{path: p.path, dir: true, ctag: c.ctag, modified: c.modified}, c, nil
+	}
+	d, ok := c.files[fn]
+	if !ok {
+		return nil, nil, w.ErrorNotFound
+	}
+	return &pubfile{path: p.path, data: d, modified: c.modified}, c, nil
+}
+
+// LookupSubtree generates each collection listed once.
+func (p *pubp) LookupSubtree(depth int) ([]w.File, error) {
+	p.fs.m.Lock()
+	defer p.fs.m.Unlock()
+	f, c, err := p.lookup()
+	if err != nil {
+		return nil, err
+	}
+	files := []w.File{f}
+	if !f.IsDirectory() || depth == 0 {
+		return files, nil
+	}
+	if c != nil {
+		return append(files, c.members(p.path)...), nil
+	}
+
+	names := make([]string, 0, len(p.fs.cols))
+	for cn := range p.fs.cols {
+		names = append(names, cn)
+	}
+	sort.Strings(names)
+	for _, cn := range names {
+		sub := &pubp{fs: p.fs, path: "/" + cn}
+		cf, c, err := sub.lookup()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, cf)
+		if depth != 1 {
+			files = append(files, c.members(sub.path)...)
+		}
+	}
+	return files, nil
+}
+
+// members gets the resources of the collection at p, as last generated.
+func (c *collection) members(p string) []w.File {
+	names := make([]string, 0, len(c.files))
+	for fn := range c.files {
+		names = append(names, fn)
+	}
+	sort.Strings(names)
+	files := make([]w.File, len(names))
+	for i, fn := range names {
+		files[i] = &pubfile{path: p + "/" + fn, data: c.files[fn], modified: c.modified}
+	}
+	return files
+}
+
+func (p *pubp) Mkdir() (w.File, error) {
+	return nil, w.ErrorNotAllowed
+}
+
+func (p *pubp) Create() (w.File, w.FileHandle, error) {
+	return nil, nil, w.ErrorNotAllowed
+}
+
+func (p *pubp) CopyTo(dst w.Path, opt w.CopyOptions) (bool, error) {
+	return false, w.ErrorNotAllowed
+}
+
+func (p *pubp) Remove() error {
+	return w.ErrorNotAllowed
+}
+
+func (p *pubp) RecursiveRemove() map[string]error {
+	return map[string]error{p.path: w.ErrorNotAllowed}
+}
+
+type pubfile struct {
+	path     string
+	dir      bool
+	data     []byte
+	ctag     string
+	modified time.Time
+}
+
+func (f *pubfile) GetPath() string {
+	return f.path
+}
+
+func (f *pubfile) IsDirectory() bool {
+	return f.dir
+}
+
+func (f *pubfile) Stat() (w.FileInfo, error) {
+	return w.FileInfo{
+		Created:      f.modified,
+		LastModified: f.modified,
+		Size:         int64(len(f.data)),
+	}, nil
+}
+
+func (f *pubfile) Open() (w.FileHandle, error) {
+	if f.dir {
+		return nil, w.ErrorIsDir
+	}
+	return &pubfileh{strings.NewReader(string(f.data))}, nil
+}
+
+func (f *pubfile) Truncate() (w.FileHandle, error) {
+	return nil, w.ErrorNotAllowed
+}
+
+func (f *pubfile) PatchProp(set, remove map[string]string) error {
+	return w.ErrorNotAllowed
+}
+
+func (f *pubfile) GetProp(k string) (string, bool) {
+	if f.ctag == "" {
+		return "", false
+	}
+	switch k {
+	case PropCTag:
+		return f.ctag, true
+	case PropSyncToken:
+		return "data:," + f.ctag, true
+	}
+	return "", false
+}
+
+func (f *pubfile) PropNames() []string {
+	if f.ctag == "" {
+		return nil
+	}
+	return []string{PropCTag, PropSyncToken}
+}
+
+type pubfileh struct {
+	*strings.Reader
+}
+
+func (h *pubfileh) Write(b []byte) (int, error) {
+	return 0, w.ErrorNotAllowed
+}
+
+func (h *pubfileh) Close() error {
+	return nil
+}
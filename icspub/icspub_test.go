@@ -0,0 +1,107 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icspub
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	w "github.com/google/go-webdav"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func TestPublish(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	busy := "BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n"
+	calls := map[string]int{}
+	gen := func(name string, content *string) Generator {
+		return func() (map[string][]byte, error) {
+			calls[name]++
+			return map[string][]byte{"a.ics": []byte(*content), "b.ics": []byte(*content)}, nil
+		}
+	}
+	other := "x"
+	fs := NewWithClock(map[string]Generator{"busy": gen("busy", &busy), "other": gen("other", &other)}, clock)
+
+	p, _ := fs.ForPath("/busy")
+	files, err := p.LookupSubtree(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 || files[1].GetPath() != "/busy/a.ics" || files[2].GetPath() != "/busy/b.ics" {
+		t.Errorf("LookupSubtree(1) of a collection got %d files", len(files))
+	}
+	if calls["busy"] != 1 {
+		t.Errorf("listing a collection generated it %d times, want once", calls["busy"])
+	}
+
+	root, _ := fs.ForPath("/")
+	files, err = root.LookupSubtree(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 7 {
+		t.Errorf("LookupSubtree(-1) of the root got %d files, want 7", len(files))
+	}
+	if calls["busy"] != 2 || calls["other"] != 1 {
+		t.Errorf("listing the root generated %v, want each collection once more", calls)
+	}
+
+	col, _ := p.Lookup()
+	ctag, _ := col.GetProp(PropCTag)
+	if fi, _ := col.Stat(); !fi.LastModified.Equal(clock.now) {
+		t.Errorf("collection modified at %s, want %s", fi.LastModified, clock.now)
+	}
+
+	// Regenerating the same content changes nothing.
+	clock.now = clock.now.Add(time.Hour)
+	col, _ = p.Lookup()
+	if tag, _ := col.GetProp(PropCTag); tag != ctag {
+		t.Errorf("ctag changed from %q to %q without a change", ctag, tag)
+	}
+	if fi, _ := col.Stat(); fi.LastModified.Equal(clock.now) {
+		t.Error("collection modified without a change")
+	}
+
+	busy = "BEGIN:VCALENDAR\r\nBEGIN:VFREEBUSY\r\nEND:VFREEBUSY\r\nEND:VCALENDAR\r\n"
+	col, _ = p.Lookup()
+	if tag, _ := col.GetProp(PropCTag); tag == ctag {
+		t.Error("ctag unchanged after the content changed")
+	}
+	if fi, _ := col.Stat(); !fi.LastModified.Equal(clock.now) {
+		t.Errorf("collection modified at %s after a change, want %s", fi.LastModified, clock.now)
+	}
+
+	fp, _ := fs.ForPath("/busy/a.ics")
+	f, err := fp.Lookup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fh, _ := f.Open()
+	if b, _ := io.ReadAll(fh); string(b) != busy {
+		t.Errorf("content got %q, want %q", b, busy)
+	}
+	if _, _, err := fp.Create(); err != w.ErrorNotAllowed {
+		t.Errorf("Create got %v, want ErrorNotAllowed", err)
+	}
+}
@@ -0,0 +1,283 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+)
+
+// CTagProp is the CalendarServer property identifying the state of a
+// collection, which changes whenever anything within it does. Collections
+// report it from the journal unless the FileSystem provides it.
+const CTagProp = "http://calendarserver.org/ns/:getctag"
+
+// DefaultJournalSize is the number of changes kept by the default
+// in-memory journal.
+const DefaultJournalSize = 10000
+
+// ErrJournalTruncated is returned by JournalStore.Since when changes after
+// the given sequence number are no longer kept.
+var ErrJournalTruncated = errors.New("webdav: journal truncated")
+
+// JournalStore keeps the journal of changes made through the handler, in
+// which each Change has a sequence number one greater than the previous.
+type JournalStore interface {
+	// Append adds a change to the end of the journal.
+	Append(c Change) error
+	// Since gets the changes with sequence numbers greater than seq, in
+	// order.
+	Since(seq uint64) ([]Change, error)
+	// Last gets the sequence number of the latest change, zero if there
+	// are none.
+	Last() (uint64, error)
+}
+
+// MemoryJournal is a JournalStore keeping a bounded number of the latest
+// changes in memory.
+type MemoryJournal struct {
+	m       sync.Mutex
+	max     int
+	changes []Change
+}
+
+// NewMemoryJournal creates a MemoryJournal keeping up to max changes.
+func NewMemoryJournal(max int) *MemoryJournal {
+	return &MemoryJournal{max: max}
+}
+
+// Append implements JournalStore.
+func (mj *MemoryJournal) Append(c Change) error {
+	mj.m.Lock()
+	defer mj.m.Unlock()
+	if len(mj.changes) >= mj.max {
+		n := copy(mj.changes, mj.changes[len(mj.changes)-mj.max+1:])
+		mj.changes = mj.changes[:n]
+	}
+	mj.changes = append(mj.changes, c)
+	return nil
+}
+
+// Since implements JournalStore.
+func (mj *MemoryJournal) Since(seq uint64) ([]Change, error) {
+	mj.m.Lock()
+	defer mj.m.Unlock()
+	if len(mj.changes) == 0 {
+		return nil, nil
+	}
+	first := mj.changes[0].Seq
+	if seq+1 < first {
+		return nil, ErrJournalTruncated
+	}
+	if seq+1-first >= uint64(len(mj.changes)) {
+		return nil, nil
+	}
+	return append([]Change(nil), mj.changes[seq+1-first:]...), nil
+}
+
+// Last implements JournalStore.
+func (mj *MemoryJournal) Last() (uint64, error) {
+	mj.m.Lock()
+	defer mj.m.Unlock()
+	if len(mj.changes) == 0 {
+		return 0, nil
+	}
+	return mj.changes[len(mj.changes)-1].Seq, nil
+}
+
+// FileJournal is a JournalStore appending changes to a file as lines of
+// JSON. The file is never truncated.
+type FileJournal struct {
+	m    sync.Mutex
+	f    *os.File
+	last uint64
+}
+
+// OpenFileJournal opens the journal in the named file, creating it if
+// necessary.
+func OpenFileJournal(name string) (*FileJournal, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	fj := &FileJournal{f: f}
+	err = fj.scan(func(c Change) { fj.last = c.Seq })
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return fj, nil
+}
+
+// Close closes the file.
+func (fj *FileJournal) Close() error {
+	return fj.f.Close()
+}
+
+// scan calls fn for each change in the file.
+func (fj *FileJournal) scan(fn func(Change)) error {
+	if _, err := fj.f.Seek(0, 0); err != nil {
+		return err
+	}
+	sc := bufio.NewScanner(fj.f)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		var c Change
+		if err := json.Unmarshal(sc.Bytes(), &c); err != nil {
+			return fmt.Errorf("%s: %w", fj.f.Name(), err)
+		}
+		fn(c)
+	}
+	return sc.Err()
+}
+
+// Append implements JournalStore.
+func (fj *FileJournal) Append(c Change) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	fj.m.Lock()
+	defer fj.m.Unlock()
+	if _, err := fj.f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	fj.last = c.Seq
+	return nil
+}
+
+// Since implements JournalStore.
+func (fj *FileJournal) Since(seq uint64) ([]Change, error) {
+	fj.m.Lock()
+	defer fj.m.Unlock()
+	var res []Change
+	err := fj.scan(func(c Change) {
+		if c.Seq > seq {
+			res = append(res, c)
+		}
+	})
+	return res, err
+}
+
+// Last implements JournalStore.
+func (fj *FileJournal) Last() (uint64, error) {
+	fj.m.Lock()
+	defer fj.m.Unlock()
+	return fj.last, nil
+}
+
+// WithJournal sets where the journal of changes is kept, by default in
+// memory with room for DefaultJournalSize changes. The journal numbers
+// changes for ChangesSince, sync-collection REPORTs, CTagProp and the
+// resumption of event streams.
+func WithJournal(store JournalStore) Option {
+	return func(s *WebDAV) {
+		s.journal.store = store
+	}
+}
+
+// journal numbers the changes made through a handler and records them in
+// a JournalStore.
+type journal struct {
+	m     sync.Mutex
+	store JournalStore
+	ready bool
+	seq   uint64
+	// epoch distinguishes CTags from those of earlier runs, as the trees
+	// index only covers changes since the handler started.
+	epoch int64
+	// trees maps collections to the sequence number of the latest change
+	// within them.
+	trees map[string]uint64
+}
+
+// load initializes the journal from its store, it must be called with the
+// mutex held.
+func (j *journal) load(s *WebDAV) {
+	if j.ready {
+		return
+	}
+	j.ready = true
+	if j.store == nil {
+		j.store = NewMemoryJournal(DefaultJournalSize)
+	}
+	j.epoch = s.clock.Now().UnixNano()
+	j.trees = make(map[string]uint64)
+	seq, err := j.store.Last()
+	if err != nil {
+		s.logger.Printf("reading journal: %s", err)
+	}
+	j.seq = seq
+}
+
+// record numbers a change and appends it to the journal, calling publish
+// before the next change is numbered.
+func (s *WebDAV) record(c Change, publish func(Change)) {
+	j := &s.journal
+	j.m.Lock()
+	defer j.m.Unlock()
+	j.load(s)
+	j.seq++
+	c.Seq = j.seq
+	if err := j.store.Append(c); err != nil {
+		s.logger.Printf("journaling change %d: %s", c.Seq, err)
+	}
+	for _, p := range []string{c.Path, c.Destination} {
+		if p == "" {
+			continue
+		}
+		for p = path.Clean(p); ; p = path.Dir(p) {
+			j.trees[p] = c.Seq
+			if p == "/" {
+				break
+			}
+		}
+	}
+	publish(c)
+}
+
+// ChangesSince gets the changes made through the handler after the one
+// with the given sequence number, failing with ErrJournalTruncated if the
+// journal no longer holds them all.
+func (s *WebDAV) ChangesSince(seq uint64) ([]Change, error) {
+	j := &s.journal
+	j.m.Lock()
+	j.load(s)
+	j.m.Unlock()
+	return j.store.Since(seq)
+}
+
+// journalSeq gets the sequence number of the latest change.
+func (s *WebDAV) journalSeq() uint64 {
+	j := &s.journal
+	j.m.Lock()
+	defer j.m.Unlock()
+	j.load(s)
+	return j.seq
+}
+
+// ctag gets CTagProp for the collection at p.
+func (s *WebDAV) ctag(p string) string {
+	j := &s.journal
+	j.m.Lock()
+	defer j.m.Unlock()
+	j.load(s)
+	return fmt.Sprintf("%d-%d", j.epoch, j.trees[path.Clean(p)])
+}
@@ -0,0 +1,103 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+func TestMemoryJournal(t *testing.T) {
+	j := webdav.NewMemoryJournal(2)
+	for seq := uint64(1); seq <= 3; seq++ {
+		j.Append(webdav.Change{Seq: seq})
+	}
+	if last, _ := j.Last(); last != 3 {
+		t.Errorf("Last() = %d, want 3", last)
+	}
+	if cs, err := j.Since(1); err != nil || len(cs) != 2 || cs[0].Seq != 2 {
+		t.Errorf("Since(1) = %v, %v", cs, err)
+	}
+	if cs, err := j.Since(3); err != nil || len(cs) != 0 {
+		t.Errorf("Since(3) = %v, %v", cs, err)
+	}
+	if _, err := j.Since(0); !errors.Is(err, webdav.ErrJournalTruncated) {
+		t.Errorf("Since(0) got %v, want ErrJournalTruncated", err)
+	}
+}
+
+func TestFileJournal(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "journal")
+	j, err := webdav.OpenFileJournal(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := webdav.NewWebDAV(memfs.NewMemFS(), webdav.WithJournal(j))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PUT", "/a", strings.NewReader("a")))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("DELETE", "/a", nil))
+	j.Close()
+
+	// Numbering continues from the journal after a restart.
+	j, err = webdav.OpenFileJournal(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	h = webdav.NewWebDAV(memfs.NewMemFS(), webdav.WithJournal(j))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PUT", "/b", strings.NewReader("b")))
+	cs, err := h.ChangesSince(1)
+	if err != nil || len(cs) != 2 {
+		t.Fatalf("ChangesSince(1) = %v, %v", cs, err)
+	}
+	if cs[0].Seq != 2 || cs[0].Kind != webdav.ChangeRemoved || cs[1].Seq != 3 || cs[1].Path != "/b" {
+		t.Errorf("ChangesSince(1) = %+v", cs)
+	}
+}
+
+var ctagRE = regexp.MustCompile(`<getctag[^>]*>([^<]*)</getctag>`)
+
+func TestCTag(t *testing.T) {
+	h := webdav.NewWebDAV(memfs.NewMemFS())
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("MKCOL", "/d", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("MKCOL", "/e", nil))
+	ctag := func(p string) string {
+		body := `<propfind xmlns="DAV:"><prop><getctag xmlns="http://calendarserver.org/ns/"/></prop></propfind>`
+		r := httptest.NewRequest("PROPFIND", p, strings.NewReader(body))
+		r.Header.Set("Depth", "0")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		m := ctagRE.FindStringSubmatch(w.Body.String())
+		if m == nil {
+			t.Fatalf("PROPFIND of %s lacks getctag:\n%s", p, w.Body)
+		}
+		return m[1]
+	}
+
+	d, e := ctag("/d"), ctag("/e")
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PUT", "/d/a", strings.NewReader("a")))
+	if ctag("/d") == d {
+		t.Error("getctag of /d unchanged by PUT within it")
+	}
+	if ctag("/e") != e {
+		t.Error("getctag of /e changed by PUT outside it")
+	}
+}
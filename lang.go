@@ -0,0 +1,179 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	x "github.com/google/go-webdav/xml"
+)
+
+// LangNS prefixes the namespaces of the dead properties recording the
+// languages of others, given by xml:lang when they were set, see LangProp.
+// They do not appear in allprop PROPFIND responses.
+const LangNS = extNS + "lang/"
+
+// LangProp gets the name of the dead property holding the value of property
+// name in language lang, as last set by PROPPATCH with xml:lang, or that
+// holding the language of its current value if lang is empty. Properties
+// set in several languages keep a value for each, selected by PROPFIND
+// according to Accept-Language.
+func LangProp(name, lang string) string {
+	return LangNS + lang + ":" + name
+}
+
+// parseLangProp parses the name of a property made by LangProp.
+func parseLangProp(pn string) (name, lang string, ok bool) {
+	rest, ok := strings.CutPrefix(pn, LangNS)
+	if !ok {
+		return "", "", false
+	}
+	lang, name, ok = strings.Cut(rest, ":")
+	return name, lang, ok
+}
+
+// langVariants gets the languages in which the dead properties of a file
+// were set, by property, the empty language standing for their current
+// value.
+func langVariants(f File) map[string][]string {
+	pl, ok := f.(PropLister)
+	if !ok {
+		return nil
+	}
+	var res map[string][]string
+	for _, pn := range pl.PropNames() {
+		if name, lang, ok := parseLangProp(pn); ok {
+			if res == nil {
+				res = make(map[string][]string)
+			}
+			res[name] = append(res[name], lang)
+		}
+	}
+	return res
+}
+
+// langPatch extends a PROPPATCH with the updates of the properties
+// recording languages. A value set with a language is also kept as the
+// variant in that language, and its language recorded, while a value set
+// without one, or removed, drops the variants of the property.
+func langPatch(f File, req x.PropPatchRequest) (set, remove map[string]string) {
+	set = make(map[string]string, len(req.Set))
+	remove = make(map[string]string, len(req.Remove))
+	for n, v := range req.Set {
+		set[n] = v
+	}
+	for n, v := range req.Remove {
+		remove[n] = v
+	}
+
+	variants := langVariants(f)
+	drop := func(n string) {
+		for _, lang := range variants[n] {
+			remove[LangProp(n, lang)] = ""
+		}
+	}
+	for n, v := range req.Set {
+		if lang, ok := req.Langs[n]; ok {
+			set[LangProp(n, "")] = lang
+			set[LangProp(n, lang)] = v
+		} else {
+			drop(n)
+		}
+	}
+	for n := range req.Remove {
+		drop(n)
+	}
+	return set, remove
+}
+
+// localize sets the languages of the properties reported for a file,
+// selecting the variants in the languages preferred by the client, given
+// its Accept-Language header, if it sent one.
+func localize(f File, props []x.Any, acceptLang string) {
+	variants := langVariants(f)
+	if len(variants) == 0 {
+		return
+	}
+	ranges := parseAcceptLanguage(acceptLang)
+	for i, a := range props {
+		n := a.XMLNS + ":" + a.XMLName.Local
+		langs, ok := variants[n]
+		if !ok {
+			continue
+		}
+		if lang := matchLang(ranges, langs); lang != "" {
+			if v, ok := f.GetProp(LangProp(n, lang)); ok {
+				props[i].Value, props[i].Lang = v, lang
+				continue
+			}
+		}
+		if lang, ok := f.GetProp(LangProp(n, "")); ok {
+			props[i].Lang = lang
+		}
+	}
+}
+
+// parseAcceptLanguage parses an Accept-Language header into its language
+// ranges, most preferred first, leaving out those refused with q=0.
+func parseAcceptLanguage(h string) []string {
+	type weighted struct {
+		lang string
+		q    float64
+	}
+	var ws []weighted
+	for _, part := range strings.Split(h, ",") {
+		lang, params, _ := strings.Cut(part, ";")
+		lang = strings.TrimSpace(lang)
+		if lang == "" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			ws = append(ws, weighted{lang, q})
+		}
+	}
+	sort.SliceStable(ws, func(i, j int) bool { return ws[i].q > ws[j].q })
+	res := make([]string, len(ws))
+	for i, w := range ws {
+		res[i] = w.lang
+	}
+	return res
+}
+
+// matchLang selects the language best matching the ranges, by the basic
+// filtering of RFC 4647, in which "fr" matches "fr-CA" and "*" anything.
+// Only the languages in which variants are kept, not empty, are selected.
+func matchLang(ranges, langs []string) string {
+	for _, r := range ranges {
+		for _, lang := range langs {
+			if lang == "" {
+				continue
+			}
+			if r == "*" || strings.EqualFold(r, lang) ||
+				(len(lang) > len(r) && lang[len(r)] == '-' && strings.EqualFold(r, lang[:len(r)])) {
+				return lang
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,72 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+func TestPropLanguages(t *testing.T) {
+	s := webdav.NewWebDAV(memfs.NewMemFS())
+	serve(s, "PUT", "/a", "x")
+	setTitle := func(attr, title string) {
+		serve(s, "PROPPATCH", "/a", `<propertyupdate xmlns="DAV:"><set><prop><title xmlns="urn:x"`+attr+`>`+title+`</title></prop></set></propertyupdate>`)
+	}
+	title := func(p string, hdr ...string) string {
+		w := serve(s, "PROPFIND", p, `<propfind xmlns="DAV:"><prop><title xmlns="urn:x"/></prop></propfind>`, append([]string{"Depth", "0"}, hdr...)...)
+		body := w.Body.String()
+		i := strings.Index(body, "<title")
+		j := strings.Index(body, "</title>")
+		if i < 0 || j < i {
+			t.Fatalf("PROPFIND lacks the title:\n%s", body)
+		}
+		return body[i:j]
+	}
+
+	setTitle(` xml:lang="en"`, "Hello")
+	setTitle(` xml:lang="fr-CA"`, "Bonjour")
+	for _, tc := range []struct {
+		accept, want string
+	}{
+		{"", `xml:lang="fr-CA">Bonjour`},
+		{"en", `xml:lang="en">Hello`},
+		{"de, en-US;q=0.8, fr;q=0.5", `xml:lang="fr-CA">Bonjour`},
+		{"fr;q=0, en;q=0.1", `xml:lang="en">Hello`},
+		{"de", `xml:lang="fr-CA">Bonjour`},
+	} {
+		if got := title("/a", "Accept-Language", tc.accept); !strings.HasSuffix(got, tc.want) {
+			t.Errorf("PROPFIND with Accept-Language %q got %s, want %s", tc.accept, got, tc.want)
+		}
+	}
+
+	// The languages are copied with the properties, and not listed.
+	serve(s, "COPY", "/a", "", "Destination", "http://example.com/b")
+	if got := title("/b", "Accept-Language", "en"); !strings.HasSuffix(got, `xml:lang="en">Hello`) {
+		t.Errorf("PROPFIND of a copy got %s", got)
+	}
+	if w := serve(s, "PROPFIND", "/b", `<propfind xmlns="DAV:"><allprop/></propfind>`, "Depth", "0"); strings.Contains(w.Body.String(), webdav.LangNS) {
+		t.Errorf("allprop PROPFIND listed languages:\n%s", w.Body)
+	}
+
+	// A value without a language replaces those in all languages.
+	setTitle("", "Hi")
+	if got := title("/a", "Accept-Language", "en"); strings.Contains(got, "xml:lang") || !strings.HasSuffix(got, ">Hi") {
+		t.Errorf("PROPFIND after setting a value without language got %s", got)
+	}
+}
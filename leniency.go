@@ -0,0 +1,149 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/google/go-webdav/cond"
+	"github.com/google/go-webdav/davhttp"
+)
+
+// Names of the recoveries applied to malformed requests when not in strict
+// mode, as counted in State.Leniencies.
+const (
+	// LenientDepth accepts Depth values differing in case or whitespace,
+	// such as "Infinity".
+	LenientDepth = "depth"
+	// LenientOverwrite accepts Overwrite values differing in case or
+	// whitespace, and treats other values as "T".
+	LenientOverwrite = "overwrite"
+	// LenientIf accepts If headers holding a lock token without the
+	// enclosing list, such as "<opaquelocktoken:...>".
+	LenientIf = "if"
+	// LenientLockToken accepts Lock-Token headers holding a lock token
+	// without the enclosing angle brackets.
+	LenientLockToken = "lock-token"
+)
+
+// WithStrict rejects requests with malformed Depth, Overwrite and If
+// headers, rather than recovering from the mistakes of known-broken clients,
+// see WithLenientClients.
+func WithStrict() Option {
+	return func(s *WebDAV) {
+		s.strict = true
+	}
+}
+
+// WithLenientClients applies the recoveries for malformed requests to
+// clients whose User-Agent contains any of the given strings, even in
+// strict mode.
+func WithLenientClients(agents ...string) Option {
+	return func(s *WebDAV) {
+		s.lenientUAs = append(s.lenientUAs, agents...)
+	}
+}
+
+// lenientFor determines if recoveries apply to a request.
+func (s *WebDAV) lenientFor(r *http.Request) bool {
+	if !s.strict {
+		return true
+	}
+	ua := r.Header.Get("User-Agent")
+	for _, a := range s.lenientUAs {
+		if a != "" && strings.Contains(ua, a) {
+			return true
+		}
+	}
+	return false
+}
+
+// leniencies counts the recoveries applied.
+type leniencies struct {
+	m      sync.Mutex
+	counts map[string]int
+}
+
+func (l *leniencies) add(name string) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	if l.counts == nil {
+		l.counts = make(map[string]int)
+	}
+	l.counts[name]++
+}
+
+func (l *leniencies) snapshot() map[string]int {
+	l.m.Lock()
+	defer l.m.Unlock()
+	res := make(map[string]int, len(l.counts))
+	for k, v := range l.counts {
+		res[k] = v
+	}
+	return res
+}
+
+func (s *WebDAV) parseDepth(dh string, lenient bool) (int, error) {
+	d, err := parseDepth(dh)
+	if err != nil && lenient {
+		if ld, lerr := parseDepth(strings.ToLower(strings.TrimSpace(dh))); lerr == nil {
+			s.leniency.add(LenientDepth)
+			return ld, nil
+		}
+	}
+	return d, err
+}
+
+func (s *WebDAV) parseOverwrite(oh string, lenient bool) (bool, error) {
+	o, err := davhttp.ParseOverwrite(oh)
+	if err == nil {
+		return o, nil
+	}
+	if !lenient {
+		return false, ErrorBadRequest.WithCause(err)
+	}
+	s.leniency.add(LenientOverwrite)
+	return strings.ToUpper(strings.TrimSpace(oh)) != "F", nil
+}
+
+func (s *WebDAV) parseIf(ih, host string, lenient bool) (*cond.IfTag, error) {
+	t, err := parseIfHeader(ih, host)
+	if err == nil || !lenient {
+		return t, err
+	}
+	ih = strings.TrimSpace(ih)
+	if !strings.HasPrefix(ih, "<") {
+		ih = "<" + ih + ">"
+	}
+	if lt, lerr := parseIfHeader("("+ih+")", host); lerr == nil {
+		s.leniency.add(LenientIf)
+		return lt, nil
+	}
+	return t, err
+}
+
+func (s *WebDAV) parseLockToken(lh string, lenient bool) (string, error) {
+	t, err := davhttp.ParseLockToken(lh)
+	if err == nil || !lenient {
+		return t, err
+	}
+	if lt, lerr := davhttp.ParseLockToken("<" + strings.TrimSpace(lh) + ">"); lerr == nil {
+		s.leniency.add(LenientLockToken)
+		return lt, nil
+	}
+	return t, err
+}
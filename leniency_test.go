@@ -0,0 +1,71 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+func TestLeniency(t *testing.T) {
+	const body = `<?xml version="1.0"?><propfind xmlns="DAV:"><prop><displayname/></prop></propfind>`
+	propfind := func(h http.Handler, depth, ua string) int {
+		r := httptest.NewRequest("PROPFIND", "/", strings.NewReader(body))
+		r.Header.Set("Depth", depth)
+		r.Header.Set("User-Agent", ua)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	lenient := webdav.NewWebDAV(memfs.NewMemFS())
+	if code := propfind(lenient, " Infinity", "any"); code != 207 {
+		t.Errorf("lenient PROPFIND with Depth \" Infinity\" got %d, want 207", code)
+	}
+	if got := lenient.Snapshot().Leniencies[webdav.LenientDepth]; got != 1 {
+		t.Errorf("got %d depth recoveries, want 1", got)
+	}
+
+	strict := webdav.NewWebDAV(memfs.NewMemFS(), webdav.WithStrict(), webdav.WithLenientClients("Broken/1.0"))
+	if code := propfind(strict, "Infinity", "any"); code != http.StatusBadRequest {
+		t.Errorf("strict PROPFIND with Depth \"Infinity\" got %d, want 400", code)
+	}
+	if code := propfind(strict, "Infinity", "Broken/1.0 (x)"); code != 207 {
+		t.Errorf("strict PROPFIND from a lenient client got %d, want 207", code)
+	}
+	if code := propfind(strict, "infinity", "any"); code != 207 {
+		t.Errorf("strict PROPFIND with Depth \"infinity\" got %d, want 207", code)
+	}
+}
+
+func TestLenientIf(t *testing.T) {
+	h := webdav.NewWebDAV(memfs.NewMemFS())
+	r := httptest.NewRequest("PUT", "/a", strings.NewReader("a"))
+	r.Header.Set("If", "<opaquelocktoken:00000000-0000-4000-8000-000000000000>")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	// The recovered condition names an unknown lock, so cannot hold.
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf("PUT with a bare lock token in If got %d, want 412", w.Code)
+	}
+	if got := h.Snapshot().Leniencies[webdav.LenientIf]; got != 1 {
+		t.Errorf("got %d If recoveries, want 1", got)
+	}
+}
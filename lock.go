@@ -15,76 +15,100 @@
 package webdav
 
 import (
+	"crypto/rand"
 	"errors"
 	"fmt"
-	"math/rand"
-	"strconv"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/google/go-webdav/davhttp"
 	wp "github.com/google/go-webdav/path"
 )
 
-var (
-	minLockDuration = 20 * time.Second
-	maxLockDuration = 5 * time.Minute
-)
-
 type lock struct {
 	token    string
 	depth    int
+	shared   bool
+	null     bool   // the resource was created by LOCK and not yet written
 	owner    string // vertabim XML
+	holder   string // see StaleLockPolicy
 	duration time.Duration
 	modified time.Time
+	used     time.Time // last submitted, other than to refresh
 	path     string
+	clock    Clock
 	m        sync.Mutex
 }
 
 func (l *lock) String() string {
-	t := (l.duration - time.Since(l.modified))
+	t := (l.duration - l.clock.Now().Sub(l.modified))
 	return fmt.Sprintf("%s@%d T%s D%s", l.path, l.depth, l.token, t)
 }
 
-func (l *lock) toXML() string {
+// toXML renders the lock as an activelock element, with the given href for
+// its root.
+func (l *lock) toXML(root string) string {
 	l.m.Lock()
 	defer l.m.Unlock()
-	ds := strconv.Itoa(l.depth)
-	if l.depth < 0 {
-		ds = "infinity"
+	t := l.duration - l.clock.Now().Sub(l.modified)
+	if t < 0 {
+		t = 0
+	}
+	scope := "exclusive"
+	if l.shared {
+		scope = "shared"
 	}
-
-	t := (l.duration - time.Since(l.modified)) / time.Second
 	return fmt.Sprintf(`
 <activelock>
   <locktype><write/></locktype>
-  <lockscope><exclusive/></lockscope>
+  <lockscope><%s/></lockscope>
   <depth>%s</depth>
   <owner>%s</owner>
-  <timeout>Second-%d</timeout>
+  <timeout>%s</timeout>
   <locktoken><href>%s</href></locktoken>
   <lockroot><href>%s</href></lockroot>
-</activelock>`, ds, l.owner, t, l.token, wp.URLEncode(l.path))
+</activelock>`, scope, davhttp.FormatDepth(l.depth), l.owner, davhttp.FormatTimeout(t), l.token, wp.URLEncode(root))
 }
 
 func (l *lock) touch() {
 	l.m.Lock()
 	defer l.m.Unlock()
-	l.modified = time.Now()
+	l.modified = l.clock.Now()
+}
+
+// use records that the token of the lock was submitted with a write.
+func (l *lock) use() {
+	l.m.Lock()
+	defer l.m.Unlock()
+	l.used = l.clock.Now()
 }
 
 func (l *lock) expired() bool {
 	l.m.Lock()
 	defer l.m.Unlock()
-	return time.Now().After(l.modified.Add(l.duration))
+	return l.clock.Now().After(l.modified.Add(l.duration))
 }
 
 type lockmaster struct {
-	m     sync.Mutex
-	locks map[string]*lock
+	m      sync.Mutex
+	locks  map[string]*lock
+	clock  Clock
+	tokens TokenSource
+	// vanished are the paths of lock-null resources whose locks ended,
+	// which are to be removed, see expire.
+	vanished []string
+	// store keeps the locks across restarts, if set.
+	store LockStore
 }
 
 func newLockMaster() *lockmaster {
-	return &lockmaster{locks: make(map[string]*lock)}
+	return &lockmaster{
+		locks:  make(map[string]*lock),
+		clock:  SystemClock,
+		tokens: RandomTokens,
+	}
 }
 
 func (lm *lockmaster) getLockForPath(p string) *lock {
@@ -92,7 +116,7 @@ func (lm *lockmaster) getLockForPath(p string) *lock {
 	defer lm.m.Unlock()
 	for _, l := range lm.locks {
 		if l.expired() {
-			delete(lm.locks, l.token)
+			lm.drop(l)
 			continue
 		}
 
@@ -104,50 +128,300 @@ func (lm *lockmaster) getLockForPath(p string) *lock {
 	return nil
 }
 
+// getLocksForPath gets all active locks covering a path.
+func (lm *lockmaster) getLocksForPath(p string) []*lock {
+	var res []*lock
+	for _, l := range lm.allLocks() {
+		if _, ok := wp.Included(p, l.path, l.depth); ok {
+			res = append(res, l)
+		}
+	}
+	return res
+}
+
+// allLocks gets all currently active locks.
+func (lm *lockmaster) allLocks() []*lock {
+	lm.m.Lock()
+	defer lm.m.Unlock()
+	var res []*lock
+	for _, l := range lm.locks {
+		if l.expired() {
+			lm.drop(l)
+			continue
+		}
+		res = append(res, l)
+	}
+	return res
+}
+
 func (lm *lockmaster) isLocked(p, t string) bool {
 	lm.m.Lock()
 	defer lm.m.Unlock()
+	t = normalizeToken(t)
 	l := lm.locks[t]
-	if l == nil || l.expired() {
-		delete(lm.locks, t)
+	if l == nil {
+		return false
+	}
+	if l.expired() {
+		lm.drop(l)
 		return false
 	}
 	_, ok := wp.Included(p, l.path, l.depth)
 	return ok
 }
 
-func (lm *lockmaster) generateToken() string {
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	return fmt.Sprintf("urn:uuid:%x-%x-280885-%x",
-		r.Int31(), r.Int31(), time.Now().UnixNano())
+// heldLockNull determines whether p is a lock-null resource whose lock is
+// one of the given tokens.
+func (lm *lockmaster) heldLockNull(p string, tokens []string) bool {
+	lm.m.Lock()
+	defer lm.m.Unlock()
+	for _, t := range tokens {
+		l := lm.locks[normalizeToken(t)]
+		if l != nil && l.null && l.path == p && !l.expired() {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenSource generates lock tokens, which must be unique absolute URIs.
+// Tokens issued by an earlier source remain usable after it is replaced.
+type TokenSource interface {
+	NewToken() (string, error)
+}
+
+type randomTokens struct{}
+
+func (randomTokens) NewToken() (string, error) {
+	u, err := newUUID()
+	if err != nil {
+		return "", err
+	}
+	return "opaquelocktoken:" + u, nil
+}
+
+// newUUID generates a random UUID.
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40 // Version 4.
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant.
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// RandomTokens is the default TokenSource, generating opaquelocktoken URIs
+// from random UUIDs as described in RFC 4918 appendix C.
+var RandomTokens TokenSource = randomTokens{}
+
+// normalizeToken maps a lock token as echoed by a client to the form used
+// for comparison. Surrounding whitespace and angle brackets are removed and
+// the scheme is compared without case. UUIDs are compared without case, and
+// the opaquelocktoken and urn:uuid schemes are treated as equivalent.
+func normalizeToken(t string) string {
+	t = strings.TrimSpace(t)
+	if len(t) >= 2 && t[0] == '<' && t[len(t)-1] == '>' {
+		t = strings.TrimSpace(t[1 : len(t)-1])
+	}
+	i := strings.IndexByte(t, ':')
+	if i < 0 {
+		return t
+	}
+	scheme, rest := strings.ToLower(t[:i]), t[i+1:]
+	switch {
+	case scheme == "opaquelocktoken":
+		return "opaquelocktoken:" + strings.ToLower(rest)
+	case scheme == "urn" && len(rest) >= 5 && strings.EqualFold(rest[:5], "uuid:"):
+		return "opaquelocktoken:" + strings.ToLower(rest[5:])
+	}
+	return scheme + ":" + rest
 }
 
-func (lm *lockmaster) unlock(t string) {
+// changed removes the locks made stale by a change: those rooted at
+// resources which were removed or moved away, or replaced by a COPY or
+// MOVE, see http://www.webdav.org/specs/rfc4918.html#rfc.section.7.7.
+// Locks covering such resources from an enclosing collection remain. As
+// the change does not tell which members survived a partially failed
+// DELETE, their locks are removed too. Lock-null resources which were
+// written are kept once their locks end.
+func (lm *lockmaster) changed(c Change) {
+	if c.Kind == ChangeModified {
+		lm.m.Lock()
+		defer lm.m.Unlock()
+		written := false
+		for _, l := range lm.locks {
+			if l.path == c.Path && l.null {
+				l.null = false
+				written = true
+			}
+		}
+		if written {
+			// Failing to save leaves the resource to vanish should the
+			// handler restart, changes have no way to report errors.
+			lm.save()
+		}
+		return
+	}
+
+	var gone []string
+	switch c.Kind {
+	case ChangeRemoved, ChangeMoved:
+		gone = append(gone, c.Path)
+	}
+	switch c.Kind {
+	case ChangeMoved, ChangeCopied:
+		gone = append(gone, c.Destination)
+	}
+	if len(gone) == 0 {
+		return
+	}
+
 	lm.m.Lock()
 	defer lm.m.Unlock()
-	delete(lm.locks, t)
+	removed := false
+	for t, l := range lm.locks {
+		for _, p := range gone {
+			if wp.InTree(l.path, p) {
+				delete(lm.locks, t)
+				removed = true
+				break
+			}
+		}
+	}
+	if removed {
+		// A stale lock restored after a failed save is harmless, as
+		// its resource is gone.
+		lm.save()
+	}
 }
 
-func (lm *lockmaster) refreshLock(tok string, path Path, duration time.Duration) (*lock, error) {
+func (lm *lockmaster) unlock(t string) error {
 	lm.m.Lock()
 	defer lm.m.Unlock()
+	if l, ok := lm.locks[normalizeToken(t)]; ok {
+		lm.drop(l)
+	}
+	return lm.save()
+}
 
-	p := path.String()
+// save saves the active locks to the LockStore, with lm.m held. Expired
+// locks are left to be skipped by restore, rather than saved on expiry.
+func (lm *lockmaster) save() error {
+	if lm.store == nil {
+		return nil
+	}
+	locks := []LockState{}
+	for _, l := range lm.locks {
+		if !l.expired() {
+			locks = append(locks, l.state())
+		}
+	}
+	sort.Sort(byLockPath(locks))
+	return lm.store.Save(locks)
+}
+
+// restore loads the locks saved in the LockStore which have not expired.
+func (lm *lockmaster) restore() error {
+	if lm.store == nil {
+		return nil
+	}
+	locks, err := lm.store.Load()
+	if err != nil {
+		return err
+	}
+	lm.m.Lock()
+	defer lm.m.Unlock()
+	now := lm.clock.Now()
+	for _, ls := range locks {
+		if !ls.Expires.After(now) {
+			continue
+		}
+		if ls.Used.IsZero() {
+			ls.Used = now
+		}
+		lm.locks[normalizeToken(ls.Token)] = &lock{
+			token:    ls.Token,
+			depth:    ls.Depth,
+			shared:   ls.Shared,
+			null:     ls.LockNull,
+			owner:    ls.Owner,
+			holder:   ls.Holder,
+			duration: ls.Expires.Sub(now),
+			modified: now,
+			used:     ls.Used,
+			path:     ls.Path,
+			clock:    lm.clock,
+		}
+	}
+	return nil
+}
 
-	// We enforce all locks to be a minimum of ten seconds.
-	if duration < minLockDuration {
-		duration = minLockDuration
+// drop removes a lock which was released or expired, with lm.m held. If it
+// was that of a lock-null resource, the resource is handed to another lock
+// rooted at it, or is to be removed.
+func (lm *lockmaster) drop(l *lock) {
+	delete(lm.locks, normalizeToken(l.token))
+	if !l.null {
+		return
 	}
-	if duration > maxLockDuration {
-		duration = maxLockDuration
+	for _, o := range lm.locks {
+		if o.path == l.path && !o.expired() {
+			o.null = true
+			return
+		}
 	}
+	lm.vanished = append(lm.vanished, l.path)
+}
+
+// setHolder records the holder of a lock, see StaleLockPolicy.
+func (lm *lockmaster) setHolder(l *lock, holder string) error {
+	lm.m.Lock()
+	defer lm.m.Unlock()
+	l.m.Lock()
+	l.holder = holder
+	l.m.Unlock()
+	return lm.save()
+}
 
-	l, ok := lm.locks[tok]
+// markNull records that a lock created the resource it is rooted at, which
+// is a lock-null resource until it is written by a PUT. RFC 2518 section
+// 7.4 lets such resources vanish when their locks end, as clients such as
+// Microsoft Office expect, where RFC 4918 keeps them as empty files.
+func (lm *lockmaster) markNull(l *lock) error {
+	lm.m.Lock()
+	defer lm.m.Unlock()
+	l.null = true
+	return lm.save()
+}
+
+// expire removes the expired locks, returning the paths of the lock-null
+// resources whose locks ended since it was last called.
+func (lm *lockmaster) expire() []string {
+	lm.m.Lock()
+	defer lm.m.Unlock()
+	for _, l := range lm.locks {
+		if l.expired() {
+			lm.drop(l)
+		}
+	}
+	v := lm.vanished
+	lm.vanished = nil
+	return v
+}
+
+func (lm *lockmaster) refreshLock(tok string, path Path, duration time.Duration) (*lock, error) {
+	lm.m.Lock()
+	defer lm.m.Unlock()
+
+	p := path.String()
+
+	l, ok := lm.locks[normalizeToken(tok)]
 	if !ok {
 		return nil, fmt.Errorf("unknown lock: %s", tok)
 	}
 	if l.expired() {
-		delete(lm.locks, l.token)
+		lm.drop(l)
 		return nil, errors.New("expired lock")
 	}
 	if _, ok := wp.Included(p, l.path, l.depth); !ok {
@@ -155,48 +429,62 @@ func (lm *lockmaster) refreshLock(tok string, path Path, duration time.Duration)
 	}
 	l.duration = duration
 	l.touch()
+	if err := lm.save(); err != nil {
+		return nil, err
+	}
 	return l, nil
 }
 
-func (lm *lockmaster) createLock(owner string, path Path, depth int, duration time.Duration) (*lock, error) {
+// createLock creates an exclusive or shared lock. A lock conflicts with the
+// active locks covering, or covered by, the resources it would cover,
+// unless all of them are shared, see
+// http://www.webdav.org/specs/rfc4918.html#lock-model.
+func (lm *lockmaster) createLock(owner string, path Path, depth int, duration time.Duration, shared bool) (*lock, error) {
 	lm.m.Lock()
 	defer lm.m.Unlock()
 
 	p := path.String()
 
-	// We enforce all locks to be a minimum of ten seconds.
-	if duration < minLockDuration {
-		duration = minLockDuration
-	}
-	if duration > maxLockDuration {
-		duration = maxLockDuration
-	}
-
 	for _, l := range lm.locks {
 		if l.expired() {
-			delete(lm.locks, l.token)
+			lm.drop(l)
+			continue
+		}
+
+		if shared && l.shared {
 			continue
 		}
 
 		// Check if the lock covers this path already.
 		if _, ok := wp.Included(p, l.path, l.depth); ok {
-			return nil, ErrorLocked
+			return nil, ErrorNoConflictingLock.WithResources(l.path)
 		}
 
 		// Check if this crosses another lock.
 		if _, ok := wp.Included(l.path, p, depth); ok {
-			return nil, ErrorLocked
+			return nil, ErrorNoConflictingLock.WithResources(l.path)
 		}
 	}
 
+	token, err := lm.tokens.NewToken()
+	if err != nil {
+		return nil, err
+	}
 	l := &lock{
-		token:    lm.generateToken(),
+		token:    token,
 		depth:    depth,
+		shared:   shared,
 		owner:    owner,
 		duration: duration,
-		modified: time.Now(),
+		modified: lm.clock.Now(),
+		used:     lm.clock.Now(),
 		path:     p,
+		clock:    lm.clock,
+	}
+	lm.locks[normalizeToken(l.token)] = l
+	if err := lm.save(); err != nil {
+		delete(lm.locks, normalizeToken(l.token))
+		return nil, err
 	}
-	lm.locks[l.token] = l
 	return l, nil
 }
@@ -0,0 +1,329 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"errors"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock which only moves when advanced.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// testPath is a Path of which only String is used by the lockmaster.
+type testPath struct {
+	Path
+	p string
+}
+
+func (p testPath) String() string {
+	return p.p
+}
+
+func TestLockExpiry(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC)}
+	lm := newLockMaster()
+	lm.clock = clock
+
+	l, err := lm.createLock("", testPath{p: "/a"}, 0, time.Minute, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.advance(59 * time.Second)
+	if !lm.isLocked("/a", l.token) {
+		t.Fatal("expected lock to be held before its timeout")
+	}
+	if _, err := lm.createLock("", testPath{p: "/a"}, 0, time.Minute, false); err == nil {
+		t.Error("expected conflicting lock to be refused")
+	}
+
+	clock.advance(2 * time.Second)
+	if lm.isLocked("/a", l.token) {
+		t.Error("expected lock to expire after its timeout")
+	}
+	if lm.getLockForPath("/a") != nil {
+		t.Error("expected no lock for path after expiry")
+	}
+}
+
+func TestLockRefresh(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC)}
+	lm := newLockMaster()
+	lm.clock = clock
+
+	l, err := lm.createLock("", testPath{p: "/a"}, -1, time.Minute, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.advance(50 * time.Second)
+	if _, err := lm.refreshLock(l.token, testPath{p: "/a/b"}, time.Minute); err != nil {
+		t.Fatalf("expected refresh within the lock to succeed: %v", err)
+	}
+	clock.advance(50 * time.Second)
+	if !lm.isLocked("/a/b", l.token) {
+		t.Error("expected refreshed lock to be held")
+	}
+
+	clock.advance(11 * time.Second)
+	if _, err := lm.refreshLock(l.token, testPath{p: "/a"}, time.Minute); err == nil {
+		t.Error("expected refresh of an expired lock to fail")
+	}
+}
+
+func TestLockPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		p         LockPolicy
+		requested time.Duration
+		want      time.Duration
+	}{
+		{LockPolicy{}, 0, DefaultLockTimeout},
+		{LockPolicy{}, time.Second, DefaultMinLockTimeout},
+		{LockPolicy{}, time.Hour, DefaultMaxLockTimeout},
+		{LockPolicy{MaxTimeout: time.Hour}, time.Hour, time.Hour},
+		{LockPolicy{MaxTimeout: time.Hour}, 2 * time.Hour, time.Hour},
+		{LockPolicy{MinTimeout: time.Second}, time.Second, time.Second},
+		{LockPolicy{DefaultTimeout: time.Minute}, 0, time.Minute},
+		{LockPolicy{DefaultTimeout: time.Hour}, 0, DefaultMaxLockTimeout},
+	} {
+		if got := tc.p.timeout(tc.requested); got != tc.want {
+			t.Errorf("%+v.timeout(%s) = %s, want %s", tc.p, tc.requested, got, tc.want)
+		}
+	}
+}
+
+func TestRandomTokens(t *testing.T) {
+	re := regexp.MustCompile(`^opaquelocktoken:[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		tok, err := RandomTokens.NewToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !re.MatchString(tok) {
+			t.Errorf("token %q is not an opaquelocktoken UUIDv4 URI", tok)
+		}
+		if seen[tok] {
+			t.Errorf("duplicate token %q", tok)
+		}
+		seen[tok] = true
+	}
+}
+
+func TestNormalizeToken(t *testing.T) {
+	const want = "opaquelocktoken:f81d4fae-7dec-11d0-a765-00a0c91e6bf6"
+	for _, tok := range []string{
+		want,
+		"<" + want + ">",
+		" < opaquelocktoken:f81d4fae-7dec-11d0-a765-00a0c91e6bf6 > ",
+		"OpaqueLockToken:F81D4FAE-7DEC-11D0-A765-00A0C91E6BF6",
+		"urn:uuid:f81d4fae-7dec-11d0-a765-00a0c91e6bf6",
+		"<URN:UUID:F81D4FAE-7DEC-11D0-A765-00A0C91E6BF6>",
+	} {
+		if got := normalizeToken(tok); got != want {
+			t.Errorf("normalizeToken(%q) = %q, want %q", tok, got, want)
+		}
+	}
+	if got := normalizeToken("HTTP://example.com/Lock"); got != "http://example.com/Lock" {
+		t.Errorf("normalizeToken kept the case of the scheme or changed the path: %q", got)
+	}
+}
+
+func TestLockTokenSchemes(t *testing.T) {
+	lm := newLockMaster()
+	l, err := lm.createLock("", testPath{p: "/a"}, 0, time.Minute, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alt := "<urn:uuid:" + strings.ToUpper(strings.TrimPrefix(l.token, "opaquelocktoken:")) + ">"
+	if !lm.isLocked("/a", alt) {
+		t.Errorf("lock not found by %q", alt)
+	}
+	lm.unlock(alt)
+	if lm.isLocked("/a", l.token) {
+		t.Error("lock not released by alternate token form")
+	}
+}
+
+func TestLockChanged(t *testing.T) {
+	lm := newLockMaster()
+	lock := func(p string, depth int) *lock {
+		l, err := lm.createLock("", testPath{p: p}, depth, time.Minute, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return l
+	}
+	d := lock("/d", -1)
+	a := lock("/a", 0)
+	b := lock("/b/x", 0)
+	c := lock("/c", 0)
+
+	lm.changed(Change{Kind: ChangeRemoved, Path: "/d/y"})
+	if !lm.isLocked("/d/y", d.token) {
+		t.Error("removing a member released the lock of its collection")
+	}
+	lm.changed(Change{Kind: ChangeMoved, Path: "/a", Destination: "/e"})
+	if lm.isLocked("/a", a.token) {
+		t.Error("lock on a moved resource remains")
+	}
+	lm.changed(Change{Kind: ChangeRemoved, Path: "/b"})
+	if lm.isLocked("/b/x", b.token) {
+		t.Error("lock within a removed collection remains")
+	}
+	lm.changed(Change{Kind: ChangeCopied, Path: "/f", Destination: "/c"})
+	if lm.isLocked("/c", c.token) {
+		t.Error("lock on a replaced resource remains")
+	}
+}
+
+func TestSharedLocks(t *testing.T) {
+	lm := newLockMaster()
+	s1, err := lm.createLock("", testPath{p: "/d"}, -1, time.Minute, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err := lm.createLock("", testPath{p: "/d/a"}, 0, time.Minute, true)
+	if err != nil {
+		t.Fatalf("shared lock within a shared lock refused: %v", err)
+	}
+	if _, err := lm.createLock("", testPath{p: "/d/a"}, 0, time.Minute, false); err == nil {
+		t.Error("exclusive lock on a resource locked shared allowed")
+	}
+	if _, err := lm.createLock("", testPath{p: "/"}, -1, time.Minute, false); err == nil {
+		t.Error("exclusive lock covering a shared lock allowed")
+	}
+	if got := len(lm.getLocksForPath("/d/a")); got != 2 {
+		t.Errorf("getLocksForPath found %d locks, want 2", got)
+	}
+	if !lm.isLocked("/d/a", s1.token) || !lm.isLocked("/d/a", s2.token) {
+		t.Error("either shared lock should cover the resource")
+	}
+
+	lm.unlock(s1.token)
+	lm.unlock(s2.token)
+	if _, err := lm.createLock("", testPath{p: "/e"}, 0, time.Minute, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lm.createLock("", testPath{p: "/e"}, 0, time.Minute, true); err == nil {
+		t.Error("shared lock on a resource locked exclusively allowed")
+	}
+}
+
+func TestLockNull(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC)}
+	lm := newLockMaster()
+	lm.clock = clock
+	lock := func(p string, shared bool) *lock {
+		l, err := lm.createLock("", testPath{p: p}, 0, time.Minute, shared)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return l
+	}
+
+	a := lock("/a", false)
+	lm.markNull(a)
+	if v := lm.expire(); len(v) != 0 {
+		t.Errorf("expire got %q while the lock is held", v)
+	}
+	lm.unlock(a.token)
+	if v := lm.expire(); len(v) != 1 || v[0] != "/a" {
+		t.Errorf("expire got %q after unlocking, want /a", v)
+	}
+
+	b := lock("/b", false)
+	lm.markNull(b)
+	lm.changed(Change{Kind: ChangeModified, Path: "/b"})
+	lm.unlock(b.token)
+	if v := lm.expire(); len(v) != 0 {
+		t.Errorf("expire got %q for a written resource", v)
+	}
+
+	c1 := lock("/c", true)
+	lm.markNull(c1)
+	c2 := lock("/c", true)
+	lm.unlock(c1.token)
+	if v := lm.expire(); len(v) != 0 {
+		t.Errorf("expire got %q while a shared lock remains", v)
+	}
+	clock.advance(2 * time.Minute)
+	if v := lm.expire(); len(v) != 1 || v[0] != "/c" {
+		t.Errorf("expire got %q after %s expired, want /c", v, c2.token)
+	}
+}
+
+func TestFileLocks(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC)}
+	store := NewFileLocks(filepath.Join(t.TempDir(), "locks.json"))
+	start := func() *lockmaster {
+		lm := newLockMaster()
+		lm.clock = clock
+		lm.store = store
+		if err := lm.restore(); err != nil {
+			t.Fatal(err)
+		}
+		return lm
+	}
+
+	lm := start()
+	a, err := lm.createLock("<href>me</href>", testPath{p: "/a"}, -1, time.Minute, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := lm.createLock("", testPath{p: "/b"}, 0, 5*time.Minute, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.advance(30 * time.Second)
+	lm = start()
+	if !lm.isLocked("/a/x", a.token) || !lm.isLocked("/b", b.token) {
+		t.Fatal("locks not restored")
+	}
+	if l := lm.getLockForPath("/a"); l.owner != "<href>me</href>" || l.depth != -1 || l.shared {
+		t.Errorf("restored lock %s lost its owner, depth or scope", l)
+	}
+	if _, err := lm.createLock("", testPath{p: "/a/y"}, 0, time.Minute, false); !errors.Is(err, ErrorLocked) {
+		t.Errorf("createLock within a restored lock got %v, want ErrorLocked", err)
+	}
+
+	if err := lm.unlock(b.token); err != nil {
+		t.Fatal(err)
+	}
+	clock.advance(time.Minute)
+	lm = start()
+	if lm.isLocked("/a", a.token) {
+		t.Error("expired lock restored")
+	}
+	if lm.isLocked("/b", b.token) {
+		t.Error("released lock restored")
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+func TestLockPolicyGranted(t *testing.T) {
+	h := webdav.NewWebDAV(memfs.NewMemFS(), webdav.WithLockPolicy(webdav.LockPolicy{MaxTimeout: time.Hour}))
+	const lockBody = `<lockinfo xmlns="DAV:"><lockscope><exclusive/></lockscope><locktype><write/></locktype></lockinfo>`
+	w := serve(h, "LOCK", "/a", lockBody, "Timeout", "Second-3600")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("LOCK got %d", w.Code)
+	}
+	tok := w.Header().Get("Lock-Token")
+	l, ok := h.Lock(tok)
+	if !ok || time.Until(l.Expires) < 59*time.Minute {
+		t.Errorf("LOCK for an hour got %+v, want the configured maximum granted", l)
+	}
+
+	w = serve(h, "LOCK", "/a", "", "If", "("+tok+")", "Timeout", "Second-7200")
+	if l, _ := h.Lock(tok); w.Code != http.StatusOK || time.Until(l.Expires) > time.Hour {
+		t.Errorf("refreshing for two hours got %d, expiring %s", w.Code, l.Expires)
+	}
+}
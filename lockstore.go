@@ -0,0 +1,101 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// LockStore keeps the active locks of a handler, so that they survive it
+// restarting rather than vanishing under the clients holding their tokens.
+// Locks are kept in memory only by default.
+type LockStore interface {
+	// Load gets the locks which were saved, some of which may have
+	// expired since.
+	Load() ([]LockState, error)
+	// Save replaces the saved locks with the given ones.
+	Save(locks []LockState) error
+}
+
+// FileLocks is a LockStore keeping locks in a file as JSON, which is
+// replaced atomically on every change.
+type FileLocks struct {
+	m    sync.Mutex
+	name string
+}
+
+// NewFileLocks creates a FileLocks keeping locks in the named file, which
+// is created once a lock is taken.
+func NewFileLocks(name string) *FileLocks {
+	return &FileLocks{name: name}
+}
+
+// Load implements LockStore.
+func (fl *FileLocks) Load() ([]LockState, error) {
+	fl.m.Lock()
+	defer fl.m.Unlock()
+	b, err := os.ReadFile(fl.name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var locks []LockState
+	if err := json.Unmarshal(b, &locks); err != nil {
+		return nil, err
+	}
+	return locks, nil
+}
+
+// Save implements LockStore.
+func (fl *FileLocks) Save(locks []LockState) error {
+	if locks == nil {
+		locks = []LockState{}
+	}
+	b, err := json.MarshalIndent(locks, "", "  ")
+	if err != nil {
+		return err
+	}
+	fl.m.Lock()
+	defer fl.m.Unlock()
+	f, err := os.CreateTemp(filepath.Dir(fl.name), filepath.Base(fl.name)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), fl.name)
+}
+
+// WithLockStore sets where locks are kept, restoring those saved which have
+// not expired.
+func WithLockStore(store LockStore) Option {
+	return func(s *WebDAV) {
+		s.lm.store = store
+	}
+}
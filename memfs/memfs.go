@@ -23,9 +23,8 @@ import (
 	"io"
 	"log"
 	"path"
-	"sort"
+	"strconv"
 	"sync"
-	"time"
 
 	w "github.com/google/go-webdav"
 	wp "github.com/google/go-webdav/path"
@@ -34,25 +33,64 @@ import (
 type memfs struct {
 	m     sync.Mutex
 	files map[string]*memfile
+	clock w.Clock
+
+	// jm guards seq, the sequence number of the latest change in journal.
+	jm      sync.Mutex
+	seq     uint64
+	journal *w.MemoryJournal
 }
 
 // NewMemFS creates a new webdav.FileSystem based in memory.
 func NewMemFS() w.FileSystem {
-	fs := &memfs{files: make(map[string]*memfile)}
+	return NewMemFSWithClock(w.SystemClock)
+}
+
+// NewMemFSWithClock creates a new webdav.FileSystem based in memory, whose
+// file timestamps are taken from the given clock.
+func NewMemFSWithClock(c w.Clock) w.FileSystem {
+	fs := &memfs{files: make(map[string]*memfile), clock: c, journal: w.NewMemoryJournal(w.DefaultJournalSize)}
 	fs.files["/"] = newMemFile(fs, "/", true)
 	return fs
 }
 
-func (fs *memfs) Dumpz() {
-	log.Printf("dump:")
-	n := make([]string, 0, len(fs.files))
-	for k := range fs.files {
-		n = append(n, k)
-	}
-	sort.StringSlice(n).Sort()
-	for _, k := range n {
-		log.Printf("%s", k)
+func (fs *memfs) Dump(out io.Writer, format w.DumpFormat) error {
+	fs.m.Lock()
+	entries := make([]w.DumpEntry, 0, len(fs.files))
+	for _, f := range fs.files {
+		fi, _ := f.Stat()
+		e := w.DumpEntry{
+			Path:     f.path,
+			Dir:      f.dir,
+			Size:     fi.Size,
+			Modified: fi.LastModified,
+			Props:    make(map[string]string),
+		}
+		for _, k := range f.PropNames() {
+			e.Props[k], _ = f.GetProp(k)
+		}
+		entries = append(entries, e)
 	}
+	fs.m.Unlock()
+	return w.WriteDump(out, format, entries)
+}
+
+// Changes implements webdav.ChangeJournal.
+func (fs *memfs) Changes(seq uint64) ([]w.Change, error) {
+	return fs.journal.Since(seq)
+}
+
+// LastChange implements webdav.ChangeJournal.
+func (fs *memfs) LastChange() (uint64, error) {
+	return fs.journal.Last()
+}
+
+// record appends a change to the journal.
+func (fs *memfs) record(kind w.ChangeKind, p, dst string) {
+	fs.jm.Lock()
+	defer fs.jm.Unlock()
+	fs.seq++
+	fs.journal.Append(w.Change{Seq: fs.seq, Kind: kind, Path: p, Destination: dst, Time: fs.clock.Now()})
 }
 
 func (fs *memfs) ForPath(p string) (w.Path, error) {
@@ -124,6 +162,7 @@ func (p *memp) Mkdir() (w.File, error) {
 
 	f := newMemFile(p.fs, p.path, true)
 	p.fs.files[p.path] = f
+	p.fs.record(w.ChangeCreated, p.path, "")
 	return f, nil
 }
 
@@ -139,6 +178,7 @@ func (p *memp) Create() (w.File, w.FileHandle, error) {
 
 	f := newMemFile(p.fs, p.path, false)
 	p.fs.files[p.path] = f
+	p.fs.record(w.ChangeCreated, p.path, "")
 	fh, err := f.Open()
 	return f, fh, err
 }
@@ -153,6 +193,7 @@ func (p *memp) Remove() error {
 		return w.ErrorIsDir
 	}
 	delete(p.fs.files, f.path)
+	p.fs.record(w.ChangeRemoved, f.path, "")
 	return nil
 }
 
@@ -178,6 +219,7 @@ func (p *memp) RecursiveRemove() (errs map[string]error) {
 		return
 	}
 	p.removeSubtree(f.path)
+	p.fs.record(w.ChangeRemoved, f.path, "")
 	return
 }
 
@@ -219,11 +261,21 @@ func (p *memp) CopyTo(dst w.Path, opt w.CopyOptions) (bool, error) {
 		}
 	}
 
+	// The files are collected, and moved files removed, before any is
+	// added, so that the files added are not visited or removed in turn.
+	// Dead properties travel with the files, locks are the handler's
+	// concern.
+	sources := make(map[string]*memfile)
 	for orig, v := range p.fs.files {
-		nn, ok := wp.Included(orig, p.path, opt.Depth)
-		if !ok {
-			continue
+		if _, ok := wp.Included(orig, p.path, opt.Depth); ok {
+			sources[orig] = v
+			if opt.Move {
+				delete(p.fs.files, orig)
+			}
 		}
+	}
+	for orig, v := range sources {
+		nn, _ := wp.Included(orig, p.path, opt.Depth)
 		nn = path.Join(dstp.path, nn)
 		if opt.Move {
 			log.Printf("MOVE %s -> %s", orig, nn)
@@ -232,13 +284,17 @@ func (p *memp) CopyTo(dst w.Path, opt w.CopyOptions) (bool, error) {
 			// file-related.
 			v.path = nn
 			p.fs.files[nn] = v
-			delete(p.fs.files, orig)
 		} else {
 			log.Printf("COPY %s -> %s", orig, nn)
 			nv := v.clone(nn)
 			p.fs.files[nn] = nv
 		}
 	}
+	kind := w.ChangeCopied
+	if opt.Move {
+		kind = w.ChangeMoved
+	}
+	p.fs.record(kind, p.path, dstp.path)
 	return newf, nil
 }
 
@@ -251,6 +307,16 @@ type memfile struct {
 	m    sync.Mutex
 	data []byte
 	p    map[string]string
+	// versions are those of a file under version control, nil otherwise.
+	versions []memversion
+	// recorded counts the versions ever recorded, naming the next one.
+	recorded int
+}
+
+// memversion is a version of a file under version control.
+type memversion struct {
+	w.Version
+	data []byte
 }
 
 func newMemFile(fs *memfs, path string, dir bool) *memfile {
@@ -263,7 +329,7 @@ func newMemFile(fs *memfs, path string, dir bool) *memfile {
 		dir:  dir,
 		path: path,
 		p:    make(map[string]string),
-		i:    w.FileInfo{Created: time.Now()},
+		i:    w.FileInfo{Created: fs.clock.Now()},
 		data: d,
 	}
 }
@@ -288,6 +354,7 @@ func (f *memfile) GetPath() string {
 }
 
 func (f *memfile) PatchProp(set, remove map[string]string) error {
+	defer f.fs.record(w.ChangeProps, f.GetPath(), "")
 	f.m.Lock()
 	defer f.m.Unlock()
 	for k, v := range set {
@@ -306,6 +373,16 @@ func (f *memfile) GetProp(k string) (string, bool) {
 	return f.p[k], exists
 }
 
+func (f *memfile) PropNames() []string {
+	f.m.Lock()
+	defer f.m.Unlock()
+	n := make([]string, 0, len(f.p))
+	for k := range f.p {
+		n = append(n, k)
+	}
+	return n
+}
+
 func (f *memfile) IsDirectory() bool {
 	return f.dir
 }
@@ -336,10 +413,94 @@ func (f *memfile) Truncate() (w.FileHandle, error) {
 		return nil, w.ErrorIsDir
 	}
 	f.data = make([]byte, 0)
-	f.i.LastModified = time.Now()
+	f.i.LastModified = f.fs.clock.Now()
 	return &memfileh{f: f}, nil
 }
 
+// Update implements webdav.Updater.
+func (f *memfile) Update() (w.FileHandle, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	if f.dir {
+		return nil, w.ErrorIsDir
+	}
+	if f.data == nil {
+		f.data = make([]byte, 0)
+	}
+	return &memfileh{f: f}, nil
+}
+
+// VersionControl implements webdav.Versioning.
+func (f *memfile) VersionControl() error {
+	f.m.Lock()
+	defer f.m.Unlock()
+	if f.dir {
+		return w.ErrorIsDir
+	}
+	if f.versions == nil {
+		f.recordVersion()
+	}
+	return nil
+}
+
+// recordVersion records the content of the file as a new version, with f.m
+// held.
+func (f *memfile) recordVersion() {
+	data := make([]byte, len(f.data))
+	copy(data, f.data)
+	f.recorded++
+	f.versions = append(f.versions, memversion{
+		Version: w.Version{
+			Name:    strconv.Itoa(f.recorded),
+			Created: f.fs.clock.Now(),
+			Size:    int64(len(data)),
+		},
+		data: data,
+	})
+}
+
+// Versions implements webdav.Versioning.
+func (f *memfile) Versions() ([]w.Version, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	var res []w.Version
+	for _, v := range f.versions {
+		res = append(res, v.Version)
+	}
+	return res, nil
+}
+
+// OpenVersion implements webdav.Versioning.
+func (f *memfile) OpenVersion(name string) (w.FileHandle, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	for _, v := range f.versions {
+		if v.Name == name {
+			data := make([]byte, len(v.data))
+			copy(data, v.data)
+			return &memfileh{f: &memfile{fs: f.fs, path: f.path, data: data}}, nil
+		}
+	}
+	return nil, w.ErrorNotFound
+}
+
+// RemoveVersion implements webdav.VersionPruner.
+func (f *memfile) RemoveVersion(name string) error {
+	f.m.Lock()
+	defer f.m.Unlock()
+	for i, v := range f.versions {
+		if v.Name != name {
+			continue
+		}
+		if i == len(f.versions)-1 {
+			return w.ErrorConflict
+		}
+		f.versions = append(f.versions[:i], f.versions[i+1:]...)
+		return nil
+	}
+	return w.ErrorNotFound
+}
+
 type memfileh struct {
 	f   *memfile
 	pos int64
@@ -363,7 +524,7 @@ func (h *memfileh) Write(b []byte) (int, error) {
 	}
 	copy(h.f.data[start:end], b)
 	h.pos = int64(end)
-	h.f.i.LastModified = time.Now()
+	h.f.i.LastModified = h.f.fs.clock.Now()
 	return len(b), nil
 }
 
@@ -371,6 +532,17 @@ func (h *memfileh) Close() error {
 	return nil
 }
 
+func (h *memfileh) Commit() (w.FileInfo, error) {
+	defer h.f.fs.record(w.ChangeModified, h.f.GetPath(), "")
+	h.f.m.Lock()
+	defer h.f.m.Unlock()
+	h.f.i.Size = int64(len(h.f.data))
+	if h.f.versions != nil {
+		h.f.recordVersion()
+	}
+	return h.f.i, nil
+}
+
 func (h *memfileh) Read(p []byte) (int, error) {
 	h.f.m.Lock()
 	defer h.f.m.Unlock()
@@ -390,6 +562,23 @@ func (h *memfileh) Read(p []byte) (int, error) {
 	return n, nil
 }
 
+// ReadAt implements io.ReaderAt.
+func (h *memfileh) ReadAt(p []byte, off int64) (int, error) {
+	h.f.m.Lock()
+	defer h.f.m.Unlock()
+	if off < 0 {
+		return 0, w.ErrorUnderrun
+	}
+	if off >= int64(len(h.f.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, h.f.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
 func (h *memfileh) Seek(offset int64, whence int) (int64, error) {
 	h.f.m.Lock()
 	defer h.f.m.Unlock()
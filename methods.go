@@ -0,0 +1,92 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"path"
+	"strings"
+	"sync"
+
+	wp "github.com/google/go-webdav/path"
+)
+
+// methodFlags records the methods disabled below given paths.
+type methodFlags struct {
+	m        sync.RWMutex
+	disabled map[string]map[string]bool
+}
+
+// DisableMethods refuses the given methods, such as "MOVE" or "LOCK", for
+// resources within the collection at prefix, which may be "/", including
+// COPY and MOVE to them. Requests are answered with 405 and the methods are
+// left out of the Allow header.
+// OPTIONS cannot be disabled. It is safe to call while serving requests.
+func (s *WebDAV) DisableMethods(prefix string, methods ...string) {
+	f := &s.methods
+	f.m.Lock()
+	defer f.m.Unlock()
+	prefix = path.Clean("/" + prefix)
+	if f.disabled == nil {
+		f.disabled = make(map[string]map[string]bool)
+	}
+	if f.disabled[prefix] == nil {
+		f.disabled[prefix] = make(map[string]bool)
+	}
+	for _, m := range methods {
+		if m = strings.ToUpper(m); m != "OPTIONS" {
+			f.disabled[prefix][m] = true
+		}
+	}
+}
+
+// EnableMethods reverts DisableMethods for the given methods and prefix.
+// Methods disabled for an enclosing prefix remain disabled.
+func (s *WebDAV) EnableMethods(prefix string, methods ...string) {
+	f := &s.methods
+	f.m.Lock()
+	defer f.m.Unlock()
+	prefix = path.Clean("/" + prefix)
+	for _, m := range methods {
+		delete(f.disabled[prefix], strings.ToUpper(m))
+	}
+	if len(f.disabled[prefix]) == 0 {
+		delete(f.disabled, prefix)
+	}
+}
+
+// methodDisabled determines if a method is disabled for a path.
+func (s *WebDAV) methodDisabled(p, method string) bool {
+	f := &s.methods
+	f.m.RLock()
+	defer f.m.RUnlock()
+	for prefix, ms := range f.disabled {
+		if ms[method] && wp.InTree(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterAllowed removes the methods disabled for a path from the value of
+// an Allow header.
+func (s *WebDAV) filterAllowed(p, allowed string) string {
+	var res []string
+	for _, m := range strings.Split(allowed, ",") {
+		if m = strings.TrimSpace(m); !s.methodDisabled(p, m) {
+			res = append(res, m)
+		}
+	}
+	return strings.Join(res, ", ")
+}
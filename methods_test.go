@@ -0,0 +1,68 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+func TestDisableMethods(t *testing.T) {
+	h := webdav.NewWebDAV(memfs.NewMemFS())
+	serve(h, "MKCOL", "/frozen", "")
+	serve(h, "PUT", "/frozen/a", "a")
+	serve(h, "PUT", "/x", "x")
+	h.DisableMethods("/frozen", "put", "MOVE", "COPY", "OPTIONS")
+
+	for _, tc := range []struct {
+		method, path, dst string
+		want              int
+	}{
+		{"PUT", "/frozen/a", "", http.StatusMethodNotAllowed},
+		{"PUT", "/frozen/b", "", http.StatusMethodNotAllowed},
+		{"MOVE", "/frozen/a", "/y", http.StatusMethodNotAllowed},
+		{"MOVE", "/x", "/frozen/a", http.StatusMethodNotAllowed},
+		{"COPY", "/x", "/frozen/c", http.StatusMethodNotAllowed},
+		{"GET", "/frozen/a", "", http.StatusOK},
+		{"OPTIONS", "/frozen/a", "", http.StatusOK},
+		{"PUT", "/frozenx", "", http.StatusCreated},
+	} {
+		var hdr []string
+		if tc.dst != "" {
+			hdr = []string{"Destination", tc.dst}
+		}
+		if w := serve(h, tc.method, tc.path, "new", hdr...); w.Code != tc.want {
+			t.Errorf("%s %s %s got %d, want %d", tc.method, tc.path, tc.dst, w.Code, tc.want)
+		}
+	}
+	if w := serve(h, "GET", "/frozen/a", ""); w.Body.String() != "a" {
+		t.Errorf("disabled methods changed /frozen/a to %q", w.Body)
+	}
+	if allow := serve(h, "OPTIONS", "/frozen/a", "").Header().Get("Allow"); strings.Contains(allow, "PUT") || strings.Contains(allow, "MOVE") || !strings.Contains(allow, "GET") {
+		t.Errorf("Allow of a frozen file got %q", allow)
+	}
+
+	h.EnableMethods("/frozen", "PUT")
+	if w := serve(h, "PUT", "/frozen/a", "b"); w.Code != http.StatusNoContent {
+		t.Errorf("PUT after EnableMethods got %d", w.Code)
+	}
+	if w := serve(h, "MOVE", "/x", "", "Destination", "/frozen/a"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("MOVE still disabled got %d", w.Code)
+	}
+}
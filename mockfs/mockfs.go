@@ -0,0 +1,404 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package mockfs provides a scriptable webdav.FileSystem for tests of code
+embedding go-webdav, much as net/http/httptest does for handlers. Tests
+declare the operations they expect on paths and the responses to give,
+serve requests, then check that the expected calls were made:
+
+	fs := mockfs.New()
+	fs.Expect(mockfs.OpLookup, "/a.txt").Return(&mockfs.File{Path: "/a.txt", Content: []byte("a")})
+	webdav.NewWebDAV(fs).ServeHTTP(w, httptest.NewRequest("GET", "/a.txt", nil))
+	if err := fs.Verify(); err != nil {
+		t.Error(err)
+	}
+
+Calls without a matching expectation fail with ErrUnexpected and are
+reported by Verify.
+*/
+package mockfs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	w "github.com/google/go-webdav"
+)
+
+// Op names a FileSystem operation.
+type Op string
+
+// Operations which may be expected.
+const (
+	OpLookup          Op = "Lookup"
+	OpLookupSubtree   Op = "LookupSubtree"
+	OpMkdir           Op = "Mkdir"
+	OpCreate          Op = "Create"
+	OpCopyTo          Op = "CopyTo"
+	OpRemove          Op = "Remove"
+	OpRecursiveRemove Op = "RecursiveRemove"
+)
+
+// Operations on Files, which are recorded but need no expectation.
+const (
+	OpOpen      Op = "Open"
+	OpTruncate  Op = "Truncate"
+	OpPatchProp Op = "PatchProp"
+)
+
+// ErrUnexpected is returned for calls without a matching expectation.
+var ErrUnexpected = errors.New("mockfs: unexpected call")
+
+// Call records an operation performed on the FileSystem.
+type Call struct {
+	Op   Op
+	Path string
+}
+
+func (c Call) String() string {
+	return fmt.Sprintf("%s(%s)", c.Op, c.Path)
+}
+
+// Expectation scripts the response to an operation on a path.
+type Expectation struct {
+	op    Op
+	path  string
+	times int // Exact number of calls expected, zero for at least one.
+	calls int
+
+	file    *File
+	files   []*File
+	created bool
+	err     error
+	errs    map[string]error
+}
+
+// Return sets the File returned by Lookup, Mkdir or Create.
+func (e *Expectation) Return(f *File) *Expectation {
+	e.file = f
+	return e
+}
+
+// ReturnList sets the Files returned by LookupSubtree.
+func (e *Expectation) ReturnList(files ...*File) *Expectation {
+	e.files = files
+	return e
+}
+
+// ReturnCreated sets whether CopyTo reports having created the destination.
+func (e *Expectation) ReturnCreated(created bool) *Expectation {
+	e.created = created
+	return e
+}
+
+// ReturnErrors sets the errors returned by RecursiveRemove.
+func (e *Expectation) ReturnErrors(errs map[string]error) *Expectation {
+	e.errs = errs
+	return e
+}
+
+// Fail makes the operation fail with the given error.
+func (e *Expectation) Fail(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+// Times expects exactly n calls, rather than at least one. Once they are
+// made, further calls go to later expectations or are unexpected.
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+func (e *Expectation) String() string {
+	return Call{e.op, e.path}.String()
+}
+
+// FS is a scripted webdav.FileSystem.
+type FS struct {
+	m            sync.Mutex
+	expectations []*Expectation
+	calls        []Call
+	unexpected   []Call
+}
+
+var _ w.FileSystem = &FS{}
+
+// New creates a FileSystem without any expectations.
+func New() *FS {
+	return &FS{}
+}
+
+// Expect adds an expectation of an operation on a path, an empty path
+// matches any. Expectations are matched in the order they were added.
+func (fs *FS) Expect(op Op, p string) *Expectation {
+	fs.m.Lock()
+	defer fs.m.Unlock()
+	e := &Expectation{op: op, path: p}
+	fs.expectations = append(fs.expectations, e)
+	return e
+}
+
+// Calls gets all the operations performed so far, in order.
+func (fs *FS) Calls() []Call {
+	fs.m.Lock()
+	defer fs.m.Unlock()
+	return append([]Call(nil), fs.calls...)
+}
+
+// Verify reports unexpected calls and expectations which were not met.
+func (fs *FS) Verify() error {
+	fs.m.Lock()
+	defer fs.m.Unlock()
+	var problems []string
+	for _, c := range fs.unexpected {
+		problems = append(problems, "unexpected "+c.String())
+	}
+	for _, e := range fs.expectations {
+		switch {
+		case e.times == 0 && e.calls == 0:
+			problems = append(problems, "missing "+e.String())
+		case e.times > 0 && e.calls != e.times:
+			problems = append(problems, fmt.Sprintf("%s called %d times, want %d", e, e.calls, e.times))
+		}
+	}
+	if problems != nil {
+		return errors.New("mockfs: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// call records an operation, getting the expectation it matches.
+func (fs *FS) call(op Op, p string) (*Expectation, error) {
+	fs.m.Lock()
+	defer fs.m.Unlock()
+	c := Call{op, p}
+	fs.calls = append(fs.calls, c)
+	for _, e := range fs.expectations {
+		if e.op != op || (e.path != "" && e.path != p) {
+			continue
+		}
+		if e.times > 0 && e.calls >= e.times {
+			continue
+		}
+		e.calls++
+		return e, e.err
+	}
+	fs.unexpected = append(fs.unexpected, c)
+	return nil, fmt.Errorf("%w: %s", ErrUnexpected, c)
+}
+
+// record records an operation on a File, which needs no expectation.
+func (fs *FS) record(op Op, p string) {
+	fs.m.Lock()
+	defer fs.m.Unlock()
+	fs.calls = append(fs.calls, Call{op, p})
+}
+
+// ForPath implements webdav.FileSystem.
+func (fs *FS) ForPath(p string) (w.Path, error) {
+	return &mpath{fs: fs, p: path.Clean("/" + p)}, nil
+}
+
+// Dump implements webdav.FileSystem, writing an empty dump.
+func (fs *FS) Dump(out io.Writer, format w.DumpFormat) error {
+	return w.WriteDump(out, format, nil)
+}
+
+type mpath struct {
+	fs *FS
+	p  string
+}
+
+func (p *mpath) String() string {
+	return p.p
+}
+
+func (p *mpath) Parent() w.Path {
+	return &mpath{fs: p.fs, p: path.Dir(p.p)}
+}
+
+func (p *mpath) Lookup() (w.File, error) {
+	e, err := p.fs.call(OpLookup, p.p)
+	if err != nil {
+		return nil, err
+	}
+	return p.fs.bind(e.file, p.p), nil
+}
+
+func (p *mpath) LookupSubtree(depth int) ([]w.File, error) {
+	e, err := p.fs.call(OpLookupSubtree, p.p)
+	if err != nil {
+		return nil, err
+	}
+	var res []w.File
+	for _, f := range e.files {
+		res = append(res, p.fs.bind(f, f.Path))
+	}
+	return res, nil
+}
+
+func (p *mpath) Mkdir() (w.File, error) {
+	e, err := p.fs.call(OpMkdir, p.p)
+	if err != nil {
+		return nil, err
+	}
+	f := e.file
+	if f == nil {
+		f = &File{Dir: true}
+	}
+	return p.fs.bind(f, p.p), nil
+}
+
+func (p *mpath) Create() (w.File, w.FileHandle, error) {
+	e, err := p.fs.call(OpCreate, p.p)
+	if err != nil {
+		return nil, nil, err
+	}
+	f := p.fs.bind(e.file, p.p)
+	fh, _ := f.Truncate()
+	return f, fh, nil
+}
+
+func (p *mpath) CopyTo(dst w.Path, opt w.CopyOptions) (bool, error) {
+	e, err := p.fs.call(OpCopyTo, p.p)
+	if err != nil {
+		return false, err
+	}
+	return e.created, nil
+}
+
+func (p *mpath) Remove() error {
+	_, err := p.fs.call(OpRemove, p.p)
+	return err
+}
+
+func (p *mpath) RecursiveRemove() map[string]error {
+	e, err := p.fs.call(OpRecursiveRemove, p.p)
+	if err != nil {
+		return map[string]error{p.p: err}
+	}
+	return e.errs
+}
+
+// bind gets the File to return for a path, creating an empty file if the
+// expectation gave none.
+func (fs *FS) bind(f *File, p string) *File {
+	if f == nil {
+		f = &File{}
+	}
+	f.m.Lock()
+	defer f.m.Unlock()
+	if f.Path == "" {
+		f.Path = p
+	}
+	f.fs = fs
+	return f
+}
+
+// File is a canned webdav.File. Writes through its handles replace its
+// Content, and PatchProp updates its Props.
+type File struct {
+	Path     string
+	Dir      bool
+	Modified time.Time
+	Content  []byte
+	Props    map[string]string
+
+	m  sync.Mutex
+	fs *FS
+}
+
+var _ w.File = &File{}
+
+func (f *File) GetPath() string {
+	return f.Path
+}
+
+func (f *File) IsDirectory() bool {
+	return f.Dir
+}
+
+func (f *File) Stat() (w.FileInfo, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	return w.FileInfo{
+		Created:      f.Modified,
+		LastModified: f.Modified,
+		Size:         int64(len(f.Content)),
+	}, nil
+}
+
+func (f *File) Open() (w.FileHandle, error) {
+	f.fs.record(OpOpen, f.Path)
+	f.m.Lock()
+	defer f.m.Unlock()
+	return &handle{Reader: bytes.NewReader(f.Content), f: f}, nil
+}
+
+func (f *File) Truncate() (w.FileHandle, error) {
+	f.fs.record(OpTruncate, f.Path)
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.Content = nil
+	return &handle{Reader: bytes.NewReader(nil), f: f}, nil
+}
+
+func (f *File) PatchProp(set, remove map[string]string) error {
+	f.fs.record(OpPatchProp, f.Path)
+	f.m.Lock()
+	defer f.m.Unlock()
+	if f.Props == nil {
+		f.Props = make(map[string]string)
+	}
+	for k, v := range set {
+		f.Props[k] = v
+	}
+	for k := range remove {
+		delete(f.Props, k)
+	}
+	return nil
+}
+
+func (f *File) GetProp(k string) (string, bool) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	v, ok := f.Props[k]
+	return v, ok
+}
+
+// handle reads the content of a File as it was opened, appending writes
+// to it.
+type handle struct {
+	*bytes.Reader
+	f *File
+}
+
+func (h *handle) Write(b []byte) (int, error) {
+	h.f.m.Lock()
+	defer h.f.m.Unlock()
+	h.f.Content = append(h.f.Content, b...)
+	return len(b), nil
+}
+
+func (h *handle) Close() error {
+	return nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mockfs
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	w "github.com/google/go-webdav"
+)
+
+func serve(fs *FS, method, p, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	w.NewWebDAV(fs).ServeHTTP(rec, httptest.NewRequest(method, p, strings.NewReader(body)))
+	return rec
+}
+
+func TestGet(t *testing.T) {
+	fs := New()
+	fs.Expect(OpLookup, "/a.txt").Return(&File{Content: []byte("hello")})
+
+	rec := serve(fs, "GET", "/a.txt", "")
+	if rec.Code != http.StatusOK || rec.Body.String() != "hello" {
+		t.Errorf("GET got %d %q, want 200 \"hello\"", rec.Code, rec.Body.String())
+	}
+	if err := fs.Verify(); err != nil {
+		t.Error(err)
+	}
+	want := []Call{{OpLookup, "/a.txt"}, {OpOpen, "/a.txt"}}
+	if got := fs.Calls(); len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Calls() = %v, want %v", got, want)
+	}
+}
+
+func TestFail(t *testing.T) {
+	fs := New()
+	fs.Expect(OpLookup, "").Fail(os.ErrNotExist)
+
+	if rec := serve(fs, "GET", "/missing", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("GET got %d, want 404", rec.Code)
+	}
+	if err := fs.Verify(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	fs := New()
+	fs.Expect(OpMkdir, "/d")
+	fs.Expect(OpLookup, "/a").Times(2)
+
+	p, _ := fs.ForPath("/a")
+	p.Lookup()
+	if err := p.Remove(); !errors.Is(err, ErrUnexpected) {
+		t.Errorf("Remove without an expectation got %v, want ErrUnexpected", err)
+	}
+
+	err := fs.Verify()
+	if err == nil {
+		t.Fatal("Verify succeeded with unmet expectations")
+	}
+	for _, want := range []string{"unexpected Remove(/a)", "missing Mkdir(/d)", "Lookup(/a) called 1 times, want 2"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Verify() = %v, want it to report %q", err, want)
+		}
+	}
+}
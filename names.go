@@ -0,0 +1,150 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// NamePolicy limits the paths of the resources clients create, so that
+// FileSystems mapping to stores which constrain names, such as object
+// stores or Windows shares, refuse them cleanly rather than mangling them.
+// Resources which exist already are not checked, and the zero value allows
+// any path.
+type NamePolicy struct {
+	// MaxDepth limits the number of segments of paths.
+	MaxDepth int
+	// MaxSegment limits the length in bytes of each segment of paths.
+	MaxSegment int
+	// MaxPath limits the length in bytes of paths.
+	MaxPath int
+	// ForbiddenChars lists the characters not allowed in names.
+	ForbiddenChars string
+	// ReservedNames lists the names not allowed, compared ignoring case
+	// and extensions, such as "CON" on Windows.
+	ReservedNames []string
+	// NoTrailingDotOrSpace forbids names ending with a dot or a space,
+	// which Windows drops.
+	NoTrailingDotOrSpace bool
+}
+
+// WindowsNamePolicy refuses the names Windows cannot store, for FileSystems
+// backed by NTFS or SMB shares.
+var WindowsNamePolicy = NamePolicy{
+	MaxSegment: 255,
+	ForbiddenChars: `<>:"\|?*` +
+		"\x00\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a\x0b\x0c\x0d\x0e\x0f" +
+		"\x10\x11\x12\x13\x14\x15\x16\x17\x18\x19\x1a\x1b\x1c\x1d\x1e\x1f",
+	ReservedNames: []string{
+		"CON", "PRN", "AUX", "NUL",
+		"COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9",
+		"LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9",
+	},
+	NoTrailingDotOrSpace: true,
+}
+
+// WithNamePolicy sets the policy for the paths of the resources created.
+func WithNamePolicy(p NamePolicy) Option {
+	return func(s *WebDAV) {
+		s.namePolicy = p
+	}
+}
+
+// check gets why a path is not allowed, or nil if it is.
+func (np NamePolicy) check(p string) error {
+	if np.MaxPath > 0 && len(p) > np.MaxPath {
+		return fmt.Errorf("path longer than %d bytes", np.MaxPath)
+	}
+	segs := strings.Split(strings.Trim(p, "/"), "/")
+	if np.MaxDepth > 0 && len(segs) > np.MaxDepth {
+		return fmt.Errorf("path deeper than %d segments", np.MaxDepth)
+	}
+	for _, seg := range segs {
+		if np.MaxSegment > 0 && len(seg) > np.MaxSegment {
+			return fmt.Errorf("name %q longer than %d bytes", seg, np.MaxSegment)
+		}
+		if i := strings.IndexAny(seg, np.ForbiddenChars); i >= 0 {
+			return fmt.Errorf("name %q has forbidden character %q", seg, seg[i])
+		}
+		if np.NoTrailingDotOrSpace && seg != "" && strings.ContainsAny(seg[len(seg)-1:], ". ") {
+			return fmt.Errorf("name %q ends with a dot or space", seg)
+		}
+		base, _, _ := strings.Cut(seg, ".")
+		for _, r := range np.ReservedNames {
+			if strings.EqualFold(base, r) {
+				return fmt.Errorf("name %q is reserved", seg)
+			}
+		}
+	}
+	return nil
+}
+
+// zero determines if the policy allows any path.
+func (np NamePolicy) zero() bool {
+	return np.MaxDepth <= 0 && np.MaxSegment <= 0 && np.MaxPath <= 0 &&
+		np.ForbiddenChars == "" && len(np.ReservedNames) == 0 && !np.NoTrailingDotOrSpace
+}
+
+// checkName checks the path of a resource which a request may create,
+// unless it exists already.
+func (s *WebDAV) checkName(ctx context, r *http.Request) error {
+	if s.namePolicy.zero() {
+		return nil
+	}
+	switch r.Method {
+	case "PUT", "MKCOL", "LOCK":
+	default:
+		return nil
+	}
+	if _, err := ctx.p.Lookup(); err == nil {
+		return nil
+	}
+	return s.checkPath(ctx.p.String())
+}
+
+// checkPath checks a path against the policy.
+func (s *WebDAV) checkPath(p string) error {
+	if err := s.namePolicy.check(p); err != nil {
+		return ErrorBadName.WithCause(err).WithResources(p)
+	}
+	return nil
+}
+
+// checkCopyNames checks the paths of the resources a COPY or MOVE of src,
+// with its members if it is a collection, would create at dst.
+func (s *WebDAV) checkCopyNames(src Path, srcf File, dst Path) error {
+	if s.namePolicy.zero() {
+		return nil
+	}
+	if _, err := dst.Lookup(); err == nil && !srcf.IsDirectory() {
+		return nil
+	}
+	if err := s.checkPath(dst.String()); err != nil || !srcf.IsDirectory() {
+		return err
+	}
+	files, err := src.LookupSubtree(-1)
+	if err != nil {
+		return nil
+	}
+	for _, f := range files {
+		rel := strings.TrimPrefix(f.GetPath(), src.String())
+		if err := s.checkPath(strings.TrimSuffix(dst.String(), "/") + rel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
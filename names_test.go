@@ -0,0 +1,72 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+func TestNamePolicy(t *testing.T) {
+	fs := memfs.NewMemFS()
+	seed := webdav.NewWebDAV(fs)
+	serve(seed, "PUT", "/con.txt", "existing")
+	serve(seed, "MKCOL", "/d", "")
+	serve(seed, "MKCOL", "/d/e", "")
+	serve(seed, "PUT", "/d/e/f", "f")
+
+	p := webdav.WindowsNamePolicy
+	p.MaxDepth = 3
+	p.MaxPath = 20
+	s := webdav.NewWebDAV(fs, webdav.WithNamePolicy(p))
+	for _, tc := range []struct {
+		method, path string
+		hdr          []string
+		want         int
+	}{
+		{"PUT", "/ok.txt", nil, http.StatusCreated},
+		{"PUT", "/a%3Fb", nil, http.StatusForbidden},
+		{"PUT", "/trailing.", nil, http.StatusForbidden},
+		{"PUT", "/nul.txt", nil, http.StatusForbidden},
+		{"MKCOL", "/Com1", nil, http.StatusForbidden},
+		{"MKCOL", "/" + strings.Repeat("x", 20), nil, http.StatusForbidden},
+		{"MKCOL", "/d/e/g", nil, http.StatusCreated},
+		{"MKCOL", "/d/e/g/h", nil, http.StatusForbidden},
+		{"LOCK", "/aux", nil, http.StatusForbidden},
+		// Existing resources remain writable.
+		{"PUT", "/con.txt", nil, http.StatusNoContent},
+		// Members copied must fit too.
+		{"COPY", "/d", []string{"Destination", "/x/d"}, http.StatusForbidden},
+		{"COPY", "/ok.txt", []string{"Destination", "/prn"}, http.StatusForbidden},
+		{"MOVE", "/ok.txt", []string{"Destination", "/moved"}, http.StatusCreated},
+	} {
+		body := ""
+		if tc.method == "LOCK" {
+			body = `<lockinfo xmlns="DAV:"><lockscope><exclusive/></lockscope><locktype><write/></locktype></lockinfo>`
+		}
+		w := serve(s, tc.method, tc.path, body, tc.hdr...)
+		if w.Code != tc.want {
+			t.Errorf("%s %s got %d, want %d", tc.method, tc.path, w.Code, tc.want)
+			continue
+		}
+		if w.Code == http.StatusForbidden && !strings.Contains(w.Body.String(), "name-allowed") {
+			t.Errorf("%s %s lacks the name-allowed condition:\n%s", tc.method, tc.path, w.Body)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"log"
+	"path"
+	"strings"
+	"time"
+)
+
+// Option configures a WebDAV handler, see NewWebDAV.
+type Option func(*WebDAV)
+
+// WithLogger sets the logger used by the handler, by default the standard
+// logger is used.
+func WithLogger(l *log.Logger) Option {
+	return func(s *WebDAV) {
+		s.logger = l
+	}
+}
+
+// WithPrefix serves the FileSystem below the given URL path, such as
+// "/dav", rather than at the root. Requests outside of it are not found.
+func WithPrefix(prefix string) Option {
+	return func(s *WebDAV) {
+		s.prefix = strings.TrimSuffix(path.Clean("/"+prefix), "/")
+	}
+}
+
+// trimPrefix maps a URL path to a FileSystem path, reporting whether it
+// is within the prefix.
+func (s *WebDAV) trimPrefix(p string) (string, bool) {
+	if s.prefix == "" {
+		return p, true
+	}
+	if p == s.prefix {
+		return "/", true
+	}
+	if !strings.HasPrefix(p, s.prefix+"/") {
+		return "", false
+	}
+	return strings.TrimPrefix(p, s.prefix), true
+}
+
+// stripPrefix maps a URL path to a FileSystem path, leaving paths outside
+// of the prefix unchanged.
+func (s *WebDAV) stripPrefix(p string) string {
+	if rp, ok := s.trimPrefix(p); ok {
+		return rp
+	}
+	return p
+}
+
+// href maps a FileSystem path to a URL path.
+func (s *WebDAV) href(p string) string {
+	if s.prefix == "" {
+		return p
+	}
+	return s.prefix + p
+}
+
+// WithDebug enables serialization and logging of all requests, and serves
+// the debug endpoints such as /dumpz.
+func WithDebug() Option {
+	return func(s *WebDAV) {
+		s.Debug = true
+	}
+}
+
+// WithEventStream enables streaming of changes as Server-Sent Events.
+func WithEventStream() Option {
+	return func(s *WebDAV) {
+		s.EventStream = true
+	}
+}
+
+// WithLegacyNotifications enables the Microsoft SUBSCRIBE, POLL and
+// UNSUBSCRIBE methods.
+func WithLegacyNotifications() Option {
+	return func(s *WebDAV) {
+		s.LegacyNotifications = true
+	}
+}
+
+// Limits bounds the resources a single request may consume, zero values
+// mean no limit unless noted.
+type Limits struct {
+	MaxDeadProps     int
+	MaxPropValueSize int
+	MaxPropfindDepth int
+	// MaxRanges limits the number of ranges served for a single GET,
+	// requests for more are answered with the whole file.
+	MaxRanges int
+	// MaxValidatedSize bounds the PUT bodies checked by Validators or
+	// written to virtual resources, zero means DefaultMaxValidatedSize.
+	MaxValidatedSize int64
+}
+
+// WithLimits sets the request limits.
+func WithLimits(l Limits) Option {
+	return func(s *WebDAV) {
+		s.MaxDeadProps = l.MaxDeadProps
+		s.MaxPropValueSize = l.MaxPropValueSize
+		s.MaxPropfindDepth = l.MaxPropfindDepth
+		s.maxRanges = l.MaxRanges
+		s.MaxValidatedSize = l.MaxValidatedSize
+	}
+}
+
+// Default LockPolicy settings, used when the corresponding field is zero.
+const (
+	DefaultLockTimeout    = 20 * time.Second
+	DefaultMinLockTimeout = 20 * time.Second
+	DefaultMaxLockTimeout = 5 * time.Minute
+)
+
+// LockPolicy controls the timeouts granted to locks, which are the only
+// bounds applied to them.
+type LockPolicy struct {
+	// DefaultTimeout is used when the client requests no timeout, zero
+	// means DefaultLockTimeout.
+	DefaultTimeout time.Duration
+	// MinTimeout and MaxTimeout bound the timeouts granted, including
+	// DefaultTimeout, zero meaning DefaultMinLockTimeout and
+	// DefaultMaxLockTimeout.
+	MinTimeout, MaxTimeout time.Duration
+}
+
+// timeout gets the lock timeout to grant for the requested one, which is
+// zero if the client requested none.
+func (p LockPolicy) timeout(requested time.Duration) time.Duration {
+	if requested == 0 {
+		requested = orDuration(p.DefaultTimeout, DefaultLockTimeout)
+	}
+	if max := orDuration(p.MaxTimeout, DefaultMaxLockTimeout); requested > max {
+		requested = max
+	}
+	if min := orDuration(p.MinTimeout, DefaultMinLockTimeout); requested < min {
+		requested = min
+	}
+	return requested
+}
+
+func orDuration(d, def time.Duration) time.Duration {
+	if d == 0 {
+		return def
+	}
+	return d
+}
+
+// WithLockPolicy sets the policy for lock timeouts.
+func WithLockPolicy(p LockPolicy) Option {
+	return func(s *WebDAV) {
+		s.lockPolicy = p
+	}
+}
+
+// WithTokenSource sets how lock tokens are generated, by default
+// RandomTokens.
+func WithTokenSource(ts TokenSource) Option {
+	return func(s *WebDAV) {
+		s.lm.tokens = ts
+	}
+}
+
+// WithAuthenticated declares that all requests reach the handler through
+// authentication, such as auth.BasicHandler.
+func WithAuthenticated() Option {
+	return func(s *WebDAV) {
+		s.Authenticated = true
+	}
+}
+
+// WithReadOnly rejects all methods which would modify the FileSystem.
+func WithReadOnly() Option {
+	return func(s *WebDAV) {
+		s.ReadOnly = true
+	}
+}
+
+// WithHardened enables the deny-by-default mode, see CheckSecurity.
+func WithHardened() Option {
+	return func(s *WebDAV) {
+		s.Hardened = true
+	}
+}
+
+// DefaultMaxValidatedSize is the size in bytes of the largest PUT body
+// checked by a ContentValidator, unless MaxValidatedSize is set.
+const DefaultMaxValidatedSize = 16 << 20
+
+// WithValidator checks PUT bodies of the given media type before they are
+// stored. They are held in memory to be checked, so are limited to
+// MaxValidatedSize.
+func WithValidator(mediaType string, v ContentValidator) Option {
+	return func(s *WebDAV) {
+		if s.Validators == nil {
+			s.Validators = make(map[string]ContentValidator)
+		}
+		s.Validators[mediaType] = v
+	}
+}
+
+// WithDropBoxes adds collections with upload-only semantics.
+func WithDropBoxes(paths ...string) Option {
+	return func(s *WebDAV) {
+		s.DropBoxes = append(s.DropBoxes, paths...)
+	}
+}
+
+// WithRetention adds retention policies.
+func WithRetention(policies ...RetentionPolicy) Option {
+	return func(s *WebDAV) {
+		s.Retention = append(s.Retention, policies...)
+	}
+}
+
+// WithVersionRetention bounds the past versions kept of files under version
+// control, which must implement VersionPruner for them to be discarded.
+func WithVersionRetention(vr VersionRetention) Option {
+	return func(s *WebDAV) {
+		s.versions = vr
+	}
+}
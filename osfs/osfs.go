@@ -0,0 +1,642 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package osfs implements webdav.FileSystem over a directory of the local
+filesystem. All access goes through an os.Root, so neither ".." nor symbolic
+links can reach files outside of the directory.
+
+Dead properties are stored as JSON in sidecar files, within a directory
+named PropsDir in the directory containing each resource. It is hidden from
+clients, who can neither list nor address it.
+*/
+package osfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	w "github.com/google/go-webdav"
+)
+
+// PropsDir is the name of the directories holding dead properties.
+const PropsDir = ".davprops"
+
+// FS is a webdav.FileSystem serving a local directory.
+type FS struct {
+	root *os.Root
+
+	// m serializes changes to properties and the structure of the tree,
+	// so that sidecar files stay with the resources they describe.
+	m sync.Mutex
+}
+
+var _ w.FileSystem = &FS{}
+
+// New creates a FileSystem serving the given directory, which must exist.
+func New(dir string) (*FS, error) {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &FS{root: root}, nil
+}
+
+// Close releases the directory.
+func (fs *FS) Close() error {
+	return fs.root.Close()
+}
+
+// ForPath implements webdav.FileSystem. Paths addressing PropsDir are
+// refused.
+func (fs *FS) ForPath(p string) (w.Path, error) {
+	p = path.Clean("/" + p)
+	for _, seg := range strings.Split(p, "/") {
+		if seg == PropsDir {
+			return nil, w.ErrorForbidden
+		}
+	}
+	return &opath{fs: fs, p: p}, nil
+}
+
+// Dump implements webdav.FileSystem.
+func (fs *FS) Dump(out io.Writer, format w.DumpFormat) error {
+	p := &opath{fs: fs, p: "/"}
+	files, err := p.LookupSubtree(-1)
+	if err != nil {
+		return err
+	}
+	var entries []w.DumpEntry
+	for _, f := range files {
+		of := f.(*ofile)
+		fi, err := of.Stat()
+		if err != nil {
+			continue
+		}
+		e := w.DumpEntry{
+			Path:     of.p,
+			Dir:      of.dir,
+			Size:     fi.Size,
+			Modified: fi.LastModified,
+		}
+		if props, err := fs.readProps(of.p); err == nil && len(props) > 0 {
+			e.Props = props
+		}
+		entries = append(entries, e)
+	}
+	return w.WriteDump(out, format, entries)
+}
+
+// rel maps a webdav path to a path relative to the root.
+func rel(p string) string {
+	if p == "/" {
+		return "."
+	}
+	return strings.TrimPrefix(p, "/")
+}
+
+// propsFile gets the sidecar file holding the properties of a path, the
+// root's properties are kept in a file without a name.
+func propsFile(p string) string {
+	if p == "/" {
+		return path.Join(PropsDir, ".props")
+	}
+	return path.Join(rel(path.Dir(p)), PropsDir, path.Base(p)+".props")
+}
+
+func (fs *FS) readProps(p string) (map[string]string, error) {
+	b, err := fs.root.ReadFile(propsFile(p))
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	props := make(map[string]string)
+	if err := json.Unmarshal(b, &props); err != nil {
+		return nil, err
+	}
+	return props, nil
+}
+
+func (fs *FS) writeProps(p string, props map[string]string) error {
+	pf := propsFile(p)
+	if len(props) == 0 {
+		if err := fs.root.Remove(pf); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	b, err := json.Marshal(props)
+	if err != nil {
+		return err
+	}
+	if err := fs.root.MkdirAll(path.Dir(pf), 0o755); err != nil {
+		return err
+	}
+	return fs.root.WriteFile(pf, b, 0o644)
+}
+
+// moveProps moves the properties of a path along with it.
+func (fs *FS) moveProps(src, dst string) error {
+	if _, err := fs.root.Stat(propsFile(src)); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err := fs.root.MkdirAll(path.Dir(propsFile(dst)), 0o755); err != nil {
+		return err
+	}
+	return fs.root.Rename(propsFile(src), propsFile(dst))
+}
+
+// copyProps copies the properties of a path to another.
+func (fs *FS) copyProps(src, dst string) error {
+	props, err := fs.readProps(src)
+	if err != nil {
+		return err
+	}
+	return fs.writeProps(dst, props)
+}
+
+var _ w.PropChecker = &FS{}
+
+// OrphanedProps implements webdav.PropChecker, finding the sidecar files of
+// resources removed from the directory directly.
+func (fs *FS) OrphanedProps() ([]string, error) {
+	fs.m.Lock()
+	defer fs.m.Unlock()
+	var res []string
+	err := iofs.WalkDir(fs.root.FS(), ".", func(name string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() || d.Name() != PropsDir {
+			return nil
+		}
+		entries, err := iofs.ReadDir(fs.root.FS(), name)
+		if err != nil {
+			return err
+		}
+		dir := "/" + path.Dir(name)
+		for _, e := range entries {
+			base, ok := strings.CutSuffix(e.Name(), ".props")
+			if !ok || e.IsDir() || base == "" {
+				continue
+			}
+			p := path.Clean(path.Join(dir, base))
+			if _, err := fs.root.Lstat(rel(p)); errors.Is(err, os.ErrNotExist) {
+				res = append(res, p)
+			} else if err != nil {
+				return err
+			}
+		}
+		return iofs.SkipDir
+	})
+	sort.Strings(res)
+	return res, err
+}
+
+// RemoveOrphanedProps implements webdav.PropChecker.
+func (fs *FS) RemoveOrphanedProps(p string) error {
+	fs.m.Lock()
+	defer fs.m.Unlock()
+	if _, err := fs.root.Lstat(rel(p)); err == nil {
+		return w.ErrorConflict
+	}
+	return fs.writeProps(p, nil)
+}
+
+// readDir gets the entries of a directory, sorted by name.
+func (fs *FS) readDir(p string) ([]os.DirEntry, error) {
+	d, err := fs.root.Open(rel(p))
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+	entries, err := d.ReadDir(-1)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, err
+}
+
+func (fs *FS) lookup(p string) (*ofile, error) {
+	fi, err := fs.root.Stat(rel(p))
+	if err != nil {
+		return nil, w.FromOSError(err)
+	}
+	return &ofile{fs: fs, p: p, dir: fi.IsDir()}, nil
+}
+
+type opath struct {
+	fs *FS
+	p  string
+}
+
+func (p *opath) String() string {
+	return p.p
+}
+
+func (p *opath) Parent() w.Path {
+	return &opath{fs: p.fs, p: path.Dir(p.p)}
+}
+
+func (p *opath) Lookup() (w.File, error) {
+	return p.fs.lookup(p.p)
+}
+
+func (p *opath) LookupSubtree(depth int) ([]w.File, error) {
+	var files []w.File
+	err := p.Walk(depth, func(f w.File) error {
+		files = append(files, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// Walk implements webdav.Walker.
+func (p *opath) Walk(depth int, fn func(w.File) error) error {
+	f, err := p.fs.lookup(p.p)
+	if err != nil {
+		return err
+	}
+	return p.walk(f, depth, fn, true)
+}
+
+// walk visits f, the file at p, and its members to the given depth. Members
+// which cannot be read are left out, as they may vanish while listing.
+func (p *opath) walk(f *ofile, depth int, fn func(w.File) error, top bool) error {
+	if err := fn(f); err != nil {
+		return err
+	}
+	if !f.dir || depth == 0 {
+		return nil
+	}
+	entries, err := p.fs.readDir(p.p)
+	if err != nil {
+		if !top {
+			return nil
+		}
+		return w.FromOSError(err)
+	}
+	for _, e := range entries {
+		if e.Name() == PropsDir {
+			continue
+		}
+		cp := &opath{fs: p.fs, p: path.Join(p.p, e.Name())}
+		cf, err := p.fs.lookup(cp.p)
+		if err != nil {
+			continue
+		}
+		if err := cp.walk(cf, depth-1, fn, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *opath) Mkdir() (w.File, error) {
+	p.fs.m.Lock()
+	defer p.fs.m.Unlock()
+	if _, err := p.fs.lookup(p.p); err == nil {
+		return nil, w.ErrorConflict
+	}
+	if f, err := p.fs.lookup(path.Dir(p.p)); err != nil || !f.dir {
+		return nil, w.ErrorMissingParent
+	}
+	if err := p.fs.root.Mkdir(rel(p.p), 0o755); err != nil {
+		return nil, w.FromOSError(err)
+	}
+	return &ofile{fs: p.fs, p: p.p, dir: true}, nil
+}
+
+func (p *opath) Create() (w.File, w.FileHandle, error) {
+	p.fs.m.Lock()
+	defer p.fs.m.Unlock()
+	if _, err := p.fs.lookup(p.p); err == nil {
+		return nil, nil, w.ErrorConflict
+	}
+	if f, err := p.fs.lookup(path.Dir(p.p)); err != nil || !f.dir {
+		return nil, nil, w.ErrorMissingParent
+	}
+	fh, err := p.fs.root.OpenFile(rel(p.p), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, nil, w.FromOSError(err)
+	}
+	return &ofile{fs: p.fs, p: p.p}, writeHandle{fh}, nil
+}
+
+func (p *opath) Remove() error {
+	p.fs.m.Lock()
+	defer p.fs.m.Unlock()
+	f, err := p.fs.lookup(p.p)
+	if err != nil {
+		return err
+	}
+	if f.dir {
+		return w.ErrorIsDir
+	}
+	if err := p.fs.root.Remove(rel(p.p)); err != nil {
+		return w.FromOSError(err)
+	}
+	return p.fs.writeProps(p.p, nil)
+}
+
+func (p *opath) RecursiveRemove() map[string]error {
+	p.fs.m.Lock()
+	defer p.fs.m.Unlock()
+	errs := make(map[string]error)
+	f, err := p.fs.lookup(p.p)
+	if err != nil {
+		errs[p.p] = err
+		return errs
+	}
+	if !f.dir {
+		errs[p.p] = w.ErrorIsNotDir
+		return errs
+	}
+	if p.p == "/" {
+		errs[p.p] = w.ErrorForbidden
+		return errs
+	}
+	if err := p.fs.root.RemoveAll(rel(p.p)); err != nil {
+		errs[p.p] = w.FromOSError(err)
+		return errs
+	}
+	if err := p.fs.writeProps(p.p, nil); err != nil {
+		errs[p.p] = err
+	}
+	return errs
+}
+
+func (p *opath) CopyTo(dst w.Path, opt w.CopyOptions) (bool, error) {
+	dstp, ok := dst.(*opath)
+	if !ok || dstp.fs != p.fs {
+		return false, w.ErrorBadHost
+	}
+	if p.p == dstp.p {
+		return false, w.ErrorSameFile
+	}
+	if strings.HasPrefix(dstp.p, strings.TrimSuffix(p.p, "/")+"/") {
+		// A collection cannot be copied or moved into itself.
+		return false, w.ErrorForbidden
+	}
+
+	p.fs.m.Lock()
+	defer p.fs.m.Unlock()
+
+	src, err := p.fs.lookup(p.p)
+	if err != nil {
+		return false, w.ErrorNotFound
+	}
+	// Can only move complete directory trees.
+	if src.dir && opt.Move && opt.Depth >= 0 {
+		return false, w.ErrorIsDir
+	}
+	if f, err := p.fs.lookup(path.Dir(dstp.p)); err != nil || !f.dir {
+		return false, w.ErrorMissingParent
+	}
+
+	created := true
+	if _, err := p.fs.lookup(dstp.p); err == nil {
+		if !opt.Overwrite {
+			return false, w.ErrorDestExists
+		}
+		created = false
+		if err := p.fs.root.RemoveAll(rel(dstp.p)); err != nil {
+			return false, w.FromOSError(err)
+		}
+		if err := p.fs.writeProps(dstp.p, nil); err != nil {
+			return false, err
+		}
+	}
+
+	if opt.Move {
+		if err := p.fs.root.Rename(rel(p.p), rel(dstp.p)); err != nil {
+			return false, w.FromOSError(err)
+		}
+		return created, p.fs.moveProps(p.p, dstp.p)
+	}
+	return created, p.fs.copyTree(p.p, dstp.p, src.dir, opt.Depth)
+}
+
+// copyTree copies a file, or a directory and its members to the given
+// depth, along with their properties.
+func (fs *FS) copyTree(src, dst string, dir bool, depth int) error {
+	if !dir {
+		if err := fs.copyFile(src, dst); err != nil {
+			return err
+		}
+		return fs.copyProps(src, dst)
+	}
+
+	if err := fs.root.Mkdir(rel(dst), 0o755); err != nil {
+		return w.FromOSError(err)
+	}
+	if err := fs.copyProps(src, dst); err != nil {
+		return err
+	}
+	if depth == 0 {
+		return nil
+	}
+	entries, err := fs.readDir(src)
+	if err != nil {
+		return w.FromOSError(err)
+	}
+	for _, e := range entries {
+		if e.Name() == PropsDir {
+			continue
+		}
+		err := fs.copyTree(path.Join(src, e.Name()), path.Join(dst, e.Name()), e.IsDir(), depth-1)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fs *FS) copyFile(src, dst string) error {
+	in, err := fs.root.Open(rel(src))
+	if err != nil {
+		return w.FromOSError(err)
+	}
+	defer in.Close()
+	out, err := fs.root.OpenFile(rel(dst), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return w.FromOSError(err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return w.FromOSError(err)
+	}
+	return w.FromOSError(out.Close())
+}
+
+type ofile struct {
+	fs  *FS
+	p   string
+	dir bool
+}
+
+var _ w.PropLister = &ofile{}
+
+func (f *ofile) GetPath() string {
+	return f.p
+}
+
+func (f *ofile) IsDirectory() bool {
+	return f.dir
+}
+
+// Stat implements webdav.File. Creation times are not portably available,
+// so the modification time is reported instead, and directories have no
+// size.
+func (f *ofile) Stat() (w.FileInfo, error) {
+	fi, err := f.fs.root.Stat(rel(f.p))
+	if err != nil {
+		return w.FileInfo{}, w.FromOSError(err)
+	}
+	return fileInfo(fi), nil
+}
+
+func fileInfo(fi os.FileInfo) w.FileInfo {
+	info := w.FileInfo{
+		Created:      fi.ModTime(),
+		LastModified: fi.ModTime(),
+	}
+	if !fi.IsDir() {
+		info.Size = fi.Size()
+	}
+	return info
+}
+
+func (f *ofile) Open() (w.FileHandle, error) {
+	if f.dir {
+		return &dirHandle{}, nil
+	}
+	fh, err := f.fs.root.Open(rel(f.p))
+	if err != nil {
+		return nil, w.FromOSError(err)
+	}
+	return readOnlyHandle{fh}, nil
+}
+
+func (f *ofile) Truncate() (w.FileHandle, error) {
+	if f.dir {
+		return nil, w.ErrorIsDir
+	}
+	fh, err := f.fs.root.OpenFile(rel(f.p), os.O_RDWR|os.O_TRUNC, 0)
+	if err != nil {
+		return nil, w.FromOSError(err)
+	}
+	return writeHandle{fh}, nil
+}
+
+// Update implements webdav.Updater.
+func (f *ofile) Update() (w.FileHandle, error) {
+	if f.dir {
+		return nil, w.ErrorIsDir
+	}
+	fh, err := f.fs.root.OpenFile(rel(f.p), os.O_RDWR, 0)
+	if err != nil {
+		return nil, w.FromOSError(err)
+	}
+	return writeHandle{fh}, nil
+}
+
+func (f *ofile) PatchProp(set, remove map[string]string) error {
+	f.fs.m.Lock()
+	defer f.fs.m.Unlock()
+	props, err := f.fs.readProps(f.p)
+	if err != nil {
+		return err
+	}
+	for k, v := range set {
+		props[k] = v
+	}
+	for k := range remove {
+		delete(props, k)
+	}
+	return f.fs.writeProps(f.p, props)
+}
+
+func (f *ofile) GetProp(k string) (string, bool) {
+	props, err := f.fs.readProps(f.p)
+	if err != nil {
+		return "", false
+	}
+	v, ok := props[k]
+	return v, ok
+}
+
+func (f *ofile) PropNames() []string {
+	props, err := f.fs.readProps(f.p)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for k := range props {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var errReadOnly = errors.New("osfs: file opened for reading")
+
+// readOnlyHandle is a file opened for reading, refusing writes.
+type readOnlyHandle struct {
+	*os.File
+}
+
+func (h readOnlyHandle) Write([]byte) (int, error) {
+	return 0, errReadOnly
+}
+
+// writeHandle is a file opened for writing.
+type writeHandle struct {
+	*os.File
+}
+
+// Commit implements webdav.Committer, getting the FileInfo of the open
+// file, which is that written even if the file was replaced since.
+func (h writeHandle) Commit() (w.FileInfo, error) {
+	fi, err := h.File.Stat()
+	if err != nil {
+		h.File.Close()
+		return w.FileInfo{}, w.FromOSError(err)
+	}
+	return fileInfo(fi), w.FromOSError(h.File.Close())
+}
+
+// dirHandle is the empty content of a directory.
+type dirHandle struct {
+	bytes.Reader
+}
+
+func (h *dirHandle) Write([]byte) (int, error) {
+	return 0, w.ErrorIsDir
+}
+
+func (h *dirHandle) Close() error {
+	return nil
+}
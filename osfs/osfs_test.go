@@ -0,0 +1,245 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package osfs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	w "github.com/google/go-webdav"
+	"github.com/google/go-webdav/fstest"
+)
+
+func newFS(t *testing.T) (*FS, string) {
+	dir := t.TempDir()
+	fs, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fs.Close() })
+	return fs, dir
+}
+
+func forPath(t *testing.T, fs *FS, p string) w.Path {
+	wp, err := fs.ForPath(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wp
+}
+
+func put(t *testing.T, fs *FS, p, content string) {
+	_, fh, err := forPath(t, fs, p).Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(fh, content)
+	fh.Close()
+}
+
+func read(t *testing.T, fs *FS, p string) string {
+	f, err := forPath(t, fs, p).Lookup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fh, err := f.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	b, _ := io.ReadAll(fh)
+	return string(b)
+}
+
+func TestFiles(t *testing.T) {
+	fs, dir := newFS(t)
+	if _, err := forPath(t, fs, "/d").Mkdir(); err != nil {
+		t.Fatal(err)
+	}
+	put(t, fs, "/d/a.txt", "hello")
+
+	if got := read(t, fs, "/d/a.txt"); got != "hello" {
+		t.Errorf("read %q, want \"hello\"", got)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "d", "a.txt")); string(b) != "hello" {
+		t.Errorf("file on disk holds %q, want \"hello\"", b)
+	}
+	if _, _, err := forPath(t, fs, "/d/a.txt").Create(); !errors.Is(err, w.ErrorConflict) {
+		t.Errorf("Create of an existing file got %v, want ErrorConflict", err)
+	}
+	if _, _, err := forPath(t, fs, "/missing/a.txt").Create(); !errors.Is(err, w.ErrorMissingParent) {
+		t.Errorf("Create without a parent got %v, want ErrorMissingParent", err)
+	}
+
+	d, _ := forPath(t, fs, "/d").Lookup()
+	if fi, err := d.Stat(); err != nil || !d.IsDirectory() || fi.Size != 0 {
+		t.Errorf("directory Stat() = %+v, %v", fi, err)
+	}
+
+	files, err := forPath(t, fs, "/").LookupSubtree(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, f := range files {
+		paths = append(paths, f.GetPath())
+	}
+	if len(paths) != 3 || paths[0] != "/" || paths[1] != "/d" || paths[2] != "/d/a.txt" {
+		t.Errorf("LookupSubtree(-1) = %v", paths)
+	}
+}
+
+func TestProps(t *testing.T) {
+	fs, _ := newFS(t)
+	forPath(t, fs, "/d").Mkdir()
+	put(t, fs, "/d/a.txt", "a")
+
+	f, _ := forPath(t, fs, "/d/a.txt").Lookup()
+	if err := f.PatchProp(map[string]string{"urn:x:color": "red"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Properties are persisted, and follow the file when moved.
+	fs2, err := New(fs.root.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs2.Close()
+	if _, err := forPath(t, fs2, "/d").CopyTo(forPath(t, fs2, "/e"), w.CopyOptions{Move: true, Depth: -1}); err != nil {
+		t.Fatal(err)
+	}
+	f, _ = forPath(t, fs2, "/e/a.txt").Lookup()
+	if v, ok := f.GetProp("urn:x:color"); !ok || v != "red" {
+		t.Errorf("GetProp after move = %q, %v, want \"red\"", v, ok)
+	}
+
+	if _, err := forPath(t, fs2, "/e/a.txt").CopyTo(forPath(t, fs2, "/b.txt"), w.CopyOptions{Depth: -1}); err != nil {
+		t.Fatal(err)
+	}
+	f, _ = forPath(t, fs2, "/b.txt").Lookup()
+	if v, _ := f.GetProp("urn:x:color"); v != "red" {
+		t.Errorf("GetProp after copy = %q, want \"red\"", v)
+	}
+	if got := read(t, fs2, "/b.txt"); got != "a" {
+		t.Errorf("copy holds %q, want \"a\"", got)
+	}
+}
+
+func TestPropsDirHidden(t *testing.T) {
+	fs, _ := newFS(t)
+	put(t, fs, "/a.txt", "a")
+	f, _ := forPath(t, fs, "/a.txt").Lookup()
+	f.PatchProp(map[string]string{"urn:x:k": "v"}, nil)
+
+	if _, err := fs.ForPath("/" + PropsDir + "/a.txt.props"); err == nil {
+		t.Error("ForPath allowed addressing the properties directory")
+	}
+	files, _ := forPath(t, fs, "/").LookupSubtree(1)
+	for _, f := range files {
+		if f.GetPath() != "/" && f.GetPath() != "/a.txt" {
+			t.Errorf("LookupSubtree listed %s", f.GetPath())
+		}
+	}
+}
+
+func TestWalk(t *testing.T) {
+	fs, _ := newFS(t)
+	forPath(t, fs, "/d").Mkdir()
+	put(t, fs, "/a.txt", "a")
+	put(t, fs, "/d/b.txt", "b")
+
+	var walked []string
+	err := forPath(t, fs, "/").(w.Walker).Walk(-1, func(f w.File) error {
+		walked = append(walked, f.GetPath())
+		return nil
+	})
+	files, _ := forPath(t, fs, "/").LookupSubtree(-1)
+	if err != nil || len(walked) != len(files) || len(walked) != 4 {
+		t.Fatalf("Walk(-1) = %v, %v, want the 4 files of LookupSubtree", walked, err)
+	}
+	for i, f := range files {
+		if walked[i] != f.GetPath() {
+			t.Errorf("Walk visited %s at %d, LookupSubtree listed %s", walked[i], i, f.GetPath())
+		}
+	}
+
+	stop := errors.New("stop")
+	n := 0
+	err = forPath(t, fs, "/").(w.Walker).Walk(-1, func(f w.File) error {
+		n++
+		return stop
+	})
+	if err != stop || n != 1 {
+		t.Errorf("Walk stopped by fn = %v after %d files, want stop after 1", err, n)
+	}
+}
+
+func TestOrphanedProps(t *testing.T) {
+	fs, dir := newFS(t)
+	forPath(t, fs, "/d").Mkdir()
+	for _, p := range []string{"/a.txt", "/d/b.txt", "/d/c.txt"} {
+		put(t, fs, p, "x")
+		f, _ := forPath(t, fs, p).Lookup()
+		f.PatchProp(map[string]string{"urn:x:k": "v"}, nil)
+	}
+	os.Remove(filepath.Join(dir, "a.txt"))
+	os.Remove(filepath.Join(dir, "d", "c.txt"))
+
+	got, err := fs.OrphanedProps()
+	if err != nil || len(got) != 2 || got[0] != "/a.txt" || got[1] != "/d/c.txt" {
+		t.Fatalf("OrphanedProps() = %v, %v, want /a.txt and /d/c.txt", got, err)
+	}
+	if err := fs.RemoveOrphanedProps("/d/b.txt"); err == nil {
+		t.Error("RemoveOrphanedProps removed the properties of an existing file")
+	}
+	for _, p := range got {
+		if err := fs.RemoveOrphanedProps(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, err := fs.OrphanedProps(); err != nil || len(got) != 0 {
+		t.Errorf("OrphanedProps() after removal = %v, %v", got, err)
+	}
+	f, _ := forPath(t, fs, "/d/b.txt").Lookup()
+	if v, _ := f.GetProp("urn:x:k"); v != "v" {
+		t.Errorf("GetProp of the remaining file = %q, want \"v\"", v)
+	}
+}
+
+func TestEscape(t *testing.T) {
+	outside := t.TempDir()
+	os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0o644)
+	fs, dir := newFS(t)
+	if err := os.Symlink(outside, filepath.Join(dir, "link")); err != nil {
+		t.Skip("symlinks unsupported:", err)
+	}
+
+	if _, err := forPath(t, fs, "/../secret").Lookup(); err == nil {
+		t.Error("Lookup escaped the root with ..")
+	}
+	if _, err := forPath(t, fs, "/link/secret").Lookup(); err == nil {
+		t.Error("Lookup escaped the root through a symlink")
+	}
+}
+
+func TestConformance(t *testing.T) {
+	fstest.TestFileSystem(t, func(t *testing.T) w.FileSystem {
+		fs, _ := newFS(t)
+		return fs
+	})
+}
@@ -0,0 +1,255 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"errors"
+	"path"
+	"sync"
+	"time"
+
+	wp "github.com/google/go-webdav/path"
+)
+
+// WithWriteOverlay makes the handler remember the files and collections it
+// creates with PUT and MKCOL, and the resources it removes or moves away,
+// for up to ttl, overlaying them onto the lookups of GET and HEAD and the
+// listings of PROPFIND until the FileSystem agrees. It is meant for
+// eventually consistent backends, such as object stores, which may not list
+// a file right after it is written, nor forget one right after it is
+// removed. Only the changes made through this handler are overlaid.
+func WithWriteOverlay(ttl time.Duration) Option {
+	return func(s *WebDAV) {
+		s.overlay.ttl = ttl
+	}
+}
+
+// writeOverlay holds the recent changes made through the handler, by path.
+type writeOverlay struct {
+	ttl time.Duration
+
+	m       sync.Mutex
+	entries map[string]overlayEntry
+}
+
+// overlayEntry is a resource written, with the FileInfo and entity tag it
+// had then, or removed, with its subtree, if f is nil.
+type overlayEntry struct {
+	f       File
+	fi      FileInfo
+	tag     string
+	expires time.Time
+}
+
+// overlayFile reports the FileInfo and entity tag of a resource as it was
+// written.
+type overlayFile struct {
+	File
+	e overlayEntry
+}
+
+func (f overlayFile) Stat() (FileInfo, error) {
+	return f.e.fi, nil
+}
+
+func (f overlayFile) ETag() (string, error) {
+	return f.e.tag, nil
+}
+
+// set records the change to a path, dropping expired entries.
+func (o *writeOverlay) set(p string, e overlayEntry) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	if o.entries == nil {
+		o.entries = make(map[string]overlayEntry)
+	}
+	for ep, old := range o.entries {
+		if e.expires.Sub(old.expires) > o.ttl {
+			delete(o.entries, ep)
+		}
+	}
+	o.entries[p] = e
+}
+
+// get gets the change to a path, which is its removal if it is within a
+// collection removed, unless it was written since.
+func (o *writeOverlay) get(p string, now time.Time) (overlayEntry, bool) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	for q := p; ; q = path.Dir(q) {
+		if e, ok := o.entries[q]; ok && now.Before(e.expires) && (q == p || e.f == nil) {
+			return e, true
+		}
+		if q == "/" || q == "." {
+			return overlayEntry{}, false
+		}
+	}
+}
+
+// confirm forgets the change to a path, once the FileSystem reflects it.
+func (o *writeOverlay) confirm(p string) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	delete(o.entries, p)
+}
+
+// written gets the resources written within a subtree.
+func (o *writeOverlay) written(root string, depth int, now time.Time) map[string]overlayEntry {
+	o.m.Lock()
+	defer o.m.Unlock()
+	res := make(map[string]overlayEntry)
+	for p, e := range o.entries {
+		if _, ok := wp.Included(p, root, depth); ok && e.f != nil && now.Before(e.expires) {
+			res[p] = e
+		}
+	}
+	return res
+}
+
+// overlayWrite records a resource written through the handler, with the
+// FileInfo reported by the FileSystem as it was written, if known.
+func (s *WebDAV) overlayWrite(f File, fi *FileInfo) {
+	if s.overlay.ttl <= 0 {
+		return
+	}
+	if fi == nil {
+		st, err := f.Stat()
+		if err != nil {
+			return
+		}
+		fi = &st
+	}
+	s.overlay.set(f.GetPath(), overlayEntry{f: f, fi: *fi, tag: fileETag(f, *fi), expires: s.clock.Now().Add(s.overlay.ttl)})
+}
+
+// overlayChange records the removals of a change made through the handler,
+// which cover the resources written within the subtree removed.
+func (s *WebDAV) overlayChange(c Change) {
+	if s.overlay.ttl <= 0 || (c.Kind != ChangeRemoved && c.Kind != ChangeMoved) {
+		return
+	}
+	s.overlay.m.Lock()
+	for p := range s.overlay.entries {
+		if wp.InTree(p, c.Path) {
+			delete(s.overlay.entries, p)
+		}
+	}
+	s.overlay.m.Unlock()
+	s.overlay.set(c.Path, overlayEntry{expires: c.Time.Add(s.overlay.ttl)})
+}
+
+// overlaid determines if a resource was recently written through the
+// handler, whether or not the FileSystem reports it yet.
+func (s *WebDAV) overlaid(p string) bool {
+	if s.overlay.ttl <= 0 {
+		return false
+	}
+	e, ok := s.overlay.get(p, s.clock.Now())
+	return ok && e.f != nil
+}
+
+// lookup looks up a resource, overlaying the recent changes made through
+// the handler.
+func (s *WebDAV) lookup(p Path) (File, error) {
+	f, err := p.Lookup()
+	if s.overlay.ttl <= 0 {
+		return f, err
+	}
+	e, ok := s.overlay.get(p.String(), s.clock.Now())
+	if !ok {
+		return f, err
+	}
+	if rf := s.resolveOverlay(p.String(), e, f, err); rf != nil {
+		return rf, nil
+	}
+	return nil, ErrorNotFound
+}
+
+// resolveOverlay gets the File to report for a resource changed recently,
+// nil if it was removed, given the result of looking it up. The change is
+// forgotten once the FileSystem agrees with it.
+func (s *WebDAV) resolveOverlay(p string, e overlayEntry, f File, err error) File {
+	// Unless the FileSystem failed, in which case nothing is known.
+	found := err == nil || !errors.Is(FromOSError(err), ErrorNotFound)
+	switch {
+	case e.f == nil:
+		if !found {
+			s.overlay.confirm(p)
+		}
+		return nil
+	case err != nil:
+		return overlayFile{e.f, e}
+	}
+	if fi, err := f.Stat(); err == nil && fileETag(f, fi) == e.tag {
+		s.overlay.confirm(p)
+		return f
+	}
+	return overlayFile{f, e}
+}
+
+// lookupSubtree lists a subtree, overlaying the recent changes made through
+// the handler.
+func (s *WebDAV) lookupSubtree(p Path, depth int) ([]File, error) {
+	files, err := p.LookupSubtree(depth)
+	if s.overlay.ttl <= 0 {
+		return files, err
+	}
+	root := p.String()
+	if err != nil {
+		if !errors.Is(FromOSError(err), ErrorNotFound) || !s.overlaid(root) {
+			return files, err
+		}
+		files = nil
+	}
+
+	now := s.clock.Now()
+	written := s.overlay.written(root, depth, now)
+	var res []File
+	for _, f := range files {
+		fp := f.GetPath()
+		e, ok := s.overlay.get(fp, now)
+		if !ok {
+			res = append(res, f)
+			continue
+		}
+		delete(written, fp)
+		if rf := s.resolveOverlay(fp, e, f, nil); rf != nil {
+			res = append(res, rf)
+		}
+	}
+	for _, e := range written {
+		res = append(res, overlayFile{e.f, e})
+	}
+	return res, nil
+}
+
+// walkSubtree visits the files of lookupSubtree one at a time, walking the
+// tree as it goes when p implements Walker. Overlaid writes need the whole
+// listing to be merged, so it is then looked up at once.
+func (s *WebDAV) walkSubtree(p Path, depth int, fn func(File) error) error {
+	if wk, ok := p.(Walker); ok && s.overlay.ttl <= 0 {
+		return wk.Walk(depth, fn)
+	}
+	files, err := s.lookupSubtree(p, depth)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"net/http"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+// lagFS wraps a FileSystem lagging behind the writes made to it: the paths
+// in hidden are not found yet, and the files in ghosts are still found
+// after being removed.
+type lagFS struct {
+	webdav.FileSystem
+	hidden map[string]bool
+	ghosts map[string]webdav.File
+}
+
+type lagPath struct {
+	webdav.Path
+	fs *lagFS
+}
+
+func (fs *lagFS) ForPath(p string) (webdav.Path, error) {
+	fp, err := fs.FileSystem.ForPath(p)
+	if err != nil {
+		return nil, err
+	}
+	return lagPath{fp, fs}, nil
+}
+
+func (p lagPath) Lookup() (webdav.File, error) {
+	if p.fs.hidden[p.String()] {
+		return nil, webdav.ErrorNotFound
+	}
+	if f, ok := p.fs.ghosts[p.String()]; ok {
+		return f, nil
+	}
+	return p.Path.Lookup()
+}
+
+func (p lagPath) LookupSubtree(depth int) ([]webdav.File, error) {
+	files, err := p.Path.LookupSubtree(depth)
+	var res []webdav.File
+	for _, f := range files {
+		if !p.fs.hidden[f.GetPath()] {
+			res = append(res, f)
+		}
+	}
+	for gp, f := range p.fs.ghosts {
+		if path.Dir(gp) == p.String() {
+			res = append(res, f)
+		}
+	}
+	return res, err
+}
+
+func TestWriteOverlay(t *testing.T) {
+	fs := &lagFS{FileSystem: memfs.NewMemFS(), hidden: make(map[string]bool), ghosts: make(map[string]webdav.File)}
+	clock := &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := webdav.NewWebDAV(fs, webdav.WithWriteOverlay(time.Minute), webdav.WithClock(clock))
+	listed := func(p string) bool {
+		w := serve(s, "PROPFIND", "/", propfindETag, "Depth", "1")
+		return strings.Contains(w.Body.String(), "<href>"+p+"</href>")
+	}
+
+	serve(s, "PUT", "/a", "hello")
+	fs.hidden["/a"] = true
+	if w := serve(s, "GET", "/a", ""); w.Code != http.StatusOK || w.Body.String() != "hello" {
+		t.Errorf("GET of a file not yet visible got %d %q", w.Code, w.Body)
+	}
+	if !listed("/a") {
+		t.Error("PROPFIND did not list a file not yet visible")
+	}
+	delete(fs.hidden, "/a")
+	if !listed("/a") {
+		t.Error("PROPFIND did not list a file once visible")
+	}
+
+	fp, _ := fs.FileSystem.ForPath("/a")
+	ghost, _ := fp.Lookup()
+	serve(s, "DELETE", "/a", "")
+	fs.ghosts["/a"] = ghost
+	if w := serve(s, "GET", "/a", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET of a file still visible after DELETE got %d, want 404", w.Code)
+	}
+	if listed("/a") {
+		t.Error("PROPFIND listed a file still visible after DELETE")
+	}
+
+	// The overlay is only kept for its ttl.
+	clock.now = clock.now.Add(2 * time.Minute)
+	if !listed("/a") {
+		t.Error("PROPFIND kept overlaying a removal after its ttl")
+	}
+	serve(s, "PUT", "/b", "b")
+	fs.hidden["/b"] = true
+	clock.now = clock.now.Add(2 * time.Minute)
+	if w := serve(s, "GET", "/b", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET of a file not yet visible after the ttl got %d, want 404", w.Code)
+	}
+}
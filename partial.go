@@ -0,0 +1,193 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// partialUpdateType is the media type of the bodies of the partial PATCH
+// of SabreDAV, see http://sabre.io/dav/http-patch/.
+const partialUpdateType = "application/x-sabredav-partialupdate"
+
+// partialRange is the part of a file updated by a request.
+type partialRange struct {
+	// start is the offset of the update, counted from the end of the file
+	// if negative.
+	start int64
+	// length is that of the update, -1 if it is given by the body.
+	length int64
+	// append places the update at the end of the file.
+	append bool
+}
+
+// parseContentRange parses the Content-Range of a PUT, such as
+// "bytes 100-199/1000", whose total length may be "*".
+func parseContentRange(h string) (partialRange, error) {
+	spec, ok := strings.CutPrefix(h, "bytes ")
+	if !ok {
+		return partialRange{}, fmt.Errorf("unsupported Content-Range %q", h)
+	}
+	rng, total, _ := strings.Cut(spec, "/")
+	first, last, err := parseByteRange(rng)
+	if err != nil || last < 0 {
+		return partialRange{}, fmt.Errorf("malformed Content-Range %q", h)
+	}
+	if total != "*" {
+		if n, err := strconv.ParseInt(total, 10, 64); err != nil || n <= last {
+			return partialRange{}, fmt.Errorf("malformed Content-Range %q", h)
+		}
+	}
+	return partialRange{start: first, length: last - first + 1}, nil
+}
+
+// parseUpdateRange parses the X-Update-Range of a PATCH, which is either
+// "append" or "bytes=" followed by a range, which may be open ended as in
+// "bytes=100-", or give the length of the end of the file, as in
+// "bytes=-100".
+func parseUpdateRange(h string) (partialRange, error) {
+	if h == "append" {
+		return partialRange{length: -1, append: true}, nil
+	}
+	spec, ok := strings.CutPrefix(h, "bytes=")
+	if !ok {
+		return partialRange{}, fmt.Errorf("unsupported X-Update-Range %q", h)
+	}
+	if n, ok := strings.CutPrefix(spec, "-"); ok {
+		size, err := strconv.ParseInt(n, 10, 64)
+		if err != nil || size <= 0 {
+			return partialRange{}, fmt.Errorf("malformed X-Update-Range %q", h)
+		}
+		return partialRange{start: -size, length: size}, nil
+	}
+	first, last, err := parseByteRange(spec)
+	if err != nil {
+		return partialRange{}, fmt.Errorf("malformed X-Update-Range %q", h)
+	}
+	if last < 0 {
+		return partialRange{start: first, length: -1}, nil
+	}
+	return partialRange{start: first, length: last - first + 1}, nil
+}
+
+// parseByteRange parses "first-last", last being -1 if omitted.
+func parseByteRange(s string) (first, last int64, err error) {
+	f, l, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, errors.New("missing -")
+	}
+	if first, err = strconv.ParseInt(f, 10, 64); err != nil || first < 0 {
+		return 0, 0, errors.New("bad first byte")
+	}
+	if l == "" {
+		return first, -1, nil
+	}
+	if last, err = strconv.ParseInt(l, 10, 64); err != nil || last < first {
+		return 0, 0, errors.New("bad last byte")
+	}
+	return first, last, nil
+}
+
+// http://sabre.io/dav/http-patch/
+func (s *WebDAV) doPatch(ctx context, w http.ResponseWriter, r *http.Request) {
+	if err := s.checkLocks(ctx, ctx.p, false); err != nil {
+		s.errorHeader(ctx, w, err)
+		return
+	}
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != partialUpdateType {
+		s.errorHeader(ctx, w, ErrorUnsupportedType)
+		return
+	}
+	rng, err := parseUpdateRange(r.Header.Get("X-Update-Range"))
+	if err != nil {
+		s.errorHeader(ctx, w, ErrorBadRequest.WithCause(err))
+		return
+	}
+	s.updatePart(ctx, w, r, rng)
+}
+
+// updatePart writes the body of a request over part of an existing file,
+// which must implement Updater. The update may extend the file, but not
+// leave a gap after its end.
+func (s *WebDAV) updatePart(ctx context, w http.ResponseWriter, r *http.Request, rng partialRange) {
+	if s.validatorFor(r) != nil {
+		// Validators check whole files.
+		s.errorHeader(ctx, w, ErrorUnsupportedType.WithCause(errors.New("partial update of validated content")))
+		return
+	}
+	f, err := ctx.p.Lookup()
+	if err != nil {
+		s.errorHeader(ctx, w, err)
+		return
+	}
+	if f.IsDirectory() {
+		s.errorHeader(ctx, w, ErrorIsDir)
+		return
+	}
+	u, ok := f.(Updater)
+	if !ok {
+		s.errorHeader(ctx, w, ErrorNotImplemented)
+		return
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		s.errorHeader(ctx, w, err)
+		return
+	}
+	start := rng.start
+	if rng.append {
+		start = fi.Size
+	} else if start < 0 {
+		start += fi.Size
+	}
+	if start < 0 || start > fi.Size {
+		s.errorHeader(ctx, w, ErrorBadRange.WithCause(fmt.Errorf("update at %d of a file of %d bytes", start, fi.Size)))
+		return
+	}
+
+	fh, err := u.Update()
+	if err != nil {
+		s.errorHeader(ctx, w, writeError(err))
+		return
+	}
+	var body io.Reader = r.Body
+	if rng.length >= 0 {
+		body = io.LimitReader(r.Body, rng.length)
+	}
+	_, err = fh.Seek(start, io.SeekStart)
+	if err == nil {
+		var n int64
+		n, err = io.Copy(fh, body)
+		if err == nil && rng.length >= 0 && n != rng.length {
+			err = ErrorBadRequest.WithCause(fmt.Errorf("body of %d bytes for a range of %d", n, rng.length))
+		}
+	}
+	if err != nil {
+		fh.Close()
+		s.errorHeader(ctx, w, writeError(err))
+		return
+	}
+	if !s.commit(ctx, w, f, fh) {
+		return
+	}
+	s.notify(ChangeModified, ctx.p.String(), "")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,79 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+func TestPartialPut(t *testing.T) {
+	s := webdav.NewWebDAV(memfs.NewMemFS())
+	serve(s, "PUT", "/a", "hello world")
+	for _, tc := range []struct {
+		rng, body string
+		code      int
+		want      string
+	}{
+		{"bytes 6-10/*", "WORLD", http.StatusNoContent, "hello WORLD"},
+		{"bytes 11-13/14", "!!!", http.StatusNoContent, "hello WORLD!!!"},
+		// Updates may not leave gaps, nor differ in length from their range.
+		{"bytes 20-21/*", "??", http.StatusRequestedRangeNotSatisfiable, "hello WORLD!!!"},
+		{"bytes 0-4/*", "HE", http.StatusBadRequest, "HEllo WORLD!!!"},
+		{"bytes 4-0/*", "", http.StatusBadRequest, "HEllo WORLD!!!"},
+		{"items 0-1/2", "ab", http.StatusBadRequest, "HEllo WORLD!!!"},
+	} {
+		if w := serve(s, "PUT", "/a", tc.body, "Content-Range", tc.rng); w.Code != tc.code {
+			t.Errorf("PUT with Content-Range %q got %d, want %d", tc.rng, w.Code, tc.code)
+		}
+		if w := serve(s, "GET", "/a", ""); w.Body.String() != tc.want {
+			t.Errorf("after PUT with Content-Range %q got %q, want %q", tc.rng, w.Body, tc.want)
+		}
+	}
+	if w := serve(s, "PUT", "/b", "x", "Content-Range", "bytes 0-0/1"); w.Code != http.StatusNotFound {
+		t.Errorf("PUT with Content-Range of a missing file got %d, want 404", w.Code)
+	}
+}
+
+func TestPatch(t *testing.T) {
+	s := webdav.NewWebDAV(memfs.NewMemFS())
+	serve(s, "PUT", "/a", "hello world")
+	const partial = "application/x-sabredav-partialupdate"
+	for _, tc := range []struct {
+		rng, body string
+		code      int
+		want      string
+	}{
+		{"bytes=0-4", "HELLO", http.StatusNoContent, "HELLO world"},
+		{"bytes=6-", "there", http.StatusNoContent, "HELLO there"},
+		{"bytes=-5", "THERE", http.StatusNoContent, "HELLO THERE"},
+		{"append", "!", http.StatusNoContent, "HELLO THERE!"},
+		{"bytes=-50", "x", http.StatusRequestedRangeNotSatisfiable, "HELLO THERE!"},
+		{"lines=1-2", "x", http.StatusBadRequest, "HELLO THERE!"},
+	} {
+		if w := serve(s, "PATCH", "/a", tc.body, "Content-Type", partial, "X-Update-Range", tc.rng); w.Code != tc.code {
+			t.Errorf("PATCH of %q got %d, want %d", tc.rng, w.Code, tc.code)
+		}
+		if w := serve(s, "GET", "/a", ""); w.Body.String() != tc.want {
+			t.Errorf("after PATCH of %q got %q, want %q", tc.rng, w.Body, tc.want)
+		}
+	}
+	if w := serve(s, "PATCH", "/a", "x", "X-Update-Range", "append"); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("PATCH without the partial update type got %d, want 415", w.Code)
+	}
+}
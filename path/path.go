@@ -41,7 +41,7 @@ func Included(fn, subtree string, depth int) (string, bool) {
 	if !InTree(fn, subtree) {
 		return "", false
 	}
-	fn = gp.Clean(fn[len(subtree):])
+	fn = strings.TrimPrefix(gp.Clean(fn[len(subtree):]), "/")
 	fd := len(strings.Split(fn, "/"))
 	if depth >= 0 && fd > depth {
 		return "", false
@@ -49,4 +49,10 @@ func TestIncluded(t *testing.T) {
 	if _, ok := Included("/foo/bar", "/", 1); ok {
 		t.Error("/ should not include /foo/bar with depth 1")
 	}
+	if n, ok := Included("/foo/bar", "/foo", 1); !ok || n != "bar" {
+		t.Error("/foo should include /foo/bar as bar with depth 1")
+	}
+	if _, ok := Included("/foo/bar/baz", "/foo", 1); ok {
+		t.Error("/foo should not include /foo/bar/baz with depth 1")
+	}
 }
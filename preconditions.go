@@ -0,0 +1,128 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// checkPreconditions evaluates the If-Match, If-Unmodified-Since and
+// If-None-Match headers of requests other than GET and HEAD, which are left
+// to http.ServeContent, in the order of RFC 9110 section 13.2.2. With
+// "If-None-Match: *" a PUT or MKCOL only creates, and with "If-Match: *"
+// it only updates, letting clients avoid races without locking. COPY and
+// MOVE are conditional on their source. If-Modified-Since only applies to
+// GET and HEAD.
+func (s *WebDAV) checkPreconditions(ctx context, r *http.Request) error {
+	im, inm := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+	ius := r.Header.Get("If-Unmodified-Since")
+	if r.Method == "GET" || r.Method == "HEAD" || (im == "" && inm == "" && ius == "") {
+		return nil
+	}
+
+	var tag string
+	var modified time.Time
+	exists := false
+	if f, err := ctx.p.Lookup(); err == nil {
+		exists = true
+		rf := represented(f)
+		if fi, err := rf.Stat(); err == nil {
+			tag, modified = fileETag(rf, fi), fi.LastModified
+		}
+	}
+
+	if im != "" && !(exists && matchesETag(im, tag, false)) {
+		return ErrorPrecondition
+	}
+	if im == "" && ius != "" && modifiedSince(modified, ius) {
+		return ErrorPrecondition
+	}
+	if inm != "" && exists && matchesETag(inm, tag, true) {
+		return ErrorPrecondition
+	}
+	return nil
+}
+
+// modifiedSince determines if a resource was modified after the date of an
+// If-Modified-Since or If-Unmodified-Since header, at the resolution of
+// HTTP dates. Resources without a modification time, and invalid dates,
+// are never considered modified, as the header is then to be ignored.
+func modifiedSince(modified time.Time, header string) bool {
+	t, err := http.ParseTime(header)
+	if err != nil || modified.IsZero() {
+		return false
+	}
+	return modified.Truncate(time.Second).After(t)
+}
+
+// matchesETag determines if the value of an If-Match or If-None-Match
+// header matches an existing resource with the given entity tag. As
+// required by RFC 9110 section 13.1, If-Match uses the strong comparison,
+// in which weak tags never match, and If-None-Match the weak one.
+func matchesETag(header, tag string, weak bool) bool {
+	opaque, tagWeak := parseETag(tag)
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" {
+			return true
+		}
+		o, w := parseETag(t)
+		if o == opaque && opaque != "" && (weak || !(w || tagWeak)) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseETag gets the opaque part of an entity tag and whether it is weak.
+// The handler's own tags are not quoted, while those of requests and of
+// ETaggers may be.
+func parseETag(t string) (string, bool) {
+	weak := strings.HasPrefix(t, "W/")
+	return strings.Trim(strings.TrimPrefix(t, "W/"), `"`), weak
+}
+
+// preconditions gets the Preconditions of a request modifying f, which is
+// nil if it does not exist.
+func (s *WebDAV) preconditions(ctx context, r *http.Request, f File) Preconditions {
+	pre := Preconditions{
+		IfMatch:     entityTags(r.Header.Get("If-Match")),
+		IfNoneMatch: entityTags(r.Header.Get("If-None-Match")),
+	}
+	if f != nil {
+		rf := represented(f)
+		if fi, err := rf.Stat(); err == nil {
+			pre.ETag = fileETag(rf, fi)
+		}
+	}
+	if ctx.cond != nil {
+		pre.Tokens = ctx.cond.GetAllTokens()
+	}
+	return pre
+}
+
+// entityTags gets the entity tags of an If-Match or If-None-Match header.
+func entityTags(header string) []string {
+	var res []string
+	for _, t := range strings.Split(header, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			opaque, _ := parseETag(t)
+			res = append(res, opaque)
+		}
+	}
+	return res
+}
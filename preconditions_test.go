@@ -0,0 +1,305 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+func TestConditionalWrites(t *testing.T) {
+	h := webdav.NewWebDAV(memfs.NewMemFS())
+	do := func(method, p, header, value string) *httptest.ResponseRecorder {
+		var body string
+		if method == "PUT" {
+			body = "x"
+		}
+		r := httptest.NewRequest(method, p, strings.NewReader(body))
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	tests := []struct {
+		method, p, header, value string
+		want                     int
+	}{
+		{"PUT", "/a", "If-Match", "*", http.StatusPreconditionFailed},
+		{"PUT", "/a", "If-None-Match", "*", http.StatusCreated},
+		{"PUT", "/a", "If-None-Match", "*", http.StatusPreconditionFailed},
+		{"PUT", "/a", "If-Match", "*", http.StatusNoContent},
+		{"PUT", "/a", "If-Match", `"stale"`, http.StatusPreconditionFailed},
+		{"PUT", "/a", "If-Unmodified-Since", "Sat, 01 Jan 2000 00:00:00 GMT", http.StatusPreconditionFailed},
+		{"PUT", "/a", "If-Unmodified-Since", "Fri, 01 Jan 2100 00:00:00 GMT", http.StatusNoContent},
+		{"PUT", "/a", "If-Unmodified-Since", "yesterday", http.StatusNoContent},
+		{"PROPPATCH", "/a", "If-Match", `"stale"`, http.StatusPreconditionFailed},
+		{"DELETE", "/a", "If-Unmodified-Since", "Sat, 01 Jan 2000 00:00:00 GMT", http.StatusPreconditionFailed},
+		{"MOVE", "/a", "If-Match", `"stale"`, http.StatusPreconditionFailed},
+		{"COPY", "/a", "If-None-Match", "*", http.StatusPreconditionFailed},
+		{"PROPFIND", "/a", "If-Match", `"stale"`, http.StatusPreconditionFailed},
+		{"MKCOL", "/d", "If-None-Match", "*", http.StatusCreated},
+		{"MKCOL", "/d", "If-None-Match", "*", http.StatusPreconditionFailed},
+		{"DELETE", "/missing", "If-Match", "*", http.StatusPreconditionFailed},
+	}
+	for _, tt := range tests {
+		if w := do(tt.method, tt.p, tt.header, tt.value); w.Code != tt.want {
+			t.Errorf("%s %s with %s: %s got %d, want %d", tt.method, tt.p, tt.header, tt.value, w.Code, tt.want)
+		}
+	}
+
+	tag := do("HEAD", "/a", "", "").Header().Get("ETag")
+	if w := do("PUT", "/a", "If-Match", `"`+tag+`"`); w.Code != http.StatusNoContent {
+		t.Errorf("PUT with the current ETag got %d, want %d", w.Code, http.StatusNoContent)
+	}
+}
+
+// condFS records the preconditions its conditional writes receive, and
+// fails them when reject is set.
+type condFS struct {
+	webdav.FileSystem
+	got    *webdav.Preconditions
+	reject bool
+}
+
+type condPath struct {
+	webdav.Path
+	fs *condFS
+}
+
+type condFile struct {
+	webdav.File
+	fs *condFS
+}
+
+func (fs *condFS) ForPath(p string) (webdav.Path, error) {
+	wp, err := fs.FileSystem.ForPath(p)
+	return condPath{wp, fs}, err
+}
+
+func (p condPath) Lookup() (webdav.File, error) {
+	f, err := p.Path.Lookup()
+	if err != nil {
+		return nil, err
+	}
+	return condFile{f, p.fs}, nil
+}
+
+func (p condPath) CreateIf(pre webdav.Preconditions) (webdav.File, webdav.FileHandle, error) {
+	p.fs.got = &pre
+	if p.fs.reject {
+		return nil, nil, webdav.ErrorPrecondition
+	}
+	return p.Path.Create()
+}
+
+func (f condFile) TruncateIf(pre webdav.Preconditions) (webdav.FileHandle, error) {
+	f.fs.got = &pre
+	if f.fs.reject {
+		return nil, webdav.ErrorPrecondition
+	}
+	return f.File.Truncate()
+}
+
+func TestBackendPreconditions(t *testing.T) {
+	fs := &condFS{FileSystem: memfs.NewMemFS()}
+	h := webdav.NewWebDAV(fs)
+	put := func(header, value string) int {
+		r := httptest.NewRequest("PUT", "/a", strings.NewReader("x"))
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := put("If-None-Match", "*"); code != http.StatusCreated {
+		t.Fatalf("PUT got %d, want %d", code, http.StatusCreated)
+	}
+	if fs.got == nil || len(fs.got.IfNoneMatch) != 1 || fs.got.IfNoneMatch[0] != "*" || fs.got.ETag != "" {
+		t.Errorf("CreateIf got %+v", fs.got)
+	}
+
+	fs.got = nil
+	put("", "")
+	if fs.got == nil || fs.got.ETag == "" {
+		t.Fatalf("TruncateIf got %+v, want the current ETag", fs.got)
+	}
+	r := httptest.NewRequest("HEAD", "/a", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	etag := strings.Trim(w.Header().Get("ETag"), `"`)
+	if code := put("If-Match", `"`+etag+`"`); code != http.StatusNoContent {
+		t.Fatalf("PUT got %d, want %d", code, http.StatusNoContent)
+	}
+	if len(fs.got.IfMatch) != 1 || fs.got.IfMatch[0] != etag || fs.got.ETag != etag {
+		t.Errorf("TruncateIf got If-Match %q, want %q", fs.got.IfMatch, etag)
+	}
+
+	// The resource changed after the handler evaluated the preconditions.
+	fs.reject = true
+	if code := put("", ""); code != http.StatusPreconditionFailed {
+		t.Errorf("rejected PUT got %d, want %d", code, http.StatusPreconditionFailed)
+	}
+}
+
+func TestPutETag(t *testing.T) {
+	h := webdav.NewWebDAV(memfs.NewMemFS())
+	r := httptest.NewRequest("PUT", "/a", strings.NewReader("x"))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	tag := w.Header().Get("ETag")
+	if tag == "" {
+		t.Fatal("PUT did not report an ETag")
+	}
+
+	r = httptest.NewRequest("HEAD", "/a", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if got := w.Header().Get("ETag"); got != tag {
+		t.Errorf("HEAD got ETag %q, want that reported by PUT, %q", got, tag)
+	}
+}
+
+// tagFS wraps a FileSystem whose Files supply their entity tags.
+type tagFS struct {
+	webdav.FileSystem
+}
+
+type tagPath struct {
+	webdav.Path
+}
+
+type tagFile struct {
+	webdav.File
+}
+
+func (fs tagFS) ForPath(p string) (webdav.Path, error) {
+	wp, err := fs.FileSystem.ForPath(p)
+	return tagPath{wp}, err
+}
+
+func (p tagPath) Lookup() (webdav.File, error) {
+	f, err := p.Path.Lookup()
+	if err != nil {
+		return nil, err
+	}
+	return tagFile{f}, nil
+}
+
+func (p tagPath) LookupSubtree(depth int) ([]webdav.File, error) {
+	files, err := p.Path.LookupSubtree(depth)
+	for i, f := range files {
+		files[i] = tagFile{f}
+	}
+	return files, err
+}
+
+func (f tagFile) ETag() (string, error) {
+	if strings.HasPrefix(f.GetPath(), "/weak") {
+		return `W/"v1` + f.GetPath() + `"`, nil
+	}
+	return "v1" + f.GetPath(), nil
+}
+
+func TestETagger(t *testing.T) {
+	h := webdav.NewWebDAV(tagFS{memfs.NewMemFS()})
+	serve(h, "PUT", "/a", "x")
+	if w := serve(h, "HEAD", "/a", ""); w.Header().Get("ETag") != "v1/a" {
+		t.Errorf("HEAD got ETag %q, want the supplied tag", w.Header().Get("ETag"))
+	}
+	if w := serve(h, "PROPFIND", "/a", propfindETag, "Depth", "0"); !strings.Contains(w.Body.String(), "v1/a") {
+		t.Errorf("PROPFIND did not report the supplied tag:\n%s", w.Body)
+	}
+	if w := serve(h, "PUT", "/a", "y", "If-Match", `"v1/a"`); w.Code >= 300 {
+		t.Errorf("PUT matching the supplied tag got %d", w.Code)
+	}
+	if w := serve(h, "PUT", "/a", "y", "If-Match", `"v2/a"`); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("PUT not matching the supplied tag got %d, want %d", w.Code, http.StatusPreconditionFailed)
+	}
+}
+
+func TestWeakETagger(t *testing.T) {
+	h := webdav.NewWebDAV(tagFS{memfs.NewMemFS()})
+	serve(h, "PUT", "/weak", "x")
+	tests := []struct {
+		header, value string
+		want          int
+	}{
+		// If-Match compares strongly, so a weak tag never matches.
+		{"If-Match", `W/"v1/weak"`, http.StatusPreconditionFailed},
+		{"If-Match", `"v1/weak"`, http.StatusPreconditionFailed},
+		{"If-Match", "*", http.StatusNoContent},
+		// If-None-Match compares weakly.
+		{"If-None-Match", `"v1/weak"`, http.StatusPreconditionFailed},
+		{"If-None-Match", `W/"v1/weak"`, http.StatusPreconditionFailed},
+		{"If-None-Match", `"v2/weak"`, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		if w := serve(h, "PUT", "/weak", "y", tt.header, tt.value); w.Code != tt.want {
+			t.Errorf("PUT with %s: %s got %d, want %d", tt.header, tt.value, w.Code, tt.want)
+		}
+	}
+	serve(h, "PUT", "/a", "x")
+	if w := serve(h, "PUT", "/a", "y", "If-Match", `W/"v1/a"`); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("PUT with If-Match of a weak tag got %d, want %d", w.Code, http.StatusPreconditionFailed)
+	}
+}
+
+func TestExpectContinue(t *testing.T) {
+	h := webdav.NewWebDAV(memfs.NewMemFS())
+	serve(h, "PUT", "/locked", "x")
+	serve(h, "LOCK", "/locked", `<lockinfo xmlns="DAV:"><lockscope><exclusive/></lockscope><locktype><write/></locktype></lockinfo>`)
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	// status sends the headers of a large PUT expecting 100 Continue, and
+	// gets the first status line answering it.
+	status := func(p string, hdr string) string {
+		c, err := net.Dial("tcp", srv.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		fmt.Fprintf(c, "PUT %s HTTP/1.1\r\nHost: example.com\r\nContent-Length: 1000000000\r\nExpect: 100-continue\r\n%s\r\n", p, hdr)
+		l, err := bufio.NewReader(c).ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(l)
+	}
+	for _, tc := range []struct {
+		p, hdr, want string
+	}{
+		{"/new", "", "HTTP/1.1 100 Continue"},
+		{"/locked", "", "HTTP/1.1 423 Locked"},
+		{"/new", "If-Match: \"x\"\r\n", "HTTP/1.1 412 Precondition Failed"},
+	} {
+		if got := status(tc.p, tc.hdr); got != tc.want {
+			t.Errorf("PUT of %s with %q got %q, want %q", tc.p, tc.hdr, got, tc.want)
+		}
+	}
+}
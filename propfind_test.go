@@ -0,0 +1,496 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+	x "github.com/google/go-webdav/xml"
+)
+
+// faultFS wraps a FileSystem, failing Stat on the files at given paths.
+type faultFS struct {
+	webdav.FileSystem
+	faults map[string]error
+}
+
+func (fs faultFS) ForPath(p string) (webdav.Path, error) {
+	wp, err := fs.FileSystem.ForPath(p)
+	if err != nil {
+		return nil, err
+	}
+	return faultPath{wp, fs.faults}, nil
+}
+
+type faultPath struct {
+	webdav.Path
+	faults map[string]error
+}
+
+func (p faultPath) Lookup() (webdav.File, error) {
+	f, err := p.Path.Lookup()
+	if err != nil {
+		return nil, err
+	}
+	return faultFile{f, p.faults}, nil
+}
+
+func (p faultPath) LookupSubtree(depth int) ([]webdav.File, error) {
+	files, err := p.Path.LookupSubtree(depth)
+	for i, f := range files {
+		files[i] = faultFile{f, p.faults}
+	}
+	return files, err
+}
+
+type faultFile struct {
+	webdav.File
+	faults map[string]error
+}
+
+func (f faultFile) Stat() (webdav.FileInfo, error) {
+	if err, ok := f.faults[f.GetPath()]; ok {
+		return webdav.FileInfo{}, err
+	}
+	return f.File.Stat()
+}
+
+func serve(h http.Handler, method, path, body string, hdr ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	for i := 0; i+1 < len(hdr); i += 2 {
+		r.Header.Set(hdr[i], hdr[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+const propfindETag = `<propfind xmlns="DAV:"><prop><getetag/></prop></propfind>`
+
+func TestPropfindPartialListing(t *testing.T) {
+	fs := faultFS{memfs.NewMemFS(), map[string]error{
+		"/gone":   &os.PathError{Op: "stat", Path: "/gone", Err: syscall.ENOENT},
+		"/secret": &os.PathError{Op: "stat", Path: "/secret", Err: syscall.EACCES},
+	}}
+	s := webdav.NewWebDAV(fs)
+	for _, p := range []string{"/gone", "/secret", "/ok"} {
+		if w := serve(s, "PUT", p, "x"); w.Code != http.StatusCreated {
+			t.Fatalf("PUT %s: got %d", p, w.Code)
+		}
+	}
+
+	w := serve(s, "PROPFIND", "/", propfindETag, "Depth", "1")
+	if w.Code != webdav.StatusMulti {
+		t.Fatalf("expected multistatus, got %d", w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		"<href>/gone</href>\n  <status>HTTP/1.1 404 Not Found</status>",
+		"<href>/secret</href>\n  <status>HTTP/1.1 403 Forbidden</status>",
+		"<href>/ok</href>\n  <propstat>",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected response to contain %q, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestPropfindFailingTarget(t *testing.T) {
+	fs := faultFS{memfs.NewMemFS(), map[string]error{
+		"/full": syscall.EIO,
+	}}
+	s := webdav.NewWebDAV(fs)
+	serve(s, "PUT", "/full", "x")
+
+	w := serve(s, "PROPFIND", "/full", propfindETag, "Depth", "0")
+	if !strings.Contains(w.Body.String(), "HTTP/1.1 500 Internal Server Error") {
+		t.Errorf("expected a 500 response for the failing file, got:\n%s", w.Body.String())
+	}
+}
+
+func TestSharedLockDiscovery(t *testing.T) {
+	s := webdav.NewWebDAV(memfs.NewMemFS())
+	serve(s, "PUT", "/a", "x")
+	lockinfo := func(scope string) string {
+		return `<lockinfo xmlns="DAV:"><lockscope><` + scope + `/></lockscope><locktype><write/></locktype></lockinfo>`
+	}
+	for i := 0; i < 2; i++ {
+		if w := serve(s, "LOCK", "/a", lockinfo("shared"), "Depth", "0"); w.Code != http.StatusOK {
+			t.Fatalf("shared LOCK %d got %d", i, w.Code)
+		}
+	}
+	if w := serve(s, "LOCK", "/a", lockinfo("exclusive"), "Depth", "0"); w.Code != webdav.StatusLocked {
+		t.Errorf("exclusive LOCK of a resource locked shared got %d", w.Code)
+	}
+
+	w := serve(s, "PROPFIND", "/a", `<propfind xmlns="DAV:"><prop><lockdiscovery/></prop></propfind>`, "Depth", "0")
+	if got := strings.Count(w.Body.String(), "<lockscope><shared/></lockscope>"); got != 2 {
+		t.Errorf("lockdiscovery listed %d shared locks, want 2:\n%s", got, w.Body.String())
+	}
+	if got := len(s.Snapshot().Locks); got != 2 {
+		t.Errorf("Snapshot got %d locks, want 2", got)
+	}
+}
+
+// indexFS wraps a FileSystem, representing collections by their index.html
+// members.
+type indexFS struct {
+	webdav.FileSystem
+}
+
+func (fs indexFS) ForPath(p string) (webdav.Path, error) {
+	wp, err := fs.FileSystem.ForPath(p)
+	if err != nil {
+		return nil, err
+	}
+	return indexPath{wp, fs.FileSystem}, nil
+}
+
+type indexPath struct {
+	webdav.Path
+	fs webdav.FileSystem
+}
+
+func (p indexPath) Lookup() (webdav.File, error) {
+	f, err := p.Path.Lookup()
+	if err != nil || !f.IsDirectory() {
+		return f, err
+	}
+	return indexFile{f, p.fs}, nil
+}
+
+func (p indexPath) LookupSubtree(depth int) ([]webdav.File, error) {
+	files, err := p.Path.LookupSubtree(depth)
+	for i, f := range files {
+		if f.IsDirectory() {
+			files[i] = indexFile{f, p.fs}
+		}
+	}
+	return files, err
+}
+
+type indexFile struct {
+	webdav.File
+	fs webdav.FileSystem
+}
+
+func (f indexFile) Representation() (webdav.File, error) {
+	p, err := f.fs.ForPath(path.Join(f.GetPath(), "index.html"))
+	if err != nil {
+		return nil, err
+	}
+	return p.Lookup()
+}
+
+func TestRepresentation(t *testing.T) {
+	s := webdav.NewWebDAV(indexFS{memfs.NewMemFS()})
+	serve(s, "MKCOL", "/d", "")
+	serve(s, "MKCOL", "/e", "")
+	serve(s, "PUT", "/d/index.html", "<p>hello</p>")
+
+	w := serve(s, "GET", "/d", "")
+	if w.Code != http.StatusOK || w.Body.String() != "<p>hello</p>" {
+		t.Fatalf("GET of a represented collection got %d %q", w.Code, w.Body)
+	}
+	tag := w.Header().Get("ETag")
+	if w := serve(s, "HEAD", "/d", ""); w.Header().Get("ETag") != tag {
+		t.Errorf("HEAD got ETag %q, want %q", w.Header().Get("ETag"), tag)
+	}
+	w = serve(s, "PROPFIND", "/d", propfindETag, "Depth", "0")
+	if !strings.Contains(w.Body.String(), ">"+tag+"</getetag>") {
+		t.Errorf("PROPFIND got %s, want the ETag %s of the representation", w.Body, tag)
+	}
+	if w := serve(s, "PROPPATCH", "/d", `<propertyupdate xmlns="DAV:"><set><prop><color xmlns="urn:x">red</color></prop></set></propertyupdate>`, "If-Match", `"`+tag+`"`); w.Code >= 300 {
+		t.Errorf("PROPPATCH matching the ETag of the representation got %d", w.Code)
+	}
+
+	// Collections without a representation are served as before.
+	if w := serve(s, "GET", "/e", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET of a collection without a representation got %d, want 405", w.Code)
+	}
+}
+
+func TestPropfindAllProp(t *testing.T) {
+	s := webdav.NewWebDAV(memfs.NewMemFS())
+	serve(s, "MKCOL", "/d", "")
+	serve(s, "PUT", "/d/a", "hello")
+	serve(s, "PROPPATCH", "/d/a", `<propertyupdate xmlns="DAV:"><set><prop><color xmlns="urn:x">red</color></prop></set></propertyupdate>`)
+
+	for _, body := range []string{`<propfind xmlns="DAV:"><allprop/></propfind>`, ""} {
+		w := serve(s, "PROPFIND", "/d", body, "Depth", "1")
+		if w.Code != webdav.StatusMulti {
+			t.Fatalf("PROPFIND %q got %d", body, w.Code)
+		}
+		got := w.Body.String()
+		for _, want := range []string{"<collection", "<getcontentlength", ">5</getcontentlength>", "<getetag", "<supportedlock", ">red</color>"} {
+			if !strings.Contains(got, want) {
+				t.Errorf("allprop PROPFIND %q got %s, want %s", body, got, want)
+			}
+		}
+		if strings.Contains(got, "404 Not Found") {
+			t.Errorf("allprop PROPFIND %q reported missing properties: %s", body, got)
+		}
+	}
+
+	// Properties named by include are reported even if missing.
+	w := serve(s, "PROPFIND", "/d/a", `<propfind xmlns="DAV:"><allprop/><include><size xmlns="urn:x"/></include></propfind>`, "Depth", "0")
+	if got := w.Body.String(); !strings.Contains(got, ">red</color>") || !strings.Contains(got, "<size") || !strings.Contains(got, "404") {
+		t.Errorf("allprop PROPFIND with include got %s", got)
+	}
+}
+
+func TestPropfindStreamed(t *testing.T) {
+	s := webdav.NewWebDAV(memfs.NewMemFS())
+	serve(s, "MKCOL", "/d", "")
+	for i := 0; i < 100; i++ {
+		serve(s, "PUT", fmt.Sprintf("/d/%d", i), "x")
+	}
+	w := serve(s, "PROPFIND", "/d", `<propfind xmlns="DAV:"><prop><getcontentlength/><nope xmlns="urn:x"/></prop></propfind>`, "Depth", "1")
+	if w.Code != x.StatusMulti || w.Header().Get("Content-Length") != "" {
+		t.Errorf("PROPFIND got %d with Content-Length %q, want a streamed 207", w.Code, w.Header().Get("Content-Length"))
+	}
+	var ms struct {
+		Response []struct {
+			Href string `xml:"href"`
+		} `xml:"response"`
+	}
+	if err := xml.Unmarshal(w.Body.Bytes(), &ms); err != nil || len(ms.Response) != 101 {
+		t.Errorf("PROPFIND got %d responses, %v, want 101", len(ms.Response), err)
+	}
+
+	// The streamed response is that which would have been buffered.
+	found, missing := []x.Any{x.NewAny("DAV::getcontentlength")}, []x.Any{x.NewAny("urn:x:nope")}
+	buffered, streamed := httptest.NewRecorder(), httptest.NewRecorder()
+	ms1, ms2 := x.NewMultiStatus(), x.NewMultiStatusWriter(streamed)
+	for _, r := range []x.Responses{ms1, ms2} {
+		r.AddPropStatus("/a b", found, missing)
+		r.AddStatus("/c", webdav.ErrorNotFound)
+	}
+	ms1.Send(buffered)
+	if err := ms2.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if buffered.Body.String() != streamed.Body.String() {
+		t.Errorf("streamed\n%s\nwant\n%s", streamed.Body, buffered.Body)
+	}
+}
+
+// statFS wraps a FileSystem, counting the Stat calls on listed files.
+type statFS struct {
+	webdav.FileSystem
+	stats *int32
+}
+
+type statPath struct {
+	webdav.Path
+	stats *int32
+}
+
+type statFile struct {
+	webdav.File
+	stats *int32
+}
+
+func (fs statFS) ForPath(p string) (webdav.Path, error) {
+	wp, err := fs.FileSystem.ForPath(p)
+	return statPath{wp, fs.stats}, err
+}
+
+func (p statPath) LookupSubtree(depth int) ([]webdav.File, error) {
+	files, err := p.Path.LookupSubtree(depth)
+	for i, f := range files {
+		files[i] = statFile{f, p.stats}
+	}
+	return files, err
+}
+
+func (f statFile) Stat() (webdav.FileInfo, error) {
+	atomic.AddInt32(f.stats, 1)
+	return f.File.Stat()
+}
+
+// walkFS wraps a FileSystem, making its paths Walkers which count the files
+// visited.
+type walkFS struct {
+	webdav.FileSystem
+	walked *int32
+}
+
+type walkPath struct {
+	webdav.Path
+	walked *int32
+}
+
+func (fs walkFS) ForPath(p string) (webdav.Path, error) {
+	wp, err := fs.FileSystem.ForPath(p)
+	return walkPath{wp, fs.walked}, err
+}
+
+func (p walkPath) Walk(depth int, fn func(webdav.File) error) error {
+	files, err := p.Path.LookupSubtree(depth)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		atomic.AddInt32(p.walked, 1)
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// slowWriter is a client which does not read its response until ready is
+// closed, or which has gone if failed is set.
+type slowWriter struct {
+	*httptest.ResponseRecorder
+	ready  chan struct{}
+	failed bool
+}
+
+func (w *slowWriter) Write(b []byte) (int, error) {
+	if w.failed {
+		return 0, syscall.EPIPE
+	}
+	<-w.ready
+	return w.ResponseRecorder.Write(b)
+}
+
+func TestPropfindBackpressure(t *testing.T) {
+	var stats int32
+	s := webdav.NewWebDAV(statFS{memfs.NewMemFS(), &stats})
+	serve(s, "MKCOL", "/d", "")
+	for i := 0; i < 100; i++ {
+		serve(s, "PUT", fmt.Sprintf("/d/%d", i), "x")
+	}
+	propfind := func(w http.ResponseWriter) {
+		r := httptest.NewRequest("PROPFIND", "/d", strings.NewReader(propfindETag))
+		r.Header.Set("Depth", "1")
+		s.ServeHTTP(w, r)
+	}
+
+	// Generation waits for a slow client.
+	w := &slowWriter{ResponseRecorder: httptest.NewRecorder(), ready: make(chan struct{})}
+	done := make(chan struct{})
+	go func() {
+		propfind(w)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&stats); n > 4 {
+		t.Errorf("PROPFIND examined %d files before the client read any", n)
+	}
+	close(w.ready)
+	<-done
+	if n := atomic.LoadInt32(&stats); n < 101 {
+		t.Errorf("PROPFIND examined %d files once the client read, want 101", n)
+	}
+
+	// And stops once the client is gone.
+	atomic.StoreInt32(&stats, 0)
+	propfind(&slowWriter{ResponseRecorder: httptest.NewRecorder(), failed: true})
+	if n := atomic.LoadInt32(&stats); n > 4 {
+		t.Errorf("PROPFIND examined %d files after the client was gone", n)
+	}
+}
+
+func TestPropfindWalkPaced(t *testing.T) {
+	var walked int32
+	s := webdav.NewWebDAV(walkFS{memfs.NewMemFS(), &walked})
+	serve(s, "MKCOL", "/d", "")
+	for i := 0; i < 100; i++ {
+		serve(s, "PUT", fmt.Sprintf("/d/%d", i), "x")
+	}
+	propfind := func(w http.ResponseWriter) {
+		r := httptest.NewRequest("PROPFIND", "/d", strings.NewReader(propfindETag))
+		r.Header.Set("Depth", "1")
+		s.ServeHTTP(w, r)
+	}
+
+	// The walk waits for a slow client.
+	w := &slowWriter{ResponseRecorder: httptest.NewRecorder(), ready: make(chan struct{})}
+	done := make(chan struct{})
+	go func() {
+		propfind(w)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&walked); n > 4 {
+		t.Errorf("PROPFIND walked %d files before the client read any", n)
+	}
+	close(w.ready)
+	<-done
+	if n := atomic.LoadInt32(&walked); n != 101 {
+		t.Errorf("PROPFIND walked %d files once the client read, want 101", n)
+	}
+	if !strings.Contains(w.Body.String(), "/d/99<") {
+		t.Errorf("PROPFIND listed %s, want /d/99", w.Body)
+	}
+
+	// And is abandoned once the client is gone.
+	atomic.StoreInt32(&walked, 0)
+	propfind(&slowWriter{ResponseRecorder: httptest.NewRecorder(), failed: true})
+	if n := atomic.LoadInt32(&walked); n > 4 {
+		t.Errorf("PROPFIND walked %d files after the client was gone", n)
+	}
+}
+
+func TestDisplayName(t *testing.T) {
+	s := webdav.NewWebDAV(memfs.NewMemFS())
+	serve(s, "MKCOL", "/cal", "")
+	name := func(p string) string {
+		w := serve(s, "PROPFIND", p, `<propfind xmlns="DAV:"><prop><displayname/></prop></propfind>`, "Depth", "0")
+		body := w.Body.String()
+		i := strings.Index(body, "<displayname")
+		j := strings.Index(body, "</displayname>")
+		if i < 0 || j < i {
+			t.Fatalf("PROPFIND of %s lacks the displayname:\n%s", p, body)
+		}
+		return body[strings.Index(body[i:], ">")+i+1 : j]
+	}
+	if got := name("/cal"); got != "cal" {
+		t.Errorf("displayname without one set is %q, want the basename", got)
+	}
+
+	serve(s, "PROPPATCH", "/cal", `<propertyupdate xmlns="DAV:"><set><prop><displayname>Work</displayname></prop></set></propertyupdate>`)
+	if got := name("/cal"); got != "Work" {
+		t.Errorf("displayname after PROPPATCH is %q, want Work", got)
+	}
+	serve(s, "MOVE", "/cal", "", "Destination", "http://example.com/cal2")
+	if got := name("/cal2"); got != "Work" {
+		t.Errorf("displayname after MOVE is %q, want Work", got)
+	}
+	serve(s, "COPY", "/cal2", "", "Destination", "http://example.com/cal3")
+	if got := name("/cal3"); got != "Work" {
+		t.Errorf("displayname after COPY is %q, want Work", got)
+	}
+
+	serve(s, "PROPPATCH", "/cal3", `<propertyupdate xmlns="DAV:"><remove><prop><displayname/></prop></remove></propertyupdate>`)
+	if got := name("/cal3"); got != "cal3" {
+		t.Errorf("displayname once removed is %q, want the basename", got)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	x "github.com/google/go-webdav/xml"
+)
+
+// ComputedProp computes the value of a live property of a file, such as
+// metadata held by another system.
+type ComputedProp func(f File) (string, error)
+
+// WithComputedProp defines a live property, named "namespace:name", whose
+// value is computed by fn whenever it is requested by PROPFIND or REPORT,
+// taking precedence over any other property of that name. Properties which
+// fail to be computed are reported missing. Computed properties are left
+// out of allprop responses, unless included, and cannot be set by
+// PROPPATCH.
+func WithComputedProp(name string, fn ComputedProp) Option {
+	return func(s *WebDAV) {
+		if s.computed == nil {
+			s.computed = make(map[string]ComputedProp)
+		}
+		s.computed[name] = fn
+	}
+}
+
+// WithNamespaceAlias serves the properties of namespace legacy as those of
+// the same name in namespace ns, whether read by PROPFIND and REPORT or
+// written by PROPPATCH, such as for clients still using the namespace an
+// application used to define its properties in.
+func WithNamespaceAlias(legacy, ns string) Option {
+	return func(s *WebDAV) {
+		if s.aliases == nil {
+			s.aliases = make(map[string]string)
+		}
+		s.aliases[legacy] = ns
+	}
+}
+
+// canonicalProp gets the name of the property served for pn, which is in
+// the namespace legacy names are aliases of.
+func (s *WebDAV) canonicalProp(pn string) string {
+	i := strings.LastIndex(pn, ":")
+	if i < 0 {
+		return pn
+	}
+	if ns, ok := s.aliases[pn[:i]]; ok {
+		return ns + pn[i:]
+	}
+	return pn
+}
+
+// computedProp computes the value of a property defined by
+// WithComputedProp, reporting whether it is one.
+func (s *WebDAV) computedProp(pn string, f File, a *x.Any) (ok, computed bool) {
+	fn, computed := s.computed[pn]
+	if !computed {
+		return false, false
+	}
+	v, err := fn(f)
+	if err != nil {
+		s.logger.Printf("E[%s]: computing %s: %s", f.GetPath(), pn, err)
+		return false, true
+	}
+	a.Value = v
+	return true, true
+}
+
+// canonicalPatch maps the properties of a PROPPATCH to those served for
+// them, refusing changes to computed properties.
+func (s *WebDAV) canonicalPatch(req x.PropPatchRequest) (x.PropPatchRequest, error) {
+	res := x.PropPatchRequest{
+		Set:    make(map[string]string, len(req.Set)),
+		Remove: make(map[string]string, len(req.Remove)),
+		Langs:  make(map[string]string, len(req.Langs)),
+	}
+	var protected []string
+	for _, m := range [][2]map[string]string{{req.Set, res.Set}, {req.Remove, res.Remove}} {
+		for n, v := range m[0] {
+			cn := s.canonicalProp(n)
+			if _, ok := s.computed[cn]; ok {
+				protected = append(protected, n)
+			}
+			m[1][cn] = v
+		}
+	}
+	for n, lang := range req.Langs {
+		res.Langs[s.canonicalProp(n)] = lang
+	}
+	if len(protected) > 0 {
+		sort.Strings(protected)
+		return res, ErrorProtectedProp.WithCause(fmt.Errorf("computed properties %s", strings.Join(protected, ", ")))
+	}
+	return res, nil
+}
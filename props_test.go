@@ -0,0 +1,62 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+func TestComputedProps(t *testing.T) {
+	s := webdav.NewWebDAV(memfs.NewMemFS(),
+		webdav.WithComputedProp("urn:org:department", func(f webdav.File) (string, error) {
+			if strings.HasPrefix(f.GetPath(), "/eng") {
+				return "Engineering", nil
+			}
+			return "", errors.New("unknown owner")
+		}),
+		webdav.WithNamespaceAlias("urn:old", "urn:new"))
+	serve(s, "PUT", "/eng", "x")
+	serve(s, "PUT", "/ops", "x")
+
+	const dept = `<propfind xmlns="DAV:"><prop><department xmlns="urn:org"/></prop></propfind>`
+	if w := serve(s, "PROPFIND", "/eng", dept, "Depth", "0"); !strings.Contains(w.Body.String(), ">Engineering</department>") {
+		t.Errorf("PROPFIND did not report the computed property:\n%s", w.Body)
+	}
+	if w := serve(s, "PROPFIND", "/ops", dept, "Depth", "0"); !strings.Contains(w.Body.String(), "404 Not Found") {
+		t.Errorf("PROPFIND did not report a property failing to be computed as missing:\n%s", w.Body)
+	}
+	if w := serve(s, "PROPFIND", "/eng", `<propfind xmlns="DAV:"><allprop/></propfind>`, "Depth", "0"); strings.Contains(w.Body.String(), "department") {
+		t.Errorf("allprop PROPFIND reported the computed property:\n%s", w.Body)
+	}
+	w := serve(s, "PROPPATCH", "/eng", `<propertyupdate xmlns="DAV:"><set><prop><department xmlns="urn:org">Sales</department></prop></set></propertyupdate>`)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "cannot-modify-protected-property") {
+		t.Errorf("PROPPATCH of a computed property got %d:\n%s", w.Code, w.Body)
+	}
+
+	// Properties set in either namespace are read from both.
+	serve(s, "PROPPATCH", "/eng", `<propertyupdate xmlns="DAV:"><set><prop><color xmlns="urn:old">red</color></prop></set></propertyupdate>`)
+	for _, ns := range []string{"urn:old", "urn:new"} {
+		w := serve(s, "PROPFIND", "/eng", `<propfind xmlns="DAV:"><prop><color xmlns="`+ns+`"/></prop></propfind>`, "Depth", "0")
+		if !strings.Contains(w.Body.String(), `<color xmlns="`+ns+`">red</color>`) {
+			t.Errorf("PROPFIND of the property in %s got:\n%s", ns, w.Body)
+		}
+	}
+}
@@ -0,0 +1,484 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package quotafs limits the storage used within collections of a wrapped
+webdav.FileSystem. Writes which would exceed a limit fail with
+webdav.ErrorInsufficientStorage, answered with 507, and collections report
+their usage with the properties of RFC 4331.
+
+The usage of each limited collection is found by listing it when first
+needed, and then tracked as files are written through the wrapper. Changes
+made to the backend by other means are only noticed after mutations of the
+collection through the wrapper.
+*/
+package quotafs
+
+import (
+	"io"
+	"strconv"
+	"sync"
+
+	w "github.com/google/go-webdav"
+	wp "github.com/google/go-webdav/path"
+)
+
+// Properties reported by collections within a limited one, see
+// https://tools.ietf.org/html/rfc4331#section-3.
+const (
+	PropAvailable = "DAV::quota-available-bytes"
+	PropUsed      = "DAV::quota-used-bytes"
+)
+
+// Options configure the limits.
+type Options struct {
+	// Limits maps collections, such as "/" or "/home/alice", to the
+	// number of bytes the files within them may use.
+	Limits map[string]int64
+}
+
+// FS is a webdav.FileSystem enforcing limits on storage use.
+type FS struct {
+	inner  w.FileSystem
+	limits map[string]int64
+
+	m sync.Mutex
+	// used holds the usage of limited collections, those which are not
+	// present must be counted.
+	used map[string]int64
+}
+
+// New wraps a FileSystem, enforcing the given limits.
+func New(inner w.FileSystem, opts Options) *FS {
+	return &FS{
+		inner:  inner,
+		limits: opts.Limits,
+		used:   make(map[string]int64),
+	}
+}
+
+// ForPath implements webdav.FileSystem.
+func (fs *FS) ForPath(p string) (w.Path, error) {
+	ip, err := fs.inner.ForPath(p)
+	if err != nil {
+		return nil, err
+	}
+	return &qpath{fs: fs, inner: ip}, nil
+}
+
+// Dump implements webdav.FileSystem, dumping the inner FileSystem.
+func (fs *FS) Dump(out io.Writer, format w.DumpFormat) error {
+	return fs.inner.Dump(out, format)
+}
+
+// Usage gets the number of bytes used by files within the collection at
+// root.
+func (fs *FS) Usage(root string) (int64, error) {
+	fs.m.Lock()
+	defer fs.m.Unlock()
+	return fs.usage(root)
+}
+
+// usage gets the usage of a collection, it must be called with the mutex
+// held.
+func (fs *FS) usage(root string) (int64, error) {
+	if u, ok := fs.used[root]; ok {
+		return u, nil
+	}
+	ip, err := fs.inner.ForPath(root)
+	if err != nil {
+		return 0, err
+	}
+	files, err := ip.LookupSubtree(-1)
+	if err != nil {
+		if _, lerr := ip.Lookup(); lerr != nil {
+			// Nothing is used within a missing collection.
+			return 0, nil
+		}
+		return 0, err
+	}
+	var u int64
+	for _, f := range files {
+		if f.IsDirectory() {
+			continue
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			return 0, err
+		}
+		u += fi.Size
+	}
+	if _, ok := fs.limits[root]; ok {
+		fs.used[root] = u
+	}
+	return u, nil
+}
+
+// reserve accounts for n more bytes used at p, failing if that exceeds a
+// limit. A negative n releases space.
+func (fs *FS) reserve(p string, n int64) error {
+	fs.m.Lock()
+	defer fs.m.Unlock()
+	if err := fs.fits(p, n); err != nil {
+		return err
+	}
+	for root := range fs.limits {
+		if u, ok := fs.used[root]; ok && wp.InTree(p, root) {
+			fs.used[root] = u + n
+		}
+	}
+	return nil
+}
+
+// fits checks that n more bytes within p exceed no limit. fs.m must be
+// held.
+func (fs *FS) fits(p string, n int64) error {
+	if n <= 0 {
+		return nil
+	}
+	for root, limit := range fs.limits {
+		if !wp.InTree(p, root) {
+			continue
+		}
+		u, err := fs.usage(root)
+		if err != nil {
+			return err
+		}
+		if u+n > limit {
+			return w.ErrorInsufficientStorage
+		}
+	}
+	return nil
+}
+
+// invalidate forgets the usage of the limited collections affected by a
+// change to the subtree at p.
+func (fs *FS) invalidate(p string) {
+	fs.m.Lock()
+	defer fs.m.Unlock()
+	for root := range fs.used {
+		if wp.InTree(p, root) || wp.InTree(root, p) {
+			delete(fs.used, root)
+		}
+	}
+}
+
+// quota gets the properties of RFC 4331 for the collection at p, reporting
+// whether a limit applies to it. The usage is that of the innermost limited
+// collection, the available bytes are the least left by any.
+func (fs *FS) quota(p string) (avail, used int64, ok bool) {
+	fs.m.Lock()
+	defer fs.m.Unlock()
+	var inner string
+	for root, limit := range fs.limits {
+		if !wp.InTree(p, root) {
+			continue
+		}
+		u, err := fs.usage(root)
+		if err != nil {
+			continue
+		}
+		left := limit - u
+		if left < 0 {
+			left = 0
+		}
+		if !ok || left < avail {
+			avail = left
+		}
+		if !ok || len(root) > len(inner) {
+			inner, used = root, u
+		}
+		ok = true
+	}
+	return avail, used, ok
+}
+
+type qpath struct {
+	fs    *FS
+	inner w.Path
+}
+
+func (p *qpath) String() string {
+	return p.inner.String()
+}
+
+func (p *qpath) Parent() w.Path {
+	return &qpath{fs: p.fs, inner: p.inner.Parent()}
+}
+
+func (p *qpath) Lookup() (w.File, error) {
+	f, err := p.inner.Lookup()
+	if err != nil {
+		return nil, err
+	}
+	return &qfile{File: f, fs: p.fs}, nil
+}
+
+// Exists implements webdav.Exister if the inner Path does.
+func (p *qpath) Exists() (bool, error) {
+	if e, ok := p.inner.(w.Exister); ok {
+		return e.Exists()
+	}
+	_, err := p.inner.Lookup()
+	return err == nil, nil
+}
+
+func (p *qpath) LookupSubtree(depth int) ([]w.File, error) {
+	files, err := p.inner.LookupSubtree(depth)
+	for i, f := range files {
+		files[i] = &qfile{File: f, fs: p.fs}
+	}
+	return files, err
+}
+
+func (p *qpath) Mkdir() (w.File, error) {
+	f, err := p.inner.Mkdir()
+	if err != nil {
+		return nil, err
+	}
+	return &qfile{File: f, fs: p.fs}, nil
+}
+
+func (p *qpath) Create() (w.File, w.FileHandle, error) {
+	f, fh, err := p.inner.Create()
+	if err != nil {
+		return nil, nil, err
+	}
+	return &qfile{File: f, fs: p.fs}, p.fs.handle(fh, p.String(), 0), nil
+}
+
+// CheckSpace implements webdav.SpaceChecker, refusing files which would
+// exceed a limit, net of the file they replace, as well as those refused
+// by the inner Path if it implements it.
+func (p *qpath) CheckSpace(size int64) error {
+	grow := size
+	if f, err := p.inner.Lookup(); err == nil {
+		if fi, err := f.Stat(); err == nil {
+			grow -= fi.Size
+		}
+	}
+	p.fs.m.Lock()
+	err := p.fs.fits(p.String(), grow)
+	p.fs.m.Unlock()
+	if err != nil {
+		return err
+	}
+	if sc, ok := p.inner.(w.SpaceChecker); ok {
+		return sc.CheckSpace(size)
+	}
+	return nil
+}
+
+func (p *qpath) CopyTo(dst w.Path, opt w.CopyOptions) (bool, error) {
+	dp, ok := dst.(*qpath)
+	if !ok {
+		return false, w.ErrorBadHost
+	}
+	src, dstp := p.String(), dp.String()
+	defer p.fs.invalidate(dstp)
+	if opt.Move {
+		defer p.fs.invalidate(src)
+	}
+	if err := p.checkCopy(dstp, opt); err != nil {
+		return false, err
+	}
+	return p.inner.CopyTo(dp.inner, opt)
+}
+
+// checkCopy fails if copying the subtree to dst would exceed a limit of a
+// collection containing dst. A move only counts against the limits which
+// do not already contain the source.
+func (p *qpath) checkCopy(dst string, opt w.CopyOptions) error {
+	fs := p.fs
+	fs.m.Lock()
+	defer fs.m.Unlock()
+	var size int64 = -1
+	for root, limit := range fs.limits {
+		if !wp.InTree(dst, root) || (opt.Move && wp.InTree(p.String(), root)) {
+			continue
+		}
+		if size < 0 {
+			files, err := p.inner.LookupSubtree(opt.Depth)
+			if err != nil {
+				return err
+			}
+			size = 0
+			for _, f := range files {
+				if fi, err := f.Stat(); err == nil && !f.IsDirectory() {
+					size += fi.Size
+				}
+			}
+		}
+		u, err := fs.usage(root)
+		if err != nil {
+			return err
+		}
+		if u+size > limit {
+			return w.ErrorInsufficientStorage
+		}
+	}
+	return nil
+}
+
+func (p *qpath) Remove() error {
+	defer p.fs.invalidate(p.String())
+	return p.inner.Remove()
+}
+
+func (p *qpath) RecursiveRemove() map[string]error {
+	defer p.fs.invalidate(p.String())
+	return p.inner.RecursiveRemove()
+}
+
+// qfile reports the quota properties of collections.
+type qfile struct {
+	w.File
+	fs *FS
+}
+
+func (f *qfile) Truncate() (w.FileHandle, error) {
+	p := f.GetPath()
+	fi, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	fh, err := f.File.Truncate()
+	if err != nil {
+		return nil, err
+	}
+	f.fs.reserve(p, -fi.Size)
+	return f.fs.handle(fh, p, 0), nil
+}
+
+// Update implements webdav.Updater if the inner File does.
+func (f *qfile) Update() (w.FileHandle, error) {
+	u, ok := f.File.(w.Updater)
+	if !ok {
+		return nil, w.ErrorNotImplemented
+	}
+	fi, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	fh, err := u.Update()
+	if err != nil {
+		return nil, err
+	}
+	return f.fs.handle(fh, f.GetPath(), fi.Size), nil
+}
+
+func (f *qfile) PatchProp(set, remove map[string]string) error {
+	for _, m := range []map[string]string{set, remove} {
+		if _, ok := m[PropAvailable]; ok {
+			return w.ErrorForbidden
+		}
+		if _, ok := m[PropUsed]; ok {
+			return w.ErrorForbidden
+		}
+	}
+	return f.File.PatchProp(set, remove)
+}
+
+func (f *qfile) GetProp(k string) (string, bool) {
+	if (k == PropAvailable || k == PropUsed) && f.IsDirectory() {
+		if avail, used, ok := f.fs.quota(f.GetPath()); ok {
+			if k == PropAvailable {
+				return strconv.FormatInt(avail, 10), true
+			}
+			return strconv.FormatInt(used, 10), true
+		}
+	}
+	return f.File.GetProp(k)
+}
+
+// PropNames implements webdav.PropLister if the inner File does.
+func (f *qfile) PropNames() []string {
+	if pl, ok := f.File.(w.PropLister); ok {
+		return pl.PropNames()
+	}
+	return nil
+}
+
+// ETag implements webdav.ETagger if the inner File does.
+func (f *qfile) ETag() (string, error) {
+	if et, ok := f.File.(w.ETagger); ok {
+		return et.ETag()
+	}
+	return "", w.ErrorNotFound
+}
+
+// Representation implements webdav.Representer if the inner File does.
+func (f *qfile) Representation() (w.File, error) {
+	if r, ok := f.File.(w.Representer); ok {
+		return r.Representation()
+	}
+	return nil, w.ErrorNotFound
+}
+
+// handle accounts for the bytes written beyond the end of the file,
+// refusing those exceeding a limit.
+type handle struct {
+	w.FileHandle
+	fs        *FS
+	path      string
+	pos, size int64
+}
+
+func (h *handle) Write(b []byte) (int, error) {
+	grow := h.pos + int64(len(b)) - h.size
+	if grow < 0 {
+		grow = 0
+	}
+	if err := h.fs.reserve(h.path, grow); err != nil {
+		return 0, err
+	}
+	n, err := h.FileHandle.Write(b)
+	if n < len(b) {
+		used := h.pos + int64(n) - h.size
+		if used < 0 {
+			used = 0
+		}
+		h.fs.reserve(h.path, used-grow)
+	}
+	if h.pos += int64(n); h.pos > h.size {
+		h.size = h.pos
+	}
+	return n, err
+}
+
+func (h *handle) Seek(offset int64, whence int) (int64, error) {
+	pos, err := h.FileHandle.Seek(offset, whence)
+	if err == nil {
+		h.pos = pos
+	}
+	return pos, err
+}
+
+// handle wraps a FileHandle of the wrapped FileSystem, open on a file of
+// the given size, keeping the webdav.Committer it may implement.
+func (fs *FS) handle(fh w.FileHandle, p string, size int64) w.FileHandle {
+	h := &handle{FileHandle: fh, fs: fs, path: p, size: size}
+	if _, ok := fh.(w.Committer); ok {
+		return committer{h}
+	}
+	return h
+}
+
+type committer struct {
+	*handle
+}
+
+func (c committer) Commit() (w.FileInfo, error) {
+	return c.FileHandle.(w.Committer).Commit()
+}
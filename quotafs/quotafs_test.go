@@ -0,0 +1,134 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quotafs
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	w "github.com/google/go-webdav"
+	"github.com/google/go-webdav/fstest"
+	"github.com/google/go-webdav/memfs"
+)
+
+func TestConformance(t *testing.T) {
+	fstest.TestFileSystem(t, func(t *testing.T) w.FileSystem {
+		return New(memfs.NewMemFS(), Options{Limits: map[string]int64{"/": 1 << 20}})
+	})
+}
+
+func TestQuota(t *testing.T) {
+	fs := New(memfs.NewMemFS(), Options{Limits: map[string]int64{"/": 100, "/small": 10}})
+	h := w.NewWebDAV(fs)
+	do := func(method, p, body string, hdr ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, p, strings.NewReader(body))
+		for i := 0; i+1 < len(hdr); i += 2 {
+			r.Header.Set(hdr[i], hdr[i+1])
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+
+	do("MKCOL", "/small", "")
+	if rec := do("PUT", "/small/a", "12345678"); rec.Code != http.StatusCreated {
+		t.Fatalf("PUT within the limit got %d", rec.Code)
+	}
+	if rec := do("PUT", "/small/b", "12345"); rec.Code != http.StatusInsufficientStorage {
+		t.Errorf("PUT over the limit got %d, want 507", rec.Code)
+	}
+	// Overwriting a file releases its space first.
+	if rec := do("PUT", "/small/a", "1234567890"); rec.Code != http.StatusNoContent {
+		t.Errorf("PUT replacing a file got %d, want 204", rec.Code)
+	}
+	if u, _ := fs.Usage("/small"); u != 10 {
+		t.Errorf("Usage(/small) = %d, want 10", u)
+	}
+
+	do("PUT", "/big", strings.Repeat("x", 85))
+	if rec := do("COPY", "/small/a", "", "Destination", "http://example.com/c"); rec.Code != http.StatusInsufficientStorage {
+		t.Errorf("COPY over the limit got %d, want 507", rec.Code)
+	}
+	if rec := do("MOVE", "/small/a", "", "Destination", "http://example.com/c"); rec.Code != http.StatusCreated {
+		t.Errorf("MOVE within the limit got %d, want 201", rec.Code)
+	}
+
+	rec := do("PROPFIND", "/small", `<propfind xmlns="DAV:"><prop><quota-available-bytes/><quota-used-bytes/></prop></propfind>`, "Depth", "0")
+	for _, want := range []string{
+		`<quota-available-bytes xmlns="DAV:">5</quota-available-bytes>`,
+		`<quota-used-bytes xmlns="DAV:">0</quota-used-bytes>`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("PROPFIND lacks %s:\n%s", want, rec.Body)
+		}
+	}
+
+	// Quotas are only reported for allprop requests which include them.
+	rec = do("PROPFIND", "/small", `<propfind xmlns="DAV:"><allprop/></propfind>`, "Depth", "0")
+	if strings.Contains(rec.Body.String(), "quota-used-bytes") {
+		t.Errorf("allprop PROPFIND reported quotas:\n%s", rec.Body)
+	}
+	rec = do("PROPFIND", "/small", `<propfind xmlns="DAV:"><allprop/><include><quota-used-bytes/></include></propfind>`, "Depth", "0")
+	if body := rec.Body.String(); !strings.Contains(body, `<quota-used-bytes xmlns="DAV:">0</quota-used-bytes>`) || !strings.Contains(body, "<getetag") {
+		t.Errorf("allprop PROPFIND including quotas got:\n%s", body)
+	}
+}
+
+func TestPartialUpdate(t *testing.T) {
+	fs := New(memfs.NewMemFS(), Options{Limits: map[string]int64{"/": 10}})
+	h := w.NewWebDAV(fs)
+	put := func(body, rng string) int {
+		r := httptest.NewRequest("PUT", "/a", strings.NewReader(body))
+		if rng != "" {
+			r.Header.Set("Content-Range", rng)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	put("12345678", "")
+	// Only the bytes written beyond the end of the file are counted.
+	if code := put("abcd", "bytes 6-9/10"); code != http.StatusNoContent {
+		t.Fatalf("PUT of a range within the limit got %d", code)
+	}
+	if u, _ := fs.Usage("/"); u != 10 {
+		t.Errorf("Usage(/) = %d, want 10", u)
+	}
+	if code := put("x", "bytes 10-10/*"); code != http.StatusInsufficientStorage {
+		t.Errorf("PUT of a range over the limit got %d, want 507", code)
+	}
+}
+
+func TestCheckSpace(t *testing.T) {
+	fs := New(memfs.NewMemFS(), Options{Limits: map[string]int64{"/": 10}})
+	p, _ := fs.ForPath("/a")
+	if err := p.(w.SpaceChecker).CheckSpace(11); !errors.Is(err, w.ErrorInsufficientStorage) {
+		t.Errorf("CheckSpace over the limit got %v", err)
+	}
+	_, fh, _ := p.Create()
+	fh.Write([]byte("12345678"))
+	fh.Close()
+	// A file replacing another may use its space.
+	if err := p.(w.SpaceChecker).CheckSpace(10); err != nil {
+		t.Errorf("CheckSpace of a file replacing another got %v", err)
+	}
+	if p, _ := fs.ForPath("/b"); p.(w.SpaceChecker).CheckSpace(3) == nil {
+		t.Error("CheckSpace of a new file exceeding the space left succeeded")
+	}
+}
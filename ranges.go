@@ -0,0 +1,94 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// limitRanges drops the Range header of requests asking for more than
+// Limits.MaxRanges ranges, so the whole file is served instead. This bounds the
+// work a single request can cause with many small or overlapping ranges.
+func (s *WebDAV) limitRanges(r *http.Request) *http.Request {
+	if s.maxRanges <= 0 {
+		return r
+	}
+	h := r.Header.Get("Range")
+	if !strings.HasPrefix(h, "bytes=") || strings.Count(h, ",")+1 <= s.maxRanges {
+		return r
+	}
+	r = r.Clone(r.Context())
+	r.Header.Del("Range")
+	return r
+}
+
+// lazySeeker serves a FileHandle of known size, only seeking the handle
+// when data is read from a position other than its current one. This
+// avoids the seeks http.ServeContent uses to find the size of the content,
+// which are expensive on some backends. Handles implementing io.ReaderAt
+// are never seeked, each range being read where it is.
+type lazySeeker struct {
+	fh   FileHandle
+	size int64
+	off  int64 // Offset of the next read.
+	pos  int64 // Offset of the handle.
+}
+
+func (l *lazySeeker) Read(p []byte) (int, error) {
+	if ra, ok := l.fh.(io.ReaderAt); ok {
+		if l.off >= l.size {
+			return 0, io.EOF
+		}
+		if rest := l.size - l.off; int64(len(p)) > rest {
+			p = p[:rest]
+		}
+		n, err := ra.ReadAt(p, l.off)
+		l.off += int64(n)
+		if err == io.EOF && n > 0 {
+			err = nil
+		}
+		return n, err
+	}
+	if l.off != l.pos {
+		if _, err := l.fh.Seek(l.off, io.SeekStart); err != nil {
+			return 0, err
+		}
+		l.pos = l.off
+	}
+	n, err := l.fh.Read(p)
+	l.off += int64(n)
+	l.pos = l.off
+	return n, err
+}
+
+func (l *lazySeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += l.off
+	case io.SeekEnd:
+		offset += l.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	l.off = offset
+	return offset, nil
+}
@@ -0,0 +1,146 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+func getRange(h http.Handler, rng string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", "/a.txt", nil)
+	r.Header.Set("Range", rng)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestMultiRangeGet(t *testing.T) {
+	h := webdav.NewWebDAV(memfs.NewMemFS(), webdav.WithLimits(webdav.Limits{MaxRanges: 2}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PUT", "/a.txt", strings.NewReader("0123456789")))
+
+	w := getRange(h, "bytes=2-3")
+	if w.Code != http.StatusPartialContent || w.Body.String() != "23" {
+		t.Errorf("single range: got %d %q, want 206 \"23\"", w.Code, w.Body.String())
+	}
+
+	w = getRange(h, "bytes=0-1,-2")
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("multiple ranges: got %d, want 206", w.Code)
+	}
+	mt, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if err != nil || mt != "multipart/byteranges" {
+		t.Fatalf("multiple ranges: got Content-Type %q", w.Header().Get("Content-Type"))
+	}
+	var parts []string
+	mr := multipart.NewReader(w.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(p)
+		parts = append(parts, string(b))
+	}
+	if strings.Join(parts, ",") != "01,89" {
+		t.Errorf("multiple ranges: got parts %q, want [01 89]", parts)
+	}
+
+	w = getRange(h, "bytes=0-0,2-2,4-4")
+	if w.Code != http.StatusOK || w.Body.String() != "0123456789" {
+		t.Errorf("too many ranges: got %d %q, want the whole file", w.Code, w.Body.String())
+	}
+}
+
+// rangeFS wraps a FileSystem, recording the seeks of the handles opened and
+// the ranges they read.
+type rangeFS struct {
+	webdav.FileSystem
+	seeks int
+	reads []string
+}
+
+type rangePath struct {
+	webdav.Path
+	fs *rangeFS
+}
+
+type rangeFile struct {
+	webdav.File
+	fs *rangeFS
+}
+
+type rangeHandle struct {
+	webdav.FileHandle
+	fs *rangeFS
+}
+
+func (fs *rangeFS) ForPath(p string) (webdav.Path, error) {
+	wp, err := fs.FileSystem.ForPath(p)
+	return rangePath{wp, fs}, err
+}
+
+func (p rangePath) Lookup() (webdav.File, error) {
+	f, err := p.Path.Lookup()
+	if err != nil {
+		return nil, err
+	}
+	return rangeFile{f, p.fs}, nil
+}
+
+func (f rangeFile) Open() (webdav.FileHandle, error) {
+	fh, err := f.File.Open()
+	return rangeHandle{fh, f.fs}, err
+}
+
+func (h rangeHandle) Seek(offset int64, whence int) (int64, error) {
+	h.fs.seeks++
+	return h.FileHandle.Seek(offset, whence)
+}
+
+func (h rangeHandle) ReadAt(p []byte, off int64) (int, error) {
+	n, err := h.FileHandle.(io.ReaderAt).ReadAt(p, off)
+	h.fs.reads = append(h.fs.reads, fmt.Sprintf("%d+%d", off, n))
+	return n, err
+}
+
+func TestReaderAtRanges(t *testing.T) {
+	fs := &rangeFS{FileSystem: memfs.NewMemFS()}
+	h := webdav.NewWebDAV(fs)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PUT", "/a.txt", strings.NewReader(strings.Repeat("0123456789", 1000))))
+
+	w := getRange(h, "bytes=10-11,5000-5001")
+	if w.Code != http.StatusPartialContent || !strings.Contains(w.Body.String(), "\r\n\r\n01\r\n") {
+		t.Fatalf("multiple ranges: got %d %q", w.Code, w.Body)
+	}
+	if fs.seeks != 0 {
+		t.Errorf("multiple ranges: the handle was seeked %d times", fs.seeks)
+	}
+	if got := strings.Join(fs.reads, ","); got != "10+2,5000+2" {
+		t.Errorf("multiple ranges: read %s, want 10+2,5000+2", got)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"sync/atomic"
+)
+
+// panicWriter tracks whether a response was started, so that a panic can
+// still be answered with an error if it was not.
+type panicWriter struct {
+	http.ResponseWriter
+	id    string
+	wrote bool
+}
+
+func (w *panicWriter) WriteHeader(status int) {
+	w.wrote = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *panicWriter) Write(b []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *panicWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// requestWriter wraps w to recover from panics, identifying the request by
+// its X-Request-Id header if the client set one, or a sequence number.
+func (s *WebDAV) requestWriter(w http.ResponseWriter, r *http.Request) *panicWriter {
+	id := r.Header.Get("X-Request-Id")
+	if id == "" {
+		id = strconv.FormatUint(atomic.AddUint64(&s.requests, 1), 10)
+	}
+	return &panicWriter{ResponseWriter: w, id: id}
+}
+
+// recoverPanic recovers from a panic serving a request, such as one of the
+// FileSystem, logging it with its stack and answering 500, or aborting the
+// response if it was already started. When debugging, the state of the
+// handler is logged as well. Panics are counted by Snapshot.
+func (s *WebDAV) recoverPanic(w *panicWriter, r *http.Request) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	if v == http.ErrAbortHandler {
+		panic(v)
+	}
+	atomic.AddInt64(&s.panics, 1)
+	s.logger.Printf("panic serving request %s, %s %s: %v\n%s", w.id, r.Method, r.URL, v, debug.Stack())
+	if s.Debug {
+		if err := s.Dump(s.logger.Writer(), DumpText); err != nil {
+			s.logger.Printf("dump failed: %s", err)
+		}
+	}
+	if w.wrote {
+		// The client must not take the truncated response as complete.
+		panic(http.ErrAbortHandler)
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusInternalServerError)
+	fmt.Fprintf(w, "internal error serving request %s\n", w.id)
+}
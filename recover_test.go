@@ -0,0 +1,53 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+// panicFS wraps a FileSystem which panics for /boom.
+type panicFS struct {
+	webdav.FileSystem
+}
+
+func (fs panicFS) ForPath(p string) (webdav.Path, error) {
+	if p == "/boom" {
+		panic("boom")
+	}
+	return fs.FileSystem.ForPath(p)
+}
+
+func TestRecoverPanic(t *testing.T) {
+	h := webdav.NewWebDAV(panicFS{memfs.NewMemFS()})
+	w := serve(h, "GET", "/boom", "", "X-Request-Id", "abc")
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("GET of a panicking path got %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	if !strings.Contains(w.Body.String(), "abc") {
+		t.Errorf("error body %q does not name the request", w.Body)
+	}
+	if got := h.Snapshot().Panics; got != 1 {
+		t.Errorf("Snapshot counted %d panics, want 1", got)
+	}
+	if w := serve(h, "PUT", "/a", "x"); w.Code >= 300 {
+		t.Errorf("PUT after a panic got %d", w.Code)
+	}
+}
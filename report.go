@@ -0,0 +1,156 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/url"
+
+	x "github.com/google/go-webdav/xml"
+)
+
+// ContentProp is the property carrying the base64 encoded content of a
+// file in the response to a multiget REPORT.
+const ContentProp = extNS + ":content"
+
+// MaxMultigetContent is the size in bytes of the largest file whose content
+// is returned by a multiget REPORT, larger files report ContentProp as
+// missing and must be fetched with GET.
+const MaxMultigetContent = 1 << 20
+
+// doReport handles the multiget REPORT, which fetches the content and
+// properties of many small files in one request, for clients syncing over
+// high latency links. The request names the properties and resources:
+//
+//	<G:multiget xmlns:D="DAV:" xmlns:G="http://github.com/google/go-webdav/">
+//	  <D:prop><D:getetag/></D:prop>
+//	  <D:href>/notes/a.txt</D:href>
+//	  <D:href>/notes/b.txt</D:href>
+//	</G:multiget>
+//
+// The response is a multistatus with a response for each href, holding the
+// requested properties and ContentProp for files. The sync-collection
+// REPORT is handled by doSyncCollection, and the version-tree REPORT by
+// doVersionTree.
+func (s *WebDAV) doReport(ctx context, w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		s.errorHeader(ctx, w, ErrorBadReport.WithCause(err))
+		return
+	}
+	switch name, _ := x.ReportName(body); name {
+	case "DAV::sync-collection":
+		req, err := x.ParseSyncCollection(bytes.NewReader(body))
+		if err != nil {
+			s.errorHeader(ctx, w, ErrorBadReport.WithCause(err))
+			return
+		}
+		s.doSyncCollection(ctx, w, req)
+		return
+	case "DAV::version-tree":
+		req, err := x.ParseVersionTree(bytes.NewReader(body))
+		if err != nil {
+			s.errorHeader(ctx, w, ErrorBadReport.WithCause(err))
+			return
+		}
+		s.doVersionTree(ctx, w, req)
+		return
+	}
+
+	req, err := x.ParseMultiGet(bytes.NewReader(body))
+	if err != nil {
+		s.errorHeader(ctx, w, ErrorBadReport.WithCause(err))
+		return
+	}
+
+	ms := x.NewMultiStatus()
+	for _, h := range req.Hrefs {
+		u, err := url.Parse(h)
+		if err != nil {
+			ms.AddStatus(h, ErrorBadPath)
+			continue
+		}
+		f, err := s.multigetFile(u.Path)
+		if err != nil {
+			ms.AddStatus(u.Path, FromOSError(err))
+			continue
+		}
+		var found, missing []x.Any
+		for _, pn := range req.PropertyNames {
+			if v, ok := s.getPropValue(pn, f); ok {
+				found = append(found, v)
+			} else {
+				missing = append(missing, v)
+			}
+		}
+		if v, ok := multigetContent(f); ok {
+			found = append(found, v)
+		} else {
+			missing = append(missing, v)
+		}
+		ms.AddPropStatus(s.href(f.GetPath()), found, missing)
+	}
+	ms.Send(w)
+}
+
+// multigetFile looks up a resource named in a multiget REPORT, subject to
+// the same visibility rules as a GET of it.
+func (s *WebDAV) multigetFile(urlPath string) (File, error) {
+	p, ok := s.trimPrefix(urlPath)
+	if !ok {
+		return nil, ErrorNotFound
+	}
+	if _, ok := s.dropBoxFor(p); ok {
+		return nil, ErrorDropBox
+	}
+	fp, err := s.fs.ForPath(p)
+	if err != nil {
+		return nil, err
+	}
+	f, err := fp.Lookup()
+	if err != nil {
+		return nil, err
+	}
+	if s.isHidden(f.GetPath(), f.IsDirectory()) {
+		return nil, ErrorNotFound
+	}
+	return f, nil
+}
+
+// multigetContent gets ContentProp for a file, if it is small enough.
+func multigetContent(f File) (x.Any, bool) {
+	a := x.NewAny(ContentProp)
+	if f.IsDirectory() {
+		return a, false
+	}
+	fi, err := f.Stat()
+	if err != nil || fi.Size > MaxMultigetContent {
+		return a, false
+	}
+	fh, err := f.Open()
+	if err != nil {
+		return a, false
+	}
+	defer fh.Close()
+	data, err := io.ReadAll(io.LimitReader(fh, MaxMultigetContent+1))
+	if err != nil || len(data) > MaxMultigetContent {
+		return a, false
+	}
+	a.Value = base64.StdEncoding.EncodeToString(data)
+	return a, true
+}
@@ -0,0 +1,66 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+func TestMultiget(t *testing.T) {
+	h := webdav.NewWebDAV(memfs.NewMemFS(), webdav.WithHidden("*.secret"))
+	for p, content := range map[string]string{"/a.txt": "alpha", "/b%20c.txt": "beta", "/x.secret": "x"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PUT", p, strings.NewReader(content)))
+	}
+
+	body := `<?xml version="1.0"?>
+<G:multiget xmlns:D="DAV:" xmlns:G="http://github.com/google/go-webdav/">
+  <D:prop><D:getcontentlength/></D:prop>
+  <D:href>/a.txt</D:href>
+  <D:href>/b%20c.txt</D:href>
+  <D:href>/x.secret</D:href>
+  <D:href>/missing</D:href>
+</G:multiget>`
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("REPORT", "/", strings.NewReader(body)))
+	if w.Code != 207 {
+		t.Fatalf("REPORT got %d, want 207", w.Code)
+	}
+	res := w.Body.String()
+	for _, want := range []string{
+		base64.StdEncoding.EncodeToString([]byte("alpha")),
+		base64.StdEncoding.EncodeToString([]byte("beta")),
+		"<href>/b%20c.txt</href>",
+		"<getcontentlength xmlns=\"DAV:\">5</getcontentlength>",
+		"<href>/missing</href>\n  <status>HTTP/1.1 404 Not Found</status>",
+		"<href>/x.secret</href>\n  <status>HTTP/1.1 404 Not Found</status>",
+	} {
+		if !strings.Contains(res, want) {
+			t.Errorf("REPORT response lacks %q:\n%s", want, res)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("REPORT", "/", strings.NewReader("<other/>")))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown REPORT got %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+func TestParseRequest(t *testing.T) {
+	s := webdav.NewWebDAV(memfs.NewMemFS(), webdav.WithPrefix("/dav"))
+
+	r := httptest.NewRequest("REPORT", "/dav/cal/a.ics", nil)
+	r.Header.Set("Depth", "1")
+	r.Header.Set("Overwrite", "F")
+	r.Header.Set("Timeout", "Second-60")
+	r.Header.Set("If", "(<opaquelocktoken:a>)")
+	rc, err := s.ParseRequest(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rc.Path.String() != "/cal/a.ics" || rc.Depth != 1 || rc.Overwrite || rc.Cond == nil {
+		t.Errorf("ParseRequest() = %+v", rc)
+	}
+	if rc.Timeout != time.Minute {
+		t.Errorf("ParseRequest() timeout = %s, want a minute", rc.Timeout)
+	}
+
+	r = httptest.NewRequest("REPORT", "/dav/a", nil)
+	r.Header.Set("Depth", "-1")
+	if _, err := s.ParseRequest(r); !errors.Is(err, webdav.ErrorBadDepth) {
+		t.Errorf("ParseRequest() with a bad depth got %v, want ErrorBadDepth", err)
+	}
+	if _, err := s.ParseRequest(httptest.NewRequest("REPORT", "/other", nil)); !errors.Is(err, webdav.ErrorNotFound) {
+		t.Errorf("ParseRequest() outside the prefix got %v, want ErrorNotFound", err)
+	}
+}
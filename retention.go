@@ -0,0 +1,108 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	wp "github.com/google/go-webdav/path"
+)
+
+// RetentionPolicy makes resources under Prefix immutable for Period after
+// their creation: they may not be deleted, overwritten, moved or have
+// their properties changed.
+type RetentionPolicy struct {
+	Prefix string
+	Period time.Duration
+}
+
+// retentionFor gets the longest retention period applying to a path.
+func (s *WebDAV) retentionFor(p string) time.Duration {
+	var period time.Duration
+	for _, rp := range s.Retention {
+		if wp.InTree(p, rp.Prefix) && rp.Period > period {
+			period = rp.Period
+		}
+	}
+	return period
+}
+
+// retentionWithin determines whether any retention policy applies to a
+// path or to the tree below it.
+func (s *WebDAV) retentionWithin(p string) bool {
+	for _, rp := range s.Retention {
+		if rp.Period > 0 && (wp.InTree(p, rp.Prefix) || wp.InTree(rp.Prefix, p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRetained fails if the file, or with subtree set any file below it,
+// is still within its retention period. Files which cannot be examined are
+// not presumed to be free of retention: the error is returned, unless the
+// file does not exist.
+func (s *WebDAV) checkRetained(p Path, subtree bool) error {
+	if !s.retentionWithin(p.String()) {
+		return nil
+	}
+	var files []File
+	var err error
+	if subtree {
+		files, err = p.LookupSubtree(-1)
+	} else {
+		var f File
+		if f, err = p.Lookup(); err == nil {
+			files = []File{f}
+		}
+	}
+	if err != nil {
+		if err = FromOSError(err); errors.Is(err, ErrorNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	now := s.clock.Now()
+	for _, f := range files {
+		period := s.retentionFor(f.GetPath())
+		if period == 0 {
+			continue
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if until := fi.Created.Add(period); now.Before(until) {
+			return ErrorRetained.WithCause(
+				fmt.Errorf("%s retained until %s", f.GetPath(), until.Format(time.RFC3339)))
+		}
+	}
+	return nil
+}
+
+// checkRetention applies retention policies to the target of a request.
+func (s *WebDAV) checkRetention(ctx context, r *http.Request) error {
+	switch r.Method {
+	case "PUT", "PATCH", "PROPPATCH", "UPDATE":
+		return s.checkRetained(ctx.p, false)
+	case "DELETE", "MOVE":
+		return s.checkRetained(ctx.p, true)
+	}
+	return nil
+}
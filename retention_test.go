@@ -0,0 +1,102 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+// flakyFS wraps a FileSystem, failing lookups of subtrees while down is
+// set.
+type flakyFS struct {
+	webdav.FileSystem
+	down *bool
+}
+
+func (fs flakyFS) ForPath(p string) (webdav.Path, error) {
+	wp, err := fs.FileSystem.ForPath(p)
+	if err != nil {
+		return nil, err
+	}
+	return flakyPath{wp, fs.down}, nil
+}
+
+type flakyPath struct {
+	webdav.Path
+	down *bool
+}
+
+func (p flakyPath) LookupSubtree(depth int) ([]webdav.File, error) {
+	if *p.down {
+		return nil, syscall.EIO
+	}
+	return p.Path.LookupSubtree(depth)
+}
+
+func TestRetention(t *testing.T) {
+	// The memfs records creation by the system clock.
+	clock := &fakeClock{now: time.Now()}
+	down := false
+	h := webdav.NewWebDAV(flakyFS{memfs.NewMemFS(), &down}, webdav.WithClock(clock),
+		webdav.WithRetention(webdav.RetentionPolicy{Prefix: "/worm", Period: time.Hour}))
+	serve(h, "MKCOL", "/worm", "")
+	if w := serve(h, "PUT", "/worm/a", "a"); w.Code != http.StatusCreated {
+		t.Fatalf("PUT of a new retained file got %d", w.Code)
+	}
+	serve(h, "PUT", "/free", "f")
+
+	const proppatch = `<propertyupdate xmlns="DAV:"><set><prop><color xmlns="urn:x:">red</color></prop></set></propertyupdate>`
+	for _, tc := range []struct {
+		method, path, body string
+		hdr                []string
+	}{
+		{"PUT", "/worm/a", "b", nil},
+		{"PROPPATCH", "/worm/a", proppatch, nil},
+		{"DELETE", "/worm/a", "", nil},
+		{"DELETE", "/worm", "", nil},
+		{"MOVE", "/worm/a", "", []string{"Destination", "/b"}},
+	} {
+		if w := serve(h, tc.method, tc.path, tc.body, tc.hdr...); w.Code != http.StatusForbidden {
+			t.Errorf("%s %s within the retention period got %d, want 403", tc.method, tc.path, w.Code)
+		}
+	}
+	if w := serve(h, "PUT", "/free", "g"); w.Code != http.StatusNoContent {
+		t.Errorf("PUT outside the policy got %d", w.Code)
+	}
+
+	// A backend failure does not lift the protection.
+	down = true
+	if w := serve(h, "DELETE", "/worm/a", ""); w.Code == http.StatusNoContent {
+		t.Error("DELETE succeeded while the backend failed lookups")
+	}
+	down = false
+	if w := serve(h, "GET", "/worm/a", ""); w.Body.String() != "a" {
+		t.Errorf("retained file got %q, want its original content", w.Body)
+	}
+
+	clock.now = clock.now.Add(2 * time.Hour)
+	if w := serve(h, "PUT", "/worm/a", "b"); w.Code != http.StatusNoContent {
+		t.Errorf("PUT after the retention period got %d", w.Code)
+	}
+	if w := serve(h, "DELETE", "/worm", ""); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE after the retention period got %d", w.Code)
+	}
+}
@@ -0,0 +1,274 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-webdav/davhttp"
+	x "github.com/google/go-webdav/xml"
+)
+
+// SearchExpr is a condition of a SEARCH with the basicsearch grammar, such
+// as comparing a property with a literal.
+type SearchExpr = x.SearchExpr
+
+// Searcher may optionally be implemented by a FileSystem able to run the
+// queries of SEARCH itself, such as with an index. Search gets the
+// resources within the subtree at root, to the given depth, which match
+// where, nil matching any resource. The handler filters the hidden
+// resources out of the results, then sorts and limits them as requested.
+// FileSystems lacking Searcher are searched by listing the subtree and
+// matching each resource in turn.
+type Searcher interface {
+	Search(root string, depth int, where *SearchExpr) ([]File, error)
+}
+
+// http://tools.ietf.org/html/rfc5323#section-2
+func (s *WebDAV) doSearch(ctx context, w http.ResponseWriter, r *http.Request) {
+	req, err := x.ParseSearch(r.Body)
+	if err != nil {
+		s.errorHeader(ctx, w, ErrorBadSearch.WithCause(err))
+		return
+	}
+
+	var files []File
+	seen := make(map[string]bool)
+	for _, sc := range req.Scopes {
+		found, err := s.searchScope(r, sc, req.Where)
+		if err != nil {
+			s.errorHeader(ctx, w, err)
+			return
+		}
+		for _, f := range found {
+			if fp := f.GetPath(); !seen[fp] && s.listable(f) {
+				seen[fp] = true
+				files = append(files, f)
+			}
+		}
+	}
+	s.sortResults(files, req.OrderBy)
+	if req.Limit > 0 && len(files) > req.Limit {
+		files = files[:req.Limit]
+	}
+
+	ms := x.NewMultiStatusWriter(w)
+	for _, f := range files {
+		if ms.Err() != nil || r.Context().Err() != nil {
+			break
+		}
+		var found, missing []x.Any
+		for _, pn := range req.PropertyNames {
+			if v, ok := s.getPropValue(pn, f); ok {
+				found = append(found, v)
+			} else {
+				missing = append(missing, v)
+			}
+		}
+		if req.AllProp {
+			found = append(s.allProps(f, nil), found...)
+		}
+		localize(f, found, r.Header.Get("Accept-Language"))
+		ms.AddPropStatus(s.href(f.GetPath()), found, missing)
+	}
+	if err := ms.Close(); err != nil {
+		s.logger.Printf("E[%s]: writing the response: %s", ctx.p, err)
+	}
+}
+
+// searchScope gets the resources matching where within a scope, whose href
+// is relative to the request.
+func (s *WebDAV) searchScope(r *http.Request, sc x.SearchScope, where *SearchExpr) ([]File, error) {
+	u, err := r.URL.Parse(sc.Href)
+	if err != nil {
+		return nil, ErrorBadSearchScope.WithCause(err)
+	}
+	root, ok := s.trimPrefix(u.Path)
+	if !ok {
+		return nil, ErrorBadSearchScope
+	}
+	if _, ok := s.dropBoxFor(root); ok {
+		return nil, ErrorDropBox
+	}
+	depth := -1
+	if sc.Depth != "" {
+		if depth, err = davhttp.ParseDepth(sc.Depth); err != nil {
+			return nil, ErrorBadSearchScope.WithCause(err)
+		}
+	}
+	if s.MaxPropfindDepth > 0 && (depth < 0 || depth > s.MaxPropfindDepth) {
+		return nil, ErrorFiniteDepth
+	}
+	if sr, ok := s.fs.(Searcher); ok {
+		return sr.Search(root, depth, where)
+	}
+
+	p, err := s.fs.ForPath(root)
+	if err != nil {
+		return nil, ErrorBadSearchScope.WithCause(err)
+	}
+	files, err := s.lookupSubtree(p, depth)
+	if err != nil {
+		return nil, ErrorBadSearchScope.WithCause(err)
+	}
+	var res []File
+	for _, f := range files {
+		if where == nil || s.matches(*where, f) {
+			res = append(res, f)
+		}
+	}
+	return res, nil
+}
+
+// listable determines if a resource found by a listing or search may be
+// reported, which hidden and virtual resources, and the members of drop
+// boxes, may not.
+func (s *WebDAV) listable(f File) bool {
+	fp := f.GetPath()
+	if _, ok := s.virtual[fp]; ok {
+		return false
+	}
+	if box, ok := s.dropBoxFor(fp); ok && fp != box {
+		return false
+	}
+	return !s.isHidden(fp, f.IsDirectory())
+}
+
+// matches evaluates a condition of a SEARCH for a resource.
+func (s *WebDAV) matches(e SearchExpr, f File) bool {
+	switch e.Op {
+	case "and":
+		for _, a := range e.Args {
+			if !s.matches(a, f) {
+				return false
+			}
+		}
+		return true
+	case "or":
+		for _, a := range e.Args {
+			if s.matches(a, f) {
+				return true
+			}
+		}
+		return false
+	case "not":
+		return !s.matches(e.Args[0], f)
+	case "is-collection":
+		return f.IsDirectory()
+	}
+
+	v, ok := s.getPropValue(e.Prop, f)
+	if !ok {
+		return false
+	}
+	switch e.Op {
+	case "is-defined":
+		return true
+	case "like":
+		return likeMatch(e.Literal, v.Value, e.Caseless)
+	}
+	c := compareValues(v.Value, e.Literal, e.Caseless)
+	switch e.Op {
+	case "eq":
+		return c == 0
+	case "lt":
+		return c < 0
+	case "lte":
+		return c <= 0
+	case "gt":
+		return c > 0
+	case "gte":
+		return c >= 0
+	}
+	return false
+}
+
+// compareValues compares property values, as numbers if both are.
+func compareValues(a, b string, caseless bool) int {
+	fa, erra := strconv.ParseFloat(strings.TrimSpace(a), 64)
+	fb, errb := strconv.ParseFloat(strings.TrimSpace(b), 64)
+	switch {
+	case erra == nil && errb == nil && fa < fb:
+		return -1
+	case erra == nil && errb == nil && fa > fb:
+		return 1
+	case erra == nil && errb == nil:
+		return 0
+	}
+	if caseless {
+		a, b = strings.ToLower(a), strings.ToLower(b)
+	}
+	return strings.Compare(a, b)
+}
+
+// likeMatch matches a value with the pattern of a like condition, in which
+// "%" matches any sequence of characters, "_" any one character, and "\"
+// escapes the character following it.
+func likeMatch(pattern, v string, caseless bool) bool {
+	var re strings.Builder
+	re.WriteString("(?s)")
+	if caseless {
+		re.WriteString("(?i)")
+	}
+	re.WriteString("^")
+	escaped := false
+	for _, c := range pattern {
+		switch {
+		case escaped:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '%':
+			re.WriteString(".*")
+		case c == '_':
+			re.WriteString(".")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	m, err := regexp.MatchString(re.String(), v)
+	return err == nil && m
+}
+
+// sortResults sorts the results of a SEARCH by the requested properties,
+// then by path, so that limits select the same results every time.
+func (s *WebDAV) sortResults(files []File, order []x.SearchOrder) {
+	values := make(map[string][]string, len(files))
+	for _, f := range files {
+		for _, o := range order {
+			v, _ := s.getPropValue(o.Prop, f)
+			values[f.GetPath()] = append(values[f.GetPath()], v.Value)
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		vi, vj := values[files[i].GetPath()], values[files[j].GetPath()]
+		for k, o := range order {
+			c := compareValues(vi[k], vj[k], false)
+			if o.Descending {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return files[i].GetPath() < files[j].GetPath()
+	})
+}
@@ -0,0 +1,120 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+// searchFS wraps a FileSystem, answering every search with the same file,
+// as if from an index.
+type searchFS struct {
+	webdav.FileSystem
+	queries int
+}
+
+func (fs *searchFS) Search(root string, depth int, where *webdav.SearchExpr) ([]webdav.File, error) {
+	fs.queries++
+	p, err := fs.ForPath("/docs/b.TXT")
+	if err != nil {
+		return nil, err
+	}
+	f, err := p.Lookup()
+	if err != nil {
+		return nil, err
+	}
+	return []webdav.File{f}, nil
+}
+
+var hrefRE = regexp.MustCompile(`<href>([^<]*)</href>`)
+
+func searchHrefs(t *testing.T, h http.Handler, where, extra string) []string {
+	t.Helper()
+	body := `<?xml version="1.0"?>
+<D:searchrequest xmlns:D="DAV:">
+  <D:basicsearch>
+    <D:select><D:prop><D:getcontentlength/></D:prop></D:select>
+    <D:from><D:scope><D:href>/docs</D:href><D:depth>infinity</D:depth></D:scope></D:from>
+    ` + where + extra + `
+  </D:basicsearch>
+</D:searchrequest>`
+	w := serve(h, "SEARCH", "/", body, "Content-Type", "text/xml")
+	if w.Code != webdav.StatusMulti {
+		t.Fatalf("SEARCH got %d:\n%s", w.Code, w.Body)
+	}
+	var hrefs []string
+	for _, m := range hrefRE.FindAllStringSubmatch(w.Body.String(), -1) {
+		hrefs = append(hrefs, m[1])
+	}
+	return hrefs
+}
+
+func TestSearch(t *testing.T) {
+	fs := memfs.NewMemFS()
+	s := webdav.NewWebDAV(fs)
+	serve(s, "MKCOL", "/docs", "")
+	serve(s, "MKCOL", "/docs/sub", "")
+	serve(s, "PUT", "/docs/a.txt", "aaa")
+	serve(s, "PUT", "/docs/b.TXT", "bbbbbbbbbb")
+	serve(s, "PUT", "/docs/sub/c.txt", "cccccc")
+	serve(s, "PUT", "/docs/d.md", "d")
+	serve(s, "PUT", "/other.txt", "o")
+
+	for _, tc := range []struct {
+		where, extra string
+		want         string
+	}{
+		{"", "", "/docs /docs/a.txt /docs/b.TXT /docs/d.md /docs/sub /docs/sub/c.txt"},
+		{`<D:where><D:like caseless="yes"><D:prop><D:displayname/></D:prop><D:literal>%.txt</D:literal></D:like></D:where>`,
+			`<D:orderby><D:order><D:prop><D:getcontentlength/></D:prop><D:descending/></D:order></D:orderby>`,
+			"/docs/b.TXT /docs/sub/c.txt /docs/a.txt"},
+		{`<D:where><D:like><D:prop><D:displayname/></D:prop><D:literal>%.txt</D:literal></D:like></D:where>`,
+			`<D:limit><D:nresults>1</D:nresults></D:limit>`,
+			"/docs/a.txt"},
+		{`<D:where><D:and><D:not><D:is-collection/></D:not><D:lt><D:prop><D:getcontentlength/></D:prop><D:literal>5</D:literal></D:lt></D:and></D:where>`,
+			`<D:orderby><D:order><D:prop><D:displayname/></D:prop></D:order></D:orderby>`,
+			"/docs/a.txt /docs/d.md"},
+		{`<D:where><D:eq><D:prop><D:getcontentlength/></D:prop><D:literal>6</D:literal></D:eq></D:where>`, "", "/docs/sub/c.txt"},
+	} {
+		got := searchHrefs(t, s, tc.where, tc.extra)
+		if tc.extra == "" {
+			sort.Strings(got)
+		}
+		if strings.Join(got, " ") != tc.want {
+			t.Errorf("SEARCH where %s%s got %v, want %s", tc.where, tc.extra, got, tc.want)
+		}
+	}
+
+	if w := serve(s, "SEARCH", "/", `<D:searchrequest xmlns:D="DAV:"><D:basicsearch><D:from><D:scope><D:href>/</D:href></D:scope></D:from><D:where><D:near/></D:where></D:basicsearch></D:searchrequest>`); w.Code != http.StatusBadRequest {
+		t.Errorf("SEARCH with an unsupported operator got %d", w.Code)
+	}
+	if w := serve(s, "OPTIONS", "/", ""); w.Header().Get("DASL") != "<DAV:basicsearch>" {
+		t.Errorf("OPTIONS got DASL %q", w.Header().Get("DASL"))
+	}
+
+	// FileSystems implementing Searcher run the queries.
+	sfs := &searchFS{FileSystem: fs}
+	got := searchHrefs(t, webdav.NewWebDAV(sfs), "", "")
+	if sfs.queries != 1 || strings.Join(got, " ") != "/docs/b.TXT" {
+		t.Errorf("SEARCH of a Searcher got %v after %d queries", got, sfs.queries)
+	}
+}
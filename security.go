@@ -0,0 +1,125 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// SecurityError lists the problems found by CheckSecurity.
+type SecurityError []string
+
+func (e SecurityError) Error() string {
+	return "insecure configuration: " + strings.Join(e, "; ")
+}
+
+// CheckSecurity reviews the configuration of a handler to be served on the
+// given address, such as ":8080", reporting dangerous combinations of
+// settings as a SecurityError. It is intended to be called before starting
+// to serve, so that configuration mistakes surface early; in Hardened mode
+// the handler also refuses requests while it fails.
+func (s *WebDAV) CheckSecurity(addr string) error {
+	var problems SecurityError
+	if !s.Authenticated && !s.ReadOnly {
+		problems = append(problems, "writable without authentication")
+	}
+	if s.dumpEnabled() && !isLoopback(addr) {
+		problems = append(problems, "debug endpoints exposed on "+addr)
+	}
+	if s.MaxPropfindDepth == 0 {
+		problems = append(problems, "infinite-depth PROPFIND is unlimited")
+	}
+	if problems != nil {
+		return problems
+	}
+	return nil
+}
+
+// dumpEnabled determines if the debug endpoints are served by the handler
+// itself. /dumpz reveals every lock token and property value, so they are
+// only served when debugging, otherwise see DebugHandler.
+func (s *WebDAV) dumpEnabled() bool {
+	return s.Debug
+}
+
+// isLoopback determines if a listening address is only reachable from the
+// local host. Addresses without a host listen on all interfaces.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// checkHardened applies Hardened mode to a request, checking the
+// configuration against the address the request was received on.
+func (s *WebDAV) checkHardened(r *http.Request) error {
+	var addr string
+	if a, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		addr = a.String()
+	}
+	return s.CheckSecurity(addr)
+}
+
+var readOnlyMethods = map[string]bool{
+	"OPTIONS":     true,
+	"GET":         true,
+	"HEAD":        true,
+	"POST":        true,
+	"PROPFIND":    true,
+	"REPORT":      true,
+	"SEARCH":      true,
+	"SUBSCRIBE":   true,
+	"POLL":        true,
+	"UNSUBSCRIBE": true,
+}
+
+// methodOverrideHeaders are used by some frameworks to tunnel a method
+// through POST. Proxies in front of the handler may authorize requests by
+// their actual method, so honoring these would bypass them.
+var methodOverrideHeaders = []string{
+	"X-HTTP-Method-Override",
+	"X-HTTP-Method",
+	"X-Method-Override",
+}
+
+// checkFraming refuses requests carrying a method override, or whose body
+// length could be interpreted differently by the handler and a proxy.
+func checkFraming(r *http.Request) error {
+	for _, h := range methodOverrideHeaders {
+		if len(r.Header.Values(h)) > 0 {
+			return ErrorBadRequest.WithCause(fmt.Errorf("method override %s", h))
+		}
+	}
+	cl := r.Header.Values("Content-Length")
+	if len(cl) > 0 && (len(r.TransferEncoding) > 0 || r.Header.Get("Transfer-Encoding") != "") {
+		return ErrorBadRequest.WithCause(errors.New("both Transfer-Encoding and Content-Length"))
+	}
+	for i := 1; i < len(cl); i++ {
+		if cl[i] != cl[0] {
+			return ErrorBadRequest.WithCause(errors.New("conflicting Content-Length"))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+func TestCheckSecurity(t *testing.T) {
+	safe := []webdav.Option{webdav.WithAuthenticated(), webdav.WithLimits(webdav.Limits{MaxPropfindDepth: 10})}
+	for _, tc := range []struct {
+		name string
+		opts []webdav.Option
+		addr string
+		want string
+	}{
+		{"safe", safe, ":8080", ""},
+		{"unauthenticated", []webdav.Option{webdav.WithLimits(webdav.Limits{MaxPropfindDepth: 10})}, ":8080", "writable without authentication"},
+		{"read-only", []webdav.Option{webdav.WithReadOnly(), webdav.WithLimits(webdav.Limits{MaxPropfindDepth: 10})}, ":8080", ""},
+		{"debug", append(safe, webdav.WithDebug()), ":8080", "debug endpoints exposed"},
+		{"debug on loopback", append(safe, webdav.WithDebug()), "127.0.0.1:8080", ""},
+		{"unlimited depth", []webdav.Option{webdav.WithAuthenticated()}, ":8080", "infinite-depth PROPFIND"},
+	} {
+		err := webdav.NewWebDAV(memfs.NewMemFS(), tc.opts...).CheckSecurity(tc.addr)
+		switch {
+		case tc.want == "" && err != nil:
+			t.Errorf("%s: CheckSecurity got %v, want nil", tc.name, err)
+		case tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)):
+			t.Errorf("%s: CheckSecurity got %v, want %q", tc.name, err, tc.want)
+		}
+	}
+}
+
+// hardenedRequest serves a request as if received on the given address.
+func hardenedRequest(h http.Handler, addr, method, path string, hdr ...string) int {
+	r := httptest.NewRequest(method, path, nil)
+	local := &net.TCPAddr{IP: net.ParseIP(addr), Port: 8080}
+	r = r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, local))
+	for i := 0; i+1 < len(hdr); i += 2 {
+		r.Header.Set(hdr[i], hdr[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestHardened(t *testing.T) {
+	h := webdav.NewWebDAV(memfs.NewMemFS(), webdav.WithHardened(), webdav.WithEventStream(),
+		webdav.WithLimits(webdav.Limits{MaxPropfindDepth: 10}))
+	for _, hdr := range [][]string{nil, {"Accept", "text/event-stream"}} {
+		if code := hardenedRequest(h, "192.0.2.1", "GET", "/", hdr...); code != http.StatusServiceUnavailable {
+			t.Errorf("GET %v of an unsafe configuration got %d, want 503", hdr, code)
+		}
+	}
+
+	h.Authenticated = true
+	if code := hardenedRequest(h, "192.0.2.1", "PROPFIND", "/", "Depth", "0"); code != webdav.StatusMulti {
+		t.Errorf("PROPFIND of a safe configuration got %d", code)
+	}
+	h.Debug = true
+	if code := hardenedRequest(h, "192.0.2.1", "PROPFIND", "/", "Depth", "0"); code != http.StatusServiceUnavailable {
+		t.Errorf("PROPFIND with debug endpoints exposed got %d, want 503", code)
+	}
+	if code := hardenedRequest(h, "127.0.0.1", "PROPFIND", "/", "Depth", "0"); code != webdav.StatusMulti {
+		t.Errorf("PROPFIND with debug endpoints on loopback got %d", code)
+	}
+}
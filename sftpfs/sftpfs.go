@@ -0,0 +1,651 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package sftpfs implements webdav.FileSystem over a directory of an SFTP
+server, so that it can be fronted with WebDAV.
+
+The server is reached through a Client, which a *sftp.Client of
+github.com/pkg/sftp satisfies once its OpenFile is adapted to return a
+File:
+
+	type client struct{ *sftp.Client }
+
+	func (c client) OpenFile(p string, flag int) (sftpfs.File, error) {
+		f, err := c.Client.OpenFile(p, flag)
+		if err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+
+Content is streamed to and from the server as clients read and write it,
+and never buffered in full. As SFTP has no server side copy, COPY streams
+the content through the handler.
+
+Errors of the server are translated with webdav.FromOSError, so that, for
+example, SSH_FX_PERMISSION_DENIED is reported as Forbidden and
+SSH_FX_NO_SUCH_FILE as Not Found. Dead properties are stored as JSON in
+sidecar files, as in osfs, within directories named PropsDir which are
+hidden from clients.
+*/
+package sftpfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	w "github.com/google/go-webdav"
+)
+
+// PropsDir is the name of the directories holding dead properties.
+const PropsDir = ".davprops"
+
+// File is an open file of the SFTP server.
+type File interface {
+	io.Reader
+	io.Writer
+	io.Seeker
+	io.Closer
+	Stat() (os.FileInfo, error)
+}
+
+// Client is a connection to an SFTP server. Paths are absolute paths of
+// the server.
+type Client interface {
+	Stat(p string) (os.FileInfo, error)
+	ReadDir(p string) ([]os.FileInfo, error)
+	OpenFile(p string, flag int) (File, error)
+	Mkdir(p string) error
+	Remove(p string) error
+	RemoveDirectory(p string) error
+	// PosixRename renames a file, replacing any file at the new path, as
+	// with the posix-rename@openssh.com extension.
+	PosixRename(oldname, newname string) error
+}
+
+// FS is a webdav.FileSystem serving a directory of an SFTP server.
+type FS struct {
+	c    Client
+	root string
+
+	// m serializes changes to properties and the structure of the tree,
+	// so that sidecar files stay with the resources they describe.
+	m sync.Mutex
+}
+
+var _ w.FileSystem = &FS{}
+
+// New creates a FileSystem serving the given directory of the server,
+// which must exist.
+func New(c Client, root string) (*FS, error) {
+	root = path.Clean("/" + root)
+	fi, err := c.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, errors.New("sftpfs: " + root + " is not a directory")
+	}
+	return &FS{c: c, root: root}, nil
+}
+
+// ForPath implements webdav.FileSystem. Paths addressing PropsDir are
+// refused.
+func (fs *FS) ForPath(p string) (w.Path, error) {
+	p = path.Clean("/" + p)
+	for _, seg := range strings.Split(p, "/") {
+		if seg == PropsDir {
+			return nil, w.ErrorForbidden
+		}
+	}
+	return &spath{fs: fs, p: p}, nil
+}
+
+// Dump implements webdav.FileSystem.
+func (fs *FS) Dump(out io.Writer, format w.DumpFormat) error {
+	p := &spath{fs: fs, p: "/"}
+	files, err := p.LookupSubtree(-1)
+	if err != nil {
+		return err
+	}
+	var entries []w.DumpEntry
+	for _, f := range files {
+		sf := f.(*sfile)
+		fi, err := sf.Stat()
+		if err != nil {
+			continue
+		}
+		e := w.DumpEntry{
+			Path:     sf.p,
+			Dir:      sf.dir,
+			Size:     fi.Size,
+			Modified: fi.LastModified,
+		}
+		if props, err := fs.readProps(sf.p); err == nil && len(props) > 0 {
+			e.Props = props
+		}
+		entries = append(entries, e)
+	}
+	return w.WriteDump(out, format, entries)
+}
+
+// remote maps a webdav path to a path of the server.
+func (fs *FS) remote(p string) string {
+	return path.Join(fs.root, p)
+}
+
+// propsFile gets the path of the server of the sidecar file holding the
+// properties of a path, the root's properties are kept in a file without a
+// name.
+func (fs *FS) propsFile(p string) string {
+	if p == "/" {
+		return fs.remote(path.Join(PropsDir, ".props"))
+	}
+	return fs.remote(path.Join(path.Dir(p), PropsDir, path.Base(p)+".props"))
+}
+
+func (fs *FS) readProps(p string) (map[string]string, error) {
+	props := make(map[string]string)
+	f, err := fs.c.OpenFile(fs.propsFile(p), os.O_RDONLY)
+	if errors.Is(err, os.ErrNotExist) {
+		return props, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(&props); err != nil {
+		return nil, err
+	}
+	return props, nil
+}
+
+func (fs *FS) writeProps(p string, props map[string]string) error {
+	pf := fs.propsFile(p)
+	if len(props) == 0 {
+		if err := fs.c.Remove(pf); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	b, err := json.Marshal(props)
+	if err != nil {
+		return err
+	}
+	if err := fs.mkPropsDir(pf); err != nil {
+		return err
+	}
+	f, err := fs.c.OpenFile(pf, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// mkPropsDir creates the directory of a sidecar file if it is missing.
+func (fs *FS) mkPropsDir(pf string) error {
+	d := path.Dir(pf)
+	if _, err := fs.c.Stat(d); err == nil {
+		return nil
+	}
+	return fs.c.Mkdir(d)
+}
+
+// moveProps moves the properties of a path along with it.
+func (fs *FS) moveProps(src, dst string) error {
+	if _, err := fs.c.Stat(fs.propsFile(src)); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err := fs.mkPropsDir(fs.propsFile(dst)); err != nil {
+		return err
+	}
+	return fs.c.PosixRename(fs.propsFile(src), fs.propsFile(dst))
+}
+
+// copyProps copies the properties of a path to another.
+func (fs *FS) copyProps(src, dst string) error {
+	props, err := fs.readProps(src)
+	if err != nil {
+		return err
+	}
+	return fs.writeProps(dst, props)
+}
+
+// readDir gets the entries of a directory, sorted by name and without
+// PropsDir.
+func (fs *FS) readDir(p string) ([]os.FileInfo, error) {
+	entries, err := fs.c.ReadDir(fs.remote(p))
+	if err != nil {
+		return nil, err
+	}
+	res := entries[:0]
+	for _, e := range entries {
+		if e.Name() != PropsDir {
+			res = append(res, e)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name() < res[j].Name() })
+	return res, nil
+}
+
+func (fs *FS) lookup(p string) (*sfile, error) {
+	fi, err := fs.c.Stat(fs.remote(p))
+	if err != nil {
+		return nil, w.FromOSError(err)
+	}
+	return &sfile{fs: fs, p: p, dir: fi.IsDir()}, nil
+}
+
+// removeAll removes a file or a directory and its members.
+func (fs *FS) removeAll(p string, dir bool) error {
+	if !dir {
+		return fs.c.Remove(fs.remote(p))
+	}
+	entries, err := fs.c.ReadDir(fs.remote(p))
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := fs.removeAll(path.Join(p, e.Name()), e.IsDir()); err != nil {
+			return err
+		}
+	}
+	return fs.c.RemoveDirectory(fs.remote(p))
+}
+
+type spath struct {
+	fs *FS
+	p  string
+}
+
+func (p *spath) String() string {
+	return p.p
+}
+
+func (p *spath) Parent() w.Path {
+	return &spath{fs: p.fs, p: path.Dir(p.p)}
+}
+
+func (p *spath) Lookup() (w.File, error) {
+	return p.fs.lookup(p.p)
+}
+
+func (p *spath) LookupSubtree(depth int) ([]w.File, error) {
+	f, err := p.fs.lookup(p.p)
+	if err != nil {
+		return nil, err
+	}
+	return p.fs.subtree(f, depth)
+}
+
+// subtree lists f and its members to the given depth, using the file
+// information of directory listings rather than a Stat per member.
+func (fs *FS) subtree(f *sfile, depth int) ([]w.File, error) {
+	files := []w.File{f}
+	if !f.dir || depth == 0 {
+		return files, nil
+	}
+	entries, err := fs.readDir(f.p)
+	if err != nil {
+		return nil, w.FromOSError(err)
+	}
+	for _, e := range entries {
+		cf := &sfile{fs: fs, p: path.Join(f.p, e.Name()), dir: e.IsDir()}
+		sub, err := fs.subtree(cf, depth-1)
+		if err != nil {
+			// Entries may vanish while listing.
+			continue
+		}
+		files = append(files, sub...)
+	}
+	return files, nil
+}
+
+func (p *spath) Mkdir() (w.File, error) {
+	p.fs.m.Lock()
+	defer p.fs.m.Unlock()
+	if _, err := p.fs.lookup(p.p); err == nil {
+		return nil, w.ErrorConflict
+	}
+	if f, err := p.fs.lookup(path.Dir(p.p)); err != nil || !f.dir {
+		return nil, w.ErrorMissingParent
+	}
+	if err := p.fs.c.Mkdir(p.fs.remote(p.p)); err != nil {
+		return nil, w.FromOSError(err)
+	}
+	return &sfile{fs: p.fs, p: p.p, dir: true}, nil
+}
+
+func (p *spath) Create() (w.File, w.FileHandle, error) {
+	p.fs.m.Lock()
+	defer p.fs.m.Unlock()
+	if _, err := p.fs.lookup(p.p); err == nil {
+		return nil, nil, w.ErrorConflict
+	}
+	if f, err := p.fs.lookup(path.Dir(p.p)); err != nil || !f.dir {
+		return nil, nil, w.ErrorMissingParent
+	}
+	fh, err := p.fs.c.OpenFile(p.fs.remote(p.p), os.O_RDWR|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return nil, nil, w.FromOSError(err)
+	}
+	return &sfile{fs: p.fs, p: p.p}, writeHandle{fh}, nil
+}
+
+func (p *spath) Remove() error {
+	p.fs.m.Lock()
+	defer p.fs.m.Unlock()
+	f, err := p.fs.lookup(p.p)
+	if err != nil {
+		return err
+	}
+	if f.dir {
+		return w.ErrorIsDir
+	}
+	if err := p.fs.c.Remove(p.fs.remote(p.p)); err != nil {
+		return w.FromOSError(err)
+	}
+	return p.fs.writeProps(p.p, nil)
+}
+
+func (p *spath) RecursiveRemove() map[string]error {
+	p.fs.m.Lock()
+	defer p.fs.m.Unlock()
+	errs := make(map[string]error)
+	f, err := p.fs.lookup(p.p)
+	if err != nil {
+		errs[p.p] = err
+		return errs
+	}
+	if !f.dir {
+		errs[p.p] = w.ErrorIsNotDir
+		return errs
+	}
+	if p.p == "/" {
+		errs[p.p] = w.ErrorForbidden
+		return errs
+	}
+	if err := p.fs.removeAll(p.p, true); err != nil {
+		errs[p.p] = w.FromOSError(err)
+		return errs
+	}
+	if err := p.fs.writeProps(p.p, nil); err != nil {
+		errs[p.p] = err
+	}
+	return errs
+}
+
+func (p *spath) CopyTo(dst w.Path, opt w.CopyOptions) (bool, error) {
+	dstp, ok := dst.(*spath)
+	if !ok || dstp.fs != p.fs {
+		return false, w.ErrorBadHost
+	}
+	if p.p == dstp.p {
+		return false, w.ErrorSameFile
+	}
+	if strings.HasPrefix(dstp.p, strings.TrimSuffix(p.p, "/")+"/") {
+		// A collection cannot be copied or moved into itself.
+		return false, w.ErrorForbidden
+	}
+
+	p.fs.m.Lock()
+	defer p.fs.m.Unlock()
+
+	src, err := p.fs.lookup(p.p)
+	if err != nil {
+		return false, w.ErrorNotFound
+	}
+	// Can only move complete directory trees.
+	if src.dir && opt.Move && opt.Depth >= 0 {
+		return false, w.ErrorIsDir
+	}
+	if f, err := p.fs.lookup(path.Dir(dstp.p)); err != nil || !f.dir {
+		return false, w.ErrorMissingParent
+	}
+
+	created := true
+	if f, err := p.fs.lookup(dstp.p); err == nil {
+		if !opt.Overwrite {
+			return false, w.ErrorDestExists
+		}
+		created = false
+		if err := p.fs.removeAll(dstp.p, f.dir); err != nil {
+			return false, w.FromOSError(err)
+		}
+		if err := p.fs.writeProps(dstp.p, nil); err != nil {
+			return false, err
+		}
+	}
+
+	if opt.Move {
+		if err := p.fs.c.PosixRename(p.fs.remote(p.p), p.fs.remote(dstp.p)); err != nil {
+			return false, w.FromOSError(err)
+		}
+		return created, p.fs.moveProps(p.p, dstp.p)
+	}
+	return created, p.fs.copyTree(p.p, dstp.p, src.dir, opt.Depth)
+}
+
+// copyTree copies a file, or a directory and its members to the given
+// depth, along with their properties.
+func (fs *FS) copyTree(src, dst string, dir bool, depth int) error {
+	if !dir {
+		if err := fs.copyFile(src, dst); err != nil {
+			return err
+		}
+		return fs.copyProps(src, dst)
+	}
+
+	if err := fs.c.Mkdir(fs.remote(dst)); err != nil {
+		return w.FromOSError(err)
+	}
+	if err := fs.copyProps(src, dst); err != nil {
+		return err
+	}
+	if depth == 0 {
+		return nil
+	}
+	entries, err := fs.readDir(src)
+	if err != nil {
+		return w.FromOSError(err)
+	}
+	for _, e := range entries {
+		err := fs.copyTree(path.Join(src, e.Name()), path.Join(dst, e.Name()), e.IsDir(), depth-1)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fs *FS) copyFile(src, dst string) error {
+	in, err := fs.c.OpenFile(fs.remote(src), os.O_RDONLY)
+	if err != nil {
+		return w.FromOSError(err)
+	}
+	defer in.Close()
+	out, err := fs.c.OpenFile(fs.remote(dst), os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return w.FromOSError(err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return w.FromOSError(err)
+	}
+	return w.FromOSError(out.Close())
+}
+
+type sfile struct {
+	fs  *FS
+	p   string
+	dir bool
+}
+
+var _ w.PropLister = &sfile{}
+
+func (f *sfile) GetPath() string {
+	return f.p
+}
+
+func (f *sfile) IsDirectory() bool {
+	return f.dir
+}
+
+// Stat implements webdav.File. SFTP does not report creation times, so the
+// modification time is reported instead, and directories have no size.
+func (f *sfile) Stat() (w.FileInfo, error) {
+	fi, err := f.fs.c.Stat(f.fs.remote(f.p))
+	if err != nil {
+		return w.FileInfo{}, w.FromOSError(err)
+	}
+	return fileInfo(fi), nil
+}
+
+func fileInfo(fi os.FileInfo) w.FileInfo {
+	info := w.FileInfo{
+		Created:      fi.ModTime(),
+		LastModified: fi.ModTime(),
+	}
+	if !fi.IsDir() {
+		info.Size = fi.Size()
+	}
+	return info
+}
+
+func (f *sfile) Open() (w.FileHandle, error) {
+	if f.dir {
+		return &dirHandle{}, nil
+	}
+	fh, err := f.fs.c.OpenFile(f.fs.remote(f.p), os.O_RDONLY)
+	if err != nil {
+		return nil, w.FromOSError(err)
+	}
+	if _, ok := fh.(io.ReaderAt); ok {
+		return readerAtHandle{readOnlyHandle{fh}}, nil
+	}
+	return readOnlyHandle{fh}, nil
+}
+
+func (f *sfile) Truncate() (w.FileHandle, error) {
+	if f.dir {
+		return nil, w.ErrorIsDir
+	}
+	fh, err := f.fs.c.OpenFile(f.fs.remote(f.p), os.O_RDWR|os.O_TRUNC)
+	if err != nil {
+		return nil, w.FromOSError(err)
+	}
+	return writeHandle{fh}, nil
+}
+
+func (f *sfile) PatchProp(set, remove map[string]string) error {
+	f.fs.m.Lock()
+	defer f.fs.m.Unlock()
+	props, err := f.fs.readProps(f.p)
+	if err != nil {
+		return err
+	}
+	for k, v := range set {
+		props[k] = v
+	}
+	for k := range remove {
+		delete(props, k)
+	}
+	return f.fs.writeProps(f.p, props)
+}
+
+func (f *sfile) GetProp(k string) (string, bool) {
+	props, err := f.fs.readProps(f.p)
+	if err != nil {
+		return "", false
+	}
+	v, ok := props[k]
+	return v, ok
+}
+
+func (f *sfile) PropNames() []string {
+	props, err := f.fs.readProps(f.p)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for k := range props {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var errReadOnly = errors.New("sftpfs: file opened for reading")
+
+// readOnlyHandle is a file opened for reading, refusing writes.
+type readOnlyHandle struct {
+	File
+}
+
+func (h readOnlyHandle) Write([]byte) (int, error) {
+	return 0, errReadOnly
+}
+
+// readerAtHandle is a file opened for reading which implements
+// io.ReaderAt, as those of github.com/pkg/sftp do, so that ranges are
+// read without seeking.
+type readerAtHandle struct {
+	readOnlyHandle
+}
+
+func (h readerAtHandle) ReadAt(p []byte, off int64) (int, error) {
+	return h.File.(io.ReaderAt).ReadAt(p, off)
+}
+
+// writeHandle is a file opened for writing.
+type writeHandle struct {
+	File
+}
+
+// Commit implements webdav.Committer, getting the FileInfo of the open
+// file with an fstat, which is that written even if the file was replaced
+// since.
+func (h writeHandle) Commit() (w.FileInfo, error) {
+	fi, err := h.File.Stat()
+	if err != nil {
+		h.File.Close()
+		return w.FileInfo{}, w.FromOSError(err)
+	}
+	return fileInfo(fi), w.FromOSError(h.File.Close())
+}
+
+// dirHandle is the empty content of a directory.
+type dirHandle struct {
+	bytes.Reader
+}
+
+func (h *dirHandle) Write([]byte) (int, error) {
+	return 0, w.ErrorIsDir
+}
+
+func (h *dirHandle) Close() error {
+	return nil
+}
@@ -0,0 +1,202 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sftpfs
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	w "github.com/google/go-webdav"
+	"github.com/google/go-webdav/fstest"
+)
+
+// localClient is a Client over a local directory standing in for the
+// server, failing with denied for the paths of denied.
+type localClient struct {
+	dir    string
+	denied map[string]bool
+}
+
+// denied is how github.com/pkg/sftp reports SSH_FX_PERMISSION_DENIED.
+var denied = &os.PathError{Op: "sftp", Err: os.ErrPermission}
+
+func (c *localClient) local(p string) (string, error) {
+	if c.denied[p] {
+		return "", denied
+	}
+	return filepath.Join(c.dir, filepath.FromSlash(p)), nil
+}
+
+func (c *localClient) Stat(p string) (os.FileInfo, error) {
+	lp, err := c.local(p)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(lp)
+}
+
+func (c *localClient) ReadDir(p string) ([]os.FileInfo, error) {
+	lp, err := c.local(p)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(lp)
+	var res []os.FileInfo
+	for _, e := range entries {
+		if fi, err := e.Info(); err == nil {
+			res = append(res, fi)
+		}
+	}
+	return res, err
+}
+
+func (c *localClient) OpenFile(p string, flag int) (File, error) {
+	lp, err := c.local(p)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(lp, flag, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (c *localClient) Mkdir(p string) error {
+	lp, err := c.local(p)
+	if err != nil {
+		return err
+	}
+	return os.Mkdir(lp, 0o755)
+}
+
+func (c *localClient) Remove(p string) error {
+	lp, err := c.local(p)
+	if err != nil {
+		return err
+	}
+	return os.Remove(lp)
+}
+
+func (c *localClient) RemoveDirectory(p string) error {
+	return c.Remove(p)
+}
+
+func (c *localClient) PosixRename(oldname, newname string) error {
+	lo, err := c.local(oldname)
+	if err != nil {
+		return err
+	}
+	ln, err := c.local(newname)
+	if err != nil {
+		return err
+	}
+	return os.Rename(lo, ln)
+}
+
+func newFS(t *testing.T) (*FS, *localClient) {
+	c := &localClient{dir: t.TempDir(), denied: make(map[string]bool)}
+	if err := os.Mkdir(filepath.Join(c.dir, "srv"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := New(c, "/srv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs, c
+}
+
+func TestFiles(t *testing.T) {
+	fs, c := newFS(t)
+	h := w.NewWebDAV(fs)
+	do := func(method, p, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, p, strings.NewReader(body))
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, r)
+		return rw
+	}
+
+	if rw := do("MKCOL", "/d", ""); rw.Code != http.StatusCreated {
+		t.Fatalf("MKCOL got %d", rw.Code)
+	}
+	if rw := do("PUT", "/d/a.txt", "hello"); rw.Code != http.StatusCreated {
+		t.Fatalf("PUT got %d", rw.Code)
+	}
+	if b, _ := os.ReadFile(filepath.Join(c.dir, "srv", "d", "a.txt")); string(b) != "hello" {
+		t.Errorf("file on the server holds %q, want \"hello\"", b)
+	}
+	if rw := do("GET", "/d/a.txt", ""); rw.Body.String() != "hello" {
+		t.Errorf("GET got %q, want \"hello\"", rw.Body.String())
+	}
+	if rw := do("DELETE", "/d", ""); rw.Code != http.StatusNoContent {
+		t.Errorf("DELETE got %d", rw.Code)
+	}
+	if _, err := os.Stat(filepath.Join(c.dir, "srv", "d")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("directory remains on the server: %v", err)
+	}
+}
+
+func TestPermissionDenied(t *testing.T) {
+	fs, c := newFS(t)
+	wp, _ := fs.ForPath("/a")
+	_, fh, err := wp.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(fh, "a")
+	fh.Close()
+
+	c.denied["/srv/a"] = true
+	if _, err := wp.Lookup(); !errors.Is(err, w.ErrorForbidden) {
+		t.Errorf("Lookup got %v, want ErrorForbidden", err)
+	}
+	c.denied["/srv/b"] = true
+	wp, _ = fs.ForPath("/b")
+	if _, err := wp.Mkdir(); !errors.Is(err, w.ErrorForbidden) {
+		t.Errorf("Mkdir got %v, want ErrorForbidden", err)
+	}
+}
+
+func TestPropsDirHidden(t *testing.T) {
+	fs, _ := newFS(t)
+	wp, _ := fs.ForPath("/a.txt")
+	f, _, err := wp.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.PatchProp(map[string]string{"urn:x:k": "v"}, nil)
+
+	if _, err := fs.ForPath("/" + PropsDir + "/a.txt.props"); err == nil {
+		t.Error("ForPath allowed addressing the properties directory")
+	}
+	root, _ := fs.ForPath("/")
+	files, _ := root.LookupSubtree(1)
+	if len(files) != 2 || files[1].GetPath() != "/a.txt" {
+		t.Errorf("LookupSubtree listed %d files", len(files))
+	}
+}
+
+func TestConformance(t *testing.T) {
+	fstest.TestFileSystem(t, func(t *testing.T) w.FileSystem {
+		fs, _ := newFS(t)
+		return fs
+	})
+}
@@ -0,0 +1,95 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// StaleLockPolicy breaks the locks of holders which seem to be gone, such
+// as clients which crashed, or keep refreshing the locks of documents left
+// open, leaving others unable to write them.
+type StaleLockPolicy struct {
+	// MaxIdle breaks the locks whose tokens have not been submitted with
+	// a write for longer, zero meaning never. Refreshing a lock does not
+	// count as using it.
+	MaxIdle time.Duration
+	// Holder, if set, identifies the holder of the locks created by a
+	// request, such as the name of its authenticated principal, which is
+	// reported as LockState.Holder.
+	Holder func(r *http.Request) string
+	// SessionEnded, if set, determines if the session of a holder has
+	// ended, such as by logging out, breaking its locks. It is called for
+	// every lock with a holder on every request, so should be cheap.
+	SessionEnded func(holder string) bool
+	// Notify publishes a ChangeUnlocked for each lock broken.
+	Notify bool
+}
+
+// WithStaleLockPolicy sets the policy for breaking stale locks. Each lock
+// broken is logged.
+func WithStaleLockPolicy(p StaleLockPolicy) Option {
+	return func(s *WebDAV) {
+		s.staleLocks = p
+	}
+}
+
+// staleReason tells why a lock is stale at now, or "" if it is not.
+func (p StaleLockPolicy) staleReason(ls LockState, now time.Time) string {
+	if idle := now.Sub(ls.Used); p.MaxIdle > 0 && idle > p.MaxIdle {
+		return fmt.Sprintf("idle for %s", idle)
+	}
+	if p.SessionEnded != nil && ls.Holder != "" && p.SessionEnded(ls.Holder) {
+		return "session ended"
+	}
+	return ""
+}
+
+// breakStaleLocks unlocks the locks found stale by the policy.
+func (s *WebDAV) breakStaleLocks() {
+	p := s.staleLocks
+	if p.MaxIdle <= 0 && p.SessionEnded == nil {
+		return
+	}
+	now := s.clock.Now()
+	for _, l := range s.lm.allLocks() {
+		ls := l.state()
+		why := p.staleReason(ls, now)
+		if why == "" {
+			continue
+		}
+		if err := s.lm.unlock(ls.Token); err != nil {
+			s.logger.Printf("breaking stale lock %s on %s: %s", ls.Token, ls.Path, err)
+			continue
+		}
+		s.logger.Printf("broke stale lock %s on %s held by %q (owner %q): %s", ls.Token, ls.Path, ls.Holder, ls.Owner, why)
+		if p.Notify {
+			s.notify(ChangeUnlocked, ls.Path, "")
+		}
+	}
+}
+
+// lockHolder records the holder of a lock created by a request, if the
+// policy identifies holders.
+func (s *WebDAV) lockHolder(l *lock, r *http.Request) {
+	if s.staleLocks.Holder == nil {
+		return
+	}
+	if err := s.lm.setHolder(l, s.staleLocks.Holder(r)); err != nil {
+		s.logger.Printf("saving lock %s: %s", l.token, err)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+func TestStaleLocks(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	ended := make(map[string]bool)
+	var logs bytes.Buffer
+	s := webdav.NewWebDAV(memfs.NewMemFS(), webdav.WithClock(clock), webdav.WithLogger(log.New(&logs, "", 0)),
+		webdav.WithStaleLockPolicy(webdav.StaleLockPolicy{
+			MaxIdle:      2 * time.Minute,
+			Holder:       func(r *http.Request) string { return r.Header.Get("X-User") },
+			SessionEnded: func(holder string) bool { return ended[holder] },
+			Notify:       true,
+		}))
+	changes, cancel := s.Subscribe("/")
+	defer cancel()
+	lock := func(p, user string) string {
+		w := serve(s, "LOCK", p, `<lockinfo xmlns="DAV:"><lockscope><exclusive/></lockscope><locktype><write/></locktype></lockinfo>`,
+			"Depth", "0", "Timeout", "Second-300", "X-User", user)
+		if w.Code != http.StatusOK {
+			t.Fatalf("LOCK %s got %d", p, w.Code)
+		}
+		return w.Header().Get("Lock-Token")
+	}
+	serve(s, "PUT", "/a", "a")
+	serve(s, "PUT", "/b", "b")
+	ta := lock("/a", "alice")
+	lock("/b", "bob")
+	if ls, _ := s.Lock(ta); ls.Holder != "alice" {
+		t.Errorf("lock holder got %q, want alice", ls.Holder)
+	}
+
+	// Writing with the token of a lock keeps it in use, but refreshing it
+	// does not.
+	clock.now = clock.now.Add(90 * time.Second)
+	if w := serve(s, "PUT", "/a", "a2", "If", "("+ta+")"); w.Code != http.StatusNoContent {
+		t.Fatalf("PUT with the lock token got %d", w.Code)
+	}
+	if w := serve(s, "LOCK", "/b", "", "If", "(<"+s.Locks()[1].Token+">)", "Timeout", "Second-300"); w.Code != http.StatusOK {
+		t.Fatalf("refreshing LOCK got %d", w.Code)
+	}
+	clock.now = clock.now.Add(time.Minute)
+	if w := serve(s, "PUT", "/b", "b2"); w.Code != http.StatusNoContent {
+		t.Errorf("PUT of a resource with an idle lock got %d", w.Code)
+	}
+	if locks := s.Locks(); len(locks) != 1 || locks[0].Path != "/a" {
+		t.Errorf("locks after breaking idle ones: %+v", locks)
+	}
+
+	ended["alice"] = true
+	if w := serve(s, "PUT", "/a", "a3"); w.Code != http.StatusNoContent {
+		t.Errorf("PUT of a resource locked by an ended session got %d", w.Code)
+	}
+	if locks := s.Locks(); len(locks) != 0 {
+		t.Errorf("locks after their holder's session ended: %+v", locks)
+	}
+
+	var unlocked []string
+	for len(changes) > 0 {
+		if c := <-changes; c.Kind == webdav.ChangeUnlocked {
+			unlocked = append(unlocked, c.Path)
+		}
+	}
+	if strings.Join(unlocked, " ") != "/b /a" {
+		t.Errorf("unlocked changes got %q, want [/b /a]", unlocked)
+	}
+	if got := strings.Count(logs.String(), "broke stale lock"); got != 2 {
+		t.Errorf("logged %d stale locks broken, want 2:\n%s", got, logs.String())
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"encoding/json"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// LockState describes a single active lock.
+type LockState struct {
+	Token string `json:"token"`
+	// Path is the root of the lock, which covers the members of a
+	// collection down to Depth, -1 meaning infinity.
+	Path   string `json:"path"`
+	Depth  int    `json:"depth"`
+	Shared bool   `json:"shared,omitempty"`
+	// Owner is the content of the owner element given by the client, as
+	// reported back in lockdiscovery.
+	Owner   string    `json:"owner"`
+	Expires time.Time `json:"expires"`
+	// LockNull is set for locks of resources created by LOCK which have
+	// not been written since, which vanish once their locks end.
+	LockNull bool `json:"lock_null,omitempty"`
+	// Holder identifies who created the lock, and Used is when its token
+	// was last submitted, see StaleLockPolicy.
+	Holder string    `json:"holder,omitempty"`
+	Used   time.Time `json:"used"`
+	// Timeout is the time the lock was granted or last refreshed for, and
+	// Remaining the time left before it expires, as of the snapshot. Both
+	// are reported in seconds by MarshalJSON.
+	Timeout   time.Duration `json:"-"`
+	Remaining time.Duration `json:"-"`
+}
+
+// MarshalJSON encodes the lock, with its timeout and remaining time in
+// whole seconds.
+func (ls LockState) MarshalJSON() ([]byte, error) {
+	type plain LockState
+	return json.Marshal(struct {
+		plain
+		Timeout   int64 `json:"timeout"`
+		Remaining int64 `json:"remaining"`
+	}{plain(ls), int64(ls.Timeout / time.Second), int64(ls.Remaining / time.Second)})
+}
+
+// Locks gets all active locks, ordered by path.
+func (s *WebDAV) Locks() []LockState {
+	return s.Snapshot().Locks
+}
+
+// Lock gets the active lock with the given token, which may be given as
+// found in the Lock-Token header.
+func (s *WebDAV) Lock(token string) (LockState, bool) {
+	token = normalizeToken(token)
+	for _, l := range s.lm.allLocks() {
+		if normalizeToken(l.token) == token {
+			return l.state(), true
+		}
+	}
+	return LockState{}, false
+}
+
+// State is a point in time snapshot of the handler, intended for making
+// assertions in tests such as no locks remaining after an UNLOCK.
+type State struct {
+	// Locks are all active locks, ordered by path.
+	Locks []LockState
+	// InFlight is the number of requests currently being served.
+	InFlight int
+	// Leniencies counts the recoveries applied to malformed requests, by
+	// name such as LenientDepth.
+	Leniencies map[string]int
+	// Panics counts the requests which panicked, answered with 500.
+	Panics int
+	// Transfers are the requests being served, see Transfers, and
+	// SlowClients counts those cut off by the TransferPolicy.
+	Transfers   []Transfer
+	SlowClients int
+}
+
+// Snapshot captures the current state of the handler.
+func (s *WebDAV) Snapshot() State {
+	st := State{
+		InFlight:    int(atomic.LoadInt32(&s.inFlight)),
+		Leniencies:  s.leniency.snapshot(),
+		Panics:      int(atomic.LoadInt64(&s.panics)),
+		Transfers:   s.Transfers(),
+		SlowClients: int(atomic.LoadInt64(&s.slowClients)),
+	}
+	for _, l := range s.lm.allLocks() {
+		st.Locks = append(st.Locks, l.state())
+	}
+	sort.Sort(byLockPath(st.Locks))
+	return st
+}
+
+// state describes a lock.
+func (l *lock) state() LockState {
+	l.m.Lock()
+	defer l.m.Unlock()
+	expires := l.modified.Add(l.duration)
+	remaining := expires.Sub(l.clock.Now())
+	if remaining < 0 {
+		remaining = 0
+	}
+	return LockState{
+		Token:     l.token,
+		Path:      l.path,
+		Depth:     l.depth,
+		Shared:    l.shared,
+		Owner:     l.owner,
+		Expires:   expires,
+		LockNull:  l.null,
+		Holder:    l.holder,
+		Used:      l.used,
+		Timeout:   l.duration,
+		Remaining: remaining,
+	}
+}
+
+type byLockPath []LockState
+
+func (b byLockPath) Len() int           { return len(b) }
+func (b byLockPath) Less(i, j int) bool { return b[i].Path < b[j].Path }
+func (b byLockPath) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
@@ -0,0 +1,70 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+func TestLockAccessors(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := webdav.NewWebDAV(memfs.NewMemFS(), webdav.WithClock(clock))
+	serve(s, "MKCOL", "/c", "")
+	owner := `mailto:a@example.com`
+	w := serve(s, "LOCK", "/c", `<D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype><D:owner>`+owner+`</D:owner></D:lockinfo>`,
+		"Depth", "infinity", "Timeout", "Second-240")
+	if w.Code != http.StatusOK {
+		t.Fatalf("LOCK got %d", w.Code)
+	}
+	tok := w.Header().Get("Lock-Token")
+
+	clock.now = clock.now.Add(time.Minute)
+	ls, ok := s.Lock(tok)
+	if !ok {
+		t.Fatalf("Lock(%q) found no lock", tok)
+	}
+	if ls.Path != "/c" || ls.Depth != -1 || ls.Timeout != 4*time.Minute || ls.Remaining != 3*time.Minute {
+		t.Errorf("Lock got %+v", ls)
+	}
+	if ls.Owner != owner {
+		t.Errorf("Lock got owner %q", ls.Owner)
+	}
+	if locks := s.Locks(); len(locks) != 1 || locks[0].Token != ls.Token {
+		t.Errorf("Locks got %+v", locks)
+	}
+
+	b, err := json.Marshal(ls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["timeout"] != 240.0 || got["remaining"] != 180.0 || got["path"] != "/c" || got["depth"] != -1.0 {
+		t.Errorf("JSON got %s", b)
+	}
+
+	serve(s, "UNLOCK", "/c", "", "Lock-Token", tok)
+	if _, ok := s.Lock(tok); ok {
+		t.Error("Lock found a lock after UNLOCK")
+	}
+}
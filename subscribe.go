@@ -0,0 +1,324 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	wp "github.com/google/go-webdav/path"
+	x "github.com/google/go-webdav/xml"
+)
+
+// This implements the SUBSCRIBE/POLL/UNSUBSCRIBE notification dialect used
+// by Exchange and legacy Microsoft WebDAV clients. Subscriptions expire in
+// the same manner as locks, and are only ever polled, callbacks are not
+// supported. The protocol numbers subscriptions, so ids are random rather
+// than sequential, and are only honoured on the path they were made for.
+
+var (
+	minSubscriptionLifetime = time.Minute
+	maxSubscriptionLifetime = time.Hour
+)
+
+// Notification types a subscription may ask for.
+var notificationKinds = map[string][]ChangeKind{
+	"update":           {ChangeModified, ChangeProps, ChangeCreated, ChangeRemoved, ChangeMoved, ChangeCopied},
+	"update/newmember": {ChangeCreated, ChangeCopied},
+	"delete":           {ChangeRemoved},
+	"move":             {ChangeMoved},
+}
+
+type subscription struct {
+	id       int
+	path     string
+	depth    int
+	kinds    map[ChangeKind]bool
+	duration time.Duration
+	modified time.Time
+	pending  bool
+}
+
+func (sub *subscription) expired(now time.Time) bool {
+	return now.After(sub.modified.Add(sub.duration))
+}
+
+// matches determines whether the change should fire the subscription.
+func (sub *subscription) matches(c Change) bool {
+	if !sub.kinds[c.Kind] {
+		return false
+	}
+	if _, ok := wp.Included(c.Path, sub.path, sub.depth); ok {
+		return true
+	}
+	// New members are reported against their collection.
+	if c.Destination != "" {
+		_, ok := wp.Included(c.Destination, sub.path, sub.depth)
+		return ok
+	}
+	return false
+}
+
+type subscriptionmaster struct {
+	m     sync.Mutex
+	clock Clock
+	subs  map[int]*subscription
+}
+
+func newSubscriptionMaster() *subscriptionmaster {
+	return &subscriptionmaster{clock: SystemClock, subs: make(map[int]*subscription)}
+}
+
+// newID picks an unused random positive subscription id.
+func (sm *subscriptionmaster) newID() (int, error) {
+	var b [8]byte
+	for {
+		if _, err := rand.Read(b[:]); err != nil {
+			return 0, err
+		}
+		id := int(binary.BigEndian.Uint64(b[:]) >> 33)
+		if id != 0 && sm.subs[id] == nil {
+			return id, nil
+		}
+	}
+}
+
+func clampLifetime(d time.Duration) time.Duration {
+	if d < minSubscriptionLifetime {
+		return minSubscriptionLifetime
+	}
+	if d > maxSubscriptionLifetime {
+		return maxSubscriptionLifetime
+	}
+	return d
+}
+
+func (sm *subscriptionmaster) subscribe(p string, depth int, kinds []ChangeKind, d time.Duration) (*subscription, error) {
+	sm.m.Lock()
+	defer sm.m.Unlock()
+	id, err := sm.newID()
+	if err != nil {
+		return nil, err
+	}
+	sub := &subscription{
+		id:       id,
+		path:     p,
+		depth:    depth,
+		kinds:    make(map[ChangeKind]bool),
+		duration: clampLifetime(d),
+		modified: sm.clock.Now(),
+	}
+	for _, k := range kinds {
+		sub.kinds[k] = true
+	}
+	sm.subs[sub.id] = sub
+	return sub, nil
+}
+
+// get gets an active subscription made on the given path, removing it if it
+// has expired.
+func (sm *subscriptionmaster) get(id int, p string) *subscription {
+	sub := sm.subs[id]
+	if sub == nil {
+		return nil
+	}
+	if sub.expired(sm.clock.Now()) {
+		delete(sm.subs, id)
+		return nil
+	}
+	if sub.path != p {
+		return nil
+	}
+	return sub
+}
+
+func (sm *subscriptionmaster) renew(id int, p string, d time.Duration) *subscription {
+	sm.m.Lock()
+	defer sm.m.Unlock()
+	sub := sm.get(id, p)
+	if sub == nil {
+		return nil
+	}
+	sub.duration = clampLifetime(d)
+	sub.modified = sm.clock.Now()
+	return sub
+}
+
+func (sm *subscriptionmaster) unsubscribe(id int, p string) bool {
+	sm.m.Lock()
+	defer sm.m.Unlock()
+	if sm.get(id, p) == nil {
+		return false
+	}
+	delete(sm.subs, id)
+	return true
+}
+
+// poll reports which of the given subscriptions on a path have fired since
+// they were last polled, and which have not. Unknown subscriptions are
+// dropped.
+func (sm *subscriptionmaster) poll(ids []int, p string) (fired, idle []int) {
+	sm.m.Lock()
+	defer sm.m.Unlock()
+	for _, id := range ids {
+		sub := sm.get(id, p)
+		if sub == nil {
+			continue
+		}
+		if sub.pending {
+			fired = append(fired, id)
+			sub.pending = false
+		} else {
+			idle = append(idle, id)
+		}
+	}
+	return
+}
+
+func (sm *subscriptionmaster) changed(c Change) {
+	sm.m.Lock()
+	defer sm.m.Unlock()
+	now := sm.clock.Now()
+	for id, sub := range sm.subs {
+		if sub.expired(now) {
+			delete(sm.subs, id)
+			continue
+		}
+		if sub.matches(c) {
+			sub.pending = true
+		}
+	}
+}
+
+// parseSubscriptionIDs parses the comma separated Subscription-id header.
+func parseSubscriptionIDs(r *http.Request) ([]int, error) {
+	var ids []int
+	for _, v := range strings.Split(r.Header.Get("Subscription-id"), ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, ErrorBadSubscription.WithCause(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// parseSubscriptionLifetime gets the requested lifetime, defaulting to the
+// maximum permitted if none or an invalid one is specified.
+func parseSubscriptionLifetime(r *http.Request) time.Duration {
+	v, err := strconv.Atoi(r.Header.Get("Subscription-lifetime"))
+	if err != nil {
+		return maxSubscriptionLifetime
+	}
+	return time.Duration(v) * time.Second
+}
+
+func (s *WebDAV) setSubscriptionHeaders(w http.ResponseWriter, sub *subscription) {
+	w.Header().Set("Subscription-id", strconv.Itoa(sub.id))
+	w.Header().Set("Subscription-lifetime", strconv.Itoa(int(sub.duration/time.Second)))
+	w.Header().Set("Content-Location", wp.URLEncode(s.href(sub.path)))
+}
+
+func (s *WebDAV) doSubscribe(ctx context, w http.ResponseWriter, r *http.Request) {
+	lifetime := parseSubscriptionLifetime(r)
+
+	// Presenting an existing subscription renews it.
+	ids, err := parseSubscriptionIDs(r)
+	if err != nil {
+		s.errorHeader(ctx, w, err)
+		return
+	}
+	if len(ids) > 0 {
+		sub := s.sm.renew(ids[0], ctx.p.String(), lifetime)
+		if sub == nil {
+			s.errorHeader(ctx, w, ErrorBadSubscription)
+			return
+		}
+		s.setSubscriptionHeaders(w, sub)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if _, err := ctx.p.Lookup(); err != nil {
+		s.errorHeader(ctx, w, ErrorNotFound.WithCause(err))
+		return
+	}
+	kinds, ok := notificationKinds[strings.ToLower(r.Header.Get("Notification-type"))]
+	if !ok {
+		s.errorHeader(ctx, w, ErrorBadSubscription)
+		return
+	}
+	sub, err := s.sm.subscribe(ctx.p.String(), ctx.depth, kinds, lifetime)
+	if err != nil {
+		s.errorHeader(ctx, w, err)
+		return
+	}
+	s.setSubscriptionHeaders(w, sub)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *WebDAV) doPoll(ctx context, w http.ResponseWriter, r *http.Request) {
+	ids, err := parseSubscriptionIDs(r)
+	if err != nil {
+		s.errorHeader(ctx, w, err)
+		return
+	}
+	if len(ids) == 0 {
+		s.errorHeader(ctx, w, ErrorBadSubscription)
+		return
+	}
+
+	fired, idle := s.sm.poll(ids, ctx.p.String())
+	if len(fired) == 0 && len(idle) == 0 {
+		s.errorHeader(ctx, w, ErrorBadSubscription)
+		return
+	}
+	ms := x.NewMultiStatus()
+	if len(fired) > 0 {
+		ms.AddSubscriptionStatus(s.href(ctx.p.String()), "HTTP/1.1 200 OK", fired)
+	}
+	if len(idle) > 0 {
+		ms.AddSubscriptionStatus(s.href(ctx.p.String()), "HTTP/1.1 204 No Content", idle)
+	}
+	ms.Send(w)
+}
+
+func (s *WebDAV) doUnsubscribe(ctx context, w http.ResponseWriter, r *http.Request) {
+	ids, err := parseSubscriptionIDs(r)
+	if err != nil {
+		s.errorHeader(ctx, w, err)
+		return
+	}
+	found := false
+	for _, id := range ids {
+		if s.sm.unsubscribe(id, ctx.p.String()) {
+			found = true
+		}
+	}
+	if !found {
+		s.errorHeader(ctx, w, ErrorBadSubscription)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
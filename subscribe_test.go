@@ -0,0 +1,90 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+func TestSubscriptions(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	h := webdav.NewWebDAV(memfs.NewMemFS(), webdav.WithLegacyNotifications(), webdav.WithClock(clock))
+	serve(h, "MKCOL", "/d", "")
+	serve(h, "MKCOL", "/other", "")
+
+	w := serve(h, "SUBSCRIBE", "/d", "", "Notification-type", "update", "Depth", "1", "Subscription-lifetime", "120")
+	id := w.Header().Get("Subscription-id")
+	if w.Code != http.StatusOK || id == "" || w.Header().Get("Subscription-lifetime") != "120" {
+		t.Fatalf("SUBSCRIBE got %d %v", w.Code, w.Header())
+	}
+	other := serve(h, "SUBSCRIBE", "/other", "", "Notification-type", "update", "Subscription-lifetime", "60").Header().Get("Subscription-id")
+	if n, _ := strconv.Atoi(id); n < 1000 || other == id {
+		t.Errorf("subscription ids %s and %s look guessable", id, other)
+	}
+
+	// fired polls the subscription, reporting if it saw a change.
+	fired := func(id string) bool {
+		w := serve(h, "POLL", "/d", "", "Subscription-id", id)
+		return w.Code == http.StatusMultiStatus && strings.Contains(w.Body.String(), "200 OK")
+	}
+	if w := serve(h, "POLL", "/d", "", "Subscription-id", id); w.Code != http.StatusMultiStatus || !strings.Contains(w.Body.String(), "204 No Content") {
+		t.Errorf("POLL before a change got %d:\n%s", w.Code, w.Body)
+	}
+	serve(h, "PUT", "/d/a", "a")
+	if !fired(id) {
+		t.Error("POLL after a change did not report it")
+	}
+	if fired(id) {
+		t.Error("POLL reported a change twice")
+	}
+
+	// Subscriptions are only honoured on their own path.
+	serve(h, "PUT", "/d/b", "b")
+	for _, m := range []string{"POLL", "SUBSCRIBE", "UNSUBSCRIBE"} {
+		if w := serve(h, m, "/other", "", "Subscription-id", id); w.Code != http.StatusPreconditionFailed {
+			t.Errorf("%s of a subscription on another path got %d, want 412", m, w.Code)
+		}
+	}
+	if !fired(id) {
+		t.Error("POLL on another path consumed the change")
+	}
+
+	// Renewing restarts the lifetime, by the configured clock.
+	clock.now = clock.now.Add(100 * time.Second)
+	if w := serve(h, "SUBSCRIBE", "/d", "", "Subscription-id", id, "Subscription-lifetime", "120"); w.Code != http.StatusOK || w.Header().Get("Subscription-id") != id {
+		t.Errorf("renewing got %d %v", w.Code, w.Header())
+	}
+	clock.now = clock.now.Add(100 * time.Second)
+	if w := serve(h, "POLL", "/d", "", "Subscription-id", id); w.Code != http.StatusMultiStatus {
+		t.Errorf("POLL of a renewed subscription got %d", w.Code)
+	}
+	if w := serve(h, "POLL", "/other", "", "Subscription-id", other); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("POLL of an expired subscription got %d, want 412", w.Code)
+	}
+
+	if w := serve(h, "UNSUBSCRIBE", "/d", "", "Subscription-id", id); w.Code != http.StatusOK {
+		t.Errorf("UNSUBSCRIBE got %d", w.Code)
+	}
+	if w := serve(h, "POLL", "/d", "", "Subscription-id", id); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("POLL after UNSUBSCRIBE got %d, want 412", w.Code)
+	}
+}
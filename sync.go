@@ -0,0 +1,456 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	wp "github.com/google/go-webdav/path"
+	x "github.com/google/go-webdav/xml"
+)
+
+// DefaultSyncTokenWindow is the time for which sync tokens remain valid,
+// unless set with WithSyncTokens.
+const DefaultSyncTokenWindow = 7 * 24 * time.Hour
+
+// SyncState is the state of a collection as reported to a client, which a
+// sync token refers to.
+type SyncState struct {
+	Collection string    `json:"collection"`
+	Issued     time.Time `json:"issued"`
+	// Seq is the sequence number of the latest change in the journal.
+	Seq uint64 `json:"seq"`
+	// Backend is set if Seq numbers the changes of the ChangeJournal of
+	// the FileSystem, in which case Members are not kept.
+	Backend bool `json:"backend,omitempty"`
+	// Members maps the path of each member to its ETag.
+	Members map[string]string `json:"members"`
+}
+
+// ChangeJournal may optionally be implemented by a FileSystem recording
+// the changes made to it by any means, such as by other servers sharing
+// the backend, numbered as the changes of a JournalStore. Sync-collection
+// REPORTs with a sync token are then answered from the changes since it was
+// issued, without listing the collection, and report the changes made
+// behind the handler's back too.
+type ChangeJournal interface {
+	// Changes gets the changes with sequence numbers greater than seq, in
+	// order, failing with ErrJournalTruncated if they are no longer all
+	// kept.
+	Changes(seq uint64) ([]Change, error)
+	// LastChange gets the sequence number of the latest change, zero if
+	// there are none.
+	LastChange() (uint64, error)
+}
+
+// SyncTokenStore persists the states which sync tokens refer to. Clients
+// can only synchronize incrementally across restarts of the handler if the
+// store persists them.
+type SyncTokenStore interface {
+	// Save records the state a new token refers to.
+	Save(token string, st SyncState) error
+	// Load gets the state a token refers to, failing with
+	// ErrorInvalidSyncToken for unknown tokens.
+	Load(token string) (SyncState, error)
+	// Expire forgets the tokens issued before the given time.
+	Expire(before time.Time) error
+}
+
+// MemorySyncTokens is a SyncTokenStore holding tokens in memory, the
+// default. Tokens are invalidated by restarts.
+type MemorySyncTokens struct {
+	m      sync.Mutex
+	states map[string]SyncState
+}
+
+// NewMemorySyncTokens creates an empty MemorySyncTokens.
+func NewMemorySyncTokens() *MemorySyncTokens {
+	return &MemorySyncTokens{states: make(map[string]SyncState)}
+}
+
+// Save implements SyncTokenStore.
+func (ms *MemorySyncTokens) Save(token string, st SyncState) error {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+	ms.states[token] = st
+	return nil
+}
+
+// Load implements SyncTokenStore.
+func (ms *MemorySyncTokens) Load(token string) (SyncState, error) {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+	st, ok := ms.states[token]
+	if !ok {
+		return st, ErrorInvalidSyncToken
+	}
+	return st, nil
+}
+
+// Expire implements SyncTokenStore.
+func (ms *MemorySyncTokens) Expire(before time.Time) error {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+	for t, st := range ms.states {
+		if st.Issued.Before(before) {
+			delete(ms.states, t)
+		}
+	}
+	return nil
+}
+
+// FileSyncTokens is a SyncTokenStore keeping each token as a JSON file in
+// a directory, so tokens survive restarts.
+type FileSyncTokens struct {
+	dir string
+}
+
+// NewFileSyncTokens creates a FileSyncTokens in the given directory,
+// creating it if necessary.
+func NewFileSyncTokens(dir string) (*FileSyncTokens, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileSyncTokens{dir: dir}, nil
+}
+
+// file gets the name of the file holding a token, which is hashed as
+// tokens are chosen by clients.
+func (fs *FileSyncTokens) file(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return filepath.Join(fs.dir, hex.EncodeToString(h[:])+".json")
+}
+
+// Save implements SyncTokenStore.
+func (fs *FileSyncTokens) Save(token string, st SyncState) error {
+	b, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first, so a crash does not leave a
+	// truncated token behind.
+	tmp, err := os.CreateTemp(fs.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), fs.file(token))
+}
+
+// Load implements SyncTokenStore.
+func (fs *FileSyncTokens) Load(token string) (SyncState, error) {
+	var st SyncState
+	b, err := os.ReadFile(fs.file(token))
+	if errors.Is(err, os.ErrNotExist) {
+		return st, ErrorInvalidSyncToken
+	}
+	if err != nil {
+		return st, err
+	}
+	if err := json.Unmarshal(b, &st); err != nil {
+		return st, ErrorInvalidSyncToken.WithCause(err)
+	}
+	return st, nil
+}
+
+// Expire implements SyncTokenStore.
+func (fs *FileSyncTokens) Expire(before time.Time) error {
+	entries, err := os.ReadDir(fs.dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		fn := filepath.Join(fs.dir, e.Name())
+		b, err := os.ReadFile(fn)
+		if err != nil {
+			continue
+		}
+		var st SyncState
+		if json.Unmarshal(b, &st) != nil || st.Issued.Before(before) {
+			os.Remove(fn)
+		}
+	}
+	return nil
+}
+
+// WithSyncTokens sets where sync tokens are kept, and the time for which
+// they remain valid. Older tokens are refused, and clients must then
+// synchronize from scratch. By default tokens are kept in memory for
+// DefaultSyncTokenWindow.
+func WithSyncTokens(store SyncTokenStore, window time.Duration) Option {
+	return func(s *WebDAV) {
+		s.syncTokens = store
+		s.syncWindow = window
+	}
+}
+
+// syncValidity gets the time for which sync tokens remain valid.
+func (s *WebDAV) syncValidity() time.Duration {
+	if s.syncWindow <= 0 {
+		return DefaultSyncTokenWindow
+	}
+	return s.syncWindow
+}
+
+// loadSyncState gets the state a sync token for the given collection
+// refers to, failing with ErrorInvalidSyncToken if the token is unknown,
+// for another collection or too old.
+func (s *WebDAV) loadSyncState(token, collection string) (SyncState, error) {
+	st, err := s.syncTokens.Load(token)
+	if err != nil {
+		return st, err
+	}
+	if st.Collection != collection || s.clock.Now().Sub(st.Issued) > s.syncValidity() {
+		return st, ErrorInvalidSyncToken
+	}
+	return st, nil
+}
+
+// saveSyncState issues a new sync token for the given state, forgetting
+// those which are no longer valid.
+func (s *WebDAV) saveSyncState(st SyncState) (string, error) {
+	if err := s.syncTokens.Expire(st.Issued.Add(-s.syncValidity())); err != nil {
+		s.logger.Printf("expiring sync tokens: %s", err)
+	}
+	u, err := newUUID()
+	if err != nil {
+		return "", err
+	}
+	token := "urn:uuid:" + u
+	return token, s.syncTokens.Save(token, st)
+}
+
+// doSyncCollection handles the sync-collection REPORT, see
+// https://tools.ietf.org/html/rfc6578. A sync token refers to the ETags
+// of the members of the collection when it was issued, against which
+// the current members are compared. Members changed since in ways the
+// ETag does not reflect, such as by PROPPATCH, are found in the journal.
+// FileSystems implementing ChangeJournal are synchronized from their
+// journal instead, see syncFromJournal.
+func (s *WebDAV) doSyncCollection(ctx context, w http.ResponseWriter, req x.SyncCollectionRequest) {
+	f, err := ctx.p.Lookup()
+	if err != nil {
+		s.errorHeader(ctx, w, err)
+		return
+	}
+	if !f.IsDirectory() {
+		s.errorHeader(ctx, w, ErrorIsNotDir)
+		return
+	}
+	collection := f.GetPath()
+
+	cj, backend := s.fs.(ChangeJournal)
+	var old SyncState
+	if req.SyncToken != "" {
+		if old, err = s.loadSyncState(req.SyncToken, collection); err != nil {
+			s.errorHeader(ctx, w, err)
+			return
+		}
+		if old.Backend != backend {
+			s.errorHeader(ctx, w, ErrorInvalidSyncToken)
+			return
+		}
+		if backend {
+			s.syncFromJournal(ctx, w, req, cj, old)
+			return
+		}
+	}
+
+	// The journal is read first, so changes made while the collection is
+	// listed are reported again by the next synchronization.
+	seq := s.journalSeq()
+	if backend {
+		if seq, err = cj.LastChange(); err != nil {
+			s.errorHeader(ctx, w, err)
+			return
+		}
+	}
+	touched := make(map[string]bool)
+	if req.SyncToken != "" {
+		changes, err := s.ChangesSince(old.Seq)
+		if err != nil {
+			s.logger.Printf("reading journal since %d: %s", old.Seq, err)
+		}
+		for _, c := range changes {
+			touched[c.Path] = true
+			touched[c.Destination] = true
+		}
+	}
+
+	depth := 1
+	if req.Infinite {
+		depth = -1
+	}
+	files, err := ctx.p.LookupSubtree(depth)
+	if err != nil {
+		s.errorHeader(ctx, w, err)
+		return
+	}
+
+	st := SyncState{Collection: collection, Issued: s.clock.Now(), Seq: seq, Backend: backend, Members: make(map[string]string)}
+	ms := x.NewMultiStatus()
+	for _, f := range files {
+		p := f.GetPath()
+		if p == collection || !s.listable(f) {
+			continue
+		}
+		rf := represented(f)
+		fi, err := rf.Stat()
+		if err != nil {
+			s.logger.Printf("E[%s]: %s", p, err)
+			continue
+		}
+		tag := fileETag(rf, fi)
+		if !backend {
+			st.Members[p] = tag
+		}
+		if old.Members[p] == tag && !touched[p] {
+			continue
+		}
+		s.syncMember(ms, req, f)
+	}
+	for p := range old.Members {
+		if _, ok := st.Members[p]; !ok {
+			ms.AddStatus(s.href(p), ErrorNotFound)
+		}
+	}
+
+	if ms.SyncToken, err = s.saveSyncState(st); err != nil {
+		s.errorHeader(ctx, w, err)
+		return
+	}
+	ms.Send(w)
+}
+
+// syncMember reports the requested properties of a member.
+func (s *WebDAV) syncMember(ms *x.MultiStatus, req x.SyncCollectionRequest, f File) {
+	var found, missing []x.Any
+	for _, pn := range req.PropertyNames {
+		if v, ok := s.getPropValue(pn, f); ok {
+			found = append(found, v)
+		} else {
+			missing = append(missing, v)
+		}
+	}
+	ms.AddPropStatus(s.href(f.GetPath()), found, missing)
+}
+
+// syncFromJournal answers a sync-collection REPORT with a sync token from
+// the ChangeJournal of the FileSystem, reporting the members touched by the
+// changes since the token was issued as they are now. Tokens older than the
+// journal are invalid, and the client must synchronize from scratch.
+func (s *WebDAV) syncFromJournal(ctx context, w http.ResponseWriter, req x.SyncCollectionRequest, cj ChangeJournal, old SyncState) {
+	changes, err := cj.Changes(old.Seq)
+	if errors.Is(err, ErrJournalTruncated) {
+		err = ErrorInvalidSyncToken.WithCause(err)
+	}
+	if err != nil {
+		s.errorHeader(ctx, w, err)
+		return
+	}
+
+	depth := 1
+	if req.Infinite {
+		depth = -1
+	}
+	st := SyncState{Collection: old.Collection, Issued: s.clock.Now(), Seq: old.Seq, Backend: true}
+	// arrived holds the destinations of copies and moves, whose members are
+	// new too.
+	touched, arrived := make(map[string]bool), make(map[string]bool)
+	for _, c := range changes {
+		if c.Seq > st.Seq {
+			st.Seq = c.Seq
+		}
+		switch c.Kind {
+		case ChangeUnlocked:
+			continue
+		case ChangeMoved, ChangeCopied:
+			arrived[c.Destination] = true
+		}
+		for _, p := range []string{c.Path, c.Destination} {
+			if _, ok := wp.Included(p, st.Collection, depth); ok && p != "" && p != st.Collection {
+				touched[p] = true
+			}
+		}
+	}
+	paths := make([]string, 0, len(touched))
+	for p := range touched {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	ms := x.NewMultiStatus()
+	reported := make(map[string]bool)
+	for _, p := range paths {
+		// Not even the removal of a member of a drop box is reported.
+		if box, ok := s.dropBoxFor(p); reported[p] || ok && p != box {
+			continue
+		}
+		fp, err := s.fs.ForPath(p)
+		if err != nil {
+			s.errorHeader(ctx, w, err)
+			return
+		}
+		f, err := fp.Lookup()
+		if errors.Is(FromOSError(err), ErrorNotFound) {
+			ms.AddStatus(s.href(p), ErrorNotFound)
+			continue
+		}
+		if err != nil {
+			s.errorHeader(ctx, w, err)
+			return
+		}
+		members := []File{f}
+		if f.IsDirectory() && depth < 0 && arrived[p] {
+			if members, err = fp.LookupSubtree(-1); err != nil {
+				s.errorHeader(ctx, w, err)
+				return
+			}
+		}
+		for _, m := range members {
+			if mp := m.GetPath(); !reported[mp] && s.listable(m) {
+				reported[mp] = true
+				s.syncMember(ms, req, m)
+			}
+		}
+	}
+
+	if ms.SyncToken, err = s.saveSyncState(st); err != nil {
+		s.errorHeader(ctx, w, err)
+		return
+	}
+	ms.Send(w)
+}
@@ -0,0 +1,219 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+var syncTokenRE = regexp.MustCompile(`<sync-token>([^<]*)</sync-token>`)
+
+func syncCollection(t *testing.T, h http.Handler, token string) (int, string, string) {
+	body := `<?xml version="1.0"?>
+<D:sync-collection xmlns:D="DAV:">
+  <D:sync-token>` + token + `</D:sync-token>
+  <D:sync-level>1</D:sync-level>
+  <D:prop><D:getcontentlength/></D:prop>
+</D:sync-collection>`
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("REPORT", "/d/", strings.NewReader(body)))
+	m := syncTokenRE.FindStringSubmatch(w.Body.String())
+	if m == nil {
+		return w.Code, w.Body.String(), ""
+	}
+	return w.Code, w.Body.String(), m[1]
+}
+
+// TestSyncCollection synchronizes a memfs both from its ChangeJournal and,
+// hiding it, by listing the collection.
+func TestSyncCollection(t *testing.T) {
+	t.Run("journal", func(t *testing.T) {
+		testSyncCollection(t, memfs.NewMemFS())
+	})
+	t.Run("listing", func(t *testing.T) {
+		testSyncCollection(t, struct{ webdav.FileSystem }{memfs.NewMemFS()})
+	})
+}
+
+func testSyncCollection(t *testing.T, fs webdav.FileSystem) {
+	clock := &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	h := webdav.NewWebDAV(fs, webdav.WithClock(clock),
+		webdav.WithSyncTokens(webdav.NewMemorySyncTokens(), time.Hour))
+	do := func(method, p, body string) {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, p, strings.NewReader(body)))
+	}
+	do("MKCOL", "/d", "")
+	do("PUT", "/d/a", "a")
+	do("PUT", "/d/b", "b")
+
+	code, res, token := syncCollection(t, h, "")
+	if code != 207 || token == "" {
+		t.Fatalf("initial sync got %d:\n%s", code, res)
+	}
+	if !strings.Contains(res, "<href>/d/a</href>") || !strings.Contains(res, "<href>/d/b</href>") {
+		t.Errorf("initial sync lacks members:\n%s", res)
+	}
+
+	do("PUT", "/d/a", "aa")
+	do("PUT", "/d/c", "c")
+	do("DELETE", "/d/b", "")
+	code, res, next := syncCollection(t, h, token)
+	if code != 207 || next == "" || next == token {
+		t.Fatalf("incremental sync got %d, token %q:\n%s", code, next, res)
+	}
+	for _, want := range []string{
+		"<href>/d/a</href>",
+		"<href>/d/c</href>",
+		"<href>/d/b</href>\n  <status>HTTP/1.1 404 Not Found</status>",
+	} {
+		if !strings.Contains(res, want) {
+			t.Errorf("incremental sync lacks %q:\n%s", want, res)
+		}
+	}
+
+	if _, res, _ := syncCollection(t, h, next); strings.Contains(res, "<response>") {
+		t.Errorf("sync without changes reported:\n%s", res)
+	}
+
+	do("PROPPATCH", "/d/c", `<propertyupdate xmlns="DAV:"><set><prop><color xmlns="urn:x:">red</color></prop></set></propertyupdate>`)
+	code, res, next = syncCollection(t, h, next)
+	if code != 207 || !strings.Contains(res, "<href>/d/c</href>") || strings.Contains(res, "<href>/d/a</href>") {
+		t.Errorf("sync after PROPPATCH got %d:\n%s", code, res)
+	}
+
+	clock.now = clock.now.Add(2 * time.Hour)
+	if code, res, _ := syncCollection(t, h, next); code != http.StatusForbidden || !strings.Contains(res, "valid-sync-token") {
+		t.Errorf("sync with an expired token got %d:\n%s", code, res)
+	}
+	if code, _, _ := syncCollection(t, h, "urn:uuid:unknown"); code != http.StatusForbidden {
+		t.Errorf("sync with an unknown token got %d, want 403", code)
+	}
+}
+
+// TestSyncCollectionDropBox checks members of drop boxes are not reported,
+// whether synchronizing by listing or from the journal.
+func TestSyncCollectionDropBox(t *testing.T) {
+	body := `<?xml version="1.0"?>
+<D:sync-collection xmlns:D="DAV:">
+  <D:sync-token>%s</D:sync-token>
+  <D:sync-level>infinite</D:sync-level>
+  <D:prop><D:getetag/></D:prop>
+</D:sync-collection>`
+	h := webdav.NewWebDAV(memfs.NewMemFS(), webdav.WithDropBoxes("/box"))
+	serve(h, "MKCOL", "/box", "")
+	serve(h, "PUT", "/box/secret.txt", "s")
+	serve(h, "PUT", "/box/old.txt", "o")
+	serve(h, "PUT", "/a", "a")
+
+	w := serve(h, "REPORT", "/", fmt.Sprintf(body, ""))
+	if w.Code != 207 || !strings.Contains(w.Body.String(), "<href>/a</href>") || !strings.Contains(w.Body.String(), "<href>/box</href>") {
+		t.Fatalf("initial sync got %d:\n%s", w.Code, w.Body)
+	}
+	if strings.Contains(w.Body.String(), "/box/secret.txt") {
+		t.Errorf("initial sync reported a member of a drop box:\n%s", w.Body)
+	}
+
+	token := syncTokenRE.FindStringSubmatch(w.Body.String())[1]
+	serve(h, "PUT", "/box/new.txt", "n")
+	serve(h, "DELETE", "/box/old.txt", "")
+	serve(h, "PUT", "/b", "b")
+	w = serve(h, "REPORT", "/", fmt.Sprintf(body, token))
+	if w.Code != 207 || !strings.Contains(w.Body.String(), "<href>/b</href>") {
+		t.Fatalf("incremental sync got %d:\n%s", w.Code, w.Body)
+	}
+	if strings.Contains(w.Body.String(), "/box/new.txt") || strings.Contains(w.Body.String(), "/box/old.txt") {
+		t.Errorf("incremental sync reported members of a drop box:\n%s", w.Body)
+	}
+}
+
+func TestSyncCollectionBackendChanges(t *testing.T) {
+	fs := memfs.NewMemFS()
+	h := webdav.NewWebDAV(fs)
+	do := func(method, p, body string) {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, p, strings.NewReader(body)))
+	}
+	do("MKCOL", "/d", "")
+	do("PUT", "/d/a", "a")
+	do("PUT", "/d/b", "b")
+	_, _, token := syncCollection(t, h, "")
+
+	// Changes made to the FileSystem directly are found in its journal.
+	p, _ := fs.ForPath("/d/c")
+	_, fh, _ := p.Create()
+	fh.Write([]byte("c"))
+	fh.(webdav.Committer).Commit()
+	p, _ = fs.ForPath("/d/a")
+	p.Remove()
+	p, _ = fs.ForPath("/d/b")
+	dst, _ := fs.ForPath("/e")
+	do("MKCOL", "/e", "")
+	p.CopyTo(dst, webdav.CopyOptions{Move: true, Overwrite: true, Depth: -1})
+
+	code, res, next := syncCollection(t, h, token)
+	if code != 207 || next == "" {
+		t.Fatalf("incremental sync got %d:\n%s", code, res)
+	}
+	for _, want := range []string{
+		"<href>/d/c</href>",
+		"<href>/d/a</href>\n  <status>HTTP/1.1 404 Not Found</status>",
+		"<href>/d/b</href>\n  <status>HTTP/1.1 404 Not Found</status>",
+	} {
+		if !strings.Contains(res, want) {
+			t.Errorf("incremental sync lacks %q:\n%s", want, res)
+		}
+	}
+	if strings.Contains(res, "/e") {
+		t.Errorf("incremental sync reported a change outside the collection:\n%s", res)
+	}
+}
+
+func TestFileSyncTokens(t *testing.T) {
+	dir := t.TempDir()
+	fs, err := webdav.NewFileSyncTokens(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issued := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	st := webdav.SyncState{Collection: "/d", Issued: issued, Members: map[string]string{"/d/a": "1-x"}}
+	if err := fs.Save("urn:uuid:1", st); err != nil {
+		t.Fatal(err)
+	}
+
+	fs, _ = webdav.NewFileSyncTokens(dir)
+	got, err := fs.Load("urn:uuid:1")
+	if err != nil || got.Collection != "/d" || got.Members["/d/a"] != "1-x" || !got.Issued.Equal(issued) {
+		t.Errorf("Load() = %+v, %v", got, err)
+	}
+	if err := fs.Expire(issued.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Load("urn:uuid:1"); !errors.Is(err, webdav.ErrorInvalidSyncToken) {
+		t.Errorf("Load() of an expired token got %v, want ErrorInvalidSyncToken", err)
+	}
+}
@@ -0,0 +1,470 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package tierfs stores the content of small files in one webdav.FileSystem
+and that of large files in another, such as a database for the former and
+a blob store for the latter, serving both as a single namespace.
+
+The small backend holds the namespace: every collection, every small file
+and the dead properties of all resources. A large file is kept there as an
+empty placeholder, marked by a property hidden from clients, while its
+content is kept at the same path in the large backend, whose collections
+are created as needed.
+
+Writes are buffered in memory up to the threshold, so files move between
+the backends as they are rewritten with sizes on either side of it.
+*/
+package tierfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"path"
+	"strings"
+
+	w "github.com/google/go-webdav"
+)
+
+// DefaultThreshold is the size above which files are stored in the large
+// backend, if Options leave it unset.
+const DefaultThreshold = 1 << 20
+
+// tierProp marks the placeholders of large files in the small backend.
+const tierProp = "http://github.com/google/go-webdav/tierfs:large"
+
+// errWriteOnly is returned for reads and seeks of handles opened to write.
+var errWriteOnly = errors.New("tierfs: handle is only open for writing")
+
+// Options configure the split between the backends.
+type Options struct {
+	// Threshold is the size in bytes above which files are stored in the
+	// large backend.
+	Threshold int64
+}
+
+// FS is a webdav.FileSystem storing files in one of two backends by size.
+type FS struct {
+	small, large w.FileSystem
+	threshold    int64
+}
+
+// New serves the files of small and large as one FileSystem, small holding
+// the namespace and files no larger than the threshold.
+func New(small, large w.FileSystem, opts Options) *FS {
+	t := opts.Threshold
+	if t <= 0 {
+		t = DefaultThreshold
+	}
+	return &FS{small: small, large: large, threshold: t}
+}
+
+// ForPath implements webdav.FileSystem.
+func (fs *FS) ForPath(p string) (w.Path, error) {
+	sp, err := fs.small.ForPath(p)
+	if err != nil {
+		return nil, err
+	}
+	return &tpath{fs: fs, small: sp}, nil
+}
+
+// Dump implements webdav.FileSystem, dumping the small backend, which holds
+// the namespace.
+func (fs *FS) Dump(out io.Writer, format w.DumpFormat) error {
+	return fs.small.Dump(out, format)
+}
+
+// largePath gets the path of the content of a large file, creating the
+// collections above it if create is set.
+func (fs *FS) largePath(p string, create bool) (w.Path, error) {
+	if create && p != "/" {
+		dir := "/"
+		for _, name := range strings.Split(strings.Trim(path.Dir(p), "/"), "/") {
+			if name == "" {
+				continue
+			}
+			dir = path.Join(dir, name)
+			dp, err := fs.large.ForPath(dir)
+			if err != nil {
+				return nil, err
+			}
+			if f, err := dp.Lookup(); err == nil {
+				if !f.IsDirectory() {
+					return nil, w.ErrorIsNotDir
+				}
+				continue
+			}
+			if _, err := dp.Mkdir(); err != nil && !errors.Is(err, w.ErrorConflict) {
+				return nil, err
+			}
+		}
+	}
+	return fs.large.ForPath(p)
+}
+
+// removeLarge removes the content of a large file.
+func (fs *FS) removeLarge(p string) error {
+	lp, err := fs.large.ForPath(p)
+	if err != nil {
+		return err
+	}
+	return lp.Remove()
+}
+
+// isLarge determines if a file of the small backend is the placeholder of
+// a large file.
+func isLarge(f w.File) bool {
+	_, ok := f.GetProp(tierProp)
+	return ok && !f.IsDirectory()
+}
+
+type tpath struct {
+	fs    *FS
+	small w.Path
+}
+
+func (p *tpath) String() string {
+	return p.small.String()
+}
+
+func (p *tpath) Parent() w.Path {
+	return &tpath{fs: p.fs, small: p.small.Parent()}
+}
+
+func (p *tpath) Lookup() (w.File, error) {
+	f, err := p.small.Lookup()
+	if err != nil {
+		return nil, err
+	}
+	return &tfile{File: f, fs: p.fs}, nil
+}
+
+// Exists implements webdav.Exister if the small backend's Path does.
+func (p *tpath) Exists() (bool, error) {
+	if e, ok := p.small.(w.Exister); ok {
+		return e.Exists()
+	}
+	_, err := p.small.Lookup()
+	return err == nil, nil
+}
+
+func (p *tpath) LookupSubtree(depth int) ([]w.File, error) {
+	files, err := p.small.LookupSubtree(depth)
+	for i, f := range files {
+		files[i] = &tfile{File: f, fs: p.fs}
+	}
+	return files, err
+}
+
+// largeFiles gets the paths of the large files within the subtree.
+func (p *tpath) largeFiles(depth int) ([]string, error) {
+	files, err := p.small.LookupSubtree(depth)
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, f := range files {
+		if isLarge(f) {
+			res = append(res, f.GetPath())
+		}
+	}
+	return res, nil
+}
+
+func (p *tpath) Mkdir() (w.File, error) {
+	f, err := p.small.Mkdir()
+	if err != nil {
+		return nil, err
+	}
+	return &tfile{File: f, fs: p.fs}, nil
+}
+
+func (p *tpath) Create() (w.File, w.FileHandle, error) {
+	f, fh, err := p.small.Create()
+	if err != nil {
+		return nil, nil, err
+	}
+	return &tfile{File: f, fs: p.fs}, &handle{fs: p.fs, file: f, small: fh}, nil
+}
+
+// CopyTo copies the namespace within the small backend, then the content
+// of the large files copied, removing that of those replaced.
+func (p *tpath) CopyTo(dst w.Path, opt w.CopyOptions) (bool, error) {
+	dp, ok := dst.(*tpath)
+	if !ok {
+		return false, w.ErrorBadHost
+	}
+	large, err := p.largeFiles(opt.Depth)
+	if err != nil {
+		return false, err
+	}
+	var replaced []string
+	if opt.Overwrite {
+		// The destination may not exist.
+		replaced, _ = dp.largeFiles(-1)
+	}
+	existed, err := p.small.CopyTo(dp.small, opt)
+	if err != nil {
+		return existed, err
+	}
+
+	fs := p.fs
+	for _, lp := range replaced {
+		fs.removeLarge(lp)
+	}
+	for _, lp := range large {
+		to, err := fs.largePath(path.Join(dp.String(), strings.TrimPrefix(lp, p.String())), true)
+		if err != nil {
+			return existed, err
+		}
+		from, err := fs.large.ForPath(lp)
+		if err != nil {
+			return existed, err
+		}
+		if _, err := from.CopyTo(to, w.CopyOptions{Move: opt.Move, Overwrite: true}); err != nil {
+			return existed, err
+		}
+	}
+	return existed, nil
+}
+
+func (p *tpath) Remove() error {
+	f, err := p.small.Lookup()
+	if err != nil {
+		return err
+	}
+	if err := p.small.Remove(); err != nil {
+		return err
+	}
+	if isLarge(f) {
+		return p.fs.removeLarge(p.String())
+	}
+	return nil
+}
+
+// RecursiveRemove removes the subtree from the small backend, then the
+// content of the large files removed with it.
+func (p *tpath) RecursiveRemove() map[string]error {
+	large, err := p.largeFiles(-1)
+	if err != nil {
+		return map[string]error{p.String(): err}
+	}
+	errs := p.small.RecursiveRemove()
+	if len(errs) == 0 {
+		// The collections of the large backend go too.
+		if lp, err := p.fs.large.ForPath(p.String()); err == nil {
+			lp.RecursiveRemove()
+		}
+		return nil
+	}
+	for _, f := range large {
+		if _, ok := errs[f]; !ok {
+			p.fs.removeLarge(f)
+		}
+	}
+	return errs
+}
+
+// tfile reads large files from the large backend, hiding their marking.
+type tfile struct {
+	w.File
+	fs *FS
+}
+
+// largeFile gets the content of a large file from the large backend.
+func (f *tfile) largeFile() (w.File, error) {
+	lp, err := f.fs.large.ForPath(f.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	return lp.Lookup()
+}
+
+func (f *tfile) Stat() (w.FileInfo, error) {
+	if !isLarge(f.File) {
+		return f.File.Stat()
+	}
+	lf, err := f.largeFile()
+	if err != nil {
+		return w.FileInfo{}, err
+	}
+	return lf.Stat()
+}
+
+func (f *tfile) Open() (w.FileHandle, error) {
+	if !isLarge(f.File) {
+		return f.File.Open()
+	}
+	lf, err := f.largeFile()
+	if err != nil {
+		return nil, err
+	}
+	return lf.Open()
+}
+
+func (f *tfile) Truncate() (w.FileHandle, error) {
+	large := isLarge(f.File)
+	fh, err := f.File.Truncate()
+	if err != nil {
+		return nil, err
+	}
+	return &handle{fs: f.fs, file: f.File, small: fh, wasLarge: large}, nil
+}
+
+func (f *tfile) PatchProp(set, remove map[string]string) error {
+	_, inSet := set[tierProp]
+	_, inRemove := remove[tierProp]
+	if inSet || inRemove {
+		return w.ErrorForbidden
+	}
+	return f.File.PatchProp(set, remove)
+}
+
+func (f *tfile) GetProp(k string) (string, bool) {
+	if k == tierProp {
+		return "", false
+	}
+	return f.File.GetProp(k)
+}
+
+// PropNames implements webdav.PropLister if the small backend's File does.
+func (f *tfile) PropNames() []string {
+	pl, ok := f.File.(w.PropLister)
+	if !ok {
+		return nil
+	}
+	var names []string
+	for _, n := range pl.PropNames() {
+		if n != tierProp {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// ETag implements webdav.ETagger if the File of the backend holding the
+// content does.
+func (f *tfile) ETag() (string, error) {
+	var cf w.File = f.File
+	if isLarge(f.File) {
+		lf, err := f.largeFile()
+		if err != nil {
+			return "", err
+		}
+		cf = lf
+	}
+	if et, ok := cf.(w.ETagger); ok {
+		return et.ETag()
+	}
+	return "", w.ErrorNotFound
+}
+
+// Representation implements webdav.Representer if the small backend's File
+// does.
+func (f *tfile) Representation() (w.File, error) {
+	r, ok := f.File.(w.Representer)
+	if !ok {
+		return nil, w.ErrorNotFound
+	}
+	rf, err := r.Representation()
+	if err != nil {
+		return nil, err
+	}
+	return &tfile{File: rf, fs: f.fs}, nil
+}
+
+// handle buffers writes up to the threshold, past which they go to the
+// large backend. On Close, the file is left in the backend its size
+// belongs in, and removed from the other one.
+type handle struct {
+	fs *FS
+	// file is the file of the small backend, truncated by small.
+	file     w.File
+	small    w.FileHandle
+	wasLarge bool
+
+	buf   bytes.Buffer
+	large w.FileHandle
+}
+
+func (h *handle) Read(b []byte) (int, error) {
+	return 0, errWriteOnly
+}
+
+func (h *handle) Seek(offset int64, whence int) (int64, error) {
+	return 0, errWriteOnly
+}
+
+func (h *handle) Write(b []byte) (int, error) {
+	if h.large != nil {
+		return h.large.Write(b)
+	}
+	if int64(h.buf.Len()+len(b)) <= h.fs.threshold {
+		return h.buf.Write(b)
+	}
+	if err := h.openLarge(); err != nil {
+		return 0, err
+	}
+	if _, err := h.large.Write(h.buf.Bytes()); err != nil {
+		return 0, err
+	}
+	h.buf.Reset()
+	return h.large.Write(b)
+}
+
+// openLarge opens the content of the file in the large backend to write.
+func (h *handle) openLarge() error {
+	lp, err := h.fs.largePath(h.file.GetPath(), true)
+	if err != nil {
+		return err
+	}
+	if f, err := lp.Lookup(); err == nil {
+		h.large, err = f.Truncate()
+		return err
+	}
+	_, h.large, err = lp.Create()
+	return err
+}
+
+func (h *handle) Close() error {
+	if h.large != nil {
+		if err := h.large.Close(); err != nil {
+			h.small.Close()
+			return err
+		}
+		if err := h.small.Close(); err != nil {
+			return err
+		}
+		if h.wasLarge {
+			return nil
+		}
+		return h.file.PatchProp(map[string]string{tierProp: "true"}, nil)
+	}
+
+	if _, err := h.small.Write(h.buf.Bytes()); err != nil {
+		h.small.Close()
+		return err
+	}
+	if err := h.small.Close(); err != nil {
+		return err
+	}
+	if !h.wasLarge {
+		return nil
+	}
+	if err := h.file.PatchProp(nil, map[string]string{tierProp: ""}); err != nil {
+		return err
+	}
+	return h.fs.removeLarge(h.file.GetPath())
+}
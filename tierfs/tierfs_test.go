@@ -0,0 +1,114 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tierfs
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	w "github.com/google/go-webdav"
+	"github.com/google/go-webdav/fstest"
+	"github.com/google/go-webdav/memfs"
+)
+
+func TestConformance(t *testing.T) {
+	fstest.TestFileSystem(t, func(t *testing.T) w.FileSystem {
+		return New(memfs.NewMemFS(), memfs.NewMemFS(), Options{Threshold: 2})
+	})
+}
+
+// content gets the content of a file of a backend, or "" if it is missing.
+func content(t *testing.T, fs w.FileSystem, p string) (string, bool) {
+	t.Helper()
+	fp, err := fs.ForPath(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := fp.Lookup()
+	if err != nil {
+		return "", false
+	}
+	fh, err := f.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	b, err := io.ReadAll(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b), true
+}
+
+func TestTiers(t *testing.T) {
+	small, large := memfs.NewMemFS(), memfs.NewMemFS()
+	h := w.NewWebDAV(New(small, large, Options{Threshold: 5}))
+	do := func(method, p, body string, hdr ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, p, strings.NewReader(body))
+		for i := 0; i+1 < len(hdr); i += 2 {
+			r.Header.Set(hdr[i], hdr[i+1])
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+	want := func(fs w.FileSystem, name, p, want string, ok bool) {
+		t.Helper()
+		if got, exists := content(t, fs, p); exists != ok || got != want {
+			t.Errorf("%s backend has %s = %q, %v, want %q, %v", name, p, got, exists, want, ok)
+		}
+	}
+
+	do("MKCOL", "/d", "")
+	do("PUT", "/d/small", "12345")
+	do("PUT", "/d/large", "1234567890")
+	want(small, "small", "/d/small", "12345", true)
+	want(large, "large", "/d/small", "", false)
+	want(small, "small", "/d/large", "", true)
+	want(large, "large", "/d/large", "1234567890", true)
+
+	rec := do("GET", "/d/large", "")
+	if rec.Body.String() != "1234567890" || rec.Header().Get("Content-Length") != "10" {
+		t.Errorf("GET of a large file got %q of length %s", rec.Body, rec.Header().Get("Content-Length"))
+	}
+	rec = do("PROPFIND", "/d/large", "", "Depth", "0")
+	if body := rec.Body.String(); !strings.Contains(body, ">10</getcontentlength>") || strings.Contains(body, "tierfs") {
+		t.Errorf("PROPFIND of a large file got %s", body)
+	}
+
+	// Files move between the backends as they are rewritten.
+	do("PUT", "/d/large", "123")
+	want(small, "small", "/d/large", "123", true)
+	want(large, "large", "/d/large", "", false)
+	do("PUT", "/d/small", "1234567")
+	want(large, "large", "/d/small", "1234567", true)
+
+	if rec := do("MOVE", "/d", "", "Destination", "http://example.com/e"); rec.Code != http.StatusCreated {
+		t.Fatalf("MOVE got %d", rec.Code)
+	}
+	want(large, "large", "/d/small", "", false)
+	want(large, "large", "/e/small", "1234567", true)
+	if rec := do("GET", "/e/small", ""); rec.Body.String() != "1234567" {
+		t.Errorf("GET of a moved large file got %q", rec.Body)
+	}
+
+	if rec := do("DELETE", "/e", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE got %d", rec.Code)
+	}
+	want(large, "large", "/e/small", "", false)
+}
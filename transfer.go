@@ -0,0 +1,237 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TransferPolicy cuts off clients transferring request or response bodies
+// too slowly, which would otherwise hold requests open indefinitely by
+// trickling data or stalling, as in slowloris attacks. Each read of the
+// request body and write of the response is given a deadline on the
+// connection, by which the client must have kept up with MinRate.
+type TransferPolicy struct {
+	// MinRate is the least rate, in bytes per second, at which a client
+	// must send or receive data while the handler waits for it, zero
+	// meaning no limit. Slow uploads are answered with 408 Request
+	// Timeout, slow downloads are cut short.
+	MinRate int64
+	// Grace is how long the handler waits for a client before checking
+	// its rate, so that short transfers are never cut off.
+	Grace time.Duration
+}
+
+// WithTransferPolicy sets the policy for slow clients.
+func WithTransferPolicy(p TransferPolicy) Option {
+	return func(s *WebDAV) {
+		s.transferPolicy = p
+	}
+}
+
+// Transfer reports the progress of a request being served.
+type Transfer struct {
+	ID      string    `json:"id"`
+	Method  string    `json:"method"`
+	Path    string    `json:"path"`
+	Remote  string    `json:"remote"`
+	Started time.Time `json:"started"`
+	// Read and Written count the bytes of the request and response
+	// bodies, and Waited is the time spent waiting for the client to send
+	// or receive them.
+	Read    int64         `json:"read"`
+	Written int64         `json:"written"`
+	Waited  time.Duration `json:"waited"`
+}
+
+// Rate gets the rate of the transfer while waiting for the client, in bytes
+// per second.
+func (t Transfer) Rate() float64 {
+	if t.Waited <= 0 {
+		return 0
+	}
+	return float64(t.Read+t.Written) / t.Waited.Seconds()
+}
+
+// transfer tracks a Transfer, its counters updated atomically.
+type transfer struct {
+	Transfer
+	read, written, waited int64
+	slow                  int32
+}
+
+func (t *transfer) snapshot() Transfer {
+	res := t.Transfer
+	res.Read = atomic.LoadInt64(&t.read)
+	res.Written = atomic.LoadInt64(&t.written)
+	res.Waited = time.Duration(atomic.LoadInt64(&t.waited))
+	return res
+}
+
+// transfers tracks the requests being served.
+type transfers struct {
+	m      sync.Mutex
+	active map[*transfer]bool
+}
+
+// Transfers gets the requests being served, ordered by when they started.
+func (s *WebDAV) Transfers() []Transfer {
+	s.transfers.m.Lock()
+	res := make([]Transfer, 0, len(s.transfers.active))
+	for t := range s.transfers.active {
+		res = append(res, t.snapshot())
+	}
+	s.transfers.m.Unlock()
+	sort.Slice(res, func(i, j int) bool { return res[i].Started.Before(res[j].Started) })
+	return res
+}
+
+// trackTransfer starts tracking a request, wrapping its body and w to count
+// the bytes transferred, until the returned function is called.
+func (s *WebDAV) trackTransfer(w *panicWriter, r *http.Request) (http.ResponseWriter, func()) {
+	t := &transfer{Transfer: Transfer{
+		ID:      w.id,
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Remote:  r.RemoteAddr,
+		Started: s.clock.Now(),
+	}}
+	s.transfers.m.Lock()
+	if s.transfers.active == nil {
+		s.transfers.active = make(map[*transfer]bool)
+	}
+	s.transfers.active[t] = true
+	s.transfers.m.Unlock()
+
+	tw := &transferWriter{ResponseWriter: w, s: s, t: t}
+	if s.transferPolicy.MinRate > 0 {
+		tw.rc = http.NewResponseController(w)
+	}
+	if r.Body != nil && r.Body != http.NoBody {
+		r.Body = &transferReader{ReadCloser: r.Body, w: tw}
+	}
+	return tw, func() {
+		if tw.rc != nil {
+			// Later requests on the connection start afresh.
+			tw.rc.SetReadDeadline(time.Time{})
+			tw.rc.SetWriteDeadline(time.Time{})
+		}
+		s.transfers.m.Lock()
+		delete(s.transfers.active, t)
+		s.transfers.m.Unlock()
+	}
+}
+
+// deadline gets the time by which the client must complete a read or write
+// of n bytes: it is allowed Grace, and the time MinRate allows for those and
+// the bytes transferred so far, less the time it was already waited for.
+// Deadlines of connections are in real time rather than that of the Clock.
+func (s *WebDAV) deadline(t *transfer, n int) time.Time {
+	p := s.transferPolicy
+	st := t.snapshot()
+	bytes := st.Read + st.Written + int64(n)
+	earned := p.Grace + time.Duration(float64(bytes)/float64(p.MinRate)*float64(time.Second))
+	return time.Now().Add(earned - st.Waited)
+}
+
+// timedOut determines if an error is that of a connection deadline passing.
+func timedOut(err error) bool {
+	return errors.Is(err, os.ErrDeadlineExceeded)
+}
+
+// waited accounts for a wait for the client, reporting if it has become too
+// slow, either because the wait reached its deadline or because the client
+// trickles data below MinRate.
+func (s *WebDAV) waited(t *transfer, since time.Time, n int, counter *int64, err error) bool {
+	atomic.AddInt64(counter, int64(n))
+	waited := time.Duration(atomic.AddInt64(&t.waited, int64(s.clock.Now().Sub(since))))
+	p := s.transferPolicy
+	if p.MinRate <= 0 {
+		return false
+	}
+	if !timedOut(err) && (waited <= p.Grace || t.snapshot().Rate() >= float64(p.MinRate)) {
+		return false
+	}
+	s.slowClient(t)
+	return true
+}
+
+// slowClient marks a transfer as cut off, counting and logging it once.
+func (s *WebDAV) slowClient(t *transfer) {
+	if atomic.CompareAndSwapInt32(&t.slow, 0, 1) {
+		st := t.snapshot()
+		atomic.AddInt64(&s.slowClients, 1)
+		s.logger.Printf("slow client %s for request %s, %s %s: %d bytes in %s", st.Remote, st.ID, st.Method, st.Path, st.Read+st.Written, st.Waited)
+	}
+}
+
+// transferWriter counts the bytes of a response, failing writes once the
+// client is too slow.
+type transferWriter struct {
+	http.ResponseWriter
+	s *WebDAV
+	t *transfer
+	// rc sets the deadlines of the connection, if there is a policy.
+	rc *http.ResponseController
+}
+
+func (w *transferWriter) Write(b []byte) (int, error) {
+	if atomic.LoadInt32(&w.t.slow) != 0 {
+		return 0, ErrorSlowClient
+	}
+	if w.rc != nil {
+		w.rc.SetWriteDeadline(w.s.deadline(w.t, len(b)))
+	}
+	start := w.s.clock.Now()
+	n, err := w.ResponseWriter.Write(b)
+	if w.s.waited(w.t, start, n, &w.t.written, err) && (err == nil || timedOut(err)) {
+		err = ErrorSlowClient
+	}
+	return n, err
+}
+
+func (w *transferWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// transferReader counts the bytes of a request body, failing reads once the
+// client is too slow, which closes the connection.
+type transferReader struct {
+	io.ReadCloser
+	w *transferWriter
+}
+
+func (r *transferReader) Read(b []byte) (int, error) {
+	if atomic.LoadInt32(&r.w.t.slow) != 0 {
+		return 0, ErrorSlowClient
+	}
+	if r.w.rc != nil {
+		r.w.rc.SetReadDeadline(r.w.s.deadline(r.w.t, len(b)))
+	}
+	start := r.w.s.clock.Now()
+	n, err := r.ReadCloser.Read(b)
+	if r.w.s.waited(r.w.t, start, n, &r.w.t.read, err) && (err == nil || timedOut(err)) {
+		r.w.Header().Set("Connection", "close")
+		err = ErrorSlowClient
+	}
+	return n, err
+}
@@ -0,0 +1,121 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+// trickleReader sends a byte at a time, each taking a second.
+type trickleReader struct {
+	clock  *fakeClock
+	r      io.Reader
+	onRead func()
+}
+
+func (r *trickleReader) Read(b []byte) (int, error) {
+	r.clock.now = r.clock.now.Add(time.Second)
+	if r.onRead != nil {
+		r.onRead()
+	}
+	return r.r.Read(b[:1])
+}
+
+// trickleRecorder receives a write at a time, each taking a thousand
+// seconds.
+type trickleRecorder struct {
+	*httptest.ResponseRecorder
+	clock *fakeClock
+}
+
+func (w trickleRecorder) Write(b []byte) (int, error) {
+	w.clock.now = w.clock.now.Add(1000 * time.Second)
+	return w.ResponseRecorder.Write(b)
+}
+
+func TestTransferPolicy(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := webdav.NewWebDAV(memfs.NewMemFS(), webdav.WithClock(clock),
+		webdav.WithTransferPolicy(webdav.TransferPolicy{MinRate: 100, Grace: 5 * time.Second}))
+
+	if w := serve(s, "PUT", "/fast", strings.Repeat("x", 1000)); w.Code != http.StatusCreated {
+		t.Fatalf("fast PUT got %d", w.Code)
+	}
+
+	var during []webdav.Transfer
+	body := &trickleReader{clock: clock, r: strings.NewReader(strings.Repeat("x", 1000))}
+	body.onRead = func() { during = s.Transfers() }
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("PUT", "/slow", body))
+	if w.Code != http.StatusRequestTimeout || w.Header().Get("Connection") != "close" {
+		t.Errorf("slow PUT got %d, Connection %q", w.Code, w.Header().Get("Connection"))
+	}
+	if len(during) != 1 || during[0].Method != "PUT" || during[0].Path != "/slow" || during[0].Read == 0 {
+		t.Errorf("Transfers during slow PUT got %+v", during)
+	}
+	if got := s.Transfers(); len(got) != 0 {
+		t.Errorf("Transfers after the requests got %+v", got)
+	}
+
+	// Downloads are cut short, even if started.
+	serve(s, "PUT", "/big", strings.Repeat("x", 64<<10))
+	tw := trickleRecorder{httptest.NewRecorder(), clock}
+	s.ServeHTTP(tw, httptest.NewRequest("GET", "/big", nil))
+	if got := tw.Body.Len(); got >= 64<<10 {
+		t.Errorf("slow GET got all %d bytes", got)
+	}
+
+	if got := s.Snapshot().SlowClients; got != 2 {
+		t.Errorf("Snapshot counted %d slow clients, want 2", got)
+	}
+}
+
+// TestTransferPolicyStalled checks clients which stop sending a body are cut
+// off, although no read of it ever returns.
+func TestTransferPolicyStalled(t *testing.T) {
+	s := webdav.NewWebDAV(memfs.NewMemFS(),
+		webdav.WithTransferPolicy(webdav.TransferPolicy{MinRate: 1 << 20, Grace: 100 * time.Millisecond}))
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "PUT /stalled HTTP/1.1\r\nHost: x\r\nContent-Length: 1000\r\n\r\n0123456789")
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("stalled PUT got no response: %v", err)
+	}
+	if res.StatusCode != http.StatusRequestTimeout {
+		t.Errorf("stalled PUT got %d, want %d", res.StatusCode, http.StatusRequestTimeout)
+	}
+	if got := s.Snapshot().SlowClients; got != 1 {
+		t.Errorf("Snapshot counted %d slow clients, want 1", got)
+	}
+}
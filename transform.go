@@ -0,0 +1,250 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"bytes"
+	"container/list"
+	gocontext "context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Transformer converts files into another representation when serving
+// GET, such as rendering markdown as HTML. A transformer is selected by
+// naming it in the "transform" query parameter, or by a client explicitly
+// accepting its ContentType.
+type Transformer struct {
+	// Name identifies the transformer in the query parameter.
+	Name string
+	// Extensions lists the file extensions the transformer applies to,
+	// such as ".md".
+	Extensions []string
+	// ContentType is the media type of the transformed content.
+	ContentType string
+	// Transform converts the content of a file.
+	Transform func(src []byte) ([]byte, error)
+	// MaxSize bounds the size in bytes of the files transformed, which
+	// are held in memory, larger ones are served as they are. Zero means
+	// DefaultMaxTransformSize.
+	MaxSize int64
+}
+
+// transformCacheSize is the number of transformed files kept in memory.
+const transformCacheSize = 64
+
+// DefaultMaxTransformSize is the size in bytes of the largest file
+// transformed, unless Transformer.MaxSize is set.
+const DefaultMaxTransformSize = 16 << 20
+
+// DefaultCommandTimeout bounds the run time of the converters run by
+// CommandTransform.
+const DefaultCommandTimeout = 30 * time.Second
+
+// WithTransformer adds a content transformer.
+func WithTransformer(t Transformer) Option {
+	return func(s *WebDAV) {
+		s.transformers = append(s.transformers, t)
+		if s.transformed == nil {
+			s.transformed = newTransformCache(transformCacheSize)
+		}
+	}
+}
+
+// CommandTransform gets a Transform function running an external
+// converter, which is given the content on its standard input and must
+// write the result to its standard output within DefaultCommandTimeout.
+func CommandTransform(name string, args ...string) func([]byte) ([]byte, error) {
+	return CommandTransformTimeout(DefaultCommandTimeout, name, args...)
+}
+
+// CommandTransformTimeout is CommandTransform with the given timeout, after
+// which the converter is killed.
+func CommandTransformTimeout(timeout time.Duration, name string, args ...string) func([]byte) ([]byte, error) {
+	return func(src []byte) ([]byte, error) {
+		ctx, cancel := gocontext.WithTimeout(gocontext.Background(), timeout)
+		defer cancel()
+		var out, errOut bytes.Buffer
+		cmd := exec.CommandContext(ctx, name, args...)
+		cmd.WaitDelay = time.Second
+		cmd.Stdin = bytes.NewReader(src)
+		cmd.Stdout = &out
+		cmd.Stderr = &errOut
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("%s: %v: %s", name, err, strings.TrimSpace(errOut.String()))
+		}
+		return out.Bytes(), nil
+	}
+}
+
+func (t Transformer) maxSize() int64 {
+	if t.MaxSize <= 0 {
+		return DefaultMaxTransformSize
+	}
+	return t.MaxSize
+}
+
+// applies determines if the transformer converts a file of the given path
+// and size.
+func (t Transformer) applies(p string, size int64) bool {
+	if size > t.maxSize() {
+		return false
+	}
+	ext := strings.ToLower(path.Ext(p))
+	for _, e := range t.Extensions {
+		if strings.ToLower(e) == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// accepts determines if the Accept header explicitly lists a media type,
+// wildcards are not considered.
+func accepts(accept, mediaType string) bool {
+	for _, a := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(a))
+		if err != nil || mt != mediaType {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// transformerFor selects the transformer for a GET of the file at the
+// given path and of the given size, also reporting whether the response
+// varies with Accept.
+func (s *WebDAV) transformerFor(r *http.Request, p string, size int64) (*Transformer, bool, error) {
+	if name := r.URL.Query().Get("transform"); name != "" {
+		for i, t := range s.transformers {
+			if t.Name == name && t.applies(p, size) {
+				return &s.transformers[i], false, nil
+			}
+		}
+		return nil, false, ErrorNotAcceptable
+	}
+
+	vary := false
+	for i, t := range s.transformers {
+		if !t.applies(p, size) {
+			continue
+		}
+		vary = true
+		if accepts(r.Header.Get("Accept"), t.ContentType) {
+			return &s.transformers[i], true, nil
+		}
+	}
+	return nil, vary, nil
+}
+
+// serveTransformed serves the transformed content of a file, reusing
+// earlier results for the same version of the file. A HEAD does not
+// transform the file, so reports no length unless the result is cached.
+func (s *WebDAV) serveTransformed(ctx context, w http.ResponseWriter, r *http.Request, f File, fi FileInfo, t *Transformer) {
+	tag := fileETag(f, fi) + "+" + t.Name
+	key := f.GetPath() + "\x00" + tag
+	w.Header().Set("Content-Type", t.ContentType)
+	w.Header().Set("ETag", tag)
+	data, ok := s.transformed.get(key)
+	if !ok && r.Method == "HEAD" {
+		w.Header().Set("Last-Modified", fi.LastModified.UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if !ok {
+		fh, err := f.Open()
+		if err != nil {
+			s.errorHeader(ctx, w, err)
+			return
+		}
+		max := t.maxSize()
+		src, err := io.ReadAll(io.LimitReader(fh, max+1))
+		fh.Close()
+		if err == nil && int64(len(src)) > max {
+			err = fmt.Errorf("%s grew beyond %d bytes", f.GetPath(), max)
+		}
+		if err != nil {
+			s.errorHeader(ctx, w, err)
+			return
+		}
+		data, err = t.Transform(src)
+		if err != nil {
+			s.errorHeader(ctx, w, err)
+			return
+		}
+		s.transformed.put(key, data)
+	}
+	http.ServeContent(w, r, "", fi.LastModified, bytes.NewReader(data))
+}
+
+// transformCache is a least recently used cache of transformed content.
+type transformCache struct {
+	m       sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type transformEntry struct {
+	key  string
+	data []byte
+}
+
+func newTransformCache(size int) *transformCache {
+	return &transformCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *transformCache) get(key string) ([]byte, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*transformEntry).data, true
+}
+
+func (c *transformCache) put(key string, data []byte) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*transformEntry).data = data
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&transformEntry{key, data})
+	for c.order.Len() > c.size {
+		e := c.order.Back()
+		c.order.Remove(e)
+		delete(c.entries, e.Value.(*transformEntry).key)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+func TestTransform(t *testing.T) {
+	calls := 0
+	h := webdav.NewWebDAV(memfs.NewMemFS(), webdav.WithTransformer(webdav.Transformer{
+		Name:        "upper",
+		Extensions:  []string{".md"},
+		ContentType: "text/html",
+		Transform: func(src []byte) ([]byte, error) {
+			calls++
+			return []byte(strings.ToUpper(string(src))), nil
+		},
+		MaxSize: 8,
+	}))
+	serve(h, "PUT", "/a.md", "hello")
+	serve(h, "PUT", "/big.md", "0123456789")
+	serve(h, "PUT", "/a.txt", "text")
+
+	plain := serve(h, "GET", "/a.md", "")
+	if plain.Body.String() != "hello" || plain.Header().Get("Vary") != "Accept" {
+		t.Errorf("GET without asking for a transform got %q, Vary %q", plain.Body, plain.Header().Get("Vary"))
+	}
+	if w := serve(h, "HEAD", "/a.md", "", "Accept", "text/html"); w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/html" {
+		t.Errorf("HEAD got %d %v", w.Code, w.Header())
+	}
+	if calls != 0 {
+		t.Errorf("HEAD ran the transform %d times", calls)
+	}
+
+	w := serve(h, "GET", "/a.md", "", "Accept", "text/html")
+	if w.Body.String() != "HELLO" || w.Header().Get("Content-Type") != "text/html" {
+		t.Errorf("GET accepting text/html got %q %v", w.Body, w.Header())
+	}
+	tag := w.Header().Get("ETag")
+	if tag == "" || tag == plain.Header().Get("ETag") {
+		t.Errorf("transformed ETag %q, want one differing from %q", tag, plain.Header().Get("ETag"))
+	}
+	if w := serve(h, "GET", "/a.md?transform=upper", ""); w.Body.String() != "HELLO" || w.Header().Get("Vary") != "" {
+		t.Errorf("GET naming the transform got %q, Vary %q", w.Body, w.Header().Get("Vary"))
+	}
+	if calls != 1 {
+		t.Errorf("transform ran %d times for one version of the file, want once", calls)
+	}
+	if w := serve(h, "HEAD", "/a.md", "", "Accept", "text/html"); w.Header().Get("Content-Length") != "5" {
+		t.Errorf("HEAD of a cached transform got Content-Length %q", w.Header().Get("Content-Length"))
+	}
+
+	serve(h, "PUT", "/a.md", "bye")
+	if w := serve(h, "GET", "/a.md", "", "Accept", "text/html"); w.Body.String() != "BYE" || calls != 2 {
+		t.Errorf("GET after a change got %q with %d transforms", w.Body, calls)
+	}
+
+	for _, tc := range []struct {
+		url, accept string
+		code        int
+		body        string
+	}{
+		{"/a.md?transform=other", "", http.StatusNotAcceptable, ""},
+		{"/a.txt?transform=upper", "", http.StatusNotAcceptable, ""},
+		{"/a.txt", "text/html", http.StatusOK, "text"},
+		{"/a.md", "*/*", http.StatusOK, "bye"},
+		{"/big.md", "text/html", http.StatusOK, "0123456789"},
+		{"/big.md?transform=upper", "", http.StatusNotAcceptable, ""},
+	} {
+		w := serve(h, "GET", tc.url, "", "Accept", tc.accept)
+		if w.Code != tc.code || tc.body != "" && w.Body.String() != tc.body {
+			t.Errorf("GET %s accepting %q got %d %q", tc.url, tc.accept, w.Code, w.Body)
+		}
+	}
+}
+
+func TestCommandTransform(t *testing.T) {
+	out, err := webdav.CommandTransform("tr", "a-z", "A-Z")([]byte("abc"))
+	if err != nil {
+		t.Skipf("tr: %v", err)
+	}
+	if string(out) != "ABC" {
+		t.Errorf("CommandTransform got %q", out)
+	}
+
+	start := time.Now()
+	if _, err := webdav.CommandTransformTimeout(100*time.Millisecond, "sleep", "10")(nil); err == nil {
+		t.Error("expected a converter running past its timeout to fail")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("converter was killed after %s", d)
+	}
+}
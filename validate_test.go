@@ -0,0 +1,69 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+func TestValidatorSizeLimit(t *testing.T) {
+	var checked []string
+	h := webdav.NewWebDAV(memfs.NewMemFS(),
+		webdav.WithValidator("text/calendar", func(p string, data []byte) error {
+			checked = append(checked, p)
+			if strings.Contains(string(data), "bad") {
+				return webdav.ErrorInvalidCalendarData
+			}
+			return nil
+		}),
+		webdav.WithLimits(webdav.Limits{MaxValidatedSize: 8}))
+
+	if w := serve(h, "PUT", "/ok.ics", "12345678", "Content-Type", "text/calendar"); w.Code != http.StatusCreated {
+		t.Errorf("PUT within the limit got %d", w.Code)
+	}
+	if w := serve(h, "PUT", "/bad.ics", "bad", "Content-Type", "text/calendar"); w.Code != http.StatusForbidden {
+		t.Errorf("PUT refused by the validator got %d, want 403", w.Code)
+	}
+	if w := serve(h, "PUT", "/big.ics", "123456789", "Content-Type", "text/calendar"); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("PUT over the limit got %d, want 413", w.Code)
+	}
+
+	// Bodies of unknown length are cut off at the limit.
+	r := httptest.NewRequest("PUT", "/chunked.ics", strings.NewReader("123456789"))
+	r.Header.Set("Content-Type", "text/calendar")
+	r.ContentLength = -1
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("chunked PUT over the limit got %d, want 413", w.Code)
+	}
+	if len(checked) != 2 {
+		t.Errorf("validator checked %v, want only the bodies within the limit", checked)
+	}
+	if w := serve(h, "GET", "/chunked.ics", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET of a refused upload got %d, want 404", w.Code)
+	}
+
+	// Plain uploads are not limited.
+	if w := serve(h, "PUT", "/big.txt", "123456789", "Content-Type", "text/plain"); w.Code != http.StatusCreated {
+		t.Errorf("PUT of an unvalidated type got %d", w.Code)
+	}
+}
@@ -0,0 +1,455 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-webdav/davhttp"
+	wp "github.com/google/go-webdav/path"
+	x "github.com/google/go-webdav/xml"
+)
+
+// VersionsRoot is the collection below which the versions of the files
+// implementing Versioning are served, the version named n of the file at p
+// being at VersionsRoot/n/p. Versions may be read with GET, and are listed
+// by the version-tree REPORT of their file.
+const VersionsRoot = "/.versions"
+
+// versionPath gets the path of a version of the file at p.
+func versionPath(p, name string) string {
+	return VersionsRoot + "/" + name + p
+}
+
+// parseVersionPath gets the file and version name a version path is of.
+func parseVersionPath(p string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(p, VersionsRoot+"/")
+	if !ok {
+		return "", "", false
+	}
+	name, fp, ok := strings.Cut(rest, "/")
+	if !ok || name == "" {
+		return "", "", false
+	}
+	return "/" + fp, name, true
+}
+
+// versionOf gets the Versioning of the file at p and its versions, if it
+// is under version control.
+func (s *WebDAV) versionOf(p string) (Versioning, []Version, bool) {
+	fp, err := s.fs.ForPath(p)
+	if err != nil {
+		return nil, nil, false
+	}
+	f, err := fp.Lookup()
+	if err != nil {
+		return nil, nil, false
+	}
+	v, ok := f.(Versioning)
+	if !ok {
+		return nil, nil, false
+	}
+	versions, err := v.Versions()
+	if err != nil || len(versions) == 0 {
+		return nil, nil, false
+	}
+	return v, versions, true
+}
+
+// serveVersion serves GET and HEAD of the versions of files, reporting
+// whether the request was for one. Versions are immutable, so any other
+// method is not allowed.
+func (s *WebDAV) serveVersion(ctx context, w http.ResponseWriter, r *http.Request) bool {
+	p, name, ok := parseVersionPath(ctx.p.String())
+	if !ok {
+		return false
+	}
+	v, versions, ok := s.versionOf(p)
+	if !ok {
+		return false
+	}
+	if err := s.checkVersionOf(ctx, r, p); err != nil {
+		s.errorHeader(ctx, w, err)
+		return true
+	}
+	var ver *Version
+	for i := range versions {
+		if versions[i].Name == name {
+			ver = &versions[i]
+		}
+	}
+	if ver == nil {
+		s.errorHeader(ctx, w, ErrorNotFound)
+		return true
+	}
+	switch r.Method {
+	case "GET", "HEAD":
+	case "OPTIONS":
+		w.Header().Set("Allow", "OPTIONS, GET, HEAD")
+		return true
+	default:
+		w.Header().Set("Allow", "OPTIONS, GET, HEAD")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return true
+	}
+	fh, err := v.OpenVersion(name)
+	if err != nil {
+		s.errorHeader(ctx, w, err)
+		return true
+	}
+	defer fh.Close()
+	http.ServeContent(w, r, p, ver.Created, fh)
+	return true
+}
+
+// checkVersionOf applies the rules for the file at p to a request for one
+// of its versions, which ServeHTTP checked against the version path only:
+// versions of hidden files are not found, and those of members of drop
+// boxes, or of files the method is disabled for, are refused.
+func (s *WebDAV) checkVersionOf(ctx context, r *http.Request, p string) error {
+	if s.isHidden(p, false) {
+		return ErrorNotFound
+	}
+	if box, ok := s.dropBoxFor(p); ok {
+		fp, err := s.fs.ForPath(p)
+		if err != nil {
+			return err
+		}
+		fctx := ctx
+		fctx.p = fp
+		if err := s.checkDropBox(&fctx, r, box); err != nil {
+			return err
+		}
+	}
+	if s.methodDisabled(p, r.Method) {
+		return ErrorNotAllowed
+	}
+	return nil
+}
+
+// http://www.webdav.org/specs/rfc3253.html#METHOD_VERSION-CONTROL
+func (s *WebDAV) doVersionControl(ctx context, w http.ResponseWriter, r *http.Request) {
+	if err := s.checkLocks(ctx, ctx.p, false); err != nil {
+		s.errorHeader(ctx, w, err)
+		return
+	}
+	f, err := ctx.p.Lookup()
+	if err != nil {
+		s.errorHeader(ctx, w, err)
+		return
+	}
+	if f.IsDirectory() {
+		s.errorHeader(ctx, w, ErrorIsDir)
+		return
+	}
+	v, ok := f.(Versioning)
+	if !ok {
+		s.errorHeader(ctx, w, ErrorNotImplemented)
+		return
+	}
+	if err := v.VersionControl(); err != nil {
+		s.errorHeader(ctx, w, err)
+		return
+	}
+	s.notify(ChangeProps, ctx.p.String(), "")
+	w.WriteHeader(http.StatusOK)
+}
+
+// versionProp gets the versioning properties of a file, reporting whether
+// pn is one of them.
+func (s *WebDAV) versionProp(pn string, f File, a *x.Any) (ok, versioning bool) {
+	switch pn {
+	case "DAV::checked-in", "DAV::checked-out", "DAV::auto-version":
+	default:
+		return false, false
+	}
+	v, ok := f.(Versioning)
+	if !ok {
+		return false, true
+	}
+	versions, err := v.Versions()
+	if err != nil || len(versions) == 0 {
+		return false, true
+	}
+	switch pn {
+	case "DAV::checked-in":
+		a.Inner = s.versionHrefs(f.GetPath(), versions[len(versions)-1])
+		return true, true
+	case "DAV::auto-version":
+		a.Inner = "<checkout-checkin/>"
+		return true, true
+	}
+	// Writes check files out and in again at once, so they are never
+	// left checked out.
+	return false, true
+}
+
+// versionHrefs renders the hrefs of versions of the file at p.
+func (s *WebDAV) versionHrefs(p string, versions ...Version) string {
+	var b bytes.Buffer
+	for _, v := range versions {
+		b.WriteString("<href>")
+		xml.EscapeText(&b, []byte(wp.URLEncode(s.href(versionPath(p, v.Name)))))
+		b.WriteString("</href>")
+	}
+	return b.String()
+}
+
+// doVersionTree handles the version-tree REPORT, listing the versions of a
+// file with the requested properties, see
+// http://www.webdav.org/specs/rfc3253.html#REPORT_version-tree.
+func (s *WebDAV) doVersionTree(ctx context, w http.ResponseWriter, req x.VersionTreeRequest) {
+	p := ctx.p.String()
+	_, versions, ok := s.versionOf(p)
+	if !ok {
+		s.errorHeader(ctx, w, ErrorBadReport)
+		return
+	}
+	ms := x.NewMultiStatus()
+	for i, v := range versions {
+		var found, missing []x.Any
+		for _, pn := range req.PropertyNames {
+			a := x.NewAny(pn)
+			ok := true
+			switch pn {
+			case "DAV::version-name":
+				a.Value = v.Name
+			case "DAV::getcontentlength":
+				a.Value = strconv.FormatInt(v.Size, 10)
+			case "DAV::creationdate", "DAV::getlastmodified":
+				a.Value = v.Created.String()
+			case "DAV::predecessor-set":
+				if i > 0 {
+					a.Inner = s.versionHrefs(p, versions[i-1])
+				}
+			case "DAV::successor-set":
+				if i < len(versions)-1 {
+					a.Inner = s.versionHrefs(p, versions[i+1])
+				}
+			case "DAV::version-history":
+				a.Inner = s.versionHrefs(p, versions...)
+			default:
+				ok = false
+			}
+			if ok {
+				found = append(found, a)
+			} else {
+				missing = append(missing, a)
+			}
+		}
+		ms.AddPropStatus(s.href(versionPath(p, v.Name)), found, missing)
+	}
+	ms.Send(w)
+}
+
+// versionHeader announces the version-control feature in the DAV header for
+// files implementing Versioning.
+func (s *WebDAV) versionHeader(w http.ResponseWriter, p Path) {
+	f, err := p.Lookup()
+	if err != nil {
+		return
+	}
+	if _, ok := f.(Versioning); ok && !f.IsDirectory() {
+		w.Header().Set(davhttp.DAV, w.Header().Get(davhttp.DAV)+", version-control")
+	}
+}
+
+// VersionRetention bounds the past versions kept of each file under version
+// control, zero values mean no limit. The latest version, which is the
+// content of the file, is always kept.
+type VersionRetention struct {
+	// KeepLast is the number of most recent versions kept.
+	KeepLast int
+	// MaxAge is how long versions are kept after they were recorded.
+	MaxAge time.Duration
+}
+
+// expendable lists the versions a policy discards, of those given oldest
+// first.
+func (vr VersionRetention) expendable(versions []Version, now time.Time) []Version {
+	var res []Version
+	for i, v := range versions[:max(len(versions)-1, 0)] {
+		if vr.KeepLast > 0 && i < len(versions)-vr.KeepLast ||
+			vr.MaxAge > 0 && now.Sub(v.Created) > vr.MaxAge {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// pruneVersions discards the versions of a file beyond the VersionRetention
+// set by WithVersionRetention, returning how many were.
+func (s *WebDAV) pruneVersions(f File) (int, error) {
+	if s.versions == (VersionRetention{}) {
+		return 0, nil
+	}
+	v, ok := f.(Versioning)
+	if !ok {
+		return 0, nil
+	}
+	vp, ok := f.(VersionPruner)
+	if !ok {
+		return 0, nil
+	}
+	versions, err := v.Versions()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, ver := range s.versions.expendable(versions, s.clock.Now()) {
+		if err := vp.RemoveVersion(ver.Name); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// PruneVersions applies the VersionRetention set by WithVersionRetention to
+// the files in the tree at root, as is otherwise only done when they are
+// written, so that versions exceeding MaxAge are discarded. It returns the
+// number of versions discarded.
+func (s *WebDAV) PruneVersions(root string) (int, error) {
+	p, err := s.fs.ForPath(root)
+	if err != nil {
+		return 0, err
+	}
+	files, err := p.LookupSubtree(-1)
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, f := range files {
+		n, err := s.pruneVersions(f)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// VersionUsage describes the storage taken by the versions of the files in
+// a tree.
+type VersionUsage struct {
+	// Files is the number of files under version control.
+	Files int `json:"files"`
+	// Versions is the number of versions kept of them.
+	Versions int `json:"versions"`
+	// Size is the total size in bytes of the versions.
+	Size int64 `json:"size"`
+}
+
+// VersionUsage reports the storage taken by the versions of the files in the
+// tree at root.
+func (s *WebDAV) VersionUsage(root string) (VersionUsage, error) {
+	var u VersionUsage
+	p, err := s.fs.ForPath(root)
+	if err != nil {
+		return u, err
+	}
+	files, err := p.LookupSubtree(-1)
+	if err != nil {
+		return u, err
+	}
+	for _, f := range files {
+		v, ok := f.(Versioning)
+		if !ok {
+			continue
+		}
+		versions, err := v.Versions()
+		if err != nil {
+			return u, err
+		}
+		if len(versions) == 0 {
+			continue
+		}
+		u.Files++
+		u.Versions += len(versions)
+		for _, ver := range versions {
+			u.Size += ver.Size
+		}
+	}
+	return u, nil
+}
+
+// doUpdate restores the content of a file under version control to that of
+// one of its versions, recording it as a new version, see
+// http://www.webdav.org/specs/rfc3253.html#METHOD_UPDATE. The versions
+// which may be restored are listed by the version-tree REPORT.
+func (s *WebDAV) doUpdate(ctx context, w http.ResponseWriter, r *http.Request) {
+	if err := s.checkLocks(ctx, ctx.p, false); err != nil {
+		s.errorHeader(ctx, w, err)
+		return
+	}
+	href, err := x.ParseUpdate(r.Body)
+	if err != nil {
+		s.errorHeader(ctx, w, ErrorBadRequest.WithCause(err))
+		return
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		s.errorHeader(ctx, w, ErrorBadPath.WithCause(err))
+		return
+	}
+	fp, name, ok := parseVersionPath(s.stripPrefix(u.Path))
+	if !ok || fp != ctx.p.String() {
+		s.errorHeader(ctx, w, ErrorConflict)
+		return
+	}
+	v, versions, ok := s.versionOf(fp)
+	if !ok {
+		s.errorHeader(ctx, w, ErrorConflict)
+		return
+	}
+	found := false
+	for _, ver := range versions {
+		found = found || ver.Name == name
+	}
+	if !found {
+		s.errorHeader(ctx, w, ErrorConflict)
+		return
+	}
+
+	src, err := v.OpenVersion(name)
+	if err != nil {
+		s.errorHeader(ctx, w, err)
+		return
+	}
+	defer src.Close()
+	f := v.(File)
+	fh, err := f.Truncate()
+	if err != nil {
+		s.errorHeader(ctx, w, ErrorConflict.WithCause(err))
+		return
+	}
+	if _, err := io.Copy(fh, src); err != nil {
+		fh.Close()
+		s.errorHeader(ctx, w, writeError(err))
+		return
+	}
+	if !s.commit(ctx, w, f, fh) {
+		return
+	}
+	s.notify(ChangeModified, fp, "")
+	w.WriteHeader(http.StatusOK)
+}
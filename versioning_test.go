@@ -0,0 +1,172 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+func TestVersioning(t *testing.T) {
+	s := webdav.NewWebDAV(memfs.NewMemFS())
+	serve(s, "PUT", "/a", "one")
+	checkedIn := `<propfind xmlns="DAV:"><prop><checked-in/><checked-out/></prop></propfind>`
+	if w := serve(s, "PROPFIND", "/a", checkedIn, "Depth", "0"); strings.Contains(w.Body.String(), "/.versions/") {
+		t.Errorf("PROPFIND of a file not under version control reported a version:\n%s", w.Body)
+	}
+
+	w := serve(s, "OPTIONS", "/a", "")
+	if !strings.Contains(w.Header().Get("DAV"), "version-control") || !strings.Contains(w.Header().Get("Allow"), "VERSION-CONTROL") {
+		t.Errorf("OPTIONS got DAV %q, Allow %q", w.Header().Get("DAV"), w.Header().Get("Allow"))
+	}
+	if w := serve(s, "VERSION-CONTROL", "/a", ""); w.Code != http.StatusOK {
+		t.Fatalf("VERSION-CONTROL got %d", w.Code)
+	}
+	serve(s, "PUT", "/a", "two")
+	serve(s, "PUT", "/a", "three")
+
+	w = serve(s, "PROPFIND", "/a", checkedIn, "Depth", "0")
+	if !strings.Contains(w.Body.String(), "<href>/.versions/3/a</href>") {
+		t.Errorf("PROPFIND did not report the latest version checked in:\n%s", w.Body)
+	}
+	if !strings.Contains(w.Body.String(), "404 Not Found") {
+		t.Errorf("PROPFIND reported an auto-versioned file checked out:\n%s", w.Body)
+	}
+
+	w = serve(s, "REPORT", "/a", `<version-tree xmlns="DAV:"><prop><version-name/><successor-set/><getcontentlength/></prop></version-tree>`)
+	if w.Code != webdav.StatusMulti {
+		t.Fatalf("version-tree REPORT got %d", w.Code)
+	}
+	for _, want := range []string{
+		"<href>/.versions/1/a</href>",
+		`<version-name xmlns="DAV:">3</version-name>`,
+		`<successor-set xmlns="DAV:"><href>/.versions/2/a</href></successor-set>`,
+		`<getcontentlength xmlns="DAV:">5</getcontentlength>`,
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("version-tree REPORT lacks %s:\n%s", want, w.Body)
+		}
+	}
+
+	for name, want := range map[string]string{"1": "one", "2": "two", "3": "three"} {
+		if w := serve(s, "GET", "/.versions/"+name+"/a", ""); w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("GET of version %s got %d %q, want %q", name, w.Code, w.Body, want)
+		}
+	}
+	if w := serve(s, "PUT", "/.versions/1/a", "x"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("PUT of a version got %d", w.Code)
+	}
+	if w := serve(s, "GET", "/.versions/4/a", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET of a missing version got %d", w.Code)
+	}
+}
+
+func TestVersionRetention(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := webdav.NewWebDAV(memfs.NewMemFSWithClock(clock), webdav.WithClock(clock),
+		webdav.WithVersionRetention(webdav.VersionRetention{KeepLast: 2, MaxAge: 24 * time.Hour}))
+	serve(s, "MKCOL", "/d", "")
+	serve(s, "PUT", "/d/a", "one")
+	serve(s, "VERSION-CONTROL", "/d/a", "")
+	for _, c := range []string{"two", "three"} {
+		clock.now = clock.now.Add(time.Hour)
+		serve(s, "PUT", "/d/a", c)
+	}
+	if w := serve(s, "GET", "/.versions/1/d/a", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET of a version beyond KeepLast got %d, want 404", w.Code)
+	}
+	u, err := s.VersionUsage("/d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (webdav.VersionUsage{Files: 1, Versions: 2, Size: 8}); u != want {
+		t.Errorf("VersionUsage got %+v, want %+v", u, want)
+	}
+
+	// Versions past MaxAge are discarded by PruneVersions, except the
+	// latest.
+	clock.now = clock.now.Add(48 * time.Hour)
+	if n, err := s.PruneVersions("/"); n != 1 || err != nil {
+		t.Errorf("PruneVersions got %d, %v, want 1 version discarded", n, err)
+	}
+	if u, _ := s.VersionUsage("/"); u.Versions != 1 {
+		t.Errorf("after pruning %d versions are kept, want the latest", u.Versions)
+	}
+	if w := serve(s, "GET", "/.versions/3/d/a", ""); w.Body.String() != "three" {
+		t.Errorf("GET of the latest version got %d %q", w.Code, w.Body)
+	}
+}
+
+func TestVersionRestore(t *testing.T) {
+	s := webdav.NewWebDAV(memfs.NewMemFS())
+	serve(s, "PUT", "/a", "one")
+	serve(s, "VERSION-CONTROL", "/a", "")
+	serve(s, "PUT", "/a", "two")
+	serve(s, "PUT", "/b", "b")
+
+	update := func(p, href string) int {
+		return serve(s, "UPDATE", p, `<update xmlns="DAV:"><version><href>`+href+`</href></version></update>`).Code
+	}
+	if code := update("/a", "/.versions/1/a"); code != http.StatusOK {
+		t.Fatalf("UPDATE got %d", code)
+	}
+	if w := serve(s, "GET", "/a", ""); w.Body.String() != "one" {
+		t.Errorf("GET after restoring got %q, want %q", w.Body, "one")
+	}
+	if w := serve(s, "GET", "/.versions/3/a", ""); w.Body.String() != "one" {
+		t.Errorf("restoring did not record a new version, got %d %q", w.Code, w.Body)
+	}
+	for _, tc := range []struct{ path, href string }{
+		{"/a", "/.versions/9/a"},
+		{"/b", "/.versions/1/a"},
+		{"/b", "/.versions/1/b"},
+	} {
+		if code := update(tc.path, tc.href); code != http.StatusConflict {
+			t.Errorf("UPDATE of %s to %s got %d, want 409", tc.path, tc.href, code)
+		}
+	}
+}
+
+// TestVersionPolicy checks versions are served only as their files would
+// be.
+func TestVersionPolicy(t *testing.T) {
+	fs := memfs.NewMemFS()
+	plain := webdav.NewWebDAV(fs)
+	for _, p := range []string{"/box", "/frozen"} {
+		serve(plain, "MKCOL", p, "")
+	}
+	for _, p := range []string{"/box/a", "/secret", "/frozen/a", "/b"} {
+		serve(plain, "PUT", p, "one")
+		serve(plain, "VERSION-CONTROL", p, "")
+	}
+
+	s := webdav.NewWebDAV(fs, webdav.WithDropBoxes("/box"), webdav.WithHidden("/secret"))
+	s.DisableMethods("/frozen", "GET")
+	for p, want := range map[string]int{
+		"/.versions/1/box/a":    http.StatusForbidden,
+		"/.versions/1/secret":   http.StatusNotFound,
+		"/.versions/1/frozen/a": http.StatusMethodNotAllowed,
+		"/.versions/1/b":        http.StatusOK,
+	} {
+		if w := serve(s, "GET", p, ""); w.Code != want {
+			t.Errorf("GET %s got %d, want %d", p, w.Code, want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+
+	wp "github.com/google/go-webdav/path"
+	x "github.com/google/go-webdav/xml"
+)
+
+// VirtualResource is a file whose content is produced by a callback
+// rather than stored in the FileSystem, such as a live status report.
+type VirtualResource struct {
+	// Get produces the current content.
+	Get func() ([]byte, error)
+	// Put optionally accepts content written by clients, without it the
+	// resource is read-only. Content is limited to MaxValidatedSize.
+	Put func(data []byte) error
+	// ContentType is reported for the content, by default
+	// "application/octet-stream".
+	ContentType string
+}
+
+// WithVirtual serves a virtual resource at the given path, shadowing any
+// file in the FileSystem. It is listed by PROPFIND on its parent, which
+// must exist.
+func WithVirtual(p string, v VirtualResource) Option {
+	return func(s *WebDAV) {
+		if s.virtual == nil {
+			s.virtual = make(map[string]VirtualResource)
+		}
+		s.virtual[path.Clean("/"+p)] = v
+	}
+}
+
+func (v VirtualResource) contentType() string {
+	if v.ContentType == "" {
+		return "application/octet-stream"
+	}
+	return v.ContentType
+}
+
+// serveVirtual handles a request for a virtual resource.
+func (s *WebDAV) serveVirtual(ctx context, w http.ResponseWriter, r *http.Request, v VirtualResource) {
+	switch r.Method {
+	case "OPTIONS":
+		s.davHeader(w, ctx.p.String())
+		s.allowedHeader(w, ctx.p)
+	case "GET", "HEAD", "POST":
+		data, err := v.Get()
+		if err != nil {
+			s.errorHeader(ctx, w, err)
+			return
+		}
+		w.Header().Set("Content-Type", v.contentType())
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.WriteHeader(http.StatusOK)
+		if r.Method != "HEAD" {
+			w.Write(data)
+		}
+	case "PUT":
+		if v.Put == nil {
+			s.errorHeader(ctx, w, ErrorNotAllowed)
+			return
+		}
+		data, err := s.readBody(r)
+		if err != nil {
+			s.errorHeader(ctx, w, err)
+			return
+		}
+		if err := v.Put(data); err != nil {
+			s.errorHeader(ctx, w, err)
+			return
+		}
+		s.notify(ChangeModified, ctx.p.String(), "")
+		w.WriteHeader(http.StatusNoContent)
+	case "PROPFIND":
+		req, err := x.ParsePropFind(r.Body)
+		if err != nil {
+			s.errorHeader(ctx, w, ErrorBadPropfind.WithCause(err))
+			return
+		}
+		ms := x.NewMultiStatus()
+		s.addVirtualPropStatus(ms, ctx.p.String(), v, virtualPropNames(req))
+		ms.Send(w)
+	default:
+		s.errorHeader(ctx, w, ErrorNotAllowed)
+	}
+}
+
+func (s *WebDAV) virtualAllowed(v VirtualResource) string {
+	if v.Put != nil {
+		return "OPTIONS, GET, HEAD, POST, PUT, PROPFIND"
+	}
+	return "OPTIONS, GET, HEAD, POST, PROPFIND"
+}
+
+// virtualAllProp are the properties of virtual resources reported for
+// allprop PROPFIND requests.
+var virtualAllProp = []string{"DAV::resourcetype", "DAV::displayname", "DAV::getcontentlength", "DAV::getcontenttype"}
+
+// virtualPropNames gets the names of the properties of virtual resources
+// requested by a PROPFIND request.
+func virtualPropNames(req x.PropFindRequest) []string {
+	if !req.AllProp {
+		return req.PropertyNames
+	}
+	return append(virtualAllProp[:len(virtualAllProp):len(virtualAllProp)], req.PropertyNames...)
+}
+
+// addVirtualPropStatus reports the requested properties of a virtual
+// resource.
+func (s *WebDAV) addVirtualPropStatus(ms x.Responses, p string, v VirtualResource, names []string) {
+	data, err := v.Get()
+	if err != nil {
+		ms.AddStatus(s.href(p), FromOSError(err))
+		return
+	}
+	var found, missing []x.Any
+	for _, pn := range names {
+		a := x.NewAny(pn)
+		switch pn {
+		case "DAV::resourcetype":
+		case "DAV::displayname":
+			a.Value = path.Base(p)
+		case "DAV::getcontentlength":
+			a.Value = strconv.Itoa(len(data))
+		case "DAV::getcontenttype":
+			a.Value = v.contentType()
+		default:
+			missing = append(missing, a)
+			continue
+		}
+		found = append(found, a)
+	}
+	ms.AddPropStatus(s.href(p), found, missing)
+}
+
+// virtualIn gets the paths of the virtual resources within the given
+// depth of a collection, in order.
+func (s *WebDAV) virtualIn(p string, depth int) []string {
+	var res []string
+	for vp := range s.virtual {
+		if _, ok := wp.Included(vp, p, depth); ok {
+			res = append(res, vp)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,89 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-webdav"
+	"github.com/google/go-webdav/memfs"
+)
+
+func TestVirtual(t *testing.T) {
+	status := "ok"
+	var written []string
+	h := webdav.NewWebDAV(memfs.NewMemFS(),
+		webdav.WithVirtual("/status", webdav.VirtualResource{
+			Get:         func() ([]byte, error) { return []byte(status), nil },
+			ContentType: "text/plain",
+		}),
+		webdav.WithVirtual("/d/config", webdav.VirtualResource{
+			Get: func() ([]byte, error) { return []byte("cfg"), nil },
+			Put: func(data []byte) error {
+				written = append(written, string(data))
+				return nil
+			},
+		}),
+		webdav.WithLimits(webdav.Limits{MaxValidatedSize: 8}))
+	serve(h, "MKCOL", "/d", "")
+
+	w := serve(h, "GET", "/status", "")
+	if w.Code != http.StatusOK || w.Body.String() != "ok" || w.Header().Get("Content-Type") != "text/plain" {
+		t.Errorf("GET got %d %q %v", w.Code, w.Body, w.Header())
+	}
+	status = "degraded"
+	if w := serve(h, "HEAD", "/status", ""); w.Header().Get("Content-Length") != "8" || w.Body.Len() != 0 {
+		t.Errorf("HEAD got %v with %d bytes", w.Header(), w.Body.Len())
+	}
+
+	if w := serve(h, "PUT", "/status", "x"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("PUT of a read-only resource got %d, want 405", w.Code)
+	}
+	if w := serve(h, "PUT", "/d/config", "new"); w.Code != http.StatusNoContent {
+		t.Errorf("PUT got %d", w.Code)
+	}
+	if w := serve(h, "PUT", "/d/config", "too large"); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("PUT over the limit got %d, want 413", w.Code)
+	}
+	if len(written) != 1 || written[0] != "new" {
+		t.Errorf("Put got %q, want only the content within the limit", written)
+	}
+
+	for p, want := range map[string]string{
+		"/status":   "OPTIONS, GET, HEAD, POST, PROPFIND",
+		"/d/config": "OPTIONS, GET, HEAD, POST, PUT, PROPFIND",
+	} {
+		if w := serve(h, "OPTIONS", p, ""); w.Header().Get("Allow") != want {
+			t.Errorf("OPTIONS %s got Allow %q, want %q", p, w.Header().Get("Allow"), want)
+		}
+	}
+
+	// Virtual resources are listed with their parents.
+	w = serve(h, "PROPFIND", "/", `<propfind xmlns="DAV:"><prop><getcontentlength/></prop></propfind>`, "Depth", "infinity")
+	body := w.Body.String()
+	for _, want := range []string{"<href>/status</href>", "<href>/d/config</href>", `<getcontentlength xmlns="DAV:">8</getcontentlength>`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("PROPFIND lacks %s:\n%s", want, body)
+		}
+	}
+	if strings.Count(body, "<href>/d/config</href>") != 1 {
+		t.Errorf("PROPFIND listed a virtual resource twice:\n%s", body)
+	}
+	if w := serve(h, "PROPFIND", "/status", "", "Depth", "0"); w.Code != webdav.StatusMulti || !strings.Contains(w.Body.String(), "<getcontenttype") {
+		t.Errorf("allprop PROPFIND got %d:\n%s", w.Code, w.Body)
+	}
+}
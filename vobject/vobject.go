@@ -0,0 +1,217 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package vobject is a minimal parser for the content line format shared by
+iCalendar (RFC 5545) and vCard (RFC 6350), along with validators suitable for
+use as webdav.ContentValidator. It checks structure only; applications
+needing full semantic validation should plug in a dedicated library.
+*/
+package vobject
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	w "github.com/google/go-webdav"
+)
+
+// Property is a single content line within a component.
+type Property struct {
+	Name   string
+	Params map[string][]string
+	Value  string
+}
+
+// Component is a BEGIN/END delimited block of properties, possibly
+// containing further nested components.
+type Component struct {
+	Name     string
+	Props    []Property
+	Children []*Component
+}
+
+// Prop gets the first property with the given name.
+func (c *Component) Prop(name string) (Property, bool) {
+	for _, p := range c.Props {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Property{}, false
+}
+
+// unfold joins folded lines back together, per RFC 5545 section 3.1.
+func unfold(s string) []string {
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	var lines []string
+	for _, l := range strings.Split(s, "\n") {
+		if len(l) > 0 && (l[0] == ' ' || l[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += l[1:]
+			continue
+		}
+		if l == "" {
+			continue
+		}
+		lines = append(lines, l)
+	}
+	return lines
+}
+
+func parseLine(l string) (Property, error) {
+	p := Property{Params: make(map[string][]string)}
+
+	// Find the first colon outside of a quoted parameter value.
+	quoted := false
+	idx := -1
+	for i, r := range l {
+		if r == '"' {
+			quoted = !quoted
+		} else if r == ':' && !quoted {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return p, fmt.Errorf("missing value in %q", l)
+	}
+	p.Value = l[idx+1:]
+
+	parts := strings.Split(l[:idx], ";")
+	p.Name = strings.ToUpper(parts[0])
+	if p.Name == "" {
+		return p, fmt.Errorf("missing name in %q", l)
+	}
+	for _, param := range parts[1:] {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			return p, fmt.Errorf("bad parameter %q", param)
+		}
+		k := strings.ToUpper(kv[0])
+		for _, v := range strings.Split(kv[1], ",") {
+			p.Params[k] = append(p.Params[k], strings.Trim(v, `"`))
+		}
+	}
+	return p, nil
+}
+
+// Parse parses a single top-level component from the given data.
+func Parse(data string) (*Component, error) {
+	var stack []*Component
+	var root *Component
+	for _, l := range unfold(data) {
+		p, err := parseLine(l)
+		if err != nil {
+			return nil, err
+		}
+		switch p.Name {
+		case "BEGIN":
+			if root != nil && len(stack) == 0 {
+				return nil, errors.New("data after end of component")
+			}
+			c := &Component{Name: strings.ToUpper(p.Value)}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, c)
+			} else {
+				root = c
+			}
+			stack = append(stack, c)
+		case "END":
+			if len(stack) == 0 {
+				return nil, errors.New("END without BEGIN")
+			}
+			c := stack[len(stack)-1]
+			if c.Name != strings.ToUpper(p.Value) {
+				return nil, fmt.Errorf("END:%s does not match BEGIN:%s", p.Value, c.Name)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("property %s outside of component", p.Name)
+			}
+			c := stack[len(stack)-1]
+			c.Props = append(c.Props, p)
+		}
+	}
+	if root == nil {
+		return nil, errors.New("no component found")
+	}
+	if len(stack) != 0 {
+		return nil, fmt.Errorf("unterminated component %s", stack[len(stack)-1].Name)
+	}
+	return root, nil
+}
+
+func requireProps(c *Component, names ...string) error {
+	for _, n := range names {
+		if _, ok := c.Prop(n); !ok {
+			return fmt.Errorf("%s is missing %s", c.Name, n)
+		}
+	}
+	return nil
+}
+
+// ValidateCalendar is a webdav.ContentValidator for iCalendar data.
+func ValidateCalendar(p string, data []byte) error {
+	if err := validateCalendar(string(data)); err != nil {
+		return w.ErrorInvalidCalendarData.WithCause(err)
+	}
+	return nil
+}
+
+func validateCalendar(data string) error {
+	c, err := Parse(data)
+	if err != nil {
+		return err
+	}
+	if c.Name != "VCALENDAR" {
+		return fmt.Errorf("expected VCALENDAR, got %s", c.Name)
+	}
+	if err := requireProps(c, "VERSION", "PRODID"); err != nil {
+		return err
+	}
+	if len(c.Children) == 0 {
+		return errors.New("VCALENDAR has no components")
+	}
+	for _, cc := range c.Children {
+		switch cc.Name {
+		case "VEVENT", "VTODO", "VJOURNAL", "VFREEBUSY":
+			if err := requireProps(cc, "UID"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateVCard is a webdav.ContentValidator for vCard data.
+func ValidateVCard(p string, data []byte) error {
+	if err := validateVCard(string(data)); err != nil {
+		return w.ErrorInvalidAddressData.WithCause(err)
+	}
+	return nil
+}
+
+func validateVCard(data string) error {
+	c, err := Parse(data)
+	if err != nil {
+		return err
+	}
+	if c.Name != "VCARD" {
+		return fmt.Errorf("expected VCARD, got %s", c.Name)
+	}
+	return requireProps(c, "VERSION", "FN")
+}
@@ -0,0 +1,57 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vobject
+
+import (
+	"testing"
+)
+
+func TestValidateCalendar(t *testing.T) {
+	examples := map[string]bool{
+		"": false,
+		"BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:x\r\nEND:VCALENDAR\r\n": false,
+		"BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:x\r\n" +
+			"BEGIN:VEVENT\r\nUID:1\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n": true,
+		"BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:x\r\n" +
+			"BEGIN:VEVENT\r\nSUMMARY:no uid\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n": false,
+		"BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:x\r\n" +
+			"BEGIN:VEVENT\r\nUID:1\r\nEND:VTODO\r\nEND:VCALENDAR\r\n": false,
+		"BEGIN:VCALENDAR\nVERSION:2.0\nPRODID:x\nBEGIN:VEVENT\nU\n ID:1\n" +
+			"DESCRIPTION;ALTREP=\"cid:a:b\":text\nEND:VEVENT\nEND:VCALENDAR\n": true,
+	}
+
+	for s, exp := range examples {
+		err := validateCalendar(s)
+		if ok := err == nil; ok != exp {
+			t.Errorf("%q: expected valid=%v, got %v", s, exp, err)
+		}
+	}
+}
+
+func TestValidateVCard(t *testing.T) {
+	examples := map[string]bool{
+		"BEGIN:VCARD\r\nVERSION:4.0\r\nFN:Someone\r\nEND:VCARD\r\n": true,
+		"BEGIN:VCARD\r\nVERSION:4.0\r\nEND:VCARD\r\n":               false,
+		"BEGIN:VCARD\r\nVERSION:4.0\r\nFN:Someone\r\n":              false,
+		"FN:Someone\r\n": false,
+	}
+
+	for s, exp := range examples {
+		err := validateVCard(s)
+		if ok := err == nil; ok != exp {
+			t.Errorf("%q: expected valid=%v, got %v", s, exp, err)
+		}
+	}
+}
@@ -15,38 +15,148 @@
 package webdav
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net/http"
-	"net/url"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/go-webdav/cond"
+	"github.com/google/go-webdav/davhttp"
+	wp "github.com/google/go-webdav/path"
 	x "github.com/google/go-webdav/xml"
 )
 
 // WebDAV is a http.Handler implementation that implements the WebDAV
-// protocol over an abstract FileSystem. Set the Debug field to true
-// in order to enable both serialization and logging of all requests.
+// protocol over an abstract FileSystem. It is configured with Options
+// passed to NewWebDAV, the exported fields are equivalent and remain for
+// compatibility. Set the Debug field to true in order to enable both
+// serialization and logging of all requests.
 type WebDAV struct {
-	fs    FileSystem
-	lm    *lockmaster
-	m     sync.Mutex
-	Debug bool
+	// Accessed atomically, first for alignment.
+	requests    uint64
+	panics      int64
+	slowClients int64
+
+	fs         FileSystem
+	lm         *lockmaster
+	m          sync.Mutex
+	inFlight   int32
+	feed       changeFeed
+	journal    journal
+	sm         *subscriptionmaster
+	logger     *log.Logger
+	prefix     string
+	lockPolicy LockPolicy
+	forks      ForkPolicy
+	clock      Clock
+	hidden     []hideRule
+	virtual    map[string]VirtualResource
+
+	methods        methodFlags
+	strict         bool
+	leniency       leniencies
+	lenientUAs     []string
+	headerHooks    []HeaderHook
+	disposition    string
+	compliance     []string
+	syncTokens     SyncTokenStore
+	syncWindow     time.Duration
+	transformers   []Transformer
+	transformed    *transformCache
+	gateway        RemoteCopier
+	gatewayHosts   []string
+	fallback       http.Handler
+	deferDelete    bool
+	deletions      deletions
+	compressible   []string
+	computed       map[string]ComputedProp
+	aliases        map[string]string
+	overlay        writeOverlay
+	advisory       []string
+	staleLocks     StaleLockPolicy
+	transfers      transfers
+	transferPolicy TransferPolicy
+	namePolicy     NamePolicy
+	maxRanges      int
+	versions       VersionRetention
+	Debug          bool
+
+	// EventStream enables streaming of changes to clients which GET a
+	// path with "Accept: text/event-stream", see Subscribe.
+	EventStream bool
+	// LegacyNotifications enables the SUBSCRIBE, POLL and UNSUBSCRIBE
+	// methods used by Microsoft WebDAV clients for change notification.
+	LegacyNotifications bool
+
+	// MaxDeadProps limits the number of dead properties a single
+	// resource may carry, zero means no limit.
+	MaxDeadProps int
+	// MaxPropValueSize limits the size in bytes of a single dead
+	// property value, zero means no limit.
+	MaxPropValueSize int
+
+	// Validators maps media types, such as "text/calendar", to functions
+	// used to check PUT bodies of that type before they are stored.
+	Validators map[string]ContentValidator
+	// MaxValidatedSize limits the size in bytes of the PUT bodies held
+	// in memory, those checked by Validators or written to virtual
+	// resources, larger ones are refused with 413. Zero means
+	// DefaultMaxValidatedSize.
+	MaxValidatedSize int64
+
+	// DropBoxes lists collections with upload-only semantics: clients
+	// may add new files, but not read, list, overwrite or remove them.
+	DropBoxes []string
+
+	// Retention lists policies making resources immutable for a period
+	// after their creation.
+	Retention []RetentionPolicy
+
+	// Hardened enables a deny-by-default mode, in which requests are
+	// refused while CheckSecurity reports problems.
+	Hardened bool
+	// Authenticated declares that all requests reach the handler through
+	// authentication, such as auth.BasicHandler.
+	Authenticated bool
+	// ReadOnly rejects all methods which would modify the FileSystem.
+	ReadOnly bool
+	// MaxPropfindDepth limits the depth of PROPFIND requests, those with
+	// greater or infinite depth are rejected. Zero means no limit.
+	MaxPropfindDepth int
 }
 
-// NewWebDAV creates a WebDAV http.Handler wrapper around a given FileSystem.
-func NewWebDAV(fs FileSystem) *WebDAV {
-	return &WebDAV{
-		fs: fs,
-		lm: newLockMaster(),
+// ContentValidator checks the content about to be stored at the given path,
+// returning an error (typically an Error with a condition) to reject it.
+type ContentValidator func(p string, data []byte) error
+
+// NewWebDAV creates a WebDAV http.Handler wrapper around a given FileSystem,
+// configured by the given options.
+func NewWebDAV(fs FileSystem, opts ...Option) *WebDAV {
+	s := &WebDAV{
+		fs:         fs,
+		lm:         newLockMaster(),
+		sm:         newSubscriptionMaster(),
+		logger:     log.Default(),
+		clock:      SystemClock,
+		syncTokens: NewMemorySyncTokens(),
 	}
+	for _, o := range opts {
+		o(s)
+	}
+	if err := s.lm.restore(); err != nil {
+		s.logger.Printf("restoring locks: %s", err)
+	}
+	return s
 }
 
 // fsEnv implements cond.Env, without exposing it via WebDAV
@@ -55,7 +165,7 @@ type fsEnv struct {
 }
 
 func (e fsEnv) ETag(r string) string {
-	p, err := e.w.fs.ForPath(r)
+	p, err := e.w.fs.ForPath(e.w.stripPrefix(r))
 	if err != nil {
 		return ""
 	}
@@ -63,15 +173,16 @@ func (e fsEnv) ETag(r string) string {
 	if err != nil {
 		return ""
 	}
+	f = represented(f)
 	fi, err := f.Stat()
 	if err != nil {
 		return ""
 	}
-	return etag(fi)
+	return fileETag(f, fi)
 }
 
 func (e fsEnv) Locked(r, l string) bool {
-	lock := e.w.lm.isLocked(r, l)
+	lock := e.w.lm.isLocked(e.w.stripPrefix(r), l)
 	return lock
 }
 
@@ -83,50 +194,38 @@ type context struct {
 	overwrite bool
 }
 
-// requestDepth gets the desired depth from the given request, defaults
-// to infinity if none specified.
-func parseDepth(r *http.Request) (int, error) {
-	dh := r.Header.Get("Depth")
-	if dh == "infinity" || dh == "Infinity" || dh == "" {
-		return -1, nil
-	}
-	d, err := strconv.Atoi(dh)
+// parseDepth gets the desired depth from the Depth header, defaults to
+// infinity if none specified.
+func parseDepth(dh string) (int, error) {
+	d, err := davhttp.ParseDepth(dh)
 	if err != nil {
 		return 0, ErrorBadDepth.WithCause(err)
 	}
-	if d < 0 {
-		return 0, ErrorBadDepth.WithCause(
-			errors.New("depth must be non-negative or infinity"))
-	}
 	return d, nil
 }
 
-// requestTimeout gets the desired timeout from the request, defaults
-// to one second if none specified or if invalid.
-func parseTimeout(r *http.Request) time.Duration {
-	// Only consider the first 3 presented options.
-	// Spec permits us to ignore this header, so we're free to do
-	// this if we wish (limits potential processing).
-	opts := strings.SplitN(r.Header.Get("Timeout"), ",", 3)
-	for _, o := range opts {
-		o = strings.TrimSpace(o)
-		if o == "Infinite" {
-			// We ignore the infinite request
-			continue
+// parseTimeout gets the desired lock timeout from the Timeout header, zero
+// if none specified or if invalid.
+func parseTimeout(th string) time.Duration {
+	opts, err := davhttp.ParseTimeout(th)
+	if err != nil {
+		// Spec permits us to ignore this header.
+		return 0
+	}
+	// Only consider the first 3 presented options, and ignore requests
+	// for infinite locks.
+	for i, d := range opts {
+		if i == 3 {
+			break
 		}
-		o = strings.TrimPrefix("Second-", o)
-		d, err := strconv.Atoi(o)
-		if err != nil {
-			// Ignoring invalid.
-			continue
+		if d > 0 {
+			return d
 		}
-		return time.Duration(d) * time.Second
 	}
-	return time.Second
+	return 0
 }
 
-func parseIfHeader(r *http.Request) (*cond.IfTag, error) {
-	ih := r.Header.Get("If")
+func parseIfHeader(ih, host string) (*cond.IfTag, error) {
 	if ih == "" {
 		return nil, nil
 	}
@@ -134,86 +233,261 @@ func parseIfHeader(r *http.Request) (*cond.IfTag, error) {
 	if err != nil {
 		return nil, err
 	}
-	err = t.RewriteHosts(r.Host)
+	err = t.RewriteHosts(host)
 	if err != nil {
 		return nil, err
 	}
-	log.Printf("If %s", t)
 	return t, nil
 }
 
 func (s *WebDAV) extractContext(r *http.Request) (ctx context, err error) {
-	ctx.p, err = s.fs.ForPath(r.URL.Path)
+	rp, ok := s.trimPrefix(r.URL.Path)
+	if !ok {
+		err = ErrorNotFound
+		return
+	}
+	ctx.p, err = s.fs.ForPath(rp)
 	if err != nil {
 		return
 	}
 
-	ctx.depth, err = parseDepth(r)
+	lenient := s.lenientFor(r)
+	ctx.depth, err = s.parseDepth(r.Header.Get(davhttp.Depth), lenient)
 	if err != nil {
 		return
 	}
 
-	ctx.cond, err = parseIfHeader(r)
+	ctx.cond, err = s.parseIf(r.Header.Get(davhttp.If), r.Host, lenient)
 	if err != nil {
 		return
 	}
+	if ctx.cond != nil {
+		s.logger.Printf("If %s", ctx.cond)
+	}
 
-	ctx.timeout = parseTimeout(r)
-	ctx.overwrite = r.Header.Get("Overwrite") != "F"
+	ctx.timeout = s.lockPolicy.timeout(parseTimeout(r.Header.Get(davhttp.Timeout)))
+	ctx.overwrite, err = s.parseOverwrite(r.Header.Get(davhttp.Overwrite), lenient)
 	return
 }
 
-func (s *WebDAV) checkCanWrite(ctx context, p Path) bool {
-	l := s.lm.getLockForPath(p.String())
-	if l == nil {
-		return true
+// RequestContext holds the WebDAV headers of a request, as parsed by
+// ParseRequest.
+type RequestContext struct {
+	// Path is the resource addressed, relative to the prefix.
+	Path Path
+	// Depth is the value of the Depth header, -1 for infinity.
+	Depth int
+	// Timeout is the lock timeout to grant, subject to the LockPolicy.
+	Timeout time.Duration
+	// Cond is the parsed If header, nil if absent.
+	Cond *cond.IfTag
+	// Overwrite is false if the Overwrite header is "F".
+	Overwrite bool
+}
+
+// ParseRequest parses the WebDAV headers of a request as the handler does,
+// so that custom method handlers and middleware, such as REPORT handlers,
+// need not duplicate it.
+func (s *WebDAV) ParseRequest(r *http.Request) (RequestContext, error) {
+	ctx, err := s.extractContext(r)
+	if err != nil {
+		return RequestContext{}, err
+	}
+	return RequestContext{
+		Path:      ctx.p,
+		Depth:     ctx.depth,
+		Timeout:   ctx.timeout,
+		Cond:      ctx.cond,
+		Overwrite: ctx.overwrite,
+	}, nil
+}
+
+// checkLocks checks that the tokens of the locks on a path were submitted
+// in the If header, returning ErrorLockTokenSubmitted naming the roots of
+// those which were not. Any token of the locks covering the path will do,
+// and with subtree, as for DELETE or MOVE, those of the locks rooted within
+// it are needed too, one for each root. Advisory locks, see
+// WithAdvisoryLocks, are not checked.
+func (s *WebDAV) checkLocks(ctx context, p Path, subtree bool) error {
+	submitted := make(map[string]bool)
+	if ctx.cond != nil {
+		for _, t := range ctx.cond.GetAllTokens() {
+			submitted[normalizeToken(t)] = true
+		}
 	}
-	if ctx.cond == nil {
-		return false
+	ps := p.String()
+	var covering []string
+	coveringOK := false
+	roots := make(map[string]bool)
+	for _, l := range s.lm.allLocks() {
+		ok := submitted[normalizeToken(l.token)]
+		if ok {
+			l.use()
+		}
+		if _, in := wp.Included(ps, l.path, l.depth); in {
+			if s.advisoryLocks(ps) {
+				continue
+			}
+			covering = append(covering, l.path)
+			coveringOK = coveringOK || ok
+		} else if subtree && wp.InTree(l.path, ps) && !s.advisoryLocks(l.path) {
+			roots[l.path] = roots[l.path] || ok
+		}
+	}
+	var missing []string
+	if !coveringOK {
+		missing = append(missing, covering...)
 	}
-	tokens := ctx.cond.GetAllTokens()
-	for _, t := range tokens {
-		if s.lm.isLocked(p.String(), t) {
-			return true
+	for r, ok := range roots {
+		if !ok {
+			missing = append(missing, r)
 		}
 	}
-	return false
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	return ErrorLockTokenSubmitted.WithResources(missing...)
 }
 
 func (s *WebDAV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&s.inFlight, 1)
+	defer atomic.AddInt32(&s.inFlight, -1)
+
+	// An unsafe configuration serves nothing at all in Hardened mode.
+	if s.Hardened {
+		if err := s.checkHardened(r); err != nil {
+			s.logger.Printf("refusing request: %s", err)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	// Event streams are long lived, so must be handled before any
+	// debug serialization.
+	if s.EventStream && wantsEventStream(r) {
+		s.serveEventStream(w, r)
+		return
+	}
+
+	if len(s.headerHooks) > 0 {
+		hw := &hookWriter{
+			ResponseWriter: w,
+			r:              r,
+			p:              s.stripPrefix(r.URL.Path),
+			hooks:          s.headerHooks,
+		}
+		defer hw.finish()
+		w = hw
+	}
+
 	// Debug processing, force serialization of all requests and
 	// log their details.
 	if s.Debug {
 		s.m.Lock()
 		defer s.m.Unlock()
 
-		log.Println()
-		log.Println(r.Method, r.URL)
+		s.logger.Println()
+		s.logger.Println(r.Method, r.URL)
 		for k, v := range r.Header {
-			log.Println(k, ":", v)
+			s.logger.Println(k, ":", v)
 		}
 	}
 
-	// Handle dumping all files.
-	if r.URL.Path == "/dumpz" {
-		s.fs.Dumpz()
+	// Answer panics with an error rather than dropping the connection.
+	pw := s.requestWriter(w, r)
+	defer s.recoverPanic(pw, r)
+
+	// Count the bytes transferred, cutting off slow clients.
+	w, done := s.trackTransfer(pw, r)
+	defer done()
+
+	if err := checkFraming(r); err != nil {
+		s.errorHeader(context{}, w, err)
 		return
 	}
 
+	// The debug endpoints shadow files of the same names when debugging.
+	if s.dumpEnabled() {
+		if h := s.debugEndpoint(r.URL.Path); h != nil {
+			h(w, r)
+			return
+		}
+	}
+
+	// Lock-null resources vanish once their locks expire, or are broken.
+	s.breakStaleLocks()
+	s.removeLockNulls()
+
 	ctx, err := s.extractContext(r)
 	if err != nil {
 		s.errorHeader(ctx, w, err)
 		return
 	}
 
+	if (r.Method == "PUT" || r.Method == "MKCOL") && s.pendingDeletion(ctx.p.String()) {
+		s.errorHeader(ctx, w, ErrorConflict.WithCause(errDeletionPending))
+		return
+	}
+
+	if s.isHiddenPath(ctx.p) {
+		s.notFound(ctx, w, r, ErrorNotFound)
+		return
+	}
+
 	if ctx.cond != nil {
-		if !ctx.cond.Eval(fsEnv{w: s}, ctx.p.String()) {
-			log.Println("Precondition failed")
+		if !ctx.cond.Eval(fsEnv{w: s}, s.href(ctx.p.String())) {
+			s.logger.Println("Precondition failed")
 			w.WriteHeader(http.StatusPreconditionFailed)
 			return
 		}
 	}
 
+	if err := s.checkPreconditions(ctx, r); err != nil {
+		s.errorHeader(ctx, w, err)
+		return
+	}
+
+	if box, ok := s.dropBoxFor(ctx.p.String()); ok {
+		if err := s.checkDropBox(&ctx, r, box); err != nil {
+			s.errorHeader(ctx, w, err)
+			return
+		}
+	}
+
+	if s.ReadOnly && !readOnlyMethods[r.Method] {
+		s.errorHeader(ctx, w, ErrorNotAllowed)
+		return
+	}
+
+	if s.methodDisabled(ctx.p.String(), r.Method) {
+		s.errorHeader(ctx, w, ErrorNotAllowed)
+		return
+	}
+
+	if err := s.checkRetention(ctx, r); err != nil {
+		s.errorHeader(ctx, w, err)
+		return
+	}
+
+	if v, ok := s.virtual[ctx.p.String()]; ok {
+		s.serveVirtual(ctx, w, r, v)
+		return
+	}
+
+	if s.serveFork(ctx, w, r) {
+		return
+	}
+
+	if s.serveVersion(ctx, w, r) {
+		return
+	}
+
+	if err := s.checkName(ctx, r); err != nil {
+		s.errorHeader(ctx, w, err)
+		return
+	}
+
 	switch r.Method {
 	case "OPTIONS":
 		s.doOptions(ctx, w, r)
@@ -228,6 +502,8 @@ func (s *WebDAV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		s.doDelete(ctx, w, r)
 	case "PUT":
 		s.doPut(ctx, w, r)
+	case "PATCH":
+		s.doPatch(ctx, w, r)
 	case "MKCOL":
 		s.doMkcol(ctx, w, r)
 
@@ -240,46 +516,98 @@ func (s *WebDAV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		s.doPropfind(ctx, w, r)
 	case "PROPPATCH":
 		s.doProppatch(ctx, w, r)
+	case "REPORT":
+		s.doReport(ctx, w, r)
+	case "SEARCH":
+		s.doSearch(ctx, w, r)
+	case "VERSION-CONTROL":
+		s.doVersionControl(ctx, w, r)
+	case "UPDATE":
+		s.doUpdate(ctx, w, r)
 
 	case "LOCK":
 		s.doLock(ctx, w, r)
 	case "UNLOCK":
 		s.doUnlock(ctx, w, r)
 
+	case "SUBSCRIBE":
+		if !s.LegacyNotifications {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.doSubscribe(ctx, w, r)
+	case "POLL":
+		if !s.LegacyNotifications {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.doPoll(ctx, w, r)
+	case "UNSUBSCRIBE":
+		if !s.LegacyNotifications {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.doUnsubscribe(ctx, w, r)
+
 	default:
 		w.WriteHeader(http.StatusBadRequest)
 	}
 }
 
 func (s *WebDAV) allowedHeader(w http.ResponseWriter, p Path) {
+	if v, ok := s.virtual[p.String()]; ok {
+		w.Header().Set("Allow", s.filterAllowed(p.String(), s.virtualAllowed(v)))
+		return
+	}
 	allowed := "OPTIONS, MKCOL, PUT, LOCK"
 	f, err := p.Lookup()
 	if err == nil {
-		allowed = "OPTIONS, GET, HEAD, POST, DELETE, TRACE, PROPPATCH, COPY, MOVE, LOCK, UNLOCK"
+		allowed = "OPTIONS, GET, HEAD, POST, DELETE, TRACE, PROPPATCH, COPY, MOVE, LOCK, UNLOCK, REPORT, SEARCH"
 		if f.IsDirectory() {
 			allowed += ", PUT, PROPFIND"
+		} else {
+			if _, ok := f.(Updater); ok {
+				allowed += ", PATCH"
+			}
+			if _, ok := f.(Versioning); ok {
+				allowed += ", VERSION-CONTROL, UPDATE"
+			}
 		}
 	}
-	w.Header().Set("Allow", allowed)
+	w.Header().Set("Allow", s.filterAllowed(p.String(), allowed))
 }
 
 func (s *WebDAV) errorHeader(ctx context, w http.ResponseWriter, e error) {
-	log.Printf("E[%s]: %s", ctx.p, e)
-	if we, ok := e.(Error); ok {
-		w.WriteHeader(we.HTTPCode())
+	s.logger.Printf("E[%s]: %s", ctx.p, e)
+	var we Error
+	if errors.As(FromOSError(e), &we) {
 		if we.HTTPCode() == http.StatusMethodNotAllowed {
 			s.allowedHeader(w, ctx.p)
 		}
+		if d := we.RetryAfter(); d > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int((d+time.Second-1)/time.Second)))
+		}
+		if we.Condition() != "" {
+			var hrefs []string
+			for _, p := range we.Resources() {
+				hrefs = append(hrefs, wp.URLEncode(s.href(p)))
+			}
+			x.SendError(w, we.HTTPCode(), we.Condition(), hrefs...)
+		} else {
+			w.WriteHeader(we.HTTPCode())
+		}
 	} else {
 		w.WriteHeader(http.StatusInternalServerError)
 	}
 }
 
 func (s *WebDAV) doOptions(ctx context, w http.ResponseWriter, r *http.Request) {
-	// http://www.webdav.org/specs/rfc4918.html#dav.compliance.classes
-	w.Header().Set("DAV", "1, 2")
+	s.davHeader(w, ctx.p.String())
 	s.allowedHeader(w, ctx.p)
 	w.Header().Set("MS-Author-Via", "DAV")
+	w.Header().Set("DASL", "<DAV:basicsearch>")
+	s.lockEnforcementHeader(w, ctx.p.String())
+	s.versionHeader(w, ctx.p)
 }
 
 // http://www.webdav.org/specs/rfc4918.html#rfc.section.9.4
@@ -293,17 +621,43 @@ func (s *WebDAV) doHead(ctx context, w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *WebDAV) servePath(ctx context, w http.ResponseWriter, r *http.Request, content bool) {
-	f, err := ctx.p.Lookup()
+	if ex, ok := ctx.p.(Exister); ok && !content {
+		if exists, err := ex.Exists(); err == nil && !exists && !s.overlaid(ctx.p.String()) {
+			s.notFound(ctx, w, r, ErrorNotFound)
+			return
+		}
+	}
+
+	f, err := s.lookup(ctx.p)
+	if errors.Is(err, ErrorUnavailable) {
+		s.errorHeader(ctx, w, err)
+		return
+	}
 	if err != nil {
-		s.errorHeader(ctx, w, ErrorNotFound.WithCause(err))
+		s.notFound(ctx, w, r, ErrorNotFound.WithCause(err))
 		return
 	}
+	f = represented(f)
 
 	fi, err := f.Stat()
 	if err != nil {
 		s.errorHeader(ctx, w, err)
 		return
 	}
+
+	t, vary, err := s.transformerFor(r, ctx.p.String(), fi.Size)
+	if err != nil {
+		s.errorHeader(ctx, w, err)
+		return
+	}
+	if vary {
+		w.Header().Add("Vary", "Accept")
+	}
+	if t != nil {
+		s.serveTransformed(ctx, w, r, f, fi, t)
+		return
+	}
+
 	var fh FileHandle
 	if content {
 		fh, err = f.Open()
@@ -315,8 +669,26 @@ func (s *WebDAV) servePath(ctx context, w http.ResponseWriter, r *http.Request,
 		return
 	}
 	defer fh.Close()
-	w.Header().Set("ETag", etag(fi))
-	http.ServeContent(w, r, ctx.p.String(), fi.LastModified, fh)
+	tag := fileETag(f, fi)
+	var rs io.ReadSeeker = fh
+	if !f.IsDirectory() {
+		s.setDisposition(w, f)
+		if content {
+			rs = &lazySeeker{fh: fh, size: fi.Size}
+		}
+		if s.compresses(ctx.p.String()) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			if acceptsGzip(r) && r.Header.Get("Range") == "" {
+				// The compressed content is an entity of its own.
+				tag += "-gzip"
+				gw := &gzipWriter{ResponseWriter: w, body: content}
+				defer gw.close()
+				w = gw
+			}
+		}
+	}
+	w.Header().Set("ETag", tag)
+	http.ServeContent(w, s.limitRanges(r), ctx.p.String(), fi.LastModified, rs)
 }
 
 // http://www.webdav.org/specs/rfc4918.html#METHOD_POST
@@ -326,8 +698,8 @@ func (s *WebDAV) doPost(ctx context, w http.ResponseWriter, r *http.Request) {
 
 // http://www.wbdav.org/specs/rfc4918.html#METHOD_DELETE
 func (s *WebDAV) doDelete(ctx context, w http.ResponseWriter, r *http.Request) {
-	if !s.checkCanWrite(ctx, ctx.p) {
-		s.errorHeader(ctx, w, ErrorLocked)
+	if err := s.checkLocks(ctx, ctx.p, true); err != nil {
+		s.errorHeader(ctx, w, err)
 		return
 	}
 
@@ -343,16 +715,26 @@ func (s *WebDAV) doDelete(ctx context, w http.ResponseWriter, r *http.Request) {
 			s.errorHeader(ctx, w, err)
 			return
 		}
+		s.notify(ChangeRemoved, ctx.p.String(), "")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if s.deferDelete {
+		s.deleteLater(ctx.p)
+		s.notify(ChangeRemoved, ctx.p.String(), "")
+		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
 	errs := ctx.p.RecursiveRemove()
+	s.notify(ChangeRemoved, ctx.p.String(), "")
 	if len(errs) == 0 {
 		w.WriteHeader(http.StatusNoContent)
 	} else {
 		ms := x.NewMultiStatus()
 		for p, e := range errs {
-			ms.AddStatus(p, e)
+			ms.AddStatus(s.href(p), FromOSError(e))
 		}
 		ms.Send(w)
 	}
@@ -360,47 +742,159 @@ func (s *WebDAV) doDelete(ctx context, w http.ResponseWriter, r *http.Request) {
 
 // http://www.webdav.org/specs/rfc4918.html#METHOD_PUT
 func (s *WebDAV) doPut(ctx context, w http.ResponseWriter, r *http.Request) {
-	if !s.checkCanWrite(ctx, ctx.p) {
-		s.errorHeader(ctx, w, ErrorLocked)
+	if err := s.checkLocks(ctx, ctx.p, false); err != nil {
+		s.errorHeader(ctx, w, err)
 		return
 	}
 
-	var fh FileHandle
+	if cr := r.Header.Get("Content-Range"); cr != "" {
+		rng, err := parseContentRange(cr)
+		if err != nil {
+			s.errorHeader(ctx, w, ErrorBadRequest.WithCause(err))
+			return
+		}
+		s.updatePart(ctx, w, r, rng)
+		return
+	}
+
+	// The body is only read, and 100 Continue only sent to clients
+	// expecting it, once the request is known to be acceptable.
 	f, err := ctx.p.Lookup()
-	exists := false
-	if err == nil {
-		if f.IsDirectory() {
-			s.errorHeader(ctx, w, ErrorIsDir)
+	exists := err == nil
+	if exists && f.IsDirectory() {
+		s.errorHeader(ctx, w, ErrorIsDir)
+		return
+	}
+	if sc, ok := ctx.p.(SpaceChecker); ok && r.ContentLength > 0 {
+		if err := sc.CheckSpace(r.ContentLength); err != nil {
+			s.errorHeader(ctx, w, err)
+			return
+		}
+	}
+
+	var body io.Reader = r.Body
+	if v := s.validatorFor(r); v != nil {
+		data, err := s.readBody(r)
+		if err != nil {
+			s.errorHeader(ctx, w, err)
+			return
+		}
+		if err := v(ctx.p.String(), data); err != nil {
+			s.errorHeader(ctx, w, err)
 			return
 		}
+		body = bytes.NewReader(data)
+	}
 
-		exists = true
-		fh, err = f.Truncate()
+	var fh FileHandle
+	if exists {
+		if ct, ok := f.(ConditionalTruncater); ok {
+			fh, err = ct.TruncateIf(s.preconditions(ctx, r, f))
+		} else {
+			fh, err = f.Truncate()
+		}
+	} else if cc, ok := ctx.p.(ConditionalCreator); ok {
+		f, fh, err = cc.CreateIf(s.preconditions(ctx, r, nil))
 	} else {
 		f, fh, err = ctx.p.Create()
 	}
 
 	if err != nil {
-		s.errorHeader(ctx, w, ErrorConflict.WithCause(err))
+		if !errors.Is(err, ErrorPrecondition) {
+			err = ErrorConflict.WithCause(err)
+		}
+		s.errorHeader(ctx, w, err)
 		return
 	}
-	defer fh.Close()
 
-	if _, err := io.Copy(fh, r.Body); err != nil {
-		s.errorHeader(ctx, w, ErrorConflict)
+	if _, err := io.Copy(fh, body); err != nil {
+		fh.Close()
+		s.errorHeader(ctx, w, writeError(err))
+		return
+	}
+	if !s.commit(ctx, w, f, fh) {
+		return
+	}
+
+	if exists {
+		s.notify(ChangeModified, ctx.p.String(), "")
+		w.WriteHeader(http.StatusNoContent)
 	} else {
-		if exists {
-			w.WriteHeader(http.StatusNoContent)
-		} else {
-			w.WriteHeader(http.StatusCreated)
+		s.notify(ChangeCreated, ctx.p.String(), "")
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+// readBody reads a PUT body to be held in memory, refusing those larger
+// than MaxValidatedSize with ErrorTooLarge.
+func (s *WebDAV) readBody(r *http.Request) ([]byte, error) {
+	max := s.MaxValidatedSize
+	if max <= 0 {
+		max = DefaultMaxValidatedSize
+	}
+	if r.ContentLength > max {
+		return nil, ErrorTooLarge
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, max+1))
+	if err != nil {
+		return nil, writeError(err)
+	}
+	if int64(len(data)) > max {
+		return nil, ErrorTooLarge
+	}
+	return data, nil
+}
+
+// commit closes a handle written by a request, reporting the ETag of the
+// content written if the handle implements Committer. It reports whether
+// it succeeded, answering the request otherwise.
+func (s *WebDAV) commit(ctx context, w http.ResponseWriter, f File, fh FileHandle) bool {
+	var written *FileInfo
+	if c, ok := fh.(Committer); ok {
+		fi, err := c.Commit()
+		if err != nil {
+			s.errorHeader(ctx, w, writeError(err))
+			return false
 		}
+		w.Header().Set("ETag", fileETag(fh, fi))
+		written = &fi
+	} else {
+		fh.Close()
 	}
+	s.overlayWrite(f, written)
+	if _, err := s.pruneVersions(f); err != nil {
+		s.logger.Printf("pruning versions of %s: %s", f.GetPath(), err)
+	}
+	return true
+}
+
+// writeError maps an error writing the body of a PUT. Errors of the
+// backend, such as running out of space, are reported as such; anything
+// else is a failure to read the body.
+func writeError(err error) error {
+	var we Error
+	if !errors.As(FromOSError(err), &we) {
+		return ErrorConflict.WithCause(err)
+	}
+	return err
+}
+
+// validatorFor gets the ContentValidator for the request's media type.
+func (s *WebDAV) validatorFor(r *http.Request) ContentValidator {
+	if len(s.Validators) == 0 {
+		return nil
+	}
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil
+	}
+	return s.Validators[mt]
 }
 
 // http://www.webdav.org/specs/rfc4918.html#METHOD_MKCOL
 func (s *WebDAV) doMkcol(ctx context, w http.ResponseWriter, r *http.Request) {
-	if !s.checkCanWrite(ctx, ctx.p) {
-		s.errorHeader(ctx, w, ErrorLocked)
+	if err := s.checkLocks(ctx, ctx.p, false); err != nil {
+		s.errorHeader(ctx, w, err)
 		return
 	}
 
@@ -415,11 +909,13 @@ func (s *WebDAV) doMkcol(ctx context, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = ctx.p.Mkdir()
+	f, err := ctx.p.Mkdir()
 	if err != nil {
 		s.errorHeader(ctx, w, ErrorConflict.WithCause(err))
 		return
 	}
+	s.overlayWrite(f, nil)
+	s.notify(ChangeCreated, ctx.p.String(), "")
 	w.WriteHeader(http.StatusCreated)
 }
 
@@ -435,49 +931,103 @@ func (s *WebDAV) doMove(ctx context, w http.ResponseWriter, r *http.Request) {
 
 func (s *WebDAV) handleCopyOrMove(ctx context, w http.ResponseWriter, r *http.Request, move bool) {
 	src := ctx.p
-	if move && !s.checkCanWrite(ctx, src) {
-		s.errorHeader(ctx, w, ErrorLocked)
+	if move {
+		if err := s.checkLocks(ctx, src, true); err != nil {
+			s.errorHeader(ctx, w, err)
+			return
+		}
+	}
+
+	durl, err := davhttp.ParseDestination(r.Header.Get(davhttp.Destination))
+	if err != nil {
+		s.errorHeader(ctx, w, ErrorBadDest.WithCause(err))
 		return
 	}
 
-	dhdr := r.Header.Get("Destination")
-	if dhdr == "" {
+	// Destination host must match our source, an absolute path is on it,
+	// unless the gateway copies to it.
+	if durl.Host != "" && durl.Host != r.Host {
+		if s.gatewayAllows(durl.Host) {
+			s.copyRemote(ctx, w, r, durl, move)
+			return
+		}
+		s.errorHeader(ctx, w, ErrorBadHost)
+		return
+	}
+
+	dp, ok := s.trimPrefix(durl.Path)
+	if !ok {
 		s.errorHeader(ctx, w, ErrorBadDest)
 		return
 	}
-	durl, err := url.Parse(dhdr)
+	dst, err := s.fs.ForPath(dp)
 	if err != nil {
 		s.errorHeader(ctx, w, ErrorBadDest.WithCause(err))
 		return
 	}
 
-	// Destination host must match our source.
-	if durl.Host != r.Host {
-		s.errorHeader(ctx, w, ErrorBadHost)
+	if _, ok := s.virtual[dst.String()]; ok || s.isHiddenPath(dst) {
+		s.errorHeader(ctx, w, ErrorForbidden)
+		return
+	}
+	if s.methodDisabled(dst.String(), r.Method) {
+		s.errorHeader(ctx, w, ErrorNotAllowed)
 		return
 	}
 
-	dst, err := s.fs.ForPath(durl.Path)
-	if err != nil {
-		s.errorHeader(ctx, w, ErrorBadDest.WithCause(err))
+	if err := s.checkLocks(ctx, dst, true); err != nil {
+		s.errorHeader(ctx, w, err)
 		return
 	}
 
-	if !s.checkCanWrite(ctx, dst) {
-		s.errorHeader(ctx, w, ErrorLocked)
+	// Destination conflicts are resolved here rather than left to the
+	// backend, so the status codes do not depend on the FileSystem.
+	srcf, err := src.Lookup()
+	if err != nil {
+		s.errorHeader(ctx, w, ErrorNotFound.WithCause(err))
+		return
+	}
+	if src.String() == dst.String() {
+		s.errorHeader(ctx, w, ErrorSameFile)
+		return
+	}
+	if err := s.checkCopyNames(src, srcf, dst); err != nil {
+		s.errorHeader(ctx, w, err)
+		return
+	}
+	if _, err := dst.Parent().Lookup(); err != nil {
+		s.errorHeader(ctx, w, ErrorMissingParent.WithCause(err))
+		return
+	}
+	if _, ok := s.dropBoxFor(dst.String()); ok {
+		// Nothing in a drop-box may be overwritten.
+		ctx.overwrite = false
+	}
+	if _, err := dst.Lookup(); err == nil && !ctx.overwrite {
+		s.errorHeader(ctx, w, ErrorDestExists)
+		return
+	}
+	if err := s.checkRetained(dst, true); err != nil {
+		s.errorHeader(ctx, w, err)
 		return
 	}
 
-	log.Println("TO ", dst)
+	s.logger.Println("TO ", dst)
 	newf, err := src.CopyTo(dst, CopyOptions{
-		Overwrite: ctx.overwrite,
-		Move:      move,
-		Depth:     ctx.depth,
+		Overwrite:     ctx.overwrite,
+		Move:          move,
+		Depth:         ctx.depth,
+		Preconditions: s.preconditions(ctx, r, srcf),
 	})
 	if err != nil {
 		s.errorHeader(ctx, w, err)
 		return
 	}
+	if move {
+		s.notify(ChangeMoved, src.String(), dst.String())
+	} else {
+		s.notify(ChangeCopied, src.String(), dst.String())
+	}
 	if newf {
 		w.WriteHeader(http.StatusCreated)
 	} else {
@@ -496,6 +1046,30 @@ func etag(fi FileInfo) string {
 	return fmt.Sprintf("%d-%s", fi.Size, fi.LastModified)
 }
 
+// fileETag gets the entity tag of a File with the given FileInfo, or of
+// the content written by a FileHandle, which is that supplied if it
+// implements ETagger.
+func fileETag(v interface{}, fi FileInfo) string {
+	if et, ok := v.(ETagger); ok {
+		if tag, err := et.ETag(); err == nil && tag != "" {
+			return tag
+		}
+	}
+	return etag(fi)
+}
+
+// represented gets the File served for GET of f, which is the
+// representation of a collection implementing Representer, if it has one,
+// and f itself otherwise.
+func represented(f File) File {
+	if r, ok := f.(Representer); ok && f.IsDirectory() {
+		if rf, err := r.Representation(); err == nil {
+			return rf
+		}
+	}
+	return f
+}
+
 func getFileStatProp(n string, f File) (v string, err error) {
 	fi, err := f.Stat()
 	if err != nil {
@@ -505,7 +1079,13 @@ func getFileStatProp(n string, f File) (v string, err error) {
 	case "DAV::getlastmodified":
 		v = fi.LastModified.String()
 	case "DAV::getetag":
-		v = etag(fi)
+		if f.IsDirectory() {
+			f = represented(f)
+			if fi, err = f.Stat(); err != nil {
+				return
+			}
+		}
+		v = fileETag(f, fi)
 	case "DAV::getcontentlength":
 		v = strconv.FormatInt(fi.Size, 10)
 	case "DAV::creationdate":
@@ -519,6 +1099,13 @@ func getFileStatProp(n string, f File) (v string, err error) {
 // with the correct name, but potentially lack a value if not present.
 func (s *WebDAV) getPropValue(pn string, f File) (x.Any, bool) {
 	a := x.NewAny(pn)
+	pn = s.canonicalProp(pn)
+	if ok, computed := s.computedProp(pn, f, &a); computed {
+		return a, ok
+	}
+	if ok, versioning := s.versionProp(pn, f, &a); versioning {
+		return a, ok
+	}
 	switch pn {
 	case "DAV::resourcetype":
 		if f.IsDirectory() {
@@ -527,19 +1114,28 @@ func (s *WebDAV) getPropValue(pn string, f File) (x.Any, bool) {
 		return a, true
 	case "DAV::supportedlock":
 		a.Inner = `
-<D:lockentry xmlns:D="DAV::">
+<D:lockentry xmlns:D="DAV:">
 <D:lockscope><D:exclusive/></D:lockscope>
 <D:locktype><D:write/></D:locktype>
+</D:lockentry>
+<D:lockentry xmlns:D="DAV:">
+<D:lockscope><D:shared/></D:lockscope>
+<D:locktype><D:write/></D:locktype>
 </D:lockentry>`
 		return a, true
 	case "DAV::lockdiscovery":
-		l := s.lm.getLockForPath(f.GetPath())
-		if l != nil {
-			a.Inner = l.toXML()
+		for _, l := range s.lm.getLocksForPath(f.GetPath()) {
+			a.Inner += l.toXML(s.href(l.path))
 		}
 		return a, true
 	case "DAV::displayname":
-		a.Value = path.Base(f.GetPath())
+		// Clients rename collections by setting it, otherwise it is the
+		// last segment of the path.
+		if v, ok := f.GetProp(pn); ok {
+			a.Value = v
+		} else {
+			a.Value = path.Base(f.GetPath())
+		}
 		return a, true
 	}
 
@@ -552,10 +1148,53 @@ func (s *WebDAV) getPropValue(pn string, f File) (x.Any, bool) {
 		return a, true
 	}
 	v, ok := f.GetProp(pn)
+	if !ok && pn == CTagProp && f.IsDirectory() {
+		v, ok = s.ctag(f.GetPath()), true
+	}
 	a.Value = v
 	return a, ok
 }
 
+// allPropNames are the live properties reported for allprop PROPFIND
+// requests, those defined by RFC 4918.
+var allPropNames = []string{
+	"DAV::creationdate",
+	"DAV::displayname",
+	"DAV::getcontentlength",
+	"DAV::getetag",
+	"DAV::getlastmodified",
+	"DAV::lockdiscovery",
+	"DAV::resourcetype",
+	"DAV::supportedlock",
+}
+
+// allProps gets the properties of f reported for an allprop request: the
+// live properties it has and all its dead properties, if its File lists
+// them, other than forks and those named by the include element.
+func (s *WebDAV) allProps(f File, include []string) []x.Any {
+	skip := make(map[string]bool)
+	for _, pn := range include {
+		skip[pn] = true
+	}
+	names := allPropNames
+	if pl, ok := f.(PropLister); ok {
+		dead := pl.PropNames()
+		sort.Strings(dead)
+		names = append(names[:len(names):len(names)], dead...)
+	}
+	var res []x.Any
+	for _, pn := range names {
+		if skip[pn] || strings.HasPrefix(pn, ForkNS+":") || strings.HasPrefix(pn, LangNS) {
+			continue
+		}
+		skip[pn] = true
+		if v, ok := s.getPropValue(pn, f); ok {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
 // http://www.webdav.org/specs/rfc4918.html#METHOD_PROPFIND
 func (s *WebDAV) doPropfind(ctx context, w http.ResponseWriter, r *http.Request) {
 	// TODO(nmvc): Limit request size.
@@ -565,33 +1204,72 @@ func (s *WebDAV) doPropfind(ctx context, w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	files, err := ctx.p.LookupSubtree(ctx.depth)
-	if err != nil {
-		s.errorHeader(ctx, w, err)
+	if s.MaxPropfindDepth > 0 && (ctx.depth < 0 || ctx.depth > s.MaxPropfindDepth) {
+		s.errorHeader(ctx, w, ErrorFiniteDepth)
 		return
 	}
-	log.Printf("FOUND %d files", len(files))
 
-	ms := x.NewMultiStatus()
-	for _, f := range files {
-		var found, missing []x.Any
+	ms := x.NewMultiStatusWriter(w)
+	found := 0
+	err = s.walkSubtree(ctx.p, ctx.depth, func(f File) error {
+		// Each file is encoded as it is visited, so a client reading
+		// slowly blocks the walk itself; the walk is abandoned once
+		// the client is gone.
+		if err := ms.Err(); err != nil {
+			return err
+		}
+		if err := r.Context().Err(); err != nil {
+			return err
+		}
+		found++
+		if !s.listable(f) {
+			return nil
+		}
+		// A member which cannot be examined is reported with its own
+		// status, without failing the listing of its siblings.
+		if _, err := f.Stat(); err != nil {
+			s.logger.Printf("E[%s]: %s", f.GetPath(), err)
+			ms.AddStatus(s.href(f.GetPath()), FromOSError(err))
+			return nil
+		}
+		var props, missing []x.Any
 		for _, pn := range req.PropertyNames {
 			v, ok := s.getPropValue(pn, f)
 			if ok {
-				found = append(found, v)
+				props = append(props, v)
 			} else {
 				missing = append(missing, v)
 			}
 		}
-		ms.AddPropStatus(f.GetPath(), found, missing)
+		if req.AllProp {
+			props = append(s.allProps(f, req.PropertyNames), props...)
+		}
+		localize(f, props, r.Header.Get("Accept-Language"))
+		ms.AddPropStatus(s.href(f.GetPath()), props, missing)
+		return nil
+	})
+	if err != nil && found == 0 {
+		s.errorHeader(ctx, w, err)
+		return
+	}
+	s.logger.Printf("FOUND %d files", found)
+	if err != nil {
+		s.logger.Printf("E[%s]: listing: %s", ctx.p, err)
+	}
+	for _, vp := range s.virtualIn(ctx.p.String(), ctx.depth) {
+		if !s.isHidden(vp, false) {
+			s.addVirtualPropStatus(ms, vp, s.virtual[vp], virtualPropNames(req))
+		}
+	}
+	if err := ms.Close(); err != nil {
+		s.logger.Printf("E[%s]: writing the response: %s", ctx.p, err)
 	}
-	ms.Send(w)
 }
 
 // http://www.webdav.org/specs/rfc4918.html#METHOD_PROPPATCH
 func (s *WebDAV) doProppatch(ctx context, w http.ResponseWriter, r *http.Request) {
-	if !s.checkCanWrite(ctx, ctx.p) {
-		s.errorHeader(ctx, w, ErrorLocked)
+	if err := s.checkLocks(ctx, ctx.p, false); err != nil {
+		s.errorHeader(ctx, w, err)
 		return
 	}
 
@@ -608,12 +1286,73 @@ func (s *WebDAV) doProppatch(ctx context, w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = f.PatchProp(req.Set, req.Remove)
+	patch, err := s.canonicalPatch(req)
+	if err != nil {
+		s.errorHeader(ctx, w, err)
+		return
+	}
+	if err := s.checkPropLimits(f, patch); err != nil {
+		s.errorHeader(ctx, w, err)
+		return
+	}
+
+	err = f.PatchProp(langPatch(f, patch))
 	if err != nil {
 		s.errorHeader(ctx, w, ErrorConflict)
 		return
 	}
-	w.WriteHeader(http.StatusNoContent)
+	s.notify(ChangeProps, ctx.p.String(), "")
+
+	// Report each property updated, as clients such as Windows Explorer
+	// expect, see http://www.webdav.org/specs/rfc4918.html#rfc.section.9.2.1.
+	var names []string
+	for _, m := range []map[string]string{req.Set, req.Remove} {
+		for n := range m {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	updated := make([]x.Any, len(names))
+	for i, n := range names {
+		updated[i] = x.NewAny(n)
+	}
+	ms := x.NewMultiStatus()
+	ms.AddPropStatus(s.href(ctx.p.String()), updated, nil)
+	ms.Send(w)
+}
+
+// checkPropLimits verifies that applying the given patch keeps the file
+// within the configured dead property limits. The property count can only
+// be fully enforced for files implementing PropLister, otherwise only the
+// properties being set by this request are counted.
+func (s *WebDAV) checkPropLimits(f File, req x.PropPatchRequest) error {
+	if s.MaxPropValueSize > 0 {
+		for _, v := range req.Set {
+			if len(v) > s.MaxPropValueSize {
+				return ErrorPropTooLarge
+			}
+		}
+	}
+	if s.MaxDeadProps <= 0 {
+		return nil
+	}
+
+	names := make(map[string]bool)
+	if pl, ok := f.(PropLister); ok {
+		for _, n := range pl.PropNames() {
+			names[n] = true
+		}
+	}
+	for n := range req.Set {
+		names[n] = true
+	}
+	for n := range req.Remove {
+		delete(names, n)
+	}
+	if len(names) > s.MaxDeadProps {
+		return ErrorPropQuota
+	}
+	return nil
 }
 
 // http://www.webdav.org/specs/rfc4918.html#METHOD_LOCK
@@ -623,7 +1362,7 @@ func (s *WebDAV) doLock(ctx context, w http.ResponseWriter, r *http.Request) {
 		s.errorHeader(ctx, w, ErrorBadLock.WithCause(err))
 		return
 	}
-	log.Printf("REQ %+v", req)
+	s.logger.Printf("REQ %+v", req)
 
 	// We don't let you lock on anything without a parent.
 	_, err = ctx.p.Parent().Lookup()
@@ -645,7 +1384,7 @@ func (s *WebDAV) doLock(ctx context, w http.ResponseWriter, r *http.Request) {
 		}
 		l, err = s.lm.refreshLock(tok, ctx.p, ctx.timeout)
 	} else {
-		l, err = s.lm.createLock(req.Owner, ctx.p, ctx.depth, ctx.timeout)
+		l, err = s.lm.createLock(req.Owner, ctx.p, ctx.depth, ctx.timeout, req.Shared)
 	}
 	if err != nil {
 		s.errorHeader(ctx, w, err)
@@ -653,13 +1392,16 @@ func (s *WebDAV) doLock(ctx context, w http.ResponseWriter, r *http.Request) {
 	}
 
 	if !req.Refresh {
-		w.Header().Set("Lock-Token", "<"+l.token+">")
+		w.Header().Set(davhttp.LockToken, davhttp.FormatLockToken(l.token))
+		s.lockHolder(l, r)
 	}
 
 	// Now that we have a successful lock, create the resource
-	// if it didn't exist already.
+	// if it didn't exist already. Forks stored as properties are
+	// only created by PUT.
+	_, _, isFork := forkOf(ctx.p.String())
 	_, err = ctx.p.Lookup()
-	if err != nil {
+	if err != nil && !(isFork && s.forks == ForksAsProps) {
 		_, fh, err := ctx.p.Create()
 		if err != nil {
 			// Unlock, as we're failing.
@@ -668,28 +1410,64 @@ func (s *WebDAV) doLock(ctx context, w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		fh.Close()
+		s.notify(ChangeCreated, ctx.p.String(), "")
+		if err := s.lm.markNull(l); err != nil {
+			s.logger.Printf("saving lock %s: %s", l.token, err)
+		}
 		w.WriteHeader(http.StatusCreated)
 	} else {
 		w.WriteHeader(http.StatusOK)
 	}
 
-	log.Println(l)
+	s.logger.Println(l)
 
 	a := x.NewAny("DAV::lockdiscovery")
-	a.Inner = l.toXML()
+	a.Inner = l.toXML(s.href(l.path))
 	x.SendProp(a, w)
 }
 
 // http://www.webdav.org/specs/rfc4918.html#METHOD_UNLOCK
 func (s *WebDAV) doUnlock(ctx context, w http.ResponseWriter, r *http.Request) {
-	lt := r.Header.Get("Lock-Token")
-	if len(lt) > 2 && lt[0] == '<' {
-		lt = lt[1 : len(lt)-1]
+	lt, err := s.parseLockToken(r.Header.Get(davhttp.LockToken), s.lenientFor(r))
+	if err != nil {
+		s.errorHeader(ctx, w, ErrorBadLock.WithCause(err))
+		return
 	}
-
 	if !s.lm.isLocked(ctx.p.String(), lt) {
-		s.errorHeader(ctx, w, ErrorBadLock)
+		s.errorHeader(ctx, w, ErrorLockTokenMismatch)
+		return
+	}
+	if err := s.lm.unlock(lt); err != nil {
+		s.errorHeader(ctx, w, err)
 		return
 	}
-	s.lm.unlock(lt)
+	s.removeLockNulls()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// removeLockNulls removes the lock-null resources whose locks ended
+// without them being written. Those covered by other locks, or which were
+// written otherwise, are kept.
+func (s *WebDAV) removeLockNulls() {
+	for _, p := range s.lm.expire() {
+		if s.lm.getLockForPath(p) != nil {
+			continue
+		}
+		fp, err := s.fs.ForPath(p)
+		if err != nil {
+			continue
+		}
+		f, err := fp.Lookup()
+		if err != nil || f.IsDirectory() {
+			continue
+		}
+		if fi, err := f.Stat(); err != nil || fi.Size != 0 {
+			continue
+		}
+		if err := fp.Remove(); err != nil {
+			s.logger.Printf("removing lock-null resource %s: %s", p, err)
+			continue
+		}
+		s.notify(ChangeRemoved, p, "")
+	}
 }
@@ -15,10 +15,13 @@
 package xml
 
 import (
+	"bytes"
 	"encoding/xml"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 
 	wp "github.com/google/go-webdav/path"
@@ -26,6 +29,20 @@ import (
 
 var blankName xml.Name
 
+// xmlNS is the namespace of the xml prefix, that of xml:lang.
+const xmlNS = "http://www.w3.org/XML/1998/namespace"
+
+// attr gets the value of an attribute of an element, empty if it is not
+// set.
+func attr(se xml.StartElement, n xml.Name) string {
+	for _, a := range se.Attr {
+		if a.Name == n {
+			return a.Value
+		}
+	}
+	return ""
+}
+
 func x2s(xn xml.Name) string {
 	return xn.Space + ":" + xn.Local
 }
@@ -45,8 +62,10 @@ func s2x(s string) xml.Name {
 type Any struct {
 	XMLName xml.Name
 	XMLNS   string `xml:"xmlns,attr"`
-	Value   string `xml:",chardata"`
-	Inner   string `xml:",innerxml"`
+	// Lang is the language of the value, given by xml:lang.
+	Lang  string `xml:"http://www.w3.org/XML/1998/namespace lang,attr,omitempty"`
+	Value string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
 }
 
 // NewAny constructs an opaque XML node.
@@ -63,6 +82,7 @@ func NewAny(n string) Any {
 type prop struct {
 	XMLName xml.Name `xml:"prop"`
 	XMLNS   string   `xml:"xmlns,attr,omitempty"`
+	Lang    string   `xml:"http://www.w3.org/XML/1998/namespace lang,attr,omitempty"`
 	Any     []Any    `xml:",any"`
 }
 
@@ -72,11 +92,16 @@ type multiProp struct {
 	PropStatus string   `xml:"status,omitempty"`
 }
 
+type subscriptionID struct {
+	IDs []int `xml:"li"`
+}
+
 type multiResponse struct {
-	XMLName xml.Name `xml:"response"`
-	Href    string   `xml:"href"`
-	Status  string   `xml:"status,omitempty"`
-	Props   []multiProp
+	XMLName        xml.Name        `xml:"response"`
+	Href           string          `xml:"href"`
+	Status         string          `xml:"status,omitempty"`
+	SubscriptionID *subscriptionID `xml:"subscriptionID,omitempty"`
+	Props          []multiProp
 }
 
 // MultiStatus is used to construct a response for multiple URIs
@@ -84,6 +109,8 @@ type MultiStatus struct {
 	XMLName  xml.Name `xml:"multistatus"`
 	XMLNS    string   `xml:"xmlns,attr"`
 	Response []multiResponse
+	// SyncToken is set in response to a sync-collection REPORT.
+	SyncToken string `xml:"sync-token,omitempty"`
 }
 
 // NewMultiStatus constructs an XML node representing status for multiple URIs.
@@ -93,8 +120,21 @@ func NewMultiStatus() *MultiStatus {
 	}
 }
 
+// Responses collects the responses of a multistatus, whether built up by a
+// MultiStatus or streamed by a MultiStatusWriter.
+type Responses interface {
+	AddPropStatus(href string, found, missing []Any)
+	AddStatus(href string, err error)
+}
+
 // AddPropStatus adds the status of a given property.
 func (m *MultiStatus) AddPropStatus(href string, found, missing []Any) {
+	m.Response = append(m.Response, propResponse(href, found, missing))
+}
+
+// propResponse constructs the response reporting the properties of a
+// resource.
+func propResponse(href string, found, missing []Any) multiResponse {
 	r := multiResponse{Href: wp.URLEncode(href)}
 	if len(found) > 0 {
 		r.Props = append(r.Props, multiProp{
@@ -108,14 +148,40 @@ func (m *MultiStatus) AddPropStatus(href string, found, missing []Any) {
 			PropStatus: "HTTP/1.1 404 Not Found",
 		})
 	}
-	m.Response = append(m.Response, r)
+	return r
+}
+
+// httpError is implemented by errors which know their HTTP status, such as
+// webdav.Error.
+type httpError interface {
+	HTTPCode() int
+	HTTPStatus() string
+}
+
+// statusLine gets the status line reporting the given error.
+func statusLine(err error) string {
+	var he httpError
+	if errors.As(err, &he) {
+		return "HTTP/1.1 " + strconv.Itoa(he.HTTPCode()) + " " + he.HTTPStatus()
+	}
+	return "HTTP/1.1 500 Internal Server Error"
 }
 
 // AddStatus adds a status of a given HREF.
 func (m *MultiStatus) AddStatus(href string, err error) {
 	m.Response = append(m.Response, multiResponse{
 		Href:   wp.URLEncode(href),
-		Status: err.Error(),
+		Status: statusLine(err),
+	})
+}
+
+// AddSubscriptionStatus adds the status of the given notification
+// subscriptions, as reported in response to POLL.
+func (m *MultiStatus) AddSubscriptionStatus(href, status string, ids []int) {
+	m.Response = append(m.Response, multiResponse{
+		Href:           wp.URLEncode(href),
+		Status:         status,
+		SubscriptionID: &subscriptionID{IDs: ids},
 	})
 }
 
@@ -132,33 +198,120 @@ func (m *MultiStatus) Send(w http.ResponseWriter) {
 		panic(err)
 	}
 	b = append([]byte(xml.Header), b...)
-	w.WriteHeader(StatusMulti)
-	w.Header().Set("Content-Length", string(len(b)))
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
 	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(StatusMulti)
 	w.Write(b)
 }
 
+// MultiStatusWriter streams a multistatus response, writing each response
+// as it is added rather than marshalling them all at once, so that a
+// listing whose responses are generated one at a time need not be held in
+// memory. Its output is that of Send, without a Content-Length.
+//
+// Each response is written to the ResponseWriter as it is added, which
+// passes it on to the connection as its buffer fills. Once the client stops
+// reading and the buffers are full, adding blocks, so that a caller
+// generating responses as it adds them is paced by the client. It should
+// stop once Err reports that the client has gone.
+type MultiStatusWriter struct {
+	w       http.ResponseWriter
+	enc     *xml.Encoder
+	started bool
+	err     error
+}
+
+var multiStatusStart = xml.StartElement{
+	Name: xml.Name{Local: "multistatus"},
+	Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: "DAV:"}},
+}
+
+// NewMultiStatusWriter constructs a MultiStatusWriter, which writes the
+// headers of the response once the first response is added, or once it is
+// closed if none are.
+func NewMultiStatusWriter(w http.ResponseWriter) *MultiStatusWriter {
+	enc := xml.NewEncoder(w)
+	enc.Indent("", " ")
+	return &MultiStatusWriter{w: w, enc: enc}
+}
+
+func (m *MultiStatusWriter) start() {
+	if m.started {
+		return
+	}
+	m.started = true
+	m.w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	m.w.WriteHeader(StatusMulti)
+	if _, m.err = io.WriteString(m.w, xml.Header); m.err == nil {
+		m.err = m.enc.EncodeToken(multiStatusStart)
+	}
+}
+
+func (m *MultiStatusWriter) write(r multiResponse) {
+	m.start()
+	if m.err == nil {
+		m.err = m.enc.Encode(r)
+	}
+}
+
+// AddPropStatus writes the status of the properties of a resource.
+func (m *MultiStatusWriter) AddPropStatus(href string, found, missing []Any) {
+	m.write(propResponse(href, found, missing))
+}
+
+// AddStatus writes the status of a resource.
+func (m *MultiStatusWriter) AddStatus(href string, err error) {
+	m.write(multiResponse{Href: wp.URLEncode(href), Status: statusLine(err)})
+}
+
+// Err gets the first error writing the multistatus, after which further
+// responses are dropped.
+func (m *MultiStatusWriter) Err() error {
+	return m.err
+}
+
+// Close ends the multistatus, returning the first error writing it, after
+// which further responses were dropped.
+func (m *MultiStatusWriter) Close() error {
+	m.start()
+	if m.err == nil {
+		m.err = m.enc.EncodeToken(multiStatusStart.End())
+	}
+	if m.err == nil {
+		m.err = m.enc.Flush()
+	}
+	return m.err
+}
+
 type propfind struct {
 	XMLName  xml.Name  `xml:"propfind"`
 	AllProp  *struct{} `xml:"allprop"`
 	PropName *struct{} `xml:"propname"`
 	Prop     prop
+	Include  struct {
+		Any []Any `xml:",any"`
+	} `xml:"include"`
 }
 
-// PropFindRequest represents the requested property query.
+// PropFindRequest represents the requested property query. For allprop
+// requests, PropertyNames are those of the include element.
 type PropFindRequest struct {
 	AllProp, PropName bool
 	PropertyNames     []string
 }
 
 // ParsePropFind parses a PROPFIND request to produce the property
-// data requested.
+// data requested. An empty body requests allprop.
 func ParsePropFind(in io.Reader) (PropFindRequest, error) {
 	req := PropFindRequest{}
 
 	d := xml.NewDecoder(in)
 	pf := propfind{}
 	err := d.Decode(&pf)
+	if err == io.EOF {
+		req.AllProp = true
+		return req, nil
+	}
 	if err != nil {
 		return req, err
 	}
@@ -166,8 +319,12 @@ func ParsePropFind(in io.Reader) (PropFindRequest, error) {
 	req.AllProp = pf.AllProp != nil
 	req.PropName = pf.PropName != nil
 
-	names := make([]string, 0, len(pf.Prop.Any))
-	for _, v := range pf.Prop.Any {
+	requested := pf.Prop.Any
+	if req.AllProp {
+		requested = pf.Include.Any
+	}
+	names := make([]string, 0, len(requested))
+	for _, v := range requested {
 		if v.XMLName.Local == "" {
 			continue
 		}
@@ -177,9 +334,333 @@ func ParsePropFind(in io.Reader) (PropFindRequest, error) {
 	return req, nil
 }
 
+type multiget struct {
+	XMLName xml.Name `xml:"multiget"`
+	Prop    prop
+	Hrefs   []string `xml:"href"`
+}
+
+// MultiGetRequest represents a multiget REPORT, requesting the content and
+// properties of a list of resources.
+type MultiGetRequest struct {
+	PropertyNames []string
+	Hrefs         []string
+}
+
+// ParseMultiGet parses a multiget REPORT request.
+func ParseMultiGet(in io.Reader) (MultiGetRequest, error) {
+	req := MultiGetRequest{}
+
+	mg := multiget{}
+	if err := xml.NewDecoder(in).Decode(&mg); err != nil {
+		return req, err
+	}
+	for _, v := range mg.Prop.Any {
+		if v.XMLName.Local == "" {
+			continue
+		}
+		req.PropertyNames = append(req.PropertyNames, x2s(v.XMLName))
+	}
+	for _, h := range mg.Hrefs {
+		req.Hrefs = append(req.Hrefs, strings.TrimSpace(h))
+	}
+	return req, nil
+}
+
+// ReportName gets the name of the root element of a REPORT request, which
+// identifies the report requested.
+func ReportName(in []byte) (string, error) {
+	d := xml.NewDecoder(bytes.NewReader(in))
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return "", err
+		}
+		if se, ok := t.(xml.StartElement); ok {
+			return x2s(se.Name), nil
+		}
+	}
+}
+
+type syncCollection struct {
+	XMLName   xml.Name `xml:"sync-collection"`
+	SyncToken string   `xml:"sync-token"`
+	SyncLevel string   `xml:"sync-level"`
+	Prop      prop
+}
+
+// SyncCollectionRequest represents a sync-collection REPORT, see
+// https://tools.ietf.org/html/rfc6578#section-3.2.
+type SyncCollectionRequest struct {
+	// SyncToken is the token of an earlier response, or empty for the
+	// initial synchronization.
+	SyncToken string
+	// Infinite is set for sync-level infinite, rather than 1.
+	Infinite      bool
+	PropertyNames []string
+}
+
+// ParseSyncCollection parses a sync-collection REPORT request.
+func ParseSyncCollection(in io.Reader) (SyncCollectionRequest, error) {
+	req := SyncCollectionRequest{}
+
+	sc := syncCollection{}
+	if err := xml.NewDecoder(in).Decode(&sc); err != nil {
+		return req, err
+	}
+	switch level := strings.TrimSpace(sc.SyncLevel); level {
+	case "1":
+	case "infinite":
+		req.Infinite = true
+	default:
+		return req, fmt.Errorf("bad sync-level %q", level)
+	}
+	req.SyncToken = strings.TrimSpace(sc.SyncToken)
+	for _, v := range sc.Prop.Any {
+		if v.XMLName.Local == "" {
+			continue
+		}
+		req.PropertyNames = append(req.PropertyNames, x2s(v.XMLName))
+	}
+	return req, nil
+}
+
+type versionTree struct {
+	XMLName xml.Name `xml:"version-tree"`
+	Prop    prop
+}
+
+// VersionTreeRequest represents a version-tree REPORT, see
+// http://www.webdav.org/specs/rfc3253.html#REPORT_version-tree.
+type VersionTreeRequest struct {
+	PropertyNames []string
+}
+
+// ParseVersionTree parses a version-tree REPORT request.
+func ParseVersionTree(in io.Reader) (VersionTreeRequest, error) {
+	req := VersionTreeRequest{}
+
+	vt := versionTree{}
+	if err := xml.NewDecoder(in).Decode(&vt); err != nil {
+		return req, err
+	}
+	for _, v := range vt.Prop.Any {
+		if v.XMLName.Local == "" {
+			continue
+		}
+		req.PropertyNames = append(req.PropertyNames, x2s(v.XMLName))
+	}
+	return req, nil
+}
+
+type searchRequest struct {
+	XMLName     xml.Name `xml:"searchrequest"`
+	BasicSearch *struct {
+		Select struct {
+			AllProp *struct{} `xml:"allprop"`
+			Prop    prop
+		} `xml:"select"`
+		From struct {
+			Scope []struct {
+				Href  string `xml:"href"`
+				Depth string `xml:"depth"`
+			} `xml:"scope"`
+		} `xml:"from"`
+		Where *struct {
+			Expr []searchExpr `xml:",any"`
+		} `xml:"where"`
+		OrderBy struct {
+			Order []struct {
+				Prop       prop
+				Descending *struct{} `xml:"descending"`
+			} `xml:"order"`
+		} `xml:"orderby"`
+		Limit struct {
+			NResults string `xml:"nresults"`
+		} `xml:"limit"`
+	} `xml:"basicsearch"`
+}
+
+type searchExpr struct {
+	XMLName  xml.Name
+	Caseless string       `xml:"caseless,attr"`
+	Prop     *prop        `xml:"prop"`
+	Literal  *string      `xml:"literal"`
+	Args     []searchExpr `xml:",any"`
+}
+
+// SearchRequest represents a SEARCH request with the basicsearch grammar,
+// see https://tools.ietf.org/html/rfc5323#section-5.
+type SearchRequest struct {
+	// PropertyNames are the properties selected, unless AllProp is set.
+	PropertyNames []string
+	AllProp       bool
+	Scopes        []SearchScope
+	// Where is the condition on the resources found, nil if any will do.
+	Where   *SearchExpr
+	OrderBy []SearchOrder
+	// Limit bounds the number of results, zero meaning no limit.
+	Limit int
+}
+
+// SearchScope is a collection searched, to the given depth, "0", "1" or
+// "infinity".
+type SearchScope struct {
+	Href  string
+	Depth string
+}
+
+// SearchExpr is a condition of the where clause of a basicsearch.
+type SearchExpr struct {
+	// Op is the operator, the name of its element, such as "and", "eq",
+	// "like" or "is-collection".
+	Op string
+	// Prop and Literal are the operands of comparisons, and Prop that of
+	// is-defined.
+	Prop    string
+	Literal string
+	// Caseless is set for comparisons ignoring case.
+	Caseless bool
+	// Args are the operands of and, or and not.
+	Args []SearchExpr
+}
+
+// SearchOrder is a property the results are sorted by.
+type SearchOrder struct {
+	Prop       string
+	Descending bool
+}
+
+// ParseSearch parses a SEARCH request, which must use the basicsearch
+// grammar.
+func ParseSearch(in io.Reader) (SearchRequest, error) {
+	req := SearchRequest{}
+
+	sr := searchRequest{}
+	if err := xml.NewDecoder(in).Decode(&sr); err != nil {
+		return req, err
+	}
+	bs := sr.BasicSearch
+	if bs == nil {
+		return req, errors.New("unsupported search grammar")
+	}
+	req.AllProp = bs.Select.AllProp != nil
+	req.PropertyNames = propNames(bs.Select.Prop)
+	for _, sc := range bs.From.Scope {
+		req.Scopes = append(req.Scopes, SearchScope{
+			Href:  strings.TrimSpace(sc.Href),
+			Depth: strings.TrimSpace(sc.Depth),
+		})
+	}
+	if len(req.Scopes) == 0 {
+		return req, errors.New("no search scope")
+	}
+	if bs.Where != nil {
+		if len(bs.Where.Expr) != 1 {
+			return req, errors.New("where must hold a single condition")
+		}
+		e, err := bs.Where.Expr[0].parse()
+		if err != nil {
+			return req, err
+		}
+		req.Where = &e
+	}
+	for _, o := range bs.OrderBy.Order {
+		names := propNames(o.Prop)
+		if len(names) != 1 {
+			return req, errors.New("order must name a single property")
+		}
+		req.OrderBy = append(req.OrderBy, SearchOrder{Prop: names[0], Descending: o.Descending != nil})
+	}
+	if n := strings.TrimSpace(bs.Limit.NResults); n != "" {
+		limit, err := strconv.Atoi(n)
+		if err != nil || limit <= 0 {
+			return req, fmt.Errorf("bad nresults %q", n)
+		}
+		req.Limit = limit
+	}
+	return req, nil
+}
+
+// parse checks the operands of a condition.
+func (e searchExpr) parse() (SearchExpr, error) {
+	res := SearchExpr{Op: e.XMLName.Local, Caseless: e.Caseless == "yes"}
+	if e.Prop != nil {
+		names := propNames(*e.Prop)
+		if len(names) != 1 {
+			return res, fmt.Errorf("%s must name a single property", res.Op)
+		}
+		res.Prop = names[0]
+	}
+	if e.Literal != nil {
+		res.Literal = *e.Literal
+	}
+	switch res.Op {
+	case "and", "or", "not":
+		if len(e.Args) == 0 || (res.Op == "not" && len(e.Args) != 1) {
+			return res, fmt.Errorf("bad operands of %s", res.Op)
+		}
+		for _, a := range e.Args {
+			ae, err := a.parse()
+			if err != nil {
+				return res, err
+			}
+			res.Args = append(res.Args, ae)
+		}
+	case "eq", "lt", "gt", "lte", "gte", "like":
+		if res.Prop == "" || e.Literal == nil {
+			return res, fmt.Errorf("bad operands of %s", res.Op)
+		}
+	case "is-defined":
+		if res.Prop == "" {
+			return res, fmt.Errorf("bad operands of %s", res.Op)
+		}
+	case "is-collection":
+	default:
+		return res, fmt.Errorf("unsupported operator %s", res.Op)
+	}
+	return res, nil
+}
+
+// propNames gets the names of the properties of a prop element.
+func propNames(p prop) []string {
+	var names []string
+	for _, v := range p.Any {
+		if v.XMLName.Local == "" {
+			continue
+		}
+		names = append(names, x2s(v.XMLName))
+	}
+	return names
+}
+
+type update struct {
+	XMLName xml.Name `xml:"update"`
+	Version struct {
+		Href string `xml:"href"`
+	} `xml:"version"`
+}
+
+// ParseUpdate parses an UPDATE request, returning the href of the version
+// to restore, see http://www.webdav.org/specs/rfc3253.html#METHOD_UPDATE.
+func ParseUpdate(in io.Reader) (string, error) {
+	u := update{}
+	if err := xml.NewDecoder(in).Decode(&u); err != nil {
+		return "", err
+	}
+	href := strings.TrimSpace(u.Version.Href)
+	if href == "" {
+		return "", errors.New("update names no version")
+	}
+	return href, nil
+}
+
 // PropPatchRequest represents the requested change to object properties.
 type PropPatchRequest struct {
 	Set, Remove map[string]string
+	// Langs maps the properties set with a language, given by xml:lang on
+	// them or an enclosing element, to that language.
+	Langs map[string]string
 }
 
 // ParsePropPatch parses a PROPPATCH request to produce the updates
@@ -192,6 +673,7 @@ func ParsePropPatch(in io.Reader) (PropPatchRequest, error) {
 	req := PropPatchRequest{
 		Set:    make(map[string]string),
 		Remove: make(map[string]string),
+		Langs:  make(map[string]string),
 	}
 
 	// Find the update block.
@@ -242,10 +724,23 @@ func ParsePropPatch(in io.Reader) (PropPatchRequest, error) {
 			sub = req.Set
 		}
 
+		lang := p.Lang
+		if lang == "" {
+			lang = attr(se, xml.Name{Space: xmlNS, Local: "lang"})
+		}
 		for _, a := range p.Any {
 			n := x2s(a.XMLName)
 			add[n] = a.Value
 			delete(sub, n)
+			delete(req.Langs, n)
+			if l := a.Lang; se.Name.Local == "set" {
+				if l == "" {
+					l = lang
+				}
+				if l != "" {
+					req.Langs[n] = l
+				}
+			}
 		}
 	}
 	return req, nil
@@ -279,13 +774,60 @@ type lockinfo struct {
 	Exclusive *struct{} `xml:"lockscope>exclusive"`
 	Shared    *struct{} `xml:"lockscope>shared"`
 	Write     *struct{} `xml:"locktype>write"`
-	Owner     string    `xml:"owner",innerxml`
+	Owner     ownerXML  `xml:"owner"`
+}
+
+// ownerXML is the content of a DAV:owner element, kept as XML so that it
+// can be returned verbatim in lock discovery. It is reencoded rather than
+// copied, so that it stays well-formed when its namespace prefixes are
+// declared outside of it and its text is escaped.
+type ownerXML string
+
+// UnmarshalXML implements xml.Unmarshaler.
+func (o *ownerXML) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var b bytes.Buffer
+	e := xml.NewEncoder(&b)
+	for depth := 0; ; {
+		t, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := t.(type) {
+		case xml.StartElement:
+			depth++
+			// The encoder declares the namespaces of names itself.
+			var attrs []xml.Attr
+			for _, a := range t.Attr {
+				if a.Name.Space != "xmlns" && !(a.Name.Space == "" && a.Name.Local == "xmlns") {
+					attrs = append(attrs, a)
+				}
+			}
+			t.Attr = attrs
+			err = e.EncodeToken(t)
+		case xml.EndElement:
+			if depth == 0 {
+				if err := e.Flush(); err != nil {
+					return err
+				}
+				*o = ownerXML(strings.TrimSpace(b.String()))
+				return nil
+			}
+			depth--
+			err = e.EncodeToken(t)
+		case xml.CharData:
+			err = e.EncodeToken(t)
+		}
+		if err != nil {
+			return err
+		}
+	}
 }
 
 // LockRequest is the parsed request for a lock change.
 type LockRequest struct {
 	Owner   string
 	Refresh bool
+	Shared  bool
 }
 
 // ParseLock parses a LOCK request
@@ -300,16 +842,14 @@ func ParseLock(in io.Reader) (LockRequest, error) {
 	} else if err != nil {
 		return req, err
 	}
-	if li.Exclusive == nil {
-		return req, errors.New("must be exclusive")
-	}
-	if li.Shared != nil {
-		return req, errors.New("must not be shared")
+	if (li.Exclusive == nil) == (li.Shared == nil) {
+		return req, errors.New("must be either exclusive or shared")
 	}
 	if li.Write == nil {
 		return req, errors.New("must be write")
 	}
-	req.Owner = li.Owner
+	req.Owner = string(li.Owner)
+	req.Shared = li.Shared != nil
 	return req, nil
 }
 
@@ -325,8 +865,43 @@ func SendProp(inner Any, w http.ResponseWriter) error {
 		return err
 	}
 	b = append([]byte(xml.Header), b...)
-	w.Header().Set("Content-Length", string(len(b)))
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Write(b)
+	return nil
+}
+
+type errorBody struct {
+	XMLName xml.Name `xml:"error"`
+	XMLNS   string   `xml:"xmlns,attr"`
+	Any     []Any    `xml:",any"`
+}
+
+// SendError writes an error response with the given HTTP code, with a body
+// naming the precondition or postcondition that failed, and the hrefs of
+// the resources it concerns, if any, such as the roots of conflicting
+// locks.
+func SendError(w http.ResponseWriter, code int, condition string, hrefs ...string) error {
+	c := NewAny(condition)
+	var inner bytes.Buffer
+	for _, h := range hrefs {
+		inner.WriteString("<href>")
+		xml.EscapeText(&inner, []byte(h))
+		inner.WriteString("</href>")
+	}
+	c.Inner = inner.String()
+	e := errorBody{
+		XMLNS: "DAV:",
+		Any:   []Any{c},
+	}
+	b, err := xml.MarshalIndent(e, "", " ")
+	if err != nil {
+		return err
+	}
+	b = append([]byte(xml.Header), b...)
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
 	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(code)
 	w.Write(b)
 	return nil
 }
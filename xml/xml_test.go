@@ -0,0 +1,91 @@
+// Copyright 2014 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xml
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestSendHeaders checks responses declare their length and type before
+// the status is written, as headers set afterwards are dropped.
+func TestSendHeaders(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		send func(w http.ResponseWriter)
+		code int
+	}{
+		{"MultiStatus", func(w http.ResponseWriter) {
+			ms := NewMultiStatus()
+			ms.AddPropStatus("/a", []Any{NewAny("DAV::getetag")}, nil)
+			ms.Send(w)
+		}, StatusMulti},
+		{"SendProp", func(w http.ResponseWriter) {
+			SendProp(NewAny("DAV::lockdiscovery"), w)
+		}, http.StatusOK},
+		{"SendError", func(w http.ResponseWriter) {
+			SendError(w, http.StatusForbidden, "DAV::propfind-finite-depth")
+		}, http.StatusForbidden},
+	} {
+		rec := httptest.NewRecorder()
+		tc.send(rec)
+		res := rec.Result()
+		if res.StatusCode != tc.code {
+			t.Errorf("%s: status %d, want %d", tc.name, res.StatusCode, tc.code)
+		}
+		if got, want := res.Header.Get("Content-Length"), strconv.Itoa(rec.Body.Len()); got != want {
+			t.Errorf("%s: Content-Length %q, want %q", tc.name, got, want)
+		}
+		if ct := res.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/xml") {
+			t.Errorf("%s: Content-Type %q", tc.name, ct)
+		}
+	}
+}
+
+func TestParseLockOwner(t *testing.T) {
+	for _, tc := range []struct {
+		name, owner, want string
+	}{
+		{"text", `<owner>alice</owner>`, "alice"},
+		{"href", `<D:owner><D:href>mailto:alice@example.com</D:href></D:owner>`,
+			`<href xmlns="DAV:">mailto:alice@example.com</href>`},
+		{"escaped", `<owner>&lt;/owner&gt; &amp; co</owner>`, "&lt;/owner&gt; &amp; co"},
+	} {
+		req, err := ParseLock(strings.NewReader(`<?xml version="1.0"?>
+<D:lockinfo xmlns:D="DAV:" xmlns="DAV:">
+ <D:lockscope><D:exclusive/></D:lockscope>
+ <D:locktype><D:write/></D:locktype>
+ ` + tc.owner + `
+</D:lockinfo>`))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if req.Owner != tc.want || req.Shared || req.Refresh {
+			t.Errorf("%s: ParseLock = %+v, want an exclusive lock owned by %q", tc.name, req, tc.want)
+		}
+		// The owner is returned verbatim in lock discovery, so it must
+		// remain well-formed on its own.
+		var v struct {
+			Inner string `xml:",innerxml"`
+		}
+		if err := xml.Unmarshal([]byte("<owner>"+req.Owner+"</owner>"), &v); err != nil {
+			t.Errorf("%s: owner %q is not well-formed: %v", tc.name, req.Owner, err)
+		}
+	}
+}